@@ -0,0 +1,353 @@
+package backend
+
+import (
+	"encoding/binary"
+	"errors"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Minimal CoAP (RFC 7252) message codec with the block options of RFC 7959,
+// covering what the backend needs to serve constrained targets.
+
+var (
+	errCoAPFormat = errors.New("Backend: malformed CoAP message")
+	errCoAPEmpty  = errors.New("Backend: empty CoAP payload")
+)
+
+// CoAP message types.
+const (
+	coapCON uint8 = 0
+	coapNON uint8 = 1
+	coapACK uint8 = 2
+	coapRST uint8 = 3
+)
+
+// CoAP codes, written as class<<5 | detail.
+const (
+	coapEmpty   uint8 = 0
+	coapGET     uint8 = 1
+	coapPOST    uint8 = 2
+	coapPUT     uint8 = 3
+	coapDELETE  uint8 = 4
+	coapCreated uint8 = 2<<5 | 1
+	coapDeleted uint8 = 2<<5 | 2
+	coapChanged uint8 = 2<<5 | 4
+	coapContent uint8 = 2<<5 | 5
+
+	coapBadOption        uint8 = 4<<5 | 2
+	coapNotFound         uint8 = 4<<5 | 4
+	coapMethodNotAllowed uint8 = 4<<5 | 5
+	coapNotAcceptable    uint8 = 4<<5 | 6
+	coapUnsupportedFmt   uint8 = 4<<5 | 15
+)
+
+// CoAP option numbers.
+const (
+	coapIfMatch       uint16 = 1
+	coapUriHost       uint16 = 3
+	coapETag          uint16 = 4
+	coapIfNoneMatch   uint16 = 5
+	coapObserve       uint16 = 6
+	coapUriPort       uint16 = 7
+	coapLocationPath  uint16 = 8
+	coapUriPath       uint16 = 11
+	coapContentFormat uint16 = 12
+	coapMaxAge        uint16 = 14
+	coapUriQuery      uint16 = 15
+	coapAccept        uint16 = 17
+	coapBlock2        uint16 = 23
+	coapBlock1        uint16 = 27
+	coapSize2         uint16 = 28
+	coapProxyUri      uint16 = 35
+	coapProxyScheme   uint16 = 39
+	coapSize1         uint16 = 60
+)
+
+// CoAP content formats.
+const (
+	coapFormatText        = 0
+	coapFormatLinks       = 40
+	coapFormatOctetStream = 42
+	coapFormatJSON        = 50
+	coapFormatCBOR        = 60
+	coapFormatTLV         = 11542
+)
+
+type coapOption struct {
+	id    uint16
+	value []byte
+}
+
+type coapMessage struct {
+	typ     uint8
+	code    uint8
+	id      uint16
+	token   []byte
+	options []coapOption
+	payload []byte
+}
+
+// coapCodeFromHTTP maps an HTTP status code to the CoAP code of the same
+// class and detail, e.g. 404 to 4.04.
+func coapCodeFromHTTP(code int) uint8 {
+	return uint8(code/100)<<5 | uint8(code%100)
+}
+
+func (m *coapMessage) option(id uint16) ([]byte, bool) {
+	for _, o := range m.options {
+		if o.id == id {
+			return o.value, true
+		}
+	}
+	return nil, false
+}
+
+func (m *coapMessage) uintOption(id uint16) (uint32, bool) {
+	v, ok := m.option(id)
+	if !ok || len(v) > 4 {
+		return 0, false
+	}
+	var n uint32
+	for _, b := range v {
+		n = n<<8 | uint32(b)
+	}
+	return n, true
+}
+
+func (m *coapMessage) path() []string {
+	var p []string
+	for _, o := range m.options {
+		if o.id == coapUriPath {
+			p = append(p, string(o.value))
+		}
+	}
+	return p
+}
+
+// query returns the value of Uri-Query parameter k.
+func (m *coapMessage) query(k string) (string, bool) {
+	for _, o := range m.options {
+		if o.id == coapUriQuery && strings.HasPrefix(string(o.value), k+"=") {
+			return string(o.value[len(k)+1:]), true
+		}
+	}
+	return "", false
+}
+
+func (m *coapMessage) addOption(id uint16, v []byte) {
+	m.options = append(m.options, coapOption{id, v})
+}
+
+func (m *coapMessage) addUintOption(id uint16, n uint32) {
+	var b [4]byte
+	binary.BigEndian.PutUint32(b[:], n)
+	v := b[:]
+	for len(v) > 0 && v[0] == 0 {
+		v = v[1:]
+	}
+	m.addOption(id, v)
+}
+
+func (m *coapMessage) setPath(p string) {
+	for _, s := range strings.Split(strings.Trim(p, "/"), "/") {
+		m.addOption(coapUriPath, []byte(s))
+	}
+}
+
+// unknownCritical reports whether m carries a critical option the codec
+// does not know, which requests must be rejected for.
+func (m *coapMessage) unknownCritical() bool {
+	for _, o := range m.options {
+		if o.id&1 == 0 {
+			continue
+		}
+		switch o.id {
+		case coapIfMatch, coapUriHost, coapIfNoneMatch, coapUriPort, coapUriPath, coapUriQuery,
+			coapAccept, coapBlock2, coapBlock1, coapProxyUri, coapProxyScheme:
+		default:
+			return true
+		}
+	}
+	return false
+}
+
+func parseCoAP(b []byte) (coapMessage, error) {
+	var m coapMessage
+	if len(b) < 4 || b[0]>>6 != 1 {
+		return m, errCoAPFormat
+	}
+	m.typ = b[0] >> 4 & 3
+	tkl := int(b[0] & 0xf)
+	m.code = b[1]
+	m.id = binary.BigEndian.Uint16(b[2:4])
+	b = b[4:]
+	if tkl > 8 || len(b) < tkl {
+		return m, errCoAPFormat
+	}
+	m.token = append([]byte{}, b[:tkl]...)
+	b = b[tkl:]
+
+	var id uint16
+	for len(b) > 0 {
+		if b[0] == 0xff {
+			if len(b) == 1 {
+				return m, errCoAPFormat
+			}
+			m.payload = append([]byte{}, b[1:]...)
+			break
+		}
+		delta, length := int(b[0]>>4), int(b[0]&0xf)
+		b = b[1:]
+		var err error
+		if delta, b, err = coapExtend(delta, b); err != nil {
+			return m, err
+		}
+		if length, b, err = coapExtend(length, b); err != nil {
+			return m, err
+		}
+		if len(b) < length || int(id)+delta > 0xffff {
+			return m, errCoAPFormat
+		}
+		id += uint16(delta)
+		m.addOption(id, append([]byte{}, b[:length]...))
+		b = b[length:]
+	}
+	return m, nil
+}
+
+func coapExtend(n int, b []byte) (int, []byte, error) {
+	switch n {
+	case 13:
+		if len(b) < 1 {
+			return 0, nil, errCoAPFormat
+		}
+		return int(b[0]) + 13, b[1:], nil
+	case 14:
+		if len(b) < 2 {
+			return 0, nil, errCoAPFormat
+		}
+		return int(binary.BigEndian.Uint16(b)) + 269, b[2:], nil
+	case 15:
+		return 0, nil, errCoAPFormat
+	}
+	return n, b, nil
+}
+
+func (m *coapMessage) marshal() []byte {
+	b := []byte{1<<6 | m.typ<<4 | uint8(len(m.token)), m.code, 0, 0}
+	binary.BigEndian.PutUint16(b[2:], m.id)
+	b = append(b, m.token...)
+
+	opts := append([]coapOption{}, m.options...)
+	sort.SliceStable(opts, func(i, j int) bool { return opts[i].id < opts[j].id })
+	var prev uint16
+	for _, o := range opts {
+		dn, dx := coapNibble(int(o.id - prev))
+		ln, lx := coapNibble(len(o.value))
+		b = append(b, dn<<4|ln)
+		b = append(b, dx...)
+		b = append(b, lx...)
+		b = append(b, o.value...)
+		prev = o.id
+	}
+	if len(m.payload) > 0 {
+		b = append(b, 0xff)
+		b = append(b, m.payload...)
+	}
+	return b
+}
+
+func coapNibble(n int) (uint8, []byte) {
+	switch {
+	case n < 13:
+		return uint8(n), nil
+	case n < 269:
+		return 13, []byte{uint8(n - 13)}
+	default:
+		x := make([]byte, 2)
+		binary.BigEndian.PutUint16(x, uint16(n-269))
+		return 14, x
+	}
+}
+
+// coapBlock is the value of a Block1 or Block2 option.
+type coapBlock struct {
+	num  uint32
+	more bool
+	szx  uint8
+}
+
+func (b coapBlock) size() int {
+	return 1 << (b.szx + 4)
+}
+
+func (b coapBlock) value() uint32 {
+	v := b.num<<4 | uint32(b.szx)
+	if b.more {
+		v |= 8
+	}
+	return v
+}
+
+func parseCoAPBlock(v uint32) coapBlock {
+	b := coapBlock{num: v >> 4, more: v&8 != 0, szx: uint8(v & 7)}
+	// SZX 7 is reserved for BERT, which only applies to CoAP over TCP.
+	if b.szx == 7 {
+		b.szx = 6
+	}
+	return b
+}
+
+// coapLifetime is the EXCHANGE_LIFETIME of RFC 7252. Responses are kept that
+// long to answer retransmitted requests, and so are the bodies of blockwise
+// transfers in progress.
+const coapLifetime = 247 * time.Second
+
+type coapExchange struct {
+	resp []byte
+	at   time.Time
+}
+
+// coapExchanges remembers the responses to recent requests for the exchange
+// lifetime, so retransmitted requests are answered alike instead of being
+// served twice.
+type coapExchanges struct {
+	mtx   sync.Mutex
+	m     map[string]coapExchange
+	swept time.Time
+}
+
+// begin reports whether the request identified by key was seen before and
+// returns its response, nil while it is being served. Unseen requests are
+// marked as seen.
+func (e *coapExchanges) begin(key string) ([]byte, bool) {
+	e.mtx.Lock()
+	defer e.mtx.Unlock()
+	now := time.Now()
+	if e.m == nil {
+		e.m = map[string]coapExchange{}
+	}
+	if now.Sub(e.swept) > coapLifetime/8 {
+		for k, x := range e.m {
+			if now.Sub(x.at) > coapLifetime {
+				delete(e.m, k)
+			}
+		}
+		e.swept = now
+	}
+	if x, ok := e.m[key]; ok {
+		return x.resp, true
+	}
+	e.m[key] = coapExchange{at: now}
+	return nil, false
+}
+
+// end records resp as the response to the request identified by key.
+func (e *coapExchanges) end(key string, resp []byte) {
+	e.mtx.Lock()
+	defer e.mtx.Unlock()
+	e.m[key] = coapExchange{resp: resp, at: time.Now()}
+}
@@ -4,25 +4,38 @@ import (
 	"context"
 
 	"github.com/go-kit/kit/endpoint"
+	"github.com/jonathanyhliang/hawkbit-fota/deployment"
 )
 
 type Endpoints struct {
-	GetControllerEndpoint              endpoint.Endpoint
-	PostCancelActionFeebackEndpoint    endpoint.Endpoint
-	PutConfigDataEndpoint              endpoint.Endpoint
-	GetDeploymentBaseEndpoint          endpoint.Endpoint
-	PostDeploymentBaseFeedbackEndpoint endpoint.Endpoint
-	GetDownloadHttpEndpoint            endpoint.Endpoint
+	GetControllerEndpoint                endpoint.Endpoint
+	PostCancelActionFeebackEndpoint      endpoint.Endpoint
+	PutConfigDataEndpoint                endpoint.Endpoint
+	GetDeploymentBaseEndpoint            endpoint.Endpoint
+	PostDeploymentBaseFeedbackEndpoint   endpoint.Endpoint
+	GetDownloadHttpEndpoint              endpoint.Endpoint
+	GetInstalledBaseEndpoint             endpoint.Endpoint
+	GetConfirmationBaseEndpoint          endpoint.Endpoint
+	GetConfirmationBaseActionEndpoint    endpoint.Endpoint
+	PostConfirmationBaseFeedbackEndpoint endpoint.Endpoint
+	PostActivateAutoConfirmEndpoint      endpoint.Endpoint
+	PostDeactivateAutoConfirmEndpoint    endpoint.Endpoint
 }
 
 func MakeBackendServerEndpoints(s BackendService) Endpoints {
 	return Endpoints{
-		GetControllerEndpoint:              MakeGetControllerEndpoint(s),
-		PostCancelActionFeebackEndpoint:    MakePostCancelActionFeedbackEndpoint(s),
-		PutConfigDataEndpoint:              MakePutConfigDataEndpoint(s),
-		GetDeploymentBaseEndpoint:          MakeGetDeploymentBaseEndpoint(s),
-		PostDeploymentBaseFeedbackEndpoint: MakePostDeploymentBaseFeedbackEndpoint(s),
-		GetDownloadHttpEndpoint:            MakeGetDownloadHttpEndpoint(s),
+		GetControllerEndpoint:                traced("GetController", MakeGetControllerEndpoint(s)),
+		PostCancelActionFeebackEndpoint:      traced("PostCancelActionFeedback", MakePostCancelActionFeedbackEndpoint(s)),
+		PutConfigDataEndpoint:                traced("PutConfigData", MakePutConfigDataEndpoint(s)),
+		GetDeploymentBaseEndpoint:            traced("GetDeploymentBase", MakeGetDeploymentBaseEndpoint(s)),
+		PostDeploymentBaseFeedbackEndpoint:   traced("PostDeploymentBaseFeedback", MakePostDeploymentBaseFeedbackEndpoint(s)),
+		GetDownloadHttpEndpoint:              traced("GetDownloadHttp", MakeGetDownloadHttpEndpoint(s)),
+		GetInstalledBaseEndpoint:             traced("GetInstalledBase", MakeGetInstalledBaseEndpoint(s)),
+		GetConfirmationBaseEndpoint:          traced("GetConfirmationBase", MakeGetConfirmationBaseEndpoint(s)),
+		GetConfirmationBaseActionEndpoint:    traced("GetConfirmationBaseAction", MakeGetConfirmationBaseActionEndpoint(s)),
+		PostConfirmationBaseFeedbackEndpoint: traced("PostConfirmationBaseFeedback", MakePostConfirmationBaseFeedbackEndpoint(s)),
+		PostActivateAutoConfirmEndpoint:      traced("PostActivateAutoConfirm", MakePostActivateAutoConfirmEndpoint(s)),
+		PostDeactivateAutoConfirmEndpoint:    traced("PostDeactivateAutoConfirm", MakePostDeactivateAutoConfirmEndpoint(s)),
 	}
 }
 
@@ -69,11 +82,56 @@ func MakePostDeploymentBaseFeedbackEndpoint(s BackendService) endpoint.Endpoint
 func MakeGetDownloadHttpEndpoint(s BackendService) endpoint.Endpoint {
 	return func(ctx context.Context, request interface{}) (response interface{}, err error) {
 		req := request.(GetDownloadHttpRequest)
-		f, e := s.GetDownloadHttp(ctx, req.Bid, req.Ver)
-		if e != nil {
-			return GetDownloadHttpResponse{File: nil}, nil
-		}
-		return GetDownloadHttpResponse{File: f}, nil
+		f, e := s.GetDownloadHttp(ctx, req.Bid, req.Ver, req.File)
+		return GetDownloadHttpResponse{File: f, Err: e}, nil
+	}
+}
+
+func MakeGetInstalledBaseEndpoint(s BackendService) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (response interface{}, err error) {
+		req := request.(GetInstalledBaseRequest)
+		d, e := s.GetInstalledBase(ctx, req.Bid, req.Acid)
+		return GetInstalledBaseResponse{Dp: d, Err: e}, nil
+	}
+}
+
+func MakeGetConfirmationBaseEndpoint(s BackendService) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (response interface{}, err error) {
+		req := request.(GetConfirmationBaseRequest)
+		c, e := s.GetConfirmationBase(ctx, req.Bid)
+		return GetConfirmationBaseResponse{Cb: c, Err: e}, nil
+	}
+}
+
+func MakeGetConfirmationBaseActionEndpoint(s BackendService) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (response interface{}, err error) {
+		req := request.(GetConfirmationBaseActionRequest)
+		c, e := s.GetConfirmationBaseAction(ctx, req.Bid, req.Acid)
+		return GetConfirmationBaseActionResponse{Ca: c, Err: e}, nil
+	}
+}
+
+func MakePostConfirmationBaseFeedbackEndpoint(s BackendService) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (response interface{}, err error) {
+		req := request.(PostConfirmationBaseFeedbackRequest)
+		e := s.PostConfirmationBaseFeedback(ctx, req.Bid, req.Acid, req.Fb)
+		return PostConfirmationBaseFeedbackResponse{Err: e}, nil
+	}
+}
+
+func MakePostActivateAutoConfirmEndpoint(s BackendService) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (response interface{}, err error) {
+		req := request.(PostActivateAutoConfirmRequest)
+		e := s.PostActivateAutoConfirm(ctx, req.Bid, req.Ac)
+		return PostActivateAutoConfirmResponse{Err: e}, nil
+	}
+}
+
+func MakePostDeactivateAutoConfirmEndpoint(s BackendService) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (response interface{}, err error) {
+		req := request.(PostDeactivateAutoConfirmRequest)
+		e := s.PostDeactivateAutoConfirm(ctx, req.Bid)
+		return PostDeactivateAutoConfirmResponse{Err: e}, nil
 	}
 }
 
@@ -88,6 +146,8 @@ type GetControllerResponse struct {
 
 func (r GetControllerResponse) error() error { return r.Err }
 
+func (r GetControllerResponse) resource() interface{} { return r.Ctrlr }
+
 type PostCancelActionFeedbackRequest struct {
 	Bid string
 	Fb  CancelActionFeedback `json:"cancelActionFeedback,omitempty"`
@@ -129,15 +189,112 @@ type PostDeploymentBaseFeedbackResponse struct {
 	Err error `json:"err,omitempty"`
 }
 
+func (r PostDeploymentBaseFeedbackResponse) error() error { return r.Err }
+
 func (r GetDeplymentBaseResponse) error() error { return r.Err }
 
+func (r GetDeplymentBaseResponse) resource() interface{} { return r.Dp }
+
 type GetDownloadHttpRequest struct {
-	Bid string
-	Ver string
+	Bid  string
+	Ver  string
+	File string
 }
 
 type GetDownloadHttpResponse struct {
 	File []byte
+	Err  error
 }
 
 func (r GetDownloadHttpResponse) file() []byte { return r.File }
+
+func (r GetDownloadHttpResponse) error() error { return r.Err }
+
+type GetInstalledBaseRequest struct {
+	Bid  string
+	Acid string
+}
+
+type GetInstalledBaseResponse struct {
+	Dp  DeploymentBase `json:"installedBase,omitempty"`
+	Err error          `json:"err,omitempty"`
+}
+
+func (r GetInstalledBaseResponse) error() error { return r.Err }
+
+func (r GetInstalledBaseResponse) resource() interface{} { return r.Dp }
+
+type GetConfirmationBaseRequest struct {
+	Bid string
+}
+
+type GetConfirmationBaseResponse struct {
+	Cb  ConfirmationBase `json:"confirmationBase"`
+	Err error            `json:"err,omitempty"`
+}
+
+func (r GetConfirmationBaseResponse) error() error { return r.Err }
+
+func (r GetConfirmationBaseResponse) resource() interface{} { return r.Cb }
+
+type GetConfirmationBaseActionRequest struct {
+	Bid  string
+	Acid string
+}
+
+type GetConfirmationBaseActionResponse struct {
+	Ca  ConfirmationBaseAction `json:"confirmationBase"`
+	Err error                  `json:"err,omitempty"`
+}
+
+func (r GetConfirmationBaseActionResponse) error() error { return r.Err }
+
+func (r GetConfirmationBaseActionResponse) resource() interface{} { return r.Ca }
+
+type PostConfirmationBaseFeedbackRequest struct {
+	Bid  string
+	Acid string
+	Fb   ConfirmationFeedback `json:"confirmationFeedback,omitempty"`
+}
+
+type PostConfirmationBaseFeedbackResponse struct {
+	Err error `json:"err,omitempty"`
+}
+
+func (r PostConfirmationBaseFeedbackResponse) error() error { return r.Err }
+
+type PostActivateAutoConfirmRequest struct {
+	Bid string
+	Ac  AutoConfirmActivation `json:"autoConfirm,omitempty"`
+}
+
+type PostActivateAutoConfirmResponse struct {
+	Err error `json:"err,omitempty"`
+}
+
+func (r PostActivateAutoConfirmResponse) error() error { return r.Err }
+
+type PostDeactivateAutoConfirmRequest struct {
+	Bid string
+}
+
+type PostDeactivateAutoConfirmResponse struct {
+	Err error `json:"err,omitempty"`
+}
+
+func (r PostDeactivateAutoConfirmResponse) error() error { return r.Err }
+
+// traced wraps e in a span named after the endpoint.
+func traced(name string, e endpoint.Endpoint) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (response interface{}, err error) {
+		ctx, span := deployment.Tracer.Start(ctx, "endpoint."+name)
+		defer func() {
+			rerr := err
+			if r, ok := response.(errorer); ok && rerr == nil {
+				rerr = r.error()
+			}
+			deployment.EndSpan(span, rerr)
+		}()
+		return e(ctx, request)
+	}
+}
@@ -0,0 +1,629 @@
+package backend
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"math/rand"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/fxamacker/cbor/v2"
+	"github.com/go-kit/kit/log"
+	"github.com/jonathanyhliang/hawkbit-fota/deployment"
+)
+
+// Resources of the LwM2M Firmware Update object (5).
+const (
+	lwm2mPackageURI   = "5/0/1"
+	lwm2mUpdate       = "5/0/2"
+	lwm2mState        = "5/0/3"
+	lwm2mUpdateResult = "5/0/5"
+)
+
+// Firmware Update states and update results.
+const (
+	lwm2mStateIdle        = 0
+	lwm2mStateDownloading = 1
+	lwm2mStateDownloaded  = 2
+	lwm2mStateUpdating    = 3
+
+	lwm2mResultInitial = 0
+	lwm2mResultSuccess = 1
+)
+
+// lwm2mAckTimeout and lwm2mRetransmit are the ACK_TIMEOUT and MAX_RETRANSMIT
+// of RFC 7252 for requests sent to clients. Once a client acknowledged a
+// request it has lwm2mResponseTimeout to send the response.
+const (
+	lwm2mAckTimeout      = 2 * time.Second
+	lwm2mRetransmit      = 4
+	lwm2mResponseTimeout = time.Minute
+)
+
+// lwm2mLifetime is the registration lifetime of clients not stating one.
+const lwm2mLifetime = 86400
+
+var (
+	ErrBackendLwM2MTimeout  = errors.New("Backend: LwM2M client did not respond in time")
+	ErrBackendLwM2MRejected = errors.New("Backend: LwM2M client rejected the request")
+)
+
+type lwm2mClient struct {
+	id       string
+	ep       string
+	addr     net.Addr
+	expires  time.Time
+	firmware bool
+	// observing is the action whose progress is observed on this
+	// registration.
+	observing string
+}
+
+// lwm2mAction follows the Firmware Update object of a client through the
+// action it was given.
+type lwm2mAction struct {
+	acid     string
+	state    int
+	result   int
+	executed bool
+	done     bool
+	reported string
+}
+
+type lwm2mObserver struct {
+	client *lwm2mClient
+	notify func(coapMessage)
+}
+
+// LwM2MServer registers LwM2M clients as targets, named after their endpoint,
+// and drives their Firmware Update object (5) through the deployments
+// assigned to them: the artifact link is written to Package URI, the update
+// is executed once State reports the package downloaded, and State and
+// Update Result are translated into the deployment status.
+type LwM2MServer struct {
+	s          BackendService
+	packageURL string
+	logger     log.Logger
+	mid        uint32
+	token      uint64
+	exchanges  coapExchanges
+
+	mtx       sync.Mutex
+	pc        net.PacketConn
+	nextId    int
+	clients   map[string]*lwm2mClient
+	pending   map[string]chan coapMessage
+	mids      map[uint16]string
+	observers map[string]lwm2mObserver
+	actions   map[string]*lwm2mAction
+	drives    map[string]*sync.Mutex
+}
+
+// NewLwM2MServer returns a server giving clients packageURL joined with the
+// artifact link of their deployment base as Package URI, so packageURL is
+// the base URL of the HTTP or CoAP backend, e.g. coap://fota.example.com.
+func NewLwM2MServer(s BackendService, packageURL string, logger log.Logger) *LwM2MServer {
+	return &LwM2MServer{
+		s:          s,
+		packageURL: strings.TrimSuffix(packageURL, "/"),
+		logger:     logger,
+		mid:        rand.Uint32(),
+		clients:    map[string]*lwm2mClient{},
+		pending:    map[string]chan coapMessage{},
+		mids:       map[uint16]string{},
+		observers:  map[string]lwm2mObserver{},
+		actions:    map[string]*lwm2mAction{},
+		drives:     map[string]*sync.Mutex{},
+	}
+}
+
+// Serve handles registrations received on pc, typically a UDP socket, and
+// sends clients their updates through it until reading from it fails.
+func (s *LwM2MServer) Serve(pc net.PacketConn) error {
+	s.mtx.Lock()
+	s.pc = pc
+	s.mtx.Unlock()
+	sub := deployment.Subscribe(1024, func(m deployment.Message) {
+		if a, ok := m.(deployment.DeploymentAssigned); ok {
+			go s.drive(a.Deployment.Target, true)
+		}
+	})
+	defer sub.Close()
+
+	buf := make([]byte, coapMaxDatagram)
+	for {
+		n, addr, err := pc.ReadFrom(buf)
+		if err != nil {
+			return err
+		}
+		s.receive(addr, append([]byte{}, buf[:n]...))
+	}
+}
+
+func (s *LwM2MServer) send(addr net.Addr, m coapMessage) {
+	if _, err := s.pc.WriteTo(m.marshal(), addr); err != nil {
+		s.logger.Log("lwm2m", addr.String(), "err", err)
+	}
+}
+
+// receive dispatches message b from addr. It runs on the read loop and must
+// not wait for the network.
+func (s *LwM2MServer) receive(addr net.Addr, b []byte) {
+	m, err := parseCoAP(b)
+	if err != nil {
+		return
+	}
+	switch {
+	case m.code == coapEmpty:
+		switch m.typ {
+		case coapCON:
+			s.send(addr, coapMessage{typ: coapRST, id: m.id})
+		case coapACK, coapRST:
+			// Acknowledgement of a separate response to come, or rejection.
+			s.mtx.Lock()
+			ch := s.pending[s.mids[m.id]]
+			s.mtx.Unlock()
+			if ch != nil {
+				select {
+				case ch <- m:
+				default:
+				}
+			}
+		}
+	case m.code>>5 == 0:
+		go s.serveRequest(addr, m)
+	default:
+		s.response(addr, m)
+	}
+}
+
+func (s *LwM2MServer) response(addr net.Addr, m coapMessage) {
+	tok := string(m.token)
+	s.mtx.Lock()
+	ch, pending := s.pending[tok]
+	delete(s.pending, tok)
+	o, observed := s.observers[tok]
+	s.mtx.Unlock()
+
+	switch {
+	case !pending && !observed:
+		// Notifications nobody waits for any more end the observation.
+		if m.typ != coapACK {
+			s.send(addr, coapMessage{typ: coapRST, id: m.id})
+		}
+		return
+	case m.typ == coapCON:
+		s.send(addr, coapMessage{typ: coapACK, id: m.id})
+	}
+	if pending {
+		ch <- m
+	} else {
+		o.notify(m)
+	}
+}
+
+// request sends req to client c and returns the response. With notify set, req
+// is an observation and later notifications are passed to notify.
+func (s *LwM2MServer) request(c *lwm2mClient, req coapMessage, notify func(coapMessage)) (coapMessage, error) {
+	tok := make([]byte, 8)
+	binary.BigEndian.PutUint64(tok, atomic.AddUint64(&s.token, 1))
+	req.typ, req.id, req.token = coapCON, uint16(atomic.AddUint32(&s.mid, 1)), tok
+	ch := make(chan coapMessage, 2)
+	s.mtx.Lock()
+	addr := c.addr
+	s.pending[string(tok)] = ch
+	s.mids[req.id] = string(tok)
+	if notify != nil {
+		s.observers[string(tok)] = lwm2mObserver{client: c, notify: notify}
+	}
+	s.mtx.Unlock()
+
+	resp, err := s.exchange(addr, req, ch)
+	s.mtx.Lock()
+	delete(s.pending, string(tok))
+	delete(s.mids, req.id)
+	if err != nil {
+		delete(s.observers, string(tok))
+	}
+	s.mtx.Unlock()
+	return resp, err
+}
+
+func (s *LwM2MServer) exchange(addr net.Addr, req coapMessage, ch chan coapMessage) (coapMessage, error) {
+	timeout, acked := lwm2mAckTimeout, false
+	for n := 0; ; {
+		if !acked {
+			s.send(addr, req)
+		}
+		select {
+		case m := <-ch:
+			switch {
+			case m.typ == coapRST:
+				return m, ErrBackendLwM2MRejected
+			case m.code == coapEmpty:
+				timeout, acked = lwm2mResponseTimeout, true
+			case m.code>>5 != 2:
+				return m, ErrBackendLwM2MRejected
+			default:
+				return m, nil
+			}
+		case <-time.After(timeout):
+			if acked || n == lwm2mRetransmit {
+				return coapMessage{}, ErrBackendLwM2MTimeout
+			}
+			n++
+			timeout *= 2
+		}
+	}
+}
+
+// serveRequest answers the registration interface requests of clients.
+func (s *LwM2MServer) serveRequest(addr net.Addr, m coapMessage) {
+	key := addr.String() + "/" + strconv.Itoa(int(m.id))
+	if b, dup := s.exchanges.begin(key); dup {
+		if b != nil {
+			s.pc.WriteTo(b, addr)
+		}
+		return
+	}
+	resp, registered := s.register(addr, m)
+	resp.token = m.token
+	if m.typ == coapCON {
+		resp.typ, resp.id = coapACK, m.id
+	} else {
+		resp.typ, resp.id = coapNON, uint16(atomic.AddUint32(&s.mid, 1))
+	}
+	b := resp.marshal()
+	s.exchanges.end(key, b)
+	if _, err := s.pc.WriteTo(b, addr); err != nil {
+		s.logger.Log("lwm2m", addr.String(), "err", err)
+	}
+	// Clients only take requests once they know they are registered.
+	if registered != nil {
+		if _, err := s.s.GetController(context.Background(), registered.ep); err != nil {
+			s.logger.Log("lwm2m", registered.ep, "err", err)
+		}
+		s.drive(registered.ep, false)
+	}
+}
+
+// register handles Register, Update and De-register requests, returning the
+// response and the client registered or updated, if any.
+func (s *LwM2MServer) register(addr net.Addr, m coapMessage) (coapMessage, *lwm2mClient) {
+	path := m.path()
+	if len(path) == 0 || path[0] != "rd" || len(path) > 2 {
+		return coapMessage{code: coapNotFound}, nil
+	}
+	lt := lwm2mLifetime
+	if v, ok := m.query("lt"); ok {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 {
+			return coapMessage{code: coapCodeFromHTTP(400)}, nil
+		}
+		lt = n
+	}
+	now := time.Now()
+
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	for id, c := range s.clients {
+		if now.After(c.expires) {
+			s.deregister(id)
+		}
+	}
+
+	if len(path) == 1 {
+		if m.code != coapPOST {
+			return coapMessage{code: coapMethodNotAllowed}, nil
+		}
+		ep, ok := m.query("ep")
+		if !ok || ep == "" {
+			return coapMessage{code: coapCodeFromHTTP(400)}, nil
+		}
+		// A client registering again replaces its registration.
+		for id, c := range s.clients {
+			if c.ep == ep {
+				s.deregister(id)
+			}
+		}
+		s.nextId++
+		c := &lwm2mClient{
+			id:       strconv.Itoa(s.nextId),
+			ep:       ep,
+			addr:     addr,
+			expires:  now.Add(time.Duration(lt) * time.Second),
+			firmware: lwm2mHasFirmware(m.payload),
+		}
+		s.clients[c.id] = c
+		resp := coapMessage{code: coapCreated}
+		resp.addOption(coapLocationPath, []byte("rd"))
+		resp.addOption(coapLocationPath, []byte(c.id))
+		return resp, c
+	}
+
+	c, ok := s.clients[path[1]]
+	if !ok {
+		return coapMessage{code: coapNotFound}, nil
+	}
+	switch m.code {
+	case coapPOST:
+		c.addr = addr
+		c.expires = now.Add(time.Duration(lt) * time.Second)
+		if len(m.payload) > 0 {
+			c.firmware = lwm2mHasFirmware(m.payload)
+		}
+		return coapMessage{code: coapChanged}, c
+	case coapDELETE:
+		s.deregister(c.id)
+		return coapMessage{code: coapDeleted}, nil
+	}
+	return coapMessage{code: coapMethodNotAllowed}, nil
+}
+
+// deregister drops registration id and its observations. The server lock
+// must be held.
+func (s *LwM2MServer) deregister(id string) {
+	c := s.clients[id]
+	delete(s.clients, id)
+	for tok, o := range s.observers {
+		if o.client == c {
+			delete(s.observers, tok)
+		}
+	}
+}
+
+func (s *LwM2MServer) client(ep string) *lwm2mClient {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	for _, c := range s.clients {
+		if c.ep == ep && time.Now().Before(c.expires) {
+			return c
+		}
+	}
+	return nil
+}
+
+// drive hands the current deployment of ep to its client, if registered
+// and not done yet, and observes the progress of the update. A distribution
+// assigned again keeps its action id, so with assigned set the action is
+// handed out anew even if it was before.
+func (s *LwM2MServer) drive(ep string, assigned bool) {
+	s.mtx.Lock()
+	l, ok := s.drives[ep]
+	if !ok {
+		l = &sync.Mutex{}
+		s.drives[ep] = l
+	}
+	s.mtx.Unlock()
+	l.Lock()
+	defer l.Unlock()
+
+	c := s.client(ep)
+	if assigned {
+		s.mtx.Lock()
+		delete(s.actions, ep)
+		if c != nil {
+			c.observing = ""
+		}
+		s.mtx.Unlock()
+	}
+	if c == nil || !c.firmware {
+		return
+	}
+	d, err := deployment.GetDeployment(ep)
+	if err != nil || d.Status.Execution == "closed" {
+		return
+	}
+	ctx := context.Background()
+
+	s.mtx.Lock()
+	a := s.actions[ep]
+	s.mtx.Unlock()
+	if a == nil || a.acid != d.ActionId {
+		db, err := s.s.GetDeplymentBase(ctx, ep, d.ActionId)
+		if err != nil {
+			// Actions awaiting confirmation are handed out once confirmed.
+			s.logger.Log("lwm2m", ep, "acid", d.ActionId, "err", err)
+			return
+		}
+		req := coapMessage{code: coapPUT}
+		req.setPath(lwm2mPackageURI)
+		req.addUintOption(coapContentFormat, coapFormatText)
+		req.payload = []byte(s.packageURL + db.Deployment.Chunks[0].Artifacts[0].Links.DownloadHttp.Href)
+		if _, err := s.request(c, req, nil); err != nil {
+			s.logger.Log("lwm2m", ep, "acid", d.ActionId, "err", err)
+			return
+		}
+		a = &lwm2mAction{acid: d.ActionId}
+		s.mtx.Lock()
+		s.actions[ep] = a
+		s.mtx.Unlock()
+	}
+
+	s.mtx.Lock()
+	observe := !a.done && c.observing != a.acid
+	c.observing = a.acid
+	s.mtx.Unlock()
+	if !observe {
+		return
+	}
+	// Observations end with the registration, so each one observes anew.
+	for _, r := range []string{lwm2mState, lwm2mUpdateResult} {
+		r := r
+		notify := func(m coapMessage) { s.observed(ep, a.acid, r, m) }
+		req := coapMessage{code: coapGET}
+		req.addUintOption(coapObserve, 0)
+		req.setPath(r)
+		req.addUintOption(coapAccept, coapFormatText)
+		resp, err := s.request(c, req, notify)
+		if err != nil {
+			s.logger.Log("lwm2m", ep, "observe", r, "err", err)
+			continue
+		}
+		notify(resp)
+	}
+}
+
+// observed updates the action of ep with the value of Firmware Update
+// resource r in m and reports the resulting status.
+func (s *LwM2MServer) observed(ep string, acid string, r string, m coapMessage) {
+	v, err := lwm2mInt(m)
+	if err != nil {
+		s.logger.Log("lwm2m", ep, "resource", r, "err", err)
+		return
+	}
+	s.mtx.Lock()
+	a := s.actions[ep]
+	if a == nil || a.acid != acid || a.done {
+		s.mtx.Unlock()
+		return
+	}
+	if r == lwm2mState {
+		a.state = v
+	} else {
+		a.result = v
+	}
+	st, ok := lwm2mStatus(a.state, a.result)
+	key := st.Execution + "/" + st.Result.Finished + "/" + strconv.Itoa(a.state)
+	report := ok && key != a.reported
+	if report {
+		a.reported = key
+	}
+	a.done = st.Execution == "closed"
+	execute := !a.done && a.state == lwm2mStateDownloaded && !a.executed
+	if execute {
+		a.executed = true
+	}
+	s.mtx.Unlock()
+
+	if report {
+		s.report(ep, acid, st)
+	}
+	if execute {
+		go s.execute(ep, acid)
+	}
+}
+
+func (s *LwM2MServer) execute(ep string, acid string) {
+	c := s.client(ep)
+	if c == nil {
+		return
+	}
+	req := coapMessage{code: coapPOST}
+	req.setPath(lwm2mUpdate)
+	if _, err := s.request(c, req, nil); err != nil {
+		s.logger.Log("lwm2m", ep, "acid", acid, "err", err)
+		s.mtx.Lock()
+		if a := s.actions[ep]; a != nil && a.acid == acid {
+			a.done = true
+		}
+		s.mtx.Unlock()
+		var st deployment.Status
+		st.Execution, st.Result.Finished = "closed", "failure"
+		s.report(ep, acid, st)
+	}
+}
+
+func (s *LwM2MServer) report(ep string, acid string, st deployment.Status) {
+	fb := DeploymentBaseFeedback{ID: acid}
+	fb.Status.Execution = st.Execution
+	fb.Status.Result.Finished = st.Result.Finished
+	fb.Status.Result.Progress = st.Result.Progress
+	if err := s.s.PostDeploymentBaseFeedback(context.Background(), ep, fb); err != nil {
+		s.logger.Log("lwm2m", ep, "acid", acid, "err", err)
+	}
+}
+
+// lwm2mStatus translates Firmware Update state and update result into the
+// deployment status, reporting whether there is anything to report. Any
+// result past success is a failure.
+func lwm2mStatus(state int, result int) (deployment.Status, bool) {
+	var st deployment.Status
+	st.Result.Finished = "none"
+	switch {
+	case result == lwm2mResultSuccess:
+		st.Execution, st.Result.Finished = "closed", "success"
+	case result > lwm2mResultSuccess:
+		st.Execution, st.Result.Finished = "closed", "failure"
+	case state == lwm2mStateDownloading:
+		st.Execution = "download"
+	case state == lwm2mStateDownloaded:
+		st.Execution = "downloaded"
+	case state == lwm2mStateUpdating:
+		st.Execution = "proceeding"
+	default:
+		return st, false
+	}
+	if st.Execution != "closed" {
+		st.Result.Progress = &deployment.Progress{Cnt: state, Of: lwm2mStateUpdating}
+	}
+	return st, true
+}
+
+// lwm2mHasFirmware reports whether the CoRE link format payload of a
+// registration lists the Firmware Update object.
+func lwm2mHasFirmware(links []byte) bool {
+	for _, l := range strings.Split(string(links), ",") {
+		p := strings.TrimSpace(l)
+		if i := strings.Index(p, ">"); strings.HasPrefix(p, "<") && i > 0 {
+			p = p[1:i]
+			if p == "/5" || strings.HasPrefix(p, "/5/") {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// lwm2mInt decodes the integer resource value carried by m as plain text,
+// CBOR or a single OMA-TLV resource.
+func lwm2mInt(m coapMessage) (int, error) {
+	f, _ := m.uintOption(coapContentFormat)
+	switch f {
+	case coapFormatText:
+		return strconv.Atoi(strings.TrimSpace(string(m.payload)))
+	case coapFormatCBOR:
+		var v int
+		err := cbor.Unmarshal(m.payload, &v)
+		return v, err
+	case coapFormatTLV:
+		b := m.payload
+		if len(b) < 2 || b[0]>>6 != 3 {
+			return 0, errCoAPFormat
+		}
+		// Skip the header and identifier, then read the length.
+		h := b[0]
+		if h&0x20 != 0 {
+			b = b[1:]
+		}
+		if len(b) < 2 {
+			return 0, errCoAPFormat
+		}
+		b = b[2:]
+		n := int(h & 7)
+		if lt := int(h >> 3 & 3); lt > 0 {
+			if len(b) < lt {
+				return 0, errCoAPFormat
+			}
+			n = 0
+			for _, x := range b[:lt] {
+				n = n<<8 | int(x)
+			}
+			b = b[lt:]
+		}
+		if len(b) != n || n == 0 || n > 8 {
+			return 0, errCoAPFormat
+		}
+		v := int64(int8(b[0]))
+		for _, x := range b[1:] {
+			v = v<<8 | int64(x)
+		}
+		return int(v), nil
+	}
+	return 0, errCoAPFormat
+}
@@ -0,0 +1,289 @@
+package backend
+
+import (
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/jonathanyhliang/hawkbit-fota/deployment"
+	"github.com/stretchr/testify/assert"
+)
+
+// lwm2mTestClient is an LwM2M client exposing the Firmware Update object.
+type lwm2mTestClient struct {
+	t         *testing.T
+	conn      net.Conn
+	responses chan coapMessage
+	uri       chan string
+	executed  chan struct{}
+
+	mtx      sync.Mutex
+	mid      uint16
+	seq      uint32
+	values   map[string]int
+	observed map[string][]byte
+}
+
+func newLwM2MTestClient(t *testing.T, server string) *lwm2mTestClient {
+	conn, err := net.Dial("udp", server)
+	assert.Equal(t, nil, err)
+	t.Cleanup(func() { conn.Close() })
+	c := &lwm2mTestClient{
+		t:         t,
+		conn:      conn,
+		responses: make(chan coapMessage, 1),
+		uri:       make(chan string, 1),
+		executed:  make(chan struct{}, 1),
+		values:    map[string]int{lwm2mState: 0, lwm2mUpdateResult: 0},
+		observed:  map[string][]byte{},
+	}
+	go c.serve()
+	return c
+}
+
+func (c *lwm2mTestClient) serve() {
+	buf := make([]byte, coapMaxDatagram)
+	for {
+		n, err := c.conn.Read(buf)
+		if err != nil {
+			return
+		}
+		m, err := parseCoAP(buf[:n])
+		if err != nil || m.code == coapEmpty {
+			continue
+		}
+		if m.code>>5 != 0 {
+			c.responses <- m
+			continue
+		}
+		resp := coapMessage{typ: coapACK, id: m.id, token: m.token, code: coapChanged}
+		path := strings.Join(m.path(), "/")
+		switch {
+		case m.code == coapPUT && path == lwm2mPackageURI:
+			// A new package starts the update over.
+			c.mtx.Lock()
+			c.values[lwm2mUpdateResult] = lwm2mResultInitial
+			c.mtx.Unlock()
+			c.uri <- string(m.payload)
+		case m.code == coapPOST && path == lwm2mUpdate:
+			c.executed <- struct{}{}
+		case m.code == coapGET:
+			c.mtx.Lock()
+			if _, ok := m.uintOption(coapObserve); ok {
+				c.observed[path] = m.token
+			}
+			resp.code = coapContent
+			resp.addUintOption(coapObserve, c.seq)
+			resp.addUintOption(coapContentFormat, coapFormatText)
+			resp.payload = []byte(strconv.Itoa(c.values[path]))
+			c.mtx.Unlock()
+		default:
+			resp.code = coapMethodNotAllowed
+		}
+		c.conn.Write(resp.marshal())
+	}
+}
+
+func (c *lwm2mTestClient) do(req coapMessage) coapMessage {
+	c.mtx.Lock()
+	c.mid++
+	req.typ, req.id, req.token = coapCON, c.mid, []byte{0x5e}
+	c.mtx.Unlock()
+	c.conn.Write(req.marshal())
+	select {
+	case m := <-c.responses:
+		return m
+	case <-time.After(5 * time.Second):
+		c.t.Fatal("no response")
+		return coapMessage{}
+	}
+}
+
+// set changes resource r and notifies its observer.
+func (c *lwm2mTestClient) set(r string, v int) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	c.values[r] = v
+	tok, ok := c.observed[r]
+	if !ok {
+		return
+	}
+	c.mid++
+	c.seq++
+	m := coapMessage{typ: coapNON, code: coapContent, id: c.mid, token: tok}
+	m.addUintOption(coapObserve, c.seq)
+	m.addUintOption(coapContentFormat, coapFormatText)
+	m.payload = []byte(strconv.Itoa(v))
+	c.conn.Write(m.marshal())
+}
+
+// register registers the client as ep and waits until the store knows the
+// target.
+func (c *lwm2mTestClient) register(ep string) coapMessage {
+	req := coapMessage{code: coapPOST}
+	req.setPath("rd")
+	req.addOption(coapUriQuery, []byte("ep="+ep))
+	req.addOption(coapUriQuery, []byte("lt=60"))
+	req.addUintOption(coapContentFormat, coapFormatLinks)
+	req.payload = []byte("</1/0>,</3/0>,</5/0>")
+	resp := c.do(req)
+	assert.Equal(c.t, coapCreated, resp.code)
+	assert.Eventually(c.t, func() bool {
+		for _, tg := range deployment.GetTargets() {
+			if tg.Name == ep {
+				return true
+			}
+		}
+		return false
+	}, 5*time.Second, 10*time.Millisecond)
+	return resp
+}
+
+// packageURI waits for the server to write Package URI.
+func (c *lwm2mTestClient) packageURI() string {
+	select {
+	case uri := <-c.uri:
+		return uri
+	case <-time.After(5 * time.Second):
+		c.t.Fatal("package URI not written")
+		return ""
+	}
+}
+
+func (c *lwm2mTestClient) observing() bool {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	return len(c.observed) == 2
+}
+
+func TestLwM2MServer(t *testing.T) {
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	assert.Equal(t, nil, err)
+	defer pc.Close()
+	backend := httptest.NewServer(MakeBackendHTTPHandler(NewHawkbitBackendService(), log.NewNopLogger()))
+	defer backend.Close()
+	go NewLwM2MServer(NewHawkbitBackendService(), backend.URL, log.NewNopLogger()).Serve(pc)
+
+	c := newLwM2MTestClient(t, pc.LocalAddr().String())
+	resp := c.register("lwm2m-dev")
+	loc, _ := resp.option(coapLocationPath)
+	assert.Equal(t, "rd", string(loc))
+
+	img := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write(make([]byte, 2048))
+	}))
+	defer img.Close()
+	assert.Equal(t, nil, deployment.SetUpload(deployment.Upload{Name: "lwm2m", Version: "1.0.0", Url: img.URL}))
+	assert.Equal(t, nil, deployment.SetDistribution(deployment.Distribution{Name: "lwm2m", Version: "1.0.0"}, "lwm2m"))
+	assert.Equal(t, nil, deployment.SetDeployment("lwm2m-dev", "lwm2m", deployment.DeploymentOptions{}))
+
+	// The assignment is written to Package URI, which the client downloads.
+	uri := c.packageURI()
+	assert.True(t, strings.HasPrefix(uri, backend.URL+"/DEFAULT/controller/v1/lwm2m-dev/softwareModules/1.0.0"))
+	r, err := http.Get(uri)
+	assert.Equal(t, nil, err)
+	b, _ := io.ReadAll(r.Body)
+	r.Body.Close()
+	assert.Equal(t, http.StatusOK, r.StatusCode)
+	assert.Equal(t, 2048, len(b))
+
+	status := func(exec string, finished string) func() bool {
+		return func() bool {
+			d, _ := deployment.GetDeployment("lwm2m-dev")
+			return d.Status.Execution == exec && d.Status.Result.Finished == finished
+		}
+	}
+	assert.Eventually(t, c.observing, 5*time.Second, 10*time.Millisecond)
+	c.set(lwm2mState, lwm2mStateDownloading)
+	assert.Eventually(t, status("download", "none"), 5*time.Second, 10*time.Millisecond)
+
+	// Once downloaded, the server executes the update.
+	c.set(lwm2mState, lwm2mStateDownloaded)
+	select {
+	case <-c.executed:
+	case <-time.After(5 * time.Second):
+		t.Fatal("update not executed")
+	}
+	c.set(lwm2mState, lwm2mStateUpdating)
+	assert.Eventually(t, status("proceeding", "none"), 5*time.Second, 10*time.Millisecond)
+	d, _ := deployment.GetDeployment("lwm2m-dev")
+	assert.Equal(t, &deployment.Progress{Cnt: 3, Of: 3}, d.Status.Result.Progress)
+
+	c.set(lwm2mUpdateResult, lwm2mResultSuccess)
+	c.set(lwm2mState, lwm2mStateIdle)
+	assert.Eventually(t, status("closed", "success"), 5*time.Second, 10*time.Millisecond)
+	_, err = deployment.GetInstalled("lwm2m-dev")
+	assert.Equal(t, nil, err)
+
+	req := coapMessage{code: coapDELETE}
+	req.setPath("rd/" + string(resp.options[1].value))
+	assert.Equal(t, coapDeleted, c.do(req).code)
+	assert.Equal(t, coapNotFound, c.do(req).code)
+}
+
+func TestLwM2MReassign(t *testing.T) {
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	assert.Equal(t, nil, err)
+	defer pc.Close()
+	backend := httptest.NewServer(MakeBackendHTTPHandler(NewHawkbitBackendService(), log.NewNopLogger()))
+	defer backend.Close()
+	go NewLwM2MServer(NewHawkbitBackendService(), backend.URL, log.NewNopLogger()).Serve(pc)
+
+	c := newLwM2MTestClient(t, pc.LocalAddr().String())
+	c.register("lwm2m-again")
+	img := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write(make([]byte, 1024))
+	}))
+	defer img.Close()
+	assert.Equal(t, nil, deployment.SetUpload(deployment.Upload{Name: "lwm2m-again", Version: "1.0.0",
+		Url: img.URL}))
+	assert.Equal(t, nil, deployment.SetDistribution(deployment.Distribution{Name: "lwm2m-again",
+		Version: "1.0.0"}, "lwm2m-again"))
+	status := func(exec string, finished string) func() bool {
+		return func() bool {
+			d, _ := deployment.GetDeployment("lwm2m-again")
+			return d.Status.Execution == exec && d.Status.Result.Finished == finished
+		}
+	}
+
+	assert.Equal(t, nil, deployment.SetDeployment("lwm2m-again", "lwm2m-again", deployment.DeploymentOptions{}))
+	first := c.packageURI()
+	assert.Eventually(t, c.observing, 5*time.Second, 10*time.Millisecond)
+	c.set(lwm2mUpdateResult, 5)
+	assert.Eventually(t, status("closed", "failure"), 5*time.Second, 10*time.Millisecond)
+
+	// Assigned again after the failure, the distribution keeps its action id
+	// and is still handed to the client once more.
+	assert.Equal(t, nil, deployment.SetDeployment("lwm2m-again", "lwm2m-again", deployment.DeploymentOptions{}))
+	assert.Equal(t, first, c.packageURI())
+	c.set(lwm2mState, lwm2mStateDownloading)
+	assert.Eventually(t, status("download", "none"), 5*time.Second, 10*time.Millisecond)
+	c.set(lwm2mUpdateResult, lwm2mResultSuccess)
+	assert.Eventually(t, status("closed", "success"), 5*time.Second, 10*time.Millisecond)
+}
+
+func TestLwM2MStatus(t *testing.T) {
+	st, ok := lwm2mStatus(lwm2mStateIdle, lwm2mResultInitial)
+	assert.False(t, ok)
+	st, _ = lwm2mStatus(lwm2mStateDownloaded, lwm2mResultInitial)
+	assert.Equal(t, "downloaded", st.Execution)
+	assert.Equal(t, &deployment.Progress{Cnt: 2, Of: 3}, st.Result.Progress)
+	st, _ = lwm2mStatus(lwm2mStateIdle, 5)
+	assert.Equal(t, "closed", st.Execution)
+	assert.Equal(t, "failure", st.Result.Finished)
+
+	tlv := coapMessage{payload: []byte{0xc1, 0x03, 0x02}}
+	tlv.addUintOption(coapContentFormat, coapFormatTLV)
+	v, err := lwm2mInt(tlv)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, 2, v)
+	assert.True(t, lwm2mHasFirmware([]byte(`</>;rt="oma.lwm2m",</1/0>,</5/0>`)))
+	assert.False(t, lwm2mHasFirmware([]byte("</1/0>,</15/0>")))
+}
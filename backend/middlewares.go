@@ -2,9 +2,13 @@ package backend
 
 import (
 	"context"
+	"fmt"
 	"time"
 
 	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/metrics"
+	"github.com/jonathanyhliang/hawkbit-fota/deployment"
+	"go.opentelemetry.io/otel/trace"
 )
 
 // Middleware describes a BackendService (as opposed to endpoint) middleware.
@@ -64,9 +68,364 @@ func (mw loggingMiddleware) PostDeploymentBaseFeedback(ctx context.Context, bid
 	return mw.next.PostDeploymentBaseFeedback(ctx, bid, fb)
 }
 
-func (mw loggingMiddleware) GetDownloadHttp(ctx context.Context, bid string, ver string) (f []byte, err error) {
+func (mw loggingMiddleware) GetDownloadHttp(ctx context.Context, bid string, ver string,
+	file string) (f []byte, err error) {
 	defer func(begin time.Time) {
-		mw.logger.Log("method", "GetDownloadHttp", "bid", bid, "ver", ver, "took", time.Since(begin), "err", err)
+		mw.logger.Log("method", "GetDownloadHttp", "bid", bid, "ver", ver, "file", file, "took", time.Since(begin),
+			"err", err)
+	}(time.Now())
+	return mw.next.GetDownloadHttp(ctx, bid, ver, file)
+}
+
+func (mw loggingMiddleware) GetInstalledBase(ctx context.Context, bid string,
+	acid string) (d DeploymentBase, err error) {
+	defer func(begin time.Time) {
+		mw.logger.Log("method", "GetInstalledBase", "bid", bid, "acid", acid, "took", time.Since(begin), "err", err)
+	}(time.Now())
+	return mw.next.GetInstalledBase(ctx, bid, acid)
+}
+
+func (mw loggingMiddleware) GetConfirmationBase(ctx context.Context, bid string) (c ConfirmationBase, err error) {
+	defer func(begin time.Time) {
+		mw.logger.Log("method", "GetConfirmationBase", "bid", bid, "took", time.Since(begin), "err", err)
+	}(time.Now())
+	return mw.next.GetConfirmationBase(ctx, bid)
+}
+
+func (mw loggingMiddleware) GetConfirmationBaseAction(ctx context.Context, bid string,
+	acid string) (c ConfirmationBaseAction, err error) {
+	defer func(begin time.Time) {
+		mw.logger.Log("method", "GetConfirmationBaseAction", "bid", bid, "acid", acid, "took", time.Since(begin),
+			"err", err)
+	}(time.Now())
+	return mw.next.GetConfirmationBaseAction(ctx, bid, acid)
+}
+
+func (mw loggingMiddleware) PostConfirmationBaseFeedback(ctx context.Context, bid string, acid string,
+	fb ConfirmationFeedback) (err error) {
+	defer func(begin time.Time) {
+		mw.logger.Log("method", "PostConfirmationBaseFeedback", "bid", bid, "acid", acid,
+			"confirmation", fb.Confirmation, "took", time.Since(begin), "err", err)
+	}(time.Now())
+	return mw.next.PostConfirmationBaseFeedback(ctx, bid, acid, fb)
+}
+
+func (mw loggingMiddleware) PostActivateAutoConfirm(ctx context.Context, bid string,
+	a AutoConfirmActivation) (err error) {
+	defer func(begin time.Time) {
+		mw.logger.Log("method", "PostActivateAutoConfirm", "bid", bid, "initiator", a.Initiator,
+			"took", time.Since(begin), "err", err)
+	}(time.Now())
+	return mw.next.PostActivateAutoConfirm(ctx, bid, a)
+}
+
+func (mw loggingMiddleware) PostDeactivateAutoConfirm(ctx context.Context, bid string) (err error) {
+	defer func(begin time.Time) {
+		mw.logger.Log("method", "PostDeactivateAutoConfirm", "bid", bid, "took", time.Since(begin), "err", err)
+	}(time.Now())
+	return mw.next.PostDeactivateAutoConfirm(ctx, bid)
+}
+
+// InstrumentingBackendMiddleware records request counts and latencies, labelled by method and
+// whether an error was returned, and the number of artifact bytes served.
+func InstrumentingBackendMiddleware(requestCount metrics.Counter, requestLatency metrics.Histogram, bytesServed metrics.Counter) Middleware {
+	return func(next BackendService) BackendService {
+		return &instrumentingMiddleware{
+			next:           next,
+			requestCount:   requestCount,
+			requestLatency: requestLatency,
+			bytesServed:    bytesServed,
+		}
+	}
+}
+
+type instrumentingMiddleware struct {
+	next           BackendService
+	requestCount   metrics.Counter
+	requestLatency metrics.Histogram
+	bytesServed    metrics.Counter
+}
+
+func (mw instrumentingMiddleware) observe(method string, begin time.Time, err error) {
+	lvs := []string{"method", method, "error", fmt.Sprint(err != nil)}
+	mw.requestCount.With(lvs...).Add(1)
+	mw.requestLatency.With(lvs...).Observe(time.Since(begin).Seconds())
+}
+
+func (mw instrumentingMiddleware) GetController(ctx context.Context, bid string) (c Controller, err error) {
+	defer func(begin time.Time) {
+		mw.observe("GetController", begin, err)
+	}(time.Now())
+	return mw.next.GetController(ctx, bid)
+}
+
+func (mw instrumentingMiddleware) PostCancelActionFeedback(ctx context.Context, bid string,
+	fb CancelActionFeedback) (err error) {
+	defer func(begin time.Time) {
+		mw.observe("PostCancelActionFeedback", begin, err)
+	}(time.Now())
+	return mw.next.PostCancelActionFeedback(ctx, bid, fb)
+}
+
+func (mw instrumentingMiddleware) PutConfigData(ctx context.Context, bid string, cfg ConfigData) (err error) {
+	defer func(begin time.Time) {
+		mw.observe("PutConfigData", begin, err)
+	}(time.Now())
+	return mw.next.PutConfigData(ctx, bid, cfg)
+}
+
+func (mw instrumentingMiddleware) GetDeplymentBase(ctx context.Context, bid string,
+	acid string) (d DeploymentBase, err error) {
+	defer func(begin time.Time) {
+		mw.observe("GetDeplymentBase", begin, err)
+	}(time.Now())
+	return mw.next.GetDeplymentBase(ctx, bid, acid)
+}
+
+func (mw instrumentingMiddleware) PostDeploymentBaseFeedback(ctx context.Context, bid string,
+	fb DeploymentBaseFeedback) (err error) {
+	defer func(begin time.Time) {
+		mw.observe("PostDeploymentBaseFeedback", begin, err)
+	}(time.Now())
+	return mw.next.PostDeploymentBaseFeedback(ctx, bid, fb)
+}
+
+func (mw instrumentingMiddleware) GetDownloadHttp(ctx context.Context, bid string, ver string,
+	file string) (f []byte, err error) {
+	defer func(begin time.Time) {
+		mw.observe("GetDownloadHttp", begin, err)
+		mw.bytesServed.Add(float64(len(f)))
+	}(time.Now())
+	return mw.next.GetDownloadHttp(ctx, bid, ver, file)
+}
+
+func (mw instrumentingMiddleware) GetInstalledBase(ctx context.Context, bid string,
+	acid string) (d DeploymentBase, err error) {
+	defer func(begin time.Time) {
+		mw.observe("GetInstalledBase", begin, err)
+	}(time.Now())
+	return mw.next.GetInstalledBase(ctx, bid, acid)
+}
+
+func (mw instrumentingMiddleware) GetConfirmationBase(ctx context.Context, bid string) (c ConfirmationBase, err error) {
+	defer func(begin time.Time) {
+		mw.observe("GetConfirmationBase", begin, err)
+	}(time.Now())
+	return mw.next.GetConfirmationBase(ctx, bid)
+}
+
+func (mw instrumentingMiddleware) GetConfirmationBaseAction(ctx context.Context, bid string,
+	acid string) (c ConfirmationBaseAction, err error) {
+	defer func(begin time.Time) {
+		mw.observe("GetConfirmationBaseAction", begin, err)
+	}(time.Now())
+	return mw.next.GetConfirmationBaseAction(ctx, bid, acid)
+}
+
+func (mw instrumentingMiddleware) PostConfirmationBaseFeedback(ctx context.Context, bid string, acid string,
+	fb ConfirmationFeedback) (err error) {
+	defer func(begin time.Time) {
+		mw.observe("PostConfirmationBaseFeedback", begin, err)
 	}(time.Now())
-	return mw.next.GetDownloadHttp(ctx, bid, ver)
+	return mw.next.PostConfirmationBaseFeedback(ctx, bid, acid, fb)
+}
+
+func (mw instrumentingMiddleware) PostActivateAutoConfirm(ctx context.Context, bid string,
+	a AutoConfirmActivation) (err error) {
+	defer func(begin time.Time) {
+		mw.observe("PostActivateAutoConfirm", begin, err)
+	}(time.Now())
+	return mw.next.PostActivateAutoConfirm(ctx, bid, a)
+}
+
+func (mw instrumentingMiddleware) PostDeactivateAutoConfirm(ctx context.Context, bid string) (err error) {
+	defer func(begin time.Time) {
+		mw.observe("PostDeactivateAutoConfirm", begin, err)
+	}(time.Now())
+	return mw.next.PostDeactivateAutoConfirm(ctx, bid)
+}
+
+// TracingBackendMiddleware wraps every call in a span named after the method, carrying
+// the target, action and distribution the call is about.
+func TracingBackendMiddleware() Middleware {
+	return func(next BackendService) BackendService {
+		return &tracingMiddleware{next: next}
+	}
+}
+
+type tracingMiddleware struct {
+	next BackendService
+}
+
+func (mw tracingMiddleware) GetController(ctx context.Context, bid string) (c Controller, err error) {
+	ctx, span := deployment.Tracer.Start(ctx, "backend.GetController",
+		trace.WithAttributes(deployment.SpanTarget.String(bid)))
+	defer func() { deployment.EndSpan(span, err) }()
+	return mw.next.GetController(ctx, bid)
+}
+
+func (mw tracingMiddleware) PostCancelActionFeedback(ctx context.Context, bid string,
+	fb CancelActionFeedback) (err error) {
+	ctx, span := deployment.Tracer.Start(ctx, "backend.PostCancelActionFeedback",
+		trace.WithAttributes(deployment.SpanTarget.String(bid), deployment.SpanAction.String(fb.ID)))
+	defer func() { deployment.EndSpan(span, err) }()
+	return mw.next.PostCancelActionFeedback(ctx, bid, fb)
+}
+
+func (mw tracingMiddleware) PutConfigData(ctx context.Context, bid string, cfg ConfigData) (err error) {
+	ctx, span := deployment.Tracer.Start(ctx, "backend.PutConfigData",
+		trace.WithAttributes(deployment.SpanTarget.String(bid)))
+	defer func() { deployment.EndSpan(span, err) }()
+	return mw.next.PutConfigData(ctx, bid, cfg)
+}
+
+func (mw tracingMiddleware) GetDeplymentBase(ctx context.Context, bid string,
+	acid string) (d DeploymentBase, err error) {
+	ctx, span := deployment.Tracer.Start(ctx, "backend.GetDeplymentBase",
+		trace.WithAttributes(deployment.SpanTarget.String(bid), deployment.SpanAction.String(acid)))
+	defer func() { deployment.EndSpan(span, err) }()
+	return mw.next.GetDeplymentBase(ctx, bid, acid)
+}
+
+func (mw tracingMiddleware) PostDeploymentBaseFeedback(ctx context.Context, bid string,
+	fb DeploymentBaseFeedback) (err error) {
+	ctx, span := deployment.Tracer.Start(ctx, "backend.PostDeploymentBaseFeedback",
+		trace.WithAttributes(deployment.SpanTarget.String(bid), deployment.SpanAction.String(fb.ID)))
+	defer func() { deployment.EndSpan(span, err) }()
+	return mw.next.PostDeploymentBaseFeedback(ctx, bid, fb)
+}
+
+func (mw tracingMiddleware) GetDownloadHttp(ctx context.Context, bid string, ver string,
+	file string) (f []byte, err error) {
+	ctx, span := deployment.Tracer.Start(ctx, "backend.GetDownloadHttp",
+		trace.WithAttributes(deployment.SpanTarget.String(bid)))
+	defer func() { deployment.EndSpan(span, err) }()
+	return mw.next.GetDownloadHttp(ctx, bid, ver, file)
+}
+
+func (mw tracingMiddleware) GetInstalledBase(ctx context.Context, bid string,
+	acid string) (d DeploymentBase, err error) {
+	ctx, span := deployment.Tracer.Start(ctx, "backend.GetInstalledBase",
+		trace.WithAttributes(deployment.SpanTarget.String(bid), deployment.SpanAction.String(acid)))
+	defer func() { deployment.EndSpan(span, err) }()
+	return mw.next.GetInstalledBase(ctx, bid, acid)
+}
+
+func (mw tracingMiddleware) GetConfirmationBase(ctx context.Context, bid string) (c ConfirmationBase, err error) {
+	ctx, span := deployment.Tracer.Start(ctx, "backend.GetConfirmationBase",
+		trace.WithAttributes(deployment.SpanTarget.String(bid)))
+	defer func() { deployment.EndSpan(span, err) }()
+	return mw.next.GetConfirmationBase(ctx, bid)
+}
+
+func (mw tracingMiddleware) GetConfirmationBaseAction(ctx context.Context, bid string,
+	acid string) (c ConfirmationBaseAction, err error) {
+	ctx, span := deployment.Tracer.Start(ctx, "backend.GetConfirmationBaseAction",
+		trace.WithAttributes(deployment.SpanTarget.String(bid), deployment.SpanAction.String(acid)))
+	defer func() { deployment.EndSpan(span, err) }()
+	return mw.next.GetConfirmationBaseAction(ctx, bid, acid)
+}
+
+func (mw tracingMiddleware) PostConfirmationBaseFeedback(ctx context.Context, bid string, acid string,
+	fb ConfirmationFeedback) (err error) {
+	ctx, span := deployment.Tracer.Start(ctx, "backend.PostConfirmationBaseFeedback",
+		trace.WithAttributes(deployment.SpanTarget.String(bid), deployment.SpanAction.String(acid)))
+	defer func() { deployment.EndSpan(span, err) }()
+	return mw.next.PostConfirmationBaseFeedback(ctx, bid, acid, fb)
+}
+
+func (mw tracingMiddleware) PostActivateAutoConfirm(ctx context.Context, bid string,
+	a AutoConfirmActivation) (err error) {
+	ctx, span := deployment.Tracer.Start(ctx, "backend.PostActivateAutoConfirm",
+		trace.WithAttributes(deployment.SpanTarget.String(bid)))
+	defer func() { deployment.EndSpan(span, err) }()
+	return mw.next.PostActivateAutoConfirm(ctx, bid, a)
+}
+
+func (mw tracingMiddleware) PostDeactivateAutoConfirm(ctx context.Context, bid string) (err error) {
+	ctx, span := deployment.Tracer.Start(ctx, "backend.PostDeactivateAutoConfirm",
+		trace.WithAttributes(deployment.SpanTarget.String(bid)))
+	defer func() { deployment.EndSpan(span, err) }()
+	return mw.next.PostDeactivateAutoConfirm(ctx, bid)
+}
+
+// AuditBackendMiddleware records every feedback a target sends in the audit
+// trail, with the target as actor. The store records the affected entity as
+// it was before and after the change; failed calls are recorded here.
+func AuditBackendMiddleware() Middleware {
+	return func(next BackendService) BackendService {
+		return &auditMiddleware{next: next}
+	}
+}
+
+type auditMiddleware struct {
+	next BackendService
+}
+
+func (mw auditMiddleware) GetController(ctx context.Context, bid string) (Controller, error) {
+	return mw.next.GetController(ctx, bid)
+}
+
+func (mw auditMiddleware) PostCancelActionFeedback(ctx context.Context, bid string,
+	fb CancelActionFeedback) (err error) {
+	ctx = deployment.WithAudit(deployment.WithActor(ctx, "target/"+bid), "PostCancelActionFeedback")
+	defer func() { deployment.EndAudit(ctx, "deployment/"+bid, err) }()
+	return mw.next.PostCancelActionFeedback(ctx, bid, fb)
+}
+
+func (mw auditMiddleware) PutConfigData(ctx context.Context, bid string, cfg ConfigData) (err error) {
+	ctx = deployment.WithAudit(deployment.WithActor(ctx, "target/"+bid), "PutConfigData")
+	defer func() { deployment.EndAudit(ctx, "attributes/"+bid, err) }()
+	return mw.next.PutConfigData(ctx, bid, cfg)
+}
+
+func (mw auditMiddleware) GetDeplymentBase(ctx context.Context, bid string,
+	acid string) (DeploymentBase, error) {
+	return mw.next.GetDeplymentBase(ctx, bid, acid)
+}
+
+func (mw auditMiddleware) PostDeploymentBaseFeedback(ctx context.Context, bid string,
+	fb DeploymentBaseFeedback) (err error) {
+	ctx = deployment.WithAudit(deployment.WithActor(ctx, "target/"+bid), "PostDeploymentBaseFeedback")
+	defer func() { deployment.EndAudit(ctx, "deployment/"+bid, err) }()
+	return mw.next.PostDeploymentBaseFeedback(ctx, bid, fb)
+}
+
+func (mw auditMiddleware) GetDownloadHttp(ctx context.Context, bid string, ver string,
+	file string) ([]byte, error) {
+	return mw.next.GetDownloadHttp(ctx, bid, ver, file)
+}
+
+func (mw auditMiddleware) GetInstalledBase(ctx context.Context, bid string,
+	acid string) (DeploymentBase, error) {
+	return mw.next.GetInstalledBase(ctx, bid, acid)
+}
+
+func (mw auditMiddleware) GetConfirmationBase(ctx context.Context, bid string) (ConfirmationBase, error) {
+	return mw.next.GetConfirmationBase(ctx, bid)
+}
+
+func (mw auditMiddleware) GetConfirmationBaseAction(ctx context.Context, bid string,
+	acid string) (ConfirmationBaseAction, error) {
+	return mw.next.GetConfirmationBaseAction(ctx, bid, acid)
+}
+
+func (mw auditMiddleware) PostConfirmationBaseFeedback(ctx context.Context, bid string, acid string,
+	fb ConfirmationFeedback) (err error) {
+	ctx = deployment.WithAudit(deployment.WithActor(ctx, "target/"+bid), "PostConfirmationBaseFeedback")
+	defer func() { deployment.EndAudit(ctx, "deployment/"+bid, err) }()
+	return mw.next.PostConfirmationBaseFeedback(ctx, bid, acid, fb)
+}
+
+func (mw auditMiddleware) PostActivateAutoConfirm(ctx context.Context, bid string,
+	a AutoConfirmActivation) (err error) {
+	ctx = deployment.WithAudit(deployment.WithActor(ctx, "target/"+bid), "PostActivateAutoConfirm")
+	defer func() { deployment.EndAudit(ctx, "autoconfirm/"+bid, err) }()
+	return mw.next.PostActivateAutoConfirm(ctx, bid, a)
+}
+
+func (mw auditMiddleware) PostDeactivateAutoConfirm(ctx context.Context, bid string) (err error) {
+	ctx = deployment.WithAudit(deployment.WithActor(ctx, "target/"+bid), "PostDeactivateAutoConfirm")
+	defer func() { deployment.EndAudit(ctx, "autoconfirm/"+bid, err) }()
+	return mw.next.PostDeactivateAutoConfirm(ctx, bid)
 }
@@ -2,18 +2,29 @@ package backend
 
 import (
 	"context"
+	"crypto/md5"
+	"crypto/sha1"
 	"errors"
 	"fmt"
-	"net/http"
+	"strconv"
+	"sync"
+	"time"
 
 	"github.com/jonathanyhliang/hawkbit-fota/deployment"
 )
 
 var (
-	ErrBackendDownload   = errors.New("Backend: image download failed")
-	ErrBackendBadRequest = errors.New("Backend: bad request")
+	ErrBackendDownload    = errors.New("Backend: image download failed")
+	ErrBackendBadRequest  = errors.New("Backend: bad request")
+	ErrBackendUnconfirmed = errors.New("Backend: action awaiting confirmation")
 )
 
+// Link is a link to a resource of the DDI API. Links a resource does not
+// offer at the moment are left out rather than sent empty.
+type Link struct {
+	Href string `json:"href"`
+}
+
 type Controller struct {
 	Config struct {
 		Polling struct {
@@ -21,15 +32,11 @@ type Controller struct {
 		} `json:"polling"`
 	} `json:"config"`
 	Links struct {
-		DeploymentBase struct {
-			Href string `json:"href"`
-		} `json:"deploymentBase"`
-		CancelAction struct {
-			Href string `json:"href"`
-		} `json:"cancelAction"`
-		ConfigData struct {
-			Href string `json:"href"`
-		} `json:"configData"`
+		DeploymentBase   *Link `json:"deploymentBase,omitempty"`
+		CancelAction     *Link `json:"cancelAction,omitempty"`
+		ConfigData       *Link `json:"configData,omitempty"`
+		InstalledBase    *Link `json:"installedBase,omitempty"`
+		ConfirmationBase *Link `json:"confirmationBase,omitempty"`
 	} `json:"_links"`
 }
 
@@ -39,19 +46,17 @@ type CancelActionFeedback struct {
 	Status struct {
 		Execution string `json:"execution"`
 		Result    struct {
-			Finished string `json:"finished"`
+			Finished string               `json:"finished"`
+			Progress *deployment.Progress `json:"progress,omitempty"`
 		} `json:"result"`
 	} `json:"status"`
 }
 
 type ConfigData struct {
-	Mode string `json:"mode"`
-	Data struct {
-		VIN        string `json:"vin"`
-		HwRevision string `json:"hwRevision"`
-	} `json:"data"`
-	ID     string `json:"id"`
-	Time   string `json:"time"`
+	Mode   string            `json:"mode"`
+	Data   map[string]string `json:"data"`
+	ID     string            `json:"id"`
+	Time   string            `json:"time"`
 	Status struct {
 		Execution string `json:"execution"`
 		Result    struct {
@@ -63,35 +68,69 @@ type ConfigData struct {
 type artifacts struct {
 	Filename string `json:"filename"`
 	Hashes   struct {
-		SHA1   string `json:"sha1"`
-		MD5    string `json:"md5"`
+		SHA1   string `json:"sha1,omitempty"`
+		MD5    string `json:"md5,omitempty"`
 		SHA256 string `json:"sha256"`
 	} `json:"hashes"`
 	Size  int `json:"size"`
 	Links struct {
-		DownloadHttp struct {
-			Href string `json:"href"`
-		} `json:"download-http"`
-		MD5SumHttp struct {
-			Href string `json:"href"`
-		} `json:"md5sum-http"`
+		DownloadHttp Link  `json:"download-http"`
+		MD5SumHttp   *Link `json:"md5sum-http,omitempty"`
 	} `json:"_links"`
 }
 
+type metadata struct {
+	Key   string `json:"key"`
+	Value string `json:"value"`
+}
+
 type chunks struct {
-	Part      string       `json:"part"`
-	Name      string       `json:"name"`
-	Version   string       `json:"version"`
-	Artifacts [1]artifacts `json:"artifacts"`
+	Part      string      `json:"part"`
+	Name      string      `json:"name"`
+	Version   string      `json:"version"`
+	Metadata  []metadata  `json:"metadata,omitempty"`
+	Artifacts []artifacts `json:"artifacts"`
+}
+
+type action struct {
+	Download          string   `json:"download"`
+	Update            string   `json:"update"`
+	MaintenanceWindow string   `json:"maintenanceWindow,omitempty"`
+	Chunks            []chunks `json:"chunks"`
 }
 
 type DeploymentBase struct {
 	ID         string `json:"id"`
-	Deployment struct {
-		Download string    `json:"download"`
-		Update   string    `json:"update"`
-		Chunks   [1]chunks `json:"chunks"`
-	} `json:"deployment"`
+	Deployment action `json:"deployment"`
+}
+
+type ConfirmationBase struct {
+	AutoConfirm struct {
+		Active    bool   `json:"active"`
+		Initiator string `json:"initiator,omitempty"`
+		Remark    string `json:"remark,omitempty"`
+	} `json:"autoConfirm"`
+	Links struct {
+		ActivateAutoConfirm   *Link `json:"activateAutoConfirm,omitempty"`
+		DeactivateAutoConfirm *Link `json:"deactivateAutoConfirm,omitempty"`
+		ConfirmationBase      *Link `json:"confirmationBase,omitempty"`
+	} `json:"_links"`
+}
+
+type ConfirmationBaseAction struct {
+	ID           string `json:"id"`
+	Confirmation action `json:"confirmation"`
+}
+
+type ConfirmationFeedback struct {
+	Confirmation string   `json:"confirmation"`
+	Code         int      `json:"code,omitempty"`
+	Details      []string `json:"details,omitempty"`
+}
+
+type AutoConfirmActivation struct {
+	Initiator string `json:"initiator,omitempty"`
+	Remark    string `json:"remark,omitempty"`
 }
 
 type DeploymentBaseFeedback struct {
@@ -99,7 +138,8 @@ type DeploymentBaseFeedback struct {
 	Status struct {
 		Execution string `json:"execution"`
 		Result    struct {
-			Finished string `json:"finished"`
+			Finished string               `json:"finished"`
+			Progress *deployment.Progress `json:"progress,omitempty"`
 		} `json:"result"`
 	} `json:"status"`
 }
@@ -110,7 +150,13 @@ type BackendService interface {
 	PutConfigData(ctx context.Context, bid string, cfg ConfigData) error
 	GetDeplymentBase(ctx context.Context, bid string, acid string) (DeploymentBase, error)
 	PostDeploymentBaseFeedback(ctx context.Context, bid string, fb DeploymentBaseFeedback) error
-	GetDownloadHttp(ctx context.Context, bid string, ver string) ([]byte, error)
+	GetDownloadHttp(ctx context.Context, bid string, ver string, file string) ([]byte, error)
+	GetInstalledBase(ctx context.Context, bid string, acid string) (DeploymentBase, error)
+	GetConfirmationBase(ctx context.Context, bid string) (ConfirmationBase, error)
+	GetConfirmationBaseAction(ctx context.Context, bid string, acid string) (ConfirmationBaseAction, error)
+	PostConfirmationBaseFeedback(ctx context.Context, bid string, acid string, fb ConfirmationFeedback) error
+	PostActivateAutoConfirm(ctx context.Context, bid string, a AutoConfirmActivation) error
+	PostDeactivateAutoConfirm(ctx context.Context, bid string) error
 }
 
 type hawkbitBackendService struct{}
@@ -121,18 +167,34 @@ func NewHawkbitBackendService() BackendService {
 
 func (h *hawkbitBackendService) GetController(ctx context.Context, bid string) (Controller, error) {
 	var c Controller
-	if d, err := deployment.GetDeployment(bid); err == nil {
-		href := fmt.Sprintf("/default/controller/v1/%s/deploymentBase/%s", d.Target, d.ActionId)
-		c.Links.DeploymentBase.Href = href
+	deployment.SetPolled(bid, time.Now())
+	c.Links.ConfirmationBase = &Link{Href: "/default/controller/v1/" + bid + "/confirmationBase"}
+	// An action the target is done with is no longer offered, whatever
+	// became of it.
+	if d, err := deployment.GetDeploymentContext(ctx, bid); err == nil && !d.Done() {
+		if d.AwaitingConfirmation() {
+			href := fmt.Sprintf("/default/controller/v1/%s/confirmationBase/%s", d.Target, d.ActionId)
+			c.Links.ConfirmationBase = &Link{Href: href}
+		} else {
+			href := fmt.Sprintf("/default/controller/v1/%s/deploymentBase/%s", d.Target, d.ActionId)
+			c.Links.DeploymentBase = &Link{Href: href}
+		}
+	}
+	if d, err := deployment.GetInstalled(bid); err == nil {
+		href := fmt.Sprintf("/default/controller/v1/%s/installedBase/%s", d.Target, d.ActionId)
+		c.Links.InstalledBase = &Link{Href: href}
 	}
 	c.Config.Polling.Sleep = "00:05:00"
-	c.Links.ConfigData.Href = "/default/controller/v1/" + bid + "/configData"
+	c.Links.ConfigData = &Link{Href: "/default/controller/v1/" + bid + "/configData"}
 	return c, nil
 }
 
 func (h *hawkbitBackendService) PostCancelActionFeedback(ctx context.Context, bid string,
 	fb CancelActionFeedback) error {
-	if err := deployment.UpdateStatus(bid, fb.ID, fb.Status); err != nil {
+	if err := checkFeedback(ctx, bid, fb.ID, fb.Status); err != nil {
+		return err
+	}
+	if err := deployment.UpdateStatusContext(ctx, bid, fb.ID, fb.Status); err != nil {
 		return err
 	}
 	return nil
@@ -140,53 +202,331 @@ func (h *hawkbitBackendService) PostCancelActionFeedback(ctx context.Context, bi
 }
 
 func (h *hawkbitBackendService) PutConfigData(ctx context.Context, bid string, cfg ConfigData) error {
+	if err := deployment.SetAttributesContext(ctx, bid, cfg.Mode, cfg.Data); err != nil {
+		return ErrBackendBadRequest
+	}
 	return nil
 }
 
 func (h *hawkbitBackendService) GetDeplymentBase(ctx context.Context, bid string,
 	acid string) (DeploymentBase, error) {
-	d, err := deployment.GetDeployment(bid)
+	d, err := deployment.GetDeploymentContext(ctx, bid)
 	if err != nil {
 		return DeploymentBase{}, err
 	}
 	if acid != d.ActionId {
 		return DeploymentBase{}, ErrBackendBadRequest
 	}
+	if d.AwaitingConfirmation() {
+		return DeploymentBase{}, ErrBackendUnconfirmed
+	}
+	return makeDeploymentBase(d, time.Now()), nil
+}
+
+func (h *hawkbitBackendService) GetInstalledBase(ctx context.Context, bid string,
+	acid string) (DeploymentBase, error) {
+	d, err := deployment.GetInstalled(bid)
+	if err != nil {
+		return DeploymentBase{}, err
+	}
+	if acid != d.ActionId {
+		return DeploymentBase{}, ErrBackendBadRequest
+	}
+	return makeInstalledBase(d), nil
+}
+
+func (h *hawkbitBackendService) GetConfirmationBase(ctx context.Context, bid string) (ConfirmationBase, error) {
+	var cb ConfirmationBase
+	a := deployment.GetAutoConfirm(bid)
+	cb.AutoConfirm.Active = a.Active
+	cb.AutoConfirm.Initiator = a.Initiator
+	cb.AutoConfirm.Remark = a.Remark
+	href := "/default/controller/v1/" + bid + "/confirmationBase/"
+	if a.Active {
+		cb.Links.DeactivateAutoConfirm = &Link{Href: href + "deactivateAutoConfirm"}
+	} else {
+		cb.Links.ActivateAutoConfirm = &Link{Href: href + "activateAutoConfirm"}
+	}
+	if d, err := deployment.GetDeploymentContext(ctx, bid); err == nil && d.AwaitingConfirmation() {
+		cb.Links.ConfirmationBase = &Link{Href: href + d.ActionId}
+	}
+	return cb, nil
+}
+
+func (h *hawkbitBackendService) GetConfirmationBaseAction(ctx context.Context, bid string,
+	acid string) (ConfirmationBaseAction, error) {
+	d, err := deployment.GetDeploymentContext(ctx, bid)
+	if err != nil {
+		return ConfirmationBaseAction{}, err
+	}
+	if acid != d.ActionId || !d.AwaitingConfirmation() {
+		return ConfirmationBaseAction{}, ErrBackendBadRequest
+	}
+	var ca ConfirmationBaseAction
+	ca.ID = d.ActionId
+	ca.Confirmation = makeAction(d, time.Now())
+	return ca, nil
+}
+
+func (h *hawkbitBackendService) PostConfirmationBaseFeedback(ctx context.Context, bid string, acid string,
+	fb ConfirmationFeedback) error {
+	if err := deployment.ConfirmContext(ctx, bid, acid, fb.Confirmation); err != nil {
+		if err == deployment.ErrDeploymentConfirmation {
+			return ErrBackendBadRequest
+		}
+		return err
+	}
+	return nil
+}
+
+func (h *hawkbitBackendService) PostActivateAutoConfirm(ctx context.Context, bid string,
+	a AutoConfirmActivation) error {
+	deployment.SetAutoConfirmContext(ctx, bid, deployment.AutoConfirm{
+		Active:    true,
+		Initiator: a.Initiator,
+		Remark:    a.Remark,
+	})
+	return nil
+}
+
+func (h *hawkbitBackendService) PostDeactivateAutoConfirm(ctx context.Context, bid string) error {
+	deployment.SetAutoConfirmContext(ctx, bid, deployment.AutoConfirm{})
+	return nil
+}
 
+func makeDeploymentBase(d deployment.Deployment, now time.Time) DeploymentBase {
 	var db DeploymentBase
-	db.ID = d.Target
-	db.Deployment.Chunks[0].Part = "bApp"
-	db.Deployment.Chunks[0].Version = d.Artifact.Version
-	db.Deployment.Chunks[0].Artifacts[0].Hashes.SHA256 = d.Artifact.Upload.Sha256
-	db.Deployment.Chunks[0].Artifacts[0].Size = d.Artifact.Upload.Size
-	href := "/DEFAULT/controller/v1/" + bid + "/softwareModules/" + d.Artifact.Upload.Version
-	db.Deployment.Chunks[0].Artifacts[0].Links.DownloadHttp.Href = href
-	return db, nil
+	db.ID = d.ActionId
+	db.Deployment = makeAction(d, now)
+	return db
+}
+
+// makeInstalledBase describes the finished action d. Maintenance windows
+// and forcing times no longer apply to it, so it reads as forced.
+func makeInstalledBase(d deployment.Deployment) DeploymentBase {
+	var db DeploymentBase
+	db.ID = d.ActionId
+	db.Deployment.Download = "forced"
+	db.Deployment.Update = "forced"
+	db.Deployment.Chunks = makeChunks(d)
+	return db
+}
+
+func makeAction(d deployment.Deployment, now time.Time) action {
+	var a action
+	switch {
+	case d.Type == deployment.ActionDownloadOnly:
+		a.Download = "forced"
+		a.Update = "skip"
+	case d.Forced(now):
+		a.Download = "forced"
+		a.Update = "forced"
+	default:
+		a.Download = "attempt"
+		a.Update = "attempt"
+	}
+	if d.Maintenance != nil {
+		// Outside the window the device may fetch the image ahead of time
+		// but must hold off installing it.
+		if d.Maintenance.Available(now) {
+			a.MaintenanceWindow = "available"
+		} else {
+			a.MaintenanceWindow = "unavailable"
+			a.Update = "skip"
+		}
+	}
+	a.Chunks = makeChunks(d)
+	return a
+}
+
+func makeChunks(d deployment.Deployment) []chunks {
+	o := bestOffer(offers(d))
+	var art artifacts
+	art.Filename = o.file
+	art.Hashes.SHA256 = o.sha
+	art.Hashes.MD5, art.Hashes.SHA1 = legacyHashes(o.sha)
+	art.Size = o.size
+	href := softwareModuleHref(d)
+	if o.file != imageFilename(d) {
+		href += "/artifacts/" + o.file
+	}
+	art.Links.DownloadHttp.Href = href
+	return []chunks{{
+		Part:      "bApp",
+		Name:      d.Artifact.Name,
+		Version:   d.Artifact.Version,
+		Metadata:  o.md,
+		Artifacts: []artifacts{art},
+	}}
+}
+
+// offer is an artifact a target may be sent for a deployment. Anything but
+// the full image carries metadata telling the device how to decode it and
+// how to verify the result.
+type offer struct {
+	file string
+	sha  string
+	size int
+	md   []metadata
+}
+
+var encodingExtensions = map[string]string{
+	deployment.EncodingGzip:       ".gz",
+	deployment.EncodingLZ4:        ".lz4",
+	deployment.EncodingHeatshrink: ".hs",
+}
+
+// offers lists the full image of d together with the compressed variants
+// its target declared decompressors for and a delta against the image the
+// target reports running.
+func offers(d deployment.Deployment) []offer {
+	img := d.Artifact.Image()
+	f := imageFilename(d)
+	image := []metadata{
+		{Key: "image-sha256", Value: img.Sha256},
+		{Key: "image-size", Value: strconv.Itoa(img.Size)},
+	}
+	os := []offer{{file: f, sha: img.Sha256, size: img.Size}}
+	for _, e := range deployment.Decompressors(d.Target) {
+		enc, ok := img.Encodings[e]
+		if !ok {
+			continue
+		}
+		md := []metadata{{Key: "content-encoding", Value: e}}
+		if e == deployment.EncodingHeatshrink {
+			md = append(md,
+				metadata{Key: "heatshrink-window", Value: strconv.Itoa(deployment.HeatshrinkWindow)},
+				metadata{Key: "heatshrink-lookahead", Value: strconv.Itoa(deployment.HeatshrinkLookahead)},
+			)
+		}
+		os = append(os, offer{
+			file: f + encodingExtensions[e],
+			sha:  enc.Sha256,
+			size: enc.Size,
+			md:   append(md, image...),
+		})
+	}
+	// The delta is generated when the deployment is assigned; until then,
+	// or if the target runs something else than the delta applies to, the
+	// target gets a full image.
+	i, err := deployment.GetInstalled(d.Target)
+	if err == nil && deployment.GetAttributes(d.Target)[deployment.AttributeVersion] == i.Artifact.Upload.Version {
+		base := i.Artifact.Image()
+		if dl, err := deployment.FindDelta(base.Sha256, img.Sha256); err == nil {
+			md := []metadata{
+				{Key: "delta-format", Value: deployment.DeltaFormat + "+gzip"},
+				{Key: "delta-base-sha256", Value: base.Sha256},
+			}
+			os = append(os, offer{
+				file: deltaFilename(d, base),
+				sha:  dl.Sha256,
+				size: dl.Size,
+				md:   append(md, image...),
+			})
+		}
+	}
+	return os
+}
+
+// legacyHashCache holds the MD5 and SHA-1 sums DDI clients may check
+// artifacts against, by the SHA-256 the store keeps artifacts under.
+var legacyHashCache sync.Map
+
+type legacyHash struct {
+	md5  string
+	sha1 string
+}
+
+// legacyHashes returns the MD5 and SHA-1 sums of the artifact sha, or empty
+// sums if the store does not have it.
+func legacyHashes(sha string) (string, string) {
+	if h, ok := legacyHashCache.Load(sha); ok {
+		return h.(legacyHash).md5, h.(legacyHash).sha1
+	}
+	f, err := deployment.GetArtifact(sha)
+	if err != nil {
+		return "", ""
+	}
+	h := legacyHash{md5: fmt.Sprintf("%x", md5.Sum(f)), sha1: fmt.Sprintf("%x", sha1.Sum(f))}
+	legacyHashCache.Store(sha, h)
+	return h.md5, h.sha1
+}
+
+func bestOffer(os []offer) offer {
+	b := os[0]
+	for _, o := range os[1:] {
+		if o.size < b.size {
+			b = o
+		}
+	}
+	return b
+}
+
+func softwareModuleHref(d deployment.Deployment) string {
+	return "/DEFAULT/controller/v1/" + d.Target + "/softwareModules/" + d.Artifact.Upload.Version
+}
+
+func imageFilename(d deployment.Deployment) string {
+	return d.Artifact.Upload.Name + ".bin"
+}
+
+func deltaFilename(d deployment.Deployment, base deployment.Artifact) string {
+	return d.Artifact.Upload.Name + "-" + base.Sha256[:7] + ".bsdiff.gz"
 }
 
 func (h *hawkbitBackendService) PostDeploymentBaseFeedback(ctx context.Context, bid string,
 	fb DeploymentBaseFeedback) error {
-	if err := deployment.UpdateStatus(bid, fb.ID, fb.Status); err != nil {
+	if err := checkFeedback(ctx, bid, fb.ID, fb.Status); err != nil {
+		return err
+	}
+	if err := deployment.UpdateStatusContext(ctx, bid, fb.ID, fb.Status); err != nil {
 		return err
 	}
 	return nil
 }
 
-func (h *hawkbitBackendService) GetDownloadHttp(ctx context.Context, bid string, ver string) ([]byte, error) {
-	var f []byte
-	d, err := deployment.GetDeployment(bid)
+// Status values a target may report in its feedback.
+var (
+	feedbackExecutions = map[string]bool{"closed": true, "proceeding": true, "canceled": true,
+		"scheduled": true, "rejected": true, "resumed": true, "downloaded": true, "download": true}
+	feedbackResults = map[string]bool{"success": true, "failure": true, "none": true}
+)
+
+// checkFeedback checks feedback of target bid is about its current action
+// and reports a status the DDI API knows.
+func checkFeedback(ctx context.Context, bid string, acid string, st deployment.Status) error {
+	d, err := deployment.GetDeploymentContext(ctx, bid)
+	if err != nil {
+		return err
+	}
+	if acid != d.ActionId || !feedbackExecutions[st.Execution] || !feedbackResults[st.Result.Finished] {
+		return ErrBackendBadRequest
+	}
+	return nil
+}
+
+func (h *hawkbitBackendService) GetDownloadHttp(ctx context.Context, bid string, ver string,
+	file string) ([]byte, error) {
+	d, err := deployment.GetDeploymentContext(ctx, bid)
 	if err != nil {
 		return nil, err
 	}
 	if ver != d.Artifact.Upload.Version {
-		return nil, err
+		return nil, ErrBackendBadRequest
 	}
-	resp, err := http.Get(d.Artifact.Upload.Url)
-	if err != nil {
-		return nil, ErrBackendDownload
+	sha := d.Artifact.Image().Sha256
+	if file != "" {
+		sha = ""
+		for _, o := range offers(d) {
+			if o.file == file {
+				sha = o.sha
+			}
+		}
+		if sha == "" {
+			return nil, deployment.ErrDeploymentArtifact
+		}
 	}
-	defer resp.Body.Close()
-	_, err = resp.Body.Read(f)
+	f, err := deployment.GetArtifact(sha)
 	if err != nil {
 		return nil, ErrBackendDownload
 	}
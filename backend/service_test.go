@@ -0,0 +1,117 @@
+package backend
+
+import (
+	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/jonathanyhliang/hawkbit-fota/deployment"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMakeActionMaintenance(t *testing.T) {
+	// A two hour window opening at 02:00 every day.
+	window := &deployment.MaintenanceWindow{Schedule: "0 2 * * *", Duration: "02:00:00", Timezone: "+00:00"}
+	eastern := &deployment.MaintenanceWindow{Schedule: "0 2 * * *", Duration: "02:00:00", Timezone: "+02:00"}
+	at := func(hhmm string) time.Time {
+		t, _ := time.Parse(time.RFC3339, "2023-05-10T"+hhmm+":00Z")
+		return t
+	}
+
+	cases := []struct {
+		name        string
+		typ         string
+		window      *deployment.MaintenanceWindow
+		now         time.Time
+		download    string
+		update      string
+		maintenance string
+	}{
+		{"no window", deployment.ActionForced, nil, at("12:00"), "forced", "forced", ""},
+		{"before", deployment.ActionForced, window, at("01:59"), "forced", "skip", "unavailable"},
+		{"opening", deployment.ActionForced, window, at("02:00"), "forced", "forced", "available"},
+		{"inside", deployment.ActionForced, window, at("03:30"), "forced", "forced", "available"},
+		{"closing", deployment.ActionForced, window, at("04:00"), "forced", "skip", "unavailable"},
+		{"after", deployment.ActionForced, window, at("05:00"), "forced", "skip", "unavailable"},
+		{"soft inside", deployment.ActionSoft, window, at("03:00"), "attempt", "attempt", "available"},
+		{"soft after", deployment.ActionSoft, window, at("05:00"), "attempt", "skip", "unavailable"},
+		{"download only inside", deployment.ActionDownloadOnly, window, at("03:00"), "forced", "skip", "available"},
+		{"timezone inside", deployment.ActionForced, eastern, at("00:30"), "forced", "forced", "available"},
+		{"timezone after", deployment.ActionForced, eastern, at("03:00"), "forced", "skip", "unavailable"},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			d := deployment.Deployment{Target: "maintenance-dev", Type: c.typ, Maintenance: c.window}
+			a := makeAction(d, c.now)
+			assert.Equal(t, c.download, a.Download)
+			assert.Equal(t, c.update, a.Update)
+			assert.Equal(t, c.maintenance, a.MaintenanceWindow)
+		})
+	}
+}
+
+func TestMakeInstalledBase(t *testing.T) {
+	// A window that is never open and a forcing time far ahead.
+	window := &deployment.MaintenanceWindow{Schedule: "0 2 1 1 *", Duration: "00:00:01", Timezone: "+00:00"}
+	for _, d := range []deployment.Deployment{
+		{Target: "installed-dev", ActionId: "1234567", Type: deployment.ActionForced, Maintenance: window},
+		{Target: "installed-dev", ActionId: "1234567", Type: deployment.ActionSoft},
+		{Target: "installed-dev", ActionId: "1234567", Type: deployment.ActionTimeForced,
+			ForceTime: "2999-01-01T00:00:00Z"},
+	} {
+		db := makeInstalledBase(d)
+		assert.Equal(t, "1234567", db.ID)
+		assert.Equal(t, "forced", db.Deployment.Download)
+		assert.Equal(t, "forced", db.Deployment.Update)
+		assert.Equal(t, "", db.Deployment.MaintenanceWindow)
+	}
+}
+
+func TestOffersDelta(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	v1 := make([]byte, 32<<10)
+	r.Read(v1)
+	v2 := append(append([]byte{}, v1[:16<<10]...), []byte("patched")...)
+	v2 = append(v2, v1[16<<10:]...)
+	img := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/v2" {
+			w.Write(v2)
+			return
+		}
+		w.Write(v1)
+	}))
+	defer img.Close()
+	for v, u := range map[string]string{"1.0.0": img.URL + "/v1", "2.0.0": img.URL + "/v2"} {
+		n := "delta-" + v
+		assert.Equal(t, nil, deployment.SetUpload(deployment.Upload{Name: n, Version: v, Url: u}))
+		assert.Equal(t, nil, deployment.SetDistribution(deployment.Distribution{Name: n, Version: v}, n))
+	}
+	assert.Equal(t, nil, deployment.SetAttributes("delta-dev", deployment.AttributesReplace, nil))
+	assert.Equal(t, nil, deployment.SetDeployment("delta-dev", "delta-1.0.0", deployment.DeploymentOptions{}))
+	d, _ := deployment.GetDeployment("delta-dev")
+	var st deployment.Status
+	st.Execution, st.Result.Finished = "closed", "success"
+	assert.Equal(t, nil, deployment.UpdateStatus("delta-dev", d.ActionId, st))
+
+	assert.Equal(t, nil, deployment.SetDeployment("delta-dev", "delta-2.0.0", deployment.DeploymentOptions{}))
+	d, _ = deployment.GetDeployment("delta-dev")
+	// The delta is generated in the background.
+	assert.Eventually(t, func() bool {
+		i, _ := deployment.GetInstalled("delta-dev")
+		_, err := deployment.FindDelta(i.Artifact.Image().Sha256, d.Artifact.Image().Sha256)
+		return err == nil
+	}, 5*time.Second, 10*time.Millisecond)
+
+	// The target has not told which version it runs.
+	assert.Equal(t, 1, len(offers(d)))
+	assert.Equal(t, nil, deployment.SetAttributes("delta-dev", "", map[string]string{deployment.AttributeVersion: "0.9.0"}))
+	assert.Equal(t, 1, len(offers(d)))
+	assert.Equal(t, nil, deployment.SetAttributes("delta-dev", "", map[string]string{deployment.AttributeVersion: "1.0.0"}))
+	os := offers(d)
+	assert.Equal(t, 2, len(os))
+	o := bestOffer(os)
+	assert.Contains(t, o.file, ".bsdiff.gz")
+	assert.Less(t, o.size, len(v2)/4)
+}
@@ -13,6 +13,7 @@ import (
 	"github.com/go-kit/kit/log"
 	"github.com/go-kit/kit/transport"
 	httptransport "github.com/go-kit/kit/transport/http"
+	"go.opentelemetry.io/contrib/instrumentation/github.com/gorilla/mux/otelmux"
 )
 
 var (
@@ -23,6 +24,7 @@ var (
 
 func MakeBackendHTTPHandler(s BackendService, logger log.Logger) http.Handler {
 	r := mux.NewRouter()
+	r.Use(otelmux.Middleware("hawkbit-backend"))
 	e := MakeBackendServerEndpoints(s)
 	options := []httptransport.ServerOption{
 		httptransport.ServerErrorHandler(transport.NewLogErrorHandler(logger)),
@@ -65,6 +67,48 @@ func MakeBackendHTTPHandler(s BackendService, logger log.Logger) http.Handler {
 		encodeDownloadHttpResponse,
 		options...,
 	))
+	r.Methods("Get").Path("/DEFAULT/controller/v1/{bid}/softwareModules/{ver}/artifacts/{file}").Handler(httptransport.NewServer(
+		e.GetDownloadHttpEndpoint,
+		decodeGetDownloadHttpEndpoint,
+		encodeDownloadHttpResponse,
+		options...,
+	))
+	r.Methods("Get").Path("/default/controller/v1/{bid}/installedBase/{acid}").Handler(httptransport.NewServer(
+		e.GetInstalledBaseEndpoint,
+		decodeGetInstalledBaseEndpoint,
+		encodeResponse,
+		options...,
+	))
+	r.Methods("Get").Path("/default/controller/v1/{bid}/confirmationBase").Handler(httptransport.NewServer(
+		e.GetConfirmationBaseEndpoint,
+		decodeGetConfirmationBaseEndpoint,
+		encodeResponse,
+		options...,
+	))
+	r.Methods("Post").Path("/default/controller/v1/{bid}/confirmationBase/activateAutoConfirm").Handler(httptransport.NewServer(
+		e.PostActivateAutoConfirmEndpoint,
+		decodePostActivateAutoConfirmEndpoint,
+		encodeResponse,
+		options...,
+	))
+	r.Methods("Post").Path("/default/controller/v1/{bid}/confirmationBase/deactivateAutoConfirm").Handler(httptransport.NewServer(
+		e.PostDeactivateAutoConfirmEndpoint,
+		decodePostDeactivateAutoConfirmEndpoint,
+		encodeResponse,
+		options...,
+	))
+	r.Methods("Get").Path("/default/controller/v1/{bid}/confirmationBase/{acid}").Handler(httptransport.NewServer(
+		e.GetConfirmationBaseActionEndpoint,
+		decodeGetConfirmationBaseActionEndpoint,
+		encodeResponse,
+		options...,
+	))
+	r.Methods("Post").Path("/default/controller/v1/{bid}/confirmationBase/{acid}/feedback").Handler(httptransport.NewServer(
+		e.PostConfirmationBaseFeedbackEndpoint,
+		decodePostConfirmationBaseFeedbackEndpoint,
+		encodeResponse,
+		options...,
+	))
 	return r
 }
 
@@ -91,9 +135,23 @@ func decodePostCancelActionFeebackEndpoint(_ context.Context, r *http.Request) (
 	if e != nil {
 		return nil, ErrBadRouting
 	}
+	acid, ok := vars["acid"]
+	if !ok {
+		return nil, ErrBadRouting
+	}
+	acid, e = url.QueryUnescape(acid)
+	if e != nil {
+		return nil, ErrBadRouting
+	}
 	var fb CancelActionFeedback
 	if e := json.NewDecoder(r.Body).Decode(&fb); e != nil {
-		return nil, e
+		return nil, ErrBackendBadRequest
+	}
+	if fb.ID == "" {
+		fb.ID = acid
+	}
+	if fb.ID != acid {
+		return nil, ErrBackendBadRequest
 	}
 	return PostCancelActionFeedbackRequest{Bid: bid, Fb: fb}, nil
 }
@@ -110,7 +168,7 @@ func decodePutConfigDataEndpoint(_ context.Context, r *http.Request) (request in
 	}
 	var cfg ConfigData
 	if e := json.NewDecoder(r.Body).Decode(&cfg); e != nil {
-		return nil, e
+		return nil, ErrBackendBadRequest
 	}
 	return PutConfigDataRequest{Bid: bid, Cfg: cfg}, nil
 }
@@ -146,9 +204,25 @@ func decodePostDeploymentBaseFeedbackEndpoint(_ context.Context, r *http.Request
 	if e != nil {
 		return nil, ErrBadRouting
 	}
+	acid, ok := vars["acid"]
+	if !ok {
+		return nil, ErrBadRouting
+	}
+	acid, e = url.QueryUnescape(acid)
+	if e != nil {
+		return nil, ErrBadRouting
+	}
 	var fb DeploymentBaseFeedback
 	if e := json.NewDecoder(r.Body).Decode(&fb); e != nil {
-		return nil, e
+		return nil, ErrBackendBadRequest
+	}
+	// The id in the body is optional, but must not name another action
+	// than the path.
+	if fb.ID == "" {
+		fb.ID = acid
+	}
+	if fb.ID != acid {
+		return nil, ErrBackendBadRequest
 	}
 	return PostDeploymentBaseFeedbackRequest{Bid: bid, Fb: fb}, nil
 }
@@ -163,15 +237,133 @@ func decodeGetDownloadHttpEndpoint(_ context.Context, r *http.Request) (request
 	if e != nil {
 		return nil, ErrBadRouting
 	}
+	// Versions such as "1.0.0+1" must keep their '+', so path rather than
+	// query unescaping applies here.
 	ver, ok := vars["ver"]
 	if !ok {
 		return nil, ErrBadRouting
 	}
-	ver, e = url.QueryUnescape(ver)
+	ver, e = url.PathUnescape(ver)
 	if e != nil {
 		return nil, ErrBadRouting
 	}
-	return GetDownloadHttpRequest{Bid: bid, Ver: ver}, nil
+	file, e := url.PathUnescape(vars["file"])
+	if e != nil {
+		return nil, ErrBadRouting
+	}
+	return GetDownloadHttpRequest{Bid: bid, Ver: ver, File: file}, nil
+}
+
+func decodeGetInstalledBaseEndpoint(_ context.Context, r *http.Request) (request interface{}, err error) {
+	vars := mux.Vars(r)
+	bid, ok := vars["bid"]
+	if !ok {
+		return nil, ErrBadRouting
+	}
+	bid, e := url.QueryUnescape(bid)
+	if e != nil {
+		return nil, ErrBadRouting
+	}
+	acid, ok := vars["acid"]
+	if !ok {
+		return nil, ErrBadRouting
+	}
+	acid, e = url.QueryUnescape(acid)
+	if e != nil {
+		return nil, ErrBadRouting
+	}
+	return GetInstalledBaseRequest{Bid: bid, Acid: acid}, nil
+}
+
+func decodeGetConfirmationBaseEndpoint(_ context.Context, r *http.Request) (request interface{}, err error) {
+	vars := mux.Vars(r)
+	bid, ok := vars["bid"]
+	if !ok {
+		return nil, ErrBadRouting
+	}
+	bid, e := url.QueryUnescape(bid)
+	if e != nil {
+		return nil, ErrBadRouting
+	}
+	return GetConfirmationBaseRequest{Bid: bid}, nil
+}
+
+func decodeGetConfirmationBaseActionEndpoint(_ context.Context, r *http.Request) (request interface{}, err error) {
+	vars := mux.Vars(r)
+	bid, ok := vars["bid"]
+	if !ok {
+		return nil, ErrBadRouting
+	}
+	bid, e := url.QueryUnescape(bid)
+	if e != nil {
+		return nil, ErrBadRouting
+	}
+	acid, ok := vars["acid"]
+	if !ok {
+		return nil, ErrBadRouting
+	}
+	acid, e = url.QueryUnescape(acid)
+	if e != nil {
+		return nil, ErrBadRouting
+	}
+	return GetConfirmationBaseActionRequest{Bid: bid, Acid: acid}, nil
+}
+
+func decodePostConfirmationBaseFeedbackEndpoint(_ context.Context, r *http.Request) (request interface{}, err error) {
+	vars := mux.Vars(r)
+	bid, ok := vars["bid"]
+	if !ok {
+		return nil, ErrBadRouting
+	}
+	bid, e := url.QueryUnescape(bid)
+	if e != nil {
+		return nil, ErrBadRouting
+	}
+	acid, ok := vars["acid"]
+	if !ok {
+		return nil, ErrBadRouting
+	}
+	acid, e = url.QueryUnescape(acid)
+	if e != nil {
+		return nil, ErrBadRouting
+	}
+	var fb ConfirmationFeedback
+	if e := json.NewDecoder(r.Body).Decode(&fb); e != nil {
+		return nil, ErrBackendBadRequest
+	}
+	return PostConfirmationBaseFeedbackRequest{Bid: bid, Acid: acid, Fb: fb}, nil
+}
+
+func decodePostActivateAutoConfirmEndpoint(_ context.Context, r *http.Request) (request interface{}, err error) {
+	vars := mux.Vars(r)
+	bid, ok := vars["bid"]
+	if !ok {
+		return nil, ErrBadRouting
+	}
+	bid, e := url.QueryUnescape(bid)
+	if e != nil {
+		return nil, ErrBadRouting
+	}
+	var ac AutoConfirmActivation
+	if r.ContentLength != 0 {
+		if e := json.NewDecoder(r.Body).Decode(&ac); e != nil {
+			return nil, ErrBackendBadRequest
+		}
+	}
+	return PostActivateAutoConfirmRequest{Bid: bid, Ac: ac}, nil
+}
+
+func decodePostDeactivateAutoConfirmEndpoint(_ context.Context, r *http.Request) (request interface{}, err error) {
+	vars := mux.Vars(r)
+	bid, ok := vars["bid"]
+	if !ok {
+		return nil, ErrBadRouting
+	}
+	bid, e := url.QueryUnescape(bid)
+	if e != nil {
+		return nil, ErrBadRouting
+	}
+	return PostDeactivateAutoConfirmRequest{Bid: bid}, nil
 }
 
 type errorer interface {
@@ -186,7 +378,21 @@ func encodeResponse(ctx context.Context, w http.ResponseWriter, response interfa
 		return nil
 	}
 	w.Header().Set("Content-Type", "application/json; charset=utf-8")
-	return json.NewEncoder(w).Encode(response)
+	return json.NewEncoder(w).Encode(responseBody(response))
+}
+
+// resourcer is implemented by the responses carrying a DDI resource.
+type resourcer interface {
+	resource() interface{}
+}
+
+// responseBody returns what goes in the body of response: the resource it
+// carries, as the DDI API sends resources without anything around them.
+func responseBody(response interface{}) interface{} {
+	if r, ok := response.(resourcer); ok {
+		return r.resource()
+	}
+	return response
 }
 
 type filer interface {
@@ -221,11 +427,23 @@ func encodeError(_ context.Context, err error, w http.ResponseWriter) {
 
 func codeFrom(err error) int {
 	switch err {
-	case deployment.ErrDeploymentNotFound:
+	case deployment.ErrDeploymentNotFound, deployment.ErrDeploymentNotInstalled, deployment.ErrDeploymentArtifact:
 		return http.StatusNotFound
 	case ErrBackendBadRequest, ErrBackendDownload:
 		return http.StatusBadRequest
+	case ErrBackendUnconfirmed:
+		return http.StatusConflict
 	default:
 		return http.StatusInternalServerError
 	}
 }
+
+// feedbackAction returns the action feedback is about: the id in the body,
+// which is optional but must not name another action than the path or topic
+// the feedback was sent to.
+func feedbackAction(acid string, id string) (string, error) {
+	if id != "" && id != acid {
+		return "", ErrBackendBadRequest
+	}
+	return acid, nil
+}
@@ -0,0 +1,526 @@
+package backend
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"math/rand"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/fxamacker/cbor/v2"
+	"github.com/go-kit/kit/endpoint"
+	"github.com/go-kit/kit/log"
+)
+
+// coapBlockSZX sizes the blocks responses are split into unless a target
+// asks for smaller ones: 1024 bytes, which fits an IPv6 minimum MTU datagram
+// together with the headers.
+const coapBlockSZX = 6
+
+// coapMaxDatagram bounds the requests read from the network.
+const coapMaxDatagram = 2048
+
+type coapRoute struct {
+	method   uint8
+	path     []string
+	endpoint endpoint.Endpoint
+	decode   func(vars map[string]string, payload func(v interface{}) error) (interface{}, error)
+	// raw routes answer with application/octet-stream instead of an encoded
+	// response.
+	raw bool
+}
+
+type coapBody struct {
+	peer   string
+	body   []byte
+	format uint32
+	etag   []byte
+	at     time.Time
+}
+
+// Bounds of the bodies kept for blockwise transfers in progress, per peer
+// and in total. Bodies evicted early are built anew by the endpoint when the
+// next block is asked for.
+const (
+	coapPeerBodies    = 4
+	coapPeerBodyBytes = 16 << 20
+	coapBodies        = 1024
+	coapBodyBytes     = 256 << 20
+)
+
+// coapUsage accounts for the bodies kept for a peer.
+type coapUsage struct {
+	n     int
+	bytes int
+}
+
+// CoAPServer exposes the backend to constrained targets over CoAP, using the
+// same resource paths as the DDI HTTP API. Request and response payloads are
+// JSON or CBOR as selected by the Content-Format and Accept options, and
+// large responses such as artifacts are transferred blockwise (RFC 7959).
+type CoAPServer struct {
+	routes []coapRoute
+	logger log.Logger
+	mid    uint32
+
+	exchanges coapExchanges
+
+	mtx       sync.Mutex
+	bodies    map[string]coapBody
+	bodyBytes int
+	peers     map[string]coapUsage
+	swept     time.Time
+}
+
+func NewCoAPServer(s BackendService, logger log.Logger) *CoAPServer {
+	e := MakeBackendServerEndpoints(s)
+	const base = "default/controller/v1/{bid}/"
+	return &CoAPServer{
+		routes: []coapRoute{
+			{coapGET, coapPath("default/controller/v1/{bid}"), e.GetControllerEndpoint, decodeCoAPGetController, false},
+			{coapPOST, coapPath(base + "cancelAction/{acid}/feedback"), e.PostCancelActionFeebackEndpoint, decodeCoAPCancelActionFeedback, false},
+			{coapPUT, coapPath(base + "configData"), e.PutConfigDataEndpoint, decodeCoAPPutConfigData, false},
+			{coapGET, coapPath(base + "deploymentBase/{acid}"), e.GetDeploymentBaseEndpoint, decodeCoAPGetDeploymentBase, false},
+			{coapPOST, coapPath(base + "deploymentBase/{acid}/feedback"), e.PostDeploymentBaseFeedbackEndpoint, decodeCoAPDeploymentBaseFeedback, false},
+			{coapGET, coapPath(base + "softwareModules/{ver}"), e.GetDownloadHttpEndpoint, decodeCoAPGetDownload, true},
+			{coapGET, coapPath(base + "softwareModules/{ver}/artifacts/{file}"), e.GetDownloadHttpEndpoint, decodeCoAPGetDownload, true},
+			{coapGET, coapPath(base + "installedBase/{acid}"), e.GetInstalledBaseEndpoint, decodeCoAPGetInstalledBase, false},
+			{coapGET, coapPath(base + "confirmationBase"), e.GetConfirmationBaseEndpoint, decodeCoAPGetConfirmationBase, false},
+			{coapPOST, coapPath(base + "confirmationBase/activateAutoConfirm"), e.PostActivateAutoConfirmEndpoint, decodeCoAPActivateAutoConfirm, false},
+			{coapPOST, coapPath(base + "confirmationBase/deactivateAutoConfirm"), e.PostDeactivateAutoConfirmEndpoint, decodeCoAPDeactivateAutoConfirm, false},
+			{coapGET, coapPath(base + "confirmationBase/{acid}"), e.GetConfirmationBaseActionEndpoint, decodeCoAPGetConfirmationBaseAction, false},
+			{coapPOST, coapPath(base + "confirmationBase/{acid}/feedback"), e.PostConfirmationBaseFeedbackEndpoint, decodeCoAPConfirmationBaseFeedback, false},
+		},
+		logger: logger,
+		mid:    rand.Uint32(),
+		bodies: map[string]coapBody{},
+		peers:  map[string]coapUsage{},
+	}
+}
+
+func coapPath(p string) []string {
+	return strings.Split(p, "/")
+}
+
+// Serve answers the requests received on pc, typically a UDP socket, until
+// reading from it fails.
+func (c *CoAPServer) Serve(pc net.PacketConn) error {
+	buf := make([]byte, coapMaxDatagram)
+	for {
+		n, addr, err := pc.ReadFrom(buf)
+		if err != nil {
+			return err
+		}
+		req := append([]byte{}, buf[:n]...)
+		go func() {
+			if resp := c.handle(addr.String(), req); resp != nil {
+				if _, err := pc.WriteTo(resp, addr); err != nil {
+					c.logger.Log("coap", addr.String(), "err", err)
+				}
+			}
+		}()
+	}
+}
+
+// ServeListener answers the requests of every session accepted on l, such as
+// a DTLS listener whose connections carry one datagram per read. Sessions
+// idle for longer than the exchange lifetime are closed.
+func (c *CoAPServer) ServeListener(l net.Listener) error {
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			return err
+		}
+		go c.serveConn(conn)
+	}
+}
+
+func (c *CoAPServer) serveConn(conn net.Conn) {
+	defer conn.Close()
+	peer := conn.RemoteAddr().String()
+	buf := make([]byte, coapMaxDatagram)
+	for {
+		conn.SetReadDeadline(time.Now().Add(coapLifetime))
+		n, err := conn.Read(buf)
+		if err != nil {
+			return
+		}
+		if resp := c.handle(peer, buf[:n]); resp != nil {
+			if _, err := conn.Write(resp); err != nil {
+				c.logger.Log("coap", peer, "err", err)
+				return
+			}
+		}
+	}
+}
+
+// handle returns the datagram answering b received from peer, if any.
+func (c *CoAPServer) handle(peer string, b []byte) []byte {
+	m, err := parseCoAP(b)
+	if err != nil {
+		// Malformed confirmable messages are rejected, anything else is
+		// silently ignored.
+		if len(b) >= 4 && b[0]>>6 == 1 && b[0]>>4&3 == coapCON {
+			rst := coapMessage{typ: coapRST, id: uint16(b[2])<<8 | uint16(b[3])}
+			return rst.marshal()
+		}
+		return nil
+	}
+	switch {
+	case m.typ == coapACK || m.typ == coapRST:
+		return nil
+	case m.code == coapEmpty:
+		// CoAP ping.
+		if m.typ == coapCON {
+			rst := coapMessage{typ: coapRST, id: m.id}
+			return rst.marshal()
+		}
+		return nil
+	case m.code>>5 != 0:
+		return nil
+	}
+
+	key := peer + "/" + strconv.Itoa(int(m.id))
+	if resp, dup := c.exchanges.begin(key); dup {
+		// A retransmission: repeat the response, or drop it while the
+		// original is still being served.
+		return resp
+	}
+	resp := c.serve(peer, m)
+	resp.token = m.token
+	if m.typ == coapCON {
+		resp.typ, resp.id = coapACK, m.id
+	} else {
+		resp.typ, resp.id = coapNON, uint16(atomic.AddUint32(&c.mid, 1))
+	}
+	b = resp.marshal()
+	c.exchanges.end(key, b)
+	return b
+}
+
+func (c *CoAPServer) serve(peer string, m coapMessage) coapMessage {
+	if m.unknownCritical() {
+		return coapMessage{code: coapBadOption}
+	}
+	if b1, ok := m.uintOption(coapBlock1); ok {
+		// Requests are small enough to never be sent blockwise.
+		if b := parseCoAPBlock(b1); b.more || b.num > 0 {
+			return coapMessage{code: coapCodeFromHTTP(413)}
+		}
+	}
+
+	r, vars, code := c.route(m)
+	if r == nil {
+		return coapMessage{code: code}
+	}
+
+	reqFormat, ok := m.uintOption(coapContentFormat)
+	if !ok {
+		reqFormat = coapFormatJSON
+	}
+	if len(m.payload) > 0 && reqFormat != coapFormatJSON && reqFormat != coapFormatCBOR {
+		return coapMessage{code: coapUnsupportedFmt}
+	}
+	format := reqFormat
+	if r.raw {
+		format = coapFormatOctetStream
+	}
+	if accept, ok := m.uintOption(coapAccept); ok {
+		if accept != format && (r.raw || (accept != coapFormatJSON && accept != coapFormatCBOR)) {
+			return coapMessage{code: coapNotAcceptable}
+		}
+		format = accept
+	}
+
+	blk := coapBlock{szx: coapBlockSZX}
+	if v, ok := m.uintOption(coapBlock2); ok {
+		if b := parseCoAPBlock(v); b.szx < blk.szx {
+			blk.szx = b.szx
+		}
+		blk.num = parseCoAPBlock(v).num
+	}
+
+	bodyKey := peer + " " + strings.Join(m.path(), "/") + " " + strconv.Itoa(int(format))
+	c.mtx.Lock()
+	body, cached := c.bodies[bodyKey]
+	c.mtx.Unlock()
+	if !cached || blk.num == 0 {
+		req, err := r.decode(vars, func(v interface{}) error {
+			return coapUnmarshal(reqFormat, m.payload, v)
+		})
+		if err != nil {
+			c.logger.Log("coap", peer, "err", err)
+			return c.coapError(ErrBackendBadRequest, format)
+		}
+		resp, err := r.endpoint(context.Background(), req)
+		if err == nil {
+			if e, ok := resp.(errorer); ok {
+				err = e.error()
+			}
+		}
+		if err != nil {
+			return c.coapError(err, format)
+		}
+		if m.code != coapGET {
+			return coapMessage{code: coapChanged}
+		}
+		body = coapBody{peer: peer, format: format, at: time.Now()}
+		if f, ok := resp.(filer); ok {
+			body.body = f.file()
+		} else if body.body, err = coapMarshal(format, responseBody(resp)); err != nil {
+			c.logger.Log("coap", peer, "err", err)
+			return coapMessage{code: coapCodeFromHTTP(500)}
+		}
+	}
+
+	resp := coapMessage{code: coapContent}
+	resp.addUintOption(coapContentFormat, body.format)
+	if len(body.body) <= blk.size() && blk.num == 0 {
+		resp.payload = body.body
+		return resp
+	}
+
+	// Blockwise transfer. The body is kept until its last block is sent so
+	// the endpoint runs once per transfer, and tagged so targets notice if
+	// it changed in between.
+	if body.etag == nil {
+		sum := sha256.Sum256(body.body)
+		body.etag = sum[:8]
+	}
+	off := int(blk.num) * blk.size()
+	if off >= len(body.body) {
+		return coapMessage{code: coapBadOption}
+	}
+	end := off + blk.size()
+	if end >= len(body.body) {
+		end = len(body.body)
+		c.mtx.Lock()
+		c.dropBody(bodyKey)
+		c.mtx.Unlock()
+	} else {
+		blk.more = true
+		body.at = time.Now()
+		c.mtx.Lock()
+		if body.at.Sub(c.swept) > coapLifetime/8 {
+			for k, b := range c.bodies {
+				if body.at.Sub(b.at) > coapLifetime {
+					c.dropBody(k)
+				}
+			}
+			c.swept = body.at
+		}
+		c.keepBody(bodyKey, body)
+		c.mtx.Unlock()
+	}
+	resp.addOption(coapETag, body.etag)
+	resp.addUintOption(coapBlock2, blk.value())
+	if blk.num == 0 {
+		resp.addUintOption(coapSize2, uint32(len(body.body)))
+	}
+	resp.payload = body.body[off:end]
+	return resp
+}
+
+// keepBody keeps body under key for the next blocks, evicting the least
+// recently used bodies of its peer, then of any peer, to stay within bounds.
+// Bodies larger than a peer may keep are not kept. The caller holds c.mtx.
+func (c *CoAPServer) keepBody(key string, body coapBody) {
+	c.dropBody(key)
+	n := len(body.body)
+	if n > coapPeerBodyBytes {
+		return
+	}
+	for u := c.peers[body.peer]; u.n >= coapPeerBodies || u.bytes+n > coapPeerBodyBytes; u = c.peers[body.peer] {
+		c.dropBody(c.oldestBody(body.peer))
+	}
+	for len(c.bodies) >= coapBodies || c.bodyBytes+n > coapBodyBytes {
+		c.dropBody(c.oldestBody(""))
+	}
+	c.bodies[key] = body
+	c.bodyBytes += n
+	u := c.peers[body.peer]
+	u.n++
+	u.bytes += n
+	c.peers[body.peer] = u
+}
+
+// dropBody forgets the body kept under key, if any. The caller holds c.mtx.
+func (c *CoAPServer) dropBody(key string) {
+	body, ok := c.bodies[key]
+	if !ok {
+		return
+	}
+	delete(c.bodies, key)
+	c.bodyBytes -= len(body.body)
+	u := c.peers[body.peer]
+	u.n--
+	u.bytes -= len(body.body)
+	if u.n == 0 {
+		delete(c.peers, body.peer)
+		return
+	}
+	c.peers[body.peer] = u
+}
+
+// oldestBody returns the key of the least recently used body kept for peer,
+// or for any peer if peer is empty. The caller holds c.mtx.
+func (c *CoAPServer) oldestBody(peer string) string {
+	var key string
+	var at time.Time
+	for k, b := range c.bodies {
+		if (peer == "" || b.peer == peer) && (key == "" || b.at.Before(at)) {
+			key, at = k, b.at
+		}
+	}
+	return key
+}
+
+// route returns the route m is addressed to and the path variables, or the
+// code to answer with if there is none.
+func (c *CoAPServer) route(m coapMessage) (*coapRoute, map[string]string, uint8) {
+	path := m.path()
+	code := coapNotFound
+	for i := range c.routes {
+		r := &c.routes[i]
+		vars, ok := matchCoAPPath(r.path, path)
+		if !ok {
+			continue
+		}
+		if r.method != m.code {
+			code = coapMethodNotAllowed
+			continue
+		}
+		return r, vars, 0
+	}
+	return nil, nil, code
+}
+
+func matchCoAPPath(pattern []string, path []string) (map[string]string, bool) {
+	if len(pattern) != len(path) {
+		return nil, false
+	}
+	vars := map[string]string{}
+	for i, p := range pattern {
+		switch {
+		case strings.HasPrefix(p, "{"):
+			if path[i] == "" {
+				return nil, false
+			}
+			vars[strings.Trim(p, "{}")] = path[i]
+		case !strings.EqualFold(p, path[i]):
+			return nil, false
+		}
+	}
+	return vars, true
+}
+
+func (c *CoAPServer) coapError(err error, format uint32) coapMessage {
+	resp := coapMessage{code: coapCodeFromHTTP(codeFrom(err))}
+	if format != coapFormatJSON && format != coapFormatCBOR {
+		format = coapFormatJSON
+	}
+	if b, e := coapMarshal(format, map[string]interface{}{"error": err.Error()}); e == nil {
+		resp.addUintOption(coapContentFormat, format)
+		resp.payload = b
+	}
+	return resp
+}
+
+func coapMarshal(format uint32, v interface{}) ([]byte, error) {
+	if format == coapFormatCBOR {
+		return cbor.Marshal(v)
+	}
+	return json.Marshal(v)
+}
+
+func coapUnmarshal(format uint32, b []byte, v interface{}) error {
+	if len(b) == 0 {
+		return errCoAPEmpty
+	}
+	if format == coapFormatCBOR {
+		return cbor.Unmarshal(b, v)
+	}
+	return json.Unmarshal(b, v)
+}
+
+func decodeCoAPGetController(vars map[string]string, _ func(v interface{}) error) (interface{}, error) {
+	return GetControllerRequest{Bid: vars["bid"]}, nil
+}
+
+func decodeCoAPCancelActionFeedback(vars map[string]string, payload func(v interface{}) error) (interface{}, error) {
+	var fb CancelActionFeedback
+	if err := payload(&fb); err != nil {
+		return nil, err
+	}
+	var err error
+	if fb.ID, err = feedbackAction(vars["acid"], fb.ID); err != nil {
+		return nil, err
+	}
+	return PostCancelActionFeedbackRequest{Bid: vars["bid"], Fb: fb}, nil
+}
+
+func decodeCoAPPutConfigData(vars map[string]string, payload func(v interface{}) error) (interface{}, error) {
+	var cfg ConfigData
+	if err := payload(&cfg); err != nil {
+		return nil, err
+	}
+	return PutConfigDataRequest{Bid: vars["bid"], Cfg: cfg}, nil
+}
+
+func decodeCoAPGetDeploymentBase(vars map[string]string, _ func(v interface{}) error) (interface{}, error) {
+	return GetDeplymentBaseRequest{Bid: vars["bid"], Acid: vars["acid"]}, nil
+}
+
+func decodeCoAPDeploymentBaseFeedback(vars map[string]string, payload func(v interface{}) error) (interface{}, error) {
+	var fb DeploymentBaseFeedback
+	if err := payload(&fb); err != nil {
+		return nil, err
+	}
+	var err error
+	if fb.ID, err = feedbackAction(vars["acid"], fb.ID); err != nil {
+		return nil, err
+	}
+	return PostDeploymentBaseFeedbackRequest{Bid: vars["bid"], Fb: fb}, nil
+}
+
+func decodeCoAPGetDownload(vars map[string]string, _ func(v interface{}) error) (interface{}, error) {
+	return GetDownloadHttpRequest{Bid: vars["bid"], Ver: vars["ver"], File: vars["file"]}, nil
+}
+
+func decodeCoAPGetInstalledBase(vars map[string]string, _ func(v interface{}) error) (interface{}, error) {
+	return GetInstalledBaseRequest{Bid: vars["bid"], Acid: vars["acid"]}, nil
+}
+
+func decodeCoAPGetConfirmationBase(vars map[string]string, _ func(v interface{}) error) (interface{}, error) {
+	return GetConfirmationBaseRequest{Bid: vars["bid"]}, nil
+}
+
+func decodeCoAPGetConfirmationBaseAction(vars map[string]string, _ func(v interface{}) error) (interface{}, error) {
+	return GetConfirmationBaseActionRequest{Bid: vars["bid"], Acid: vars["acid"]}, nil
+}
+
+func decodeCoAPConfirmationBaseFeedback(vars map[string]string, payload func(v interface{}) error) (interface{}, error) {
+	var fb ConfirmationFeedback
+	if err := payload(&fb); err != nil {
+		return nil, err
+	}
+	return PostConfirmationBaseFeedbackRequest{Bid: vars["bid"], Acid: vars["acid"], Fb: fb}, nil
+}
+
+func decodeCoAPActivateAutoConfirm(vars map[string]string, payload func(v interface{}) error) (interface{}, error) {
+	var ac AutoConfirmActivation
+	// The activation details are optional, as over HTTP.
+	if err := payload(&ac); err != nil && err != errCoAPEmpty {
+		return nil, err
+	}
+	return PostActivateAutoConfirmRequest{Bid: vars["bid"], Ac: ac}, nil
+}
+
+func decodeCoAPDeactivateAutoConfirm(vars map[string]string, _ func(v interface{}) error) (interface{}, error) {
+	return PostDeactivateAutoConfirmRequest{Bid: vars["bid"]}, nil
+}
@@ -0,0 +1,311 @@
+package backend
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/fxamacker/cbor/v2"
+	"github.com/go-kit/kit/log"
+	"github.com/jonathanyhliang/hawkbit-fota/deployment"
+	"github.com/pion/dtls/v2"
+	"github.com/stretchr/testify/assert"
+)
+
+type coapTestClient struct {
+	t    *testing.T
+	conn net.Conn
+	mid  uint16
+}
+
+func (c *coapTestClient) do(req coapMessage) coapMessage {
+	c.mid++
+	req.typ, req.id, req.token = coapCON, c.mid, []byte{0xca, 0xfe}
+	_, err := c.conn.Write(req.marshal())
+	assert.Equal(c.t, nil, err)
+	buf := make([]byte, coapMaxDatagram)
+	c.conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	n, err := c.conn.Read(buf)
+	assert.Equal(c.t, nil, err)
+	resp, err := parseCoAP(buf[:n])
+	assert.Equal(c.t, nil, err)
+	assert.Equal(c.t, coapACK, resp.typ)
+	assert.Equal(c.t, c.mid, resp.id)
+	assert.Equal(c.t, req.token, resp.token)
+	return resp
+}
+
+func (c *coapTestClient) get(path string, accept int) coapMessage {
+	req := coapMessage{code: coapGET}
+	req.setPath(path)
+	if accept != 0 {
+		req.addUintOption(coapAccept, uint32(accept))
+	}
+	return c.do(req)
+}
+
+func newCoAPTestClient(t *testing.T) *coapTestClient {
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	assert.Equal(t, nil, err)
+	t.Cleanup(func() { pc.Close() })
+	go NewCoAPServer(NewHawkbitBackendService(), log.NewNopLogger()).Serve(pc)
+
+	conn, err := net.Dial("udp", pc.LocalAddr().String())
+	assert.Equal(t, nil, err)
+	t.Cleanup(func() { conn.Close() })
+	return &coapTestClient{t: t, conn: conn}
+}
+
+func TestCoAPMessage(t *testing.T) {
+	m := coapMessage{typ: coapNON, code: coapPOST, id: 0x1234, token: []byte{1, 2, 3}}
+	m.setPath("default/controller/v1/dev")
+	m.addUintOption(coapContentFormat, coapFormatCBOR)
+	m.addUintOption(coapSize1, 70000)
+	m.addOption(coapProxyUri, bytes.Repeat([]byte{'x'}, 300))
+	m.payload = []byte("{}")
+
+	p, err := parseCoAP(m.marshal())
+	assert.Equal(t, nil, err)
+	assert.Equal(t, m.typ, p.typ)
+	assert.Equal(t, m.code, p.code)
+	assert.Equal(t, m.id, p.id)
+	assert.Equal(t, m.token, p.token)
+	assert.Equal(t, []string{"default", "controller", "v1", "dev"}, p.path())
+	n, _ := p.uintOption(coapSize1)
+	assert.Equal(t, uint32(70000), n)
+	v, _ := p.option(coapProxyUri)
+	assert.Equal(t, 300, len(v))
+	assert.Equal(t, m.payload, p.payload)
+
+	_, err = parseCoAP([]byte{0x40, 0x01, 0x00, 0x01, 0xff})
+	assert.Equal(t, errCoAPFormat, err)
+}
+
+func TestServeCoAP(t *testing.T) {
+	c := newCoAPTestClient(t)
+
+	resp := c.get("default/controller/v1/coap-dev", 0)
+	assert.Equal(t, coapContent, resp.code)
+	f, _ := resp.uintOption(coapContentFormat)
+	assert.Equal(t, uint32(coapFormatJSON), f)
+	var ctrl Controller
+	assert.Equal(t, nil, json.Unmarshal(resp.payload, &ctrl))
+	assert.Equal(t, "00:05:00", ctrl.Config.Polling.Sleep)
+
+	resp = c.get("default/controller/v1/coap-dev", coapFormatCBOR)
+	assert.Equal(t, coapContent, resp.code)
+	ctrl = Controller{}
+	assert.Equal(t, nil, cbor.Unmarshal(resp.payload, &ctrl))
+	assert.Equal(t, "00:05:00", ctrl.Config.Polling.Sleep)
+
+	resp = c.get("default/controller/v1/coap-dev", 11050)
+	assert.Equal(t, coapNotAcceptable, resp.code)
+	resp = c.get("default/controller/v2/coap-dev", 0)
+	assert.Equal(t, coapNotFound, resp.code)
+	resp = c.get("default/controller/v1/coap-dev/deploymentBase/none", 0)
+	assert.Equal(t, coapCodeFromHTTP(404), resp.code)
+	assert.Contains(t, string(resp.payload), deployment.ErrDeploymentNotFound.Error())
+
+	req := coapMessage{code: coapPUT}
+	req.setPath("default/controller/v1/coap-dev")
+	assert.Equal(t, coapMethodNotAllowed, c.do(req).code)
+	req = coapMessage{code: coapGET}
+	req.setPath("default/controller/v1/coap-dev")
+	req.addOption(2049, nil)
+	assert.Equal(t, coapBadOption, c.do(req).code)
+
+	// Config data in CBOR.
+	req = coapMessage{code: coapPUT}
+	req.setPath("default/controller/v1/coap-dev/configData")
+	req.addUintOption(coapContentFormat, coapFormatCBOR)
+	req.payload, _ = cbor.Marshal(ConfigData{Data: map[string]string{deployment.AttributeBoard: "nrf52840dk"}})
+	assert.Equal(t, coapChanged, c.do(req).code)
+	assert.Equal(t, "nrf52840dk", deployment.GetAttributes("coap-dev")[deployment.AttributeBoard])
+	req.payload = []byte{0xff}
+	assert.Equal(t, coapCodeFromHTTP(400), c.do(req).code)
+}
+
+func TestServeCoAPBlockwise(t *testing.T) {
+	img := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b := make([]byte, 3000)
+		for i := range b {
+			b[i] = byte(i)
+		}
+		w.Write(b)
+	}))
+	defer img.Close()
+	assert.Equal(t, nil, deployment.SetUpload(deployment.Upload{Name: "coap", Version: "1.0.0", Url: img.URL}))
+	assert.Equal(t, nil, deployment.SetDistribution(deployment.Distribution{Name: "coap", Version: "1.0.0"}, "coap"))
+	assert.Equal(t, nil, deployment.SetDeployment("coap-blk", "coap", deployment.DeploymentOptions{}))
+	d, _ := deployment.GetDeployment("coap-blk")
+
+	c := newCoAPTestClient(t)
+	resp := c.get("default/controller/v1/coap-blk/deploymentBase/"+d.ActionId, 0)
+	assert.Equal(t, coapContent, resp.code)
+	var db DeploymentBase
+	assert.Equal(t, nil, json.Unmarshal(resp.payload, &db))
+	a := db.Deployment.Chunks[0].Artifacts[0]
+
+	want, err := NewHawkbitBackendService().GetDownloadHttp(context.Background(), "coap-blk", "1.0.0", "")
+	assert.Equal(t, nil, err)
+	assert.Equal(t, a.Size, len(want))
+
+	// The target asks for 512 byte blocks.
+	var got, etag []byte
+	for num := uint32(0); ; num++ {
+		req := coapMessage{code: coapGET}
+		req.setPath(a.Links.DownloadHttp.Href)
+		req.addUintOption(coapBlock2, coapBlock{num: num, szx: 5}.value())
+		resp := c.do(req)
+		assert.Equal(t, coapContent, resp.code)
+		v, ok := resp.uintOption(coapBlock2)
+		assert.True(t, ok)
+		blk := parseCoAPBlock(v)
+		assert.Equal(t, num, blk.num)
+		assert.Equal(t, 512, blk.size())
+		if num == 0 {
+			size, _ := resp.uintOption(coapSize2)
+			assert.Equal(t, uint32(len(want)), size)
+			etag, _ = resp.option(coapETag)
+		}
+		e, _ := resp.option(coapETag)
+		assert.Equal(t, etag, e)
+		got = append(got, resp.payload...)
+		if !blk.more {
+			break
+		}
+	}
+	assert.Equal(t, want, got)
+
+	// Without asking, large responses come in blocks of the default size.
+	resp = c.get(a.Links.DownloadHttp.Href, 0)
+	v, _ := resp.uintOption(coapBlock2)
+	assert.Equal(t, coapBlock{num: 0, more: true, szx: coapBlockSZX}, parseCoAPBlock(v))
+	assert.Equal(t, 1024, len(resp.payload))
+}
+
+func TestServeCoAPRetransmission(t *testing.T) {
+	s := NewCoAPServer(NewHawkbitBackendService(), log.NewNopLogger())
+
+	req := coapMessage{typ: coapCON, code: coapGET, id: 7}
+	req.setPath("default/controller/v1/coap-dup")
+	first := s.handle("peer", req.marshal())
+	assert.Equal(t, first, s.handle("peer", req.marshal()))
+	req.id = 8
+	assert.NotEqual(t, nil, s.handle("peer", req.marshal()))
+
+	ping := coapMessage{typ: coapCON, code: coapEmpty, id: 9}
+	resp, _ := parseCoAP(s.handle("peer", ping.marshal()))
+	assert.Equal(t, coapRST, resp.typ)
+	assert.Equal(t, uint16(9), resp.id)
+}
+
+func TestServeCoAPS(t *testing.T) {
+	psk := func([]byte) ([]byte, error) { return []byte{0x01, 0x02, 0x03, 0x04}, nil }
+	l, err := dtls.Listen("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)}, &dtls.Config{
+		PSK:             psk,
+		PSKIdentityHint: []byte("hawkbit"),
+		CipherSuites:    []dtls.CipherSuiteID{dtls.TLS_PSK_WITH_AES_128_CCM_8},
+	})
+	assert.Equal(t, nil, err)
+	defer l.Close()
+	go NewCoAPServer(NewHawkbitBackendService(), log.NewNopLogger()).ServeListener(l)
+
+	conn, err := dtls.Dial("udp", l.Addr().(*net.UDPAddr), &dtls.Config{
+		PSK:             psk,
+		PSKIdentityHint: []byte("coaps-dev"),
+		CipherSuites:    []dtls.CipherSuiteID{dtls.TLS_PSK_WITH_AES_128_CCM_8},
+	})
+	assert.Equal(t, nil, err)
+	defer conn.Close()
+
+	c := &coapTestClient{t: t, conn: conn}
+	resp := c.get("default/controller/v1/coaps-dev", 0)
+	assert.Equal(t, coapContent, resp.code)
+}
+
+func TestServeCoAPFeedbackAction(t *testing.T) {
+	img := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("coap feedback image"))
+	}))
+	defer img.Close()
+	assert.Equal(t, nil, deployment.SetUpload(deployment.Upload{Name: "coap-fb", Version: "1.0.0", Url: img.URL}))
+	assert.Equal(t, nil, deployment.SetDistribution(deployment.Distribution{Name: "coap-fb", Version: "1.0.0"}, "coap-fb"))
+	assert.Equal(t, nil, deployment.SetDeployment("coap-fb-dev", "coap-fb", deployment.DeploymentOptions{}))
+	d, _ := deployment.GetDeployment("coap-fb-dev")
+
+	c := newCoAPTestClient(t)
+	post := func(path string, body string) uint8 {
+		req := coapMessage{code: coapPOST}
+		req.setPath("default/controller/v1/coap-fb-dev/" + path)
+		req.payload = []byte(body)
+		return c.do(req).code
+	}
+	proceeding := `"status":{"execution":"proceeding","result":{"finished":"none"}}}`
+	for _, r := range []string{"deploymentBase", "cancelAction"} {
+		// The id in the body must not name another action than the path.
+		assert.Equal(t, coapCodeFromHTTP(400), post(r+"/"+d.ActionId+"/feedback", `{"id":"0000000",`+proceeding))
+		assert.Equal(t, coapCodeFromHTTP(400), post(r+"/0000000/feedback", `{"id":"`+d.ActionId+`",`+proceeding))
+		assert.Equal(t, coapCodeFromHTTP(400), post(r+"/0000000/feedback", `{`+proceeding))
+		assert.Equal(t, coapChanged, post(r+"/"+d.ActionId+"/feedback", `{`+proceeding))
+	}
+	d, _ = deployment.GetDeployment("coap-fb-dev")
+	assert.Equal(t, "proceeding", d.Status.Execution)
+}
+
+func TestCoAPBodyBounds(t *testing.T) {
+	c := NewCoAPServer(NewHawkbitBackendService(), log.NewNopLogger())
+	at := time.Now()
+	buf := make([]byte, coapPeerBodyBytes+1)
+	keep := func(peer string, key string, size int) {
+		at = at.Add(time.Millisecond)
+		c.keepBody(peer+" "+key, coapBody{peer: peer, body: buf[:size], at: at})
+	}
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	// A peer keeps its most recent bodies only.
+	for i := 0; i < coapPeerBodies+2; i++ {
+		keep("a", strconv.Itoa(i), 10)
+	}
+	assert.Equal(t, coapPeerBodies, len(c.bodies))
+	_, ok := c.bodies["a 0"]
+	assert.False(t, ok)
+	_, ok = c.bodies["a "+strconv.Itoa(coapPeerBodies+1)]
+	assert.True(t, ok)
+	keep("a", "big", coapPeerBodyBytes-15)
+	assert.Equal(t, coapUsage{n: 2, bytes: coapPeerBodyBytes - 5}, c.peers["a"])
+	keep("a", "huge", coapPeerBodyBytes+1)
+	_, ok = c.bodies["a huge"]
+	assert.False(t, ok)
+
+	// Other peers are evicted oldest first to stay within the total.
+	for p := 0; p < coapBodyBytes/coapPeerBodyBytes+1; p++ {
+		keep(strconv.Itoa(p), "big", coapPeerBodyBytes)
+	}
+	assert.Equal(t, coapBodyBytes, c.bodyBytes)
+	_, ok = c.peers["a"]
+	assert.False(t, ok)
+	_, ok = c.peers["0"]
+	assert.False(t, ok)
+	for p := 0; p < coapBodies+1; p++ {
+		keep("small-"+strconv.Itoa(p), "", 1)
+	}
+	assert.Equal(t, coapBodies, len(c.bodies))
+	total := 0
+	for _, b := range c.bodies {
+		total += len(b.body)
+	}
+	assert.Equal(t, total, c.bodyBytes)
+	for k := range c.bodies {
+		c.dropBody(k)
+	}
+	assert.Equal(t, 0, c.bodyBytes)
+	assert.Empty(t, c.peers)
+}
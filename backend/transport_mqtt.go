@@ -0,0 +1,243 @@
+package backend
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+	"time"
+
+	paho "github.com/eclipse/paho.mqtt.golang"
+	"github.com/go-kit/kit/endpoint"
+	"github.com/go-kit/kit/log"
+	"github.com/jonathanyhliang/hawkbit-fota/deployment"
+)
+
+// MQTTTopicPrefix roots the topics of the MQTT transport. Targets publish
+// requests to hawkbit/{bid}/{resource}/{method}, feedback about an action to
+// hawkbit/{bid}/{resource}/{acid}/feedback, and receive replies on
+// hawkbit/{bid}/{resource}. Failed requests are answered on hawkbit/{bid}/error
+// with the error and the HTTP status code the DDI API would have returned.
+const MQTTTopicPrefix = "hawkbit"
+
+// mqttTimeout bounds waiting for the broker to acknowledge a request.
+const mqttTimeout = 10 * time.Second
+
+var (
+	ErrBackendMQTTTimeout = errors.New("Backend: MQTT broker did not respond in time")
+)
+
+type mqttRoute struct {
+	// method is matched against the topic below hawkbit/{bid}; a + level
+	// matches the action id.
+	method   string
+	endpoint endpoint.Endpoint
+	decode   func(bid string, acid string, payload []byte) (interface{}, error)
+	// reply is the resource replies are published to, if any.
+	reply string
+}
+
+// ServeMQTT answers the DDI requests targets publish via c, and pushes each
+// new assignment to hawkbit/{bid}/deploymentBase as a retained message, so
+// sleeping targets receive it as soon as they reconnect. The retained message
+// is cleared once the target is done with the action. Artifacts are still
+// downloaded from the HTTP links in the deployment base. The returned
+// function stops serving.
+func ServeMQTT(s BackendService, c paho.Client, logger log.Logger) (func(), error) {
+	e := MakeBackendServerEndpoints(s)
+	routes := []mqttRoute{
+		{"controller/get", e.GetControllerEndpoint, decodeMQTTGetController, "controller"},
+		{"deploymentBase/get", e.GetDeploymentBaseEndpoint, decodeMQTTGetDeploymentBase, "deploymentBase"},
+		{"deploymentBase/+/feedback", e.PostDeploymentBaseFeedbackEndpoint, decodeMQTTDeploymentBaseFeedback, ""},
+		{"cancelAction/+/feedback", e.PostCancelActionFeebackEndpoint, decodeMQTTCancelActionFeedback, ""},
+		{"configData/put", e.PutConfigDataEndpoint, decodeMQTTPutConfigData, ""},
+	}
+	filters := map[string]byte{}
+	for _, r := range routes {
+		filters[MQTTTopicPrefix+"/+/"+r.method] = 1
+	}
+	handle := func(_ paho.Client, m paho.Message) {
+		bid, method, ok := splitMQTTTopic(m.Topic())
+		if !ok {
+			return
+		}
+		for _, r := range routes {
+			if acid, ok := matchMQTTMethod(r.method, method); ok {
+				serveMQTT(c, r, bid, acid, m.Payload(), logger)
+				return
+			}
+		}
+	}
+	t := c.SubscribeMultiple(filters, handle)
+	if !t.WaitTimeout(mqttTimeout) {
+		return nil, ErrBackendMQTTTimeout
+	}
+	if t.Error() != nil {
+		return nil, t.Error()
+	}
+
+	sub := deployment.Subscribe(1024, func(m deployment.Message) {
+		switch m := m.(type) {
+		case deployment.DeploymentAssigned:
+			pushMQTTDeploymentBase(c, e.GetDeploymentBaseEndpoint, m.Deployment, logger)
+		case deployment.StatusChanged:
+			if m.After.Terminal() && !m.Before.Terminal() {
+				clearMQTT(c, m.Target, "deploymentBase", logger)
+			}
+		}
+	})
+	return func() {
+		sub.Close()
+		topics := make([]string, 0, len(filters))
+		for f := range filters {
+			topics = append(topics, f)
+		}
+		c.Unsubscribe(topics...).WaitTimeout(mqttTimeout)
+	}, nil
+}
+
+func splitMQTTTopic(topic string) (bid string, method string, ok bool) {
+	p := strings.SplitN(topic, "/", 3)
+	if len(p) != 3 || p[0] != MQTTTopicPrefix || p[1] == "" {
+		return "", "", false
+	}
+	return p[1], p[2], true
+}
+
+// matchMQTTMethod matches method against the pattern of a route, returning
+// the action id a + level stands for.
+func matchMQTTMethod(pattern string, method string) (acid string, ok bool) {
+	ps, ms := strings.Split(pattern, "/"), strings.Split(method, "/")
+	if len(ps) != len(ms) {
+		return "", false
+	}
+	for i, p := range ps {
+		switch {
+		case p == "+" && ms[i] != "":
+			acid = ms[i]
+		case p != ms[i]:
+			return "", false
+		}
+	}
+	return acid, true
+}
+
+func serveMQTT(c paho.Client, r mqttRoute, bid string, acid string, payload []byte, logger log.Logger) {
+	ctx := deployment.WithActor(context.Background(), "target/"+bid)
+	req, err := r.decode(bid, acid, payload)
+	if err != nil {
+		publishMQTTError(c, bid, r.method, err, logger)
+		return
+	}
+	resp, err := r.endpoint(ctx, req)
+	if err == nil {
+		if e, ok := resp.(errorer); ok {
+			err = e.error()
+		}
+	}
+	if err != nil {
+		publishMQTTError(c, bid, r.method, err, logger)
+		return
+	}
+	if r.reply != "" {
+		publishMQTT(c, bid, r.reply, false, responseBody(resp), logger)
+	}
+}
+
+func pushMQTTDeploymentBase(c paho.Client, e endpoint.Endpoint, d deployment.Deployment, logger log.Logger) {
+	ctx := context.Background()
+	resp, err := e(ctx, GetDeplymentBaseRequest{Bid: d.Target, Acid: d.ActionId})
+	if err == nil {
+		err = resp.(errorer).error()
+	}
+	if err != nil {
+		// Actions awaiting confirmation are picked up on the next poll.
+		logger.Log("mqtt", "push", "bid", d.Target, "acid", d.ActionId, "err", err)
+		return
+	}
+	publishMQTT(c, d.Target, "deploymentBase", true, responseBody(resp), logger)
+}
+
+func publishMQTTError(c paho.Client, bid string, method string, err error, logger log.Logger) {
+	publishMQTT(c, bid, "error", false, map[string]interface{}{
+		"request": method,
+		"error":   err.Error(),
+		"code":    codeFrom(err),
+	}, logger)
+}
+
+// publishMQTT publishes v without waiting for the broker, as message handlers
+// must not block.
+func publishMQTT(c paho.Client, bid string, resource string, retained bool, v interface{}, logger log.Logger) {
+	b, err := json.Marshal(v)
+	if err != nil {
+		logger.Log("mqtt", resource, "bid", bid, "err", err)
+		return
+	}
+	publishMQTTPayload(c, bid, resource, retained, b, logger)
+}
+
+// clearMQTT removes the retained message of resource, by publishing an
+// empty retained one.
+func clearMQTT(c paho.Client, bid string, resource string, logger log.Logger) {
+	publishMQTTPayload(c, bid, resource, true, []byte{}, logger)
+}
+
+func publishMQTTPayload(c paho.Client, bid string, resource string, retained bool, b []byte, logger log.Logger) {
+	t := c.Publish(MQTTTopicPrefix+"/"+bid+"/"+resource, 1, retained, b)
+	go func() {
+		err := ErrBackendMQTTTimeout
+		if t.WaitTimeout(mqttTimeout) {
+			err = t.Error()
+		}
+		if err != nil {
+			logger.Log("mqtt", resource, "bid", bid, "err", err)
+		}
+	}()
+}
+
+func decodeMQTTGetController(bid string, _ string, _ []byte) (interface{}, error) {
+	return GetControllerRequest{Bid: bid}, nil
+}
+
+func decodeMQTTGetDeploymentBase(bid string, _ string, payload []byte) (interface{}, error) {
+	var r struct {
+		ActionId string `json:"actionId"`
+	}
+	if err := json.Unmarshal(payload, &r); err != nil || r.ActionId == "" {
+		return nil, ErrBackendBadRequest
+	}
+	return GetDeplymentBaseRequest{Bid: bid, Acid: r.ActionId}, nil
+}
+
+func decodeMQTTDeploymentBaseFeedback(bid string, acid string, payload []byte) (interface{}, error) {
+	var fb DeploymentBaseFeedback
+	if err := json.Unmarshal(payload, &fb); err != nil {
+		return nil, ErrBackendBadRequest
+	}
+	var err error
+	if fb.ID, err = feedbackAction(acid, fb.ID); err != nil {
+		return nil, err
+	}
+	return PostDeploymentBaseFeedbackRequest{Bid: bid, Fb: fb}, nil
+}
+
+func decodeMQTTCancelActionFeedback(bid string, acid string, payload []byte) (interface{}, error) {
+	var fb CancelActionFeedback
+	if err := json.Unmarshal(payload, &fb); err != nil {
+		return nil, ErrBackendBadRequest
+	}
+	var err error
+	if fb.ID, err = feedbackAction(acid, fb.ID); err != nil {
+		return nil, err
+	}
+	return PostCancelActionFeedbackRequest{Bid: bid, Fb: fb}, nil
+}
+
+func decodeMQTTPutConfigData(bid string, _ string, payload []byte) (interface{}, error) {
+	var cfg ConfigData
+	if err := json.Unmarshal(payload, &cfg); err != nil {
+		return nil, ErrBackendBadRequest
+	}
+	return PutConfigDataRequest{Bid: bid, Cfg: cfg}, nil
+}
@@ -0,0 +1,141 @@
+package backend
+
+import (
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	paho "github.com/eclipse/paho.mqtt.golang"
+	"github.com/go-kit/kit/log"
+	"github.com/jonathanyhliang/hawkbit-fota/deployment"
+	mochi "github.com/mochi-mqtt/server/v2"
+	"github.com/mochi-mqtt/server/v2/hooks/auth"
+	"github.com/mochi-mqtt/server/v2/listeners"
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestBroker(t *testing.T) string {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.Equal(t, nil, err)
+	addr := l.Addr().String()
+	l.Close()
+
+	b := mochi.New(nil)
+	b.AddHook(new(auth.AllowHook), nil)
+	assert.Equal(t, nil, b.AddListener(listeners.NewTCP("tcp", addr, nil)))
+	go b.Serve()
+	t.Cleanup(func() { b.Close() })
+	return "tcp://" + addr
+}
+
+func newTestClient(t *testing.T, broker string, id string) paho.Client {
+	c := paho.NewClient(paho.NewClientOptions().AddBroker(broker).SetClientID(id))
+	tk := c.Connect()
+	assert.True(t, tk.WaitTimeout(5*time.Second))
+	assert.Equal(t, nil, tk.Error())
+	t.Cleanup(func() { c.Disconnect(0) })
+	return c
+}
+
+func TestServeMQTT(t *testing.T) {
+	broker := newTestBroker(t)
+	stop, err := ServeMQTT(NewHawkbitBackendService(), newTestClient(t, broker, "server"), log.NewNopLogger())
+	assert.Equal(t, nil, err)
+	defer stop()
+
+	msgs := make(chan paho.Message, 16)
+	dev := newTestClient(t, broker, "mqtt-dev")
+	dev.Subscribe("hawkbit/mqtt-dev/#", 1, func(_ paho.Client, m paho.Message) {
+		if !strings.HasSuffix(m.Topic(), "/get") && !strings.HasSuffix(m.Topic(), "/feedback") {
+			msgs <- m
+		}
+	}).Wait()
+	next := func() paho.Message {
+		select {
+		case m := <-msgs:
+			return m
+		case <-time.After(5 * time.Second):
+			t.Fatal("no message received")
+			return nil
+		}
+	}
+
+	dev.Publish("hawkbit/mqtt-dev/controller/get", 1, false, "").Wait()
+	m := next()
+	assert.Equal(t, "hawkbit/mqtt-dev/controller", m.Topic())
+	var c Controller
+	assert.Equal(t, nil, json.Unmarshal(m.Payload(), &c))
+	assert.Equal(t, "00:05:00", c.Config.Polling.Sleep)
+
+	// Assignments are pushed without the target asking.
+	img := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write(make([]byte, 1024))
+	}))
+	defer img.Close()
+	assert.Equal(t, nil, deployment.SetUpload(deployment.Upload{Name: "mqtt", Version: "1.0.0", Url: img.URL}))
+	assert.Equal(t, nil, deployment.SetDistribution(deployment.Distribution{Name: "mqtt", Version: "1.0.0"}, "mqtt"))
+	assert.Equal(t, nil, deployment.SetDeployment("mqtt-dev", "mqtt", deployment.DeploymentOptions{}))
+	m = next()
+	assert.Equal(t, "hawkbit/mqtt-dev/deploymentBase", m.Topic())
+	var db DeploymentBase
+	assert.Equal(t, nil, json.Unmarshal(m.Payload(), &db))
+	assert.Equal(t, "forced", db.Deployment.Update)
+
+	// The push is retained for targets that were offline.
+	retained := make(chan paho.Message, 1)
+	late := newTestClient(t, broker, "mqtt-late")
+	late.Subscribe("hawkbit/mqtt-dev/deploymentBase", 1, func(_ paho.Client, m paho.Message) {
+		retained <- m
+	}).Wait()
+	select {
+	case m := <-retained:
+		assert.True(t, m.Retained())
+	case <-time.After(5 * time.Second):
+		t.Fatal("no retained deployment base")
+	}
+	d, _ := deployment.GetDeployment("mqtt-dev")
+
+	feedback := "hawkbit/mqtt-dev/deploymentBase/" + d.ActionId + "/feedback"
+	dev.Publish(feedback, 1, false, "{").Wait()
+	m = next()
+	assert.Equal(t, "hawkbit/mqtt-dev/error", m.Topic())
+	assert.Contains(t, string(m.Payload()), `"code":400`)
+
+	// Feedback must be about the action of its topic.
+	fb := `{"id":"0000000","status":{"execution":"closed","result":{"finished":"success"}}}`
+	dev.Publish(feedback, 1, false, fb).Wait()
+	m = next()
+	assert.Equal(t, "hawkbit/mqtt-dev/error", m.Topic())
+	assert.Contains(t, string(m.Payload()), `"code":400`)
+	dev.Publish("hawkbit/mqtt-dev/deploymentBase/0000000/feedback", 1, false,
+		`{"status":{"execution":"closed","result":{"finished":"success"}}}`).Wait()
+	m = next()
+	assert.Equal(t, "hawkbit/mqtt-dev/error", m.Topic())
+	assert.Contains(t, string(m.Payload()), `"code":400`)
+
+	fb = `{"status":{"execution":"closed","result":{"finished":"success"}}}`
+	dev.Publish(feedback, 1, false, fb).Wait()
+	assert.Eventually(t, func() bool {
+		i, err := deployment.GetInstalled("mqtt-dev")
+		return err == nil && i.ActionId == d.ActionId
+	}, 5*time.Second, 10*time.Millisecond)
+
+	// Once the action is closed, its retained push is cleared.
+	m = next()
+	assert.Equal(t, "hawkbit/mqtt-dev/deploymentBase", m.Topic())
+	assert.Empty(t, m.Payload())
+	cleared := make(chan paho.Message, 1)
+	later := newTestClient(t, broker, "mqtt-later")
+	later.Subscribe("hawkbit/mqtt-dev/deploymentBase", 1, func(_ paho.Client, m paho.Message) {
+		cleared <- m
+	}).Wait()
+	select {
+	case m := <-cleared:
+		t.Fatalf("retained deployment base left: %s", m.Payload())
+	case <-time.After(200 * time.Millisecond):
+	}
+}
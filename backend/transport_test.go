@@ -0,0 +1,242 @@
+package backend
+
+import (
+	"encoding/json"
+	"flag"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/go-kit/kit/log"
+	"github.com/jonathanyhliang/hawkbit-fota/deployment"
+	"github.com/stretchr/testify/assert"
+)
+
+var update = flag.Bool("update", false, "update the golden files in testdata")
+
+// The fields the hawkBit DDI API documents for each resource, as dotted
+// paths into the response body.
+var (
+	ddiController = []string{"config.polling.sleep", "_links.configData.href"}
+	ddiDeployment = []string{"id", "deployment.download", "deployment.update", "deployment.chunks.0.part",
+		"deployment.chunks.0.name", "deployment.chunks.0.version", "deployment.chunks.0.artifacts.0.filename",
+		"deployment.chunks.0.artifacts.0.hashes.sha256", "deployment.chunks.0.artifacts.0.hashes.sha1",
+		"deployment.chunks.0.artifacts.0.hashes.md5", "deployment.chunks.0.artifacts.0.size",
+		"deployment.chunks.0.artifacts.0._links.download-http.href"}
+	ddiConfirmation = []string{"id", "confirmation.download", "confirmation.update", "confirmation.chunks.0.part",
+		"confirmation.chunks.0.name", "confirmation.chunks.0.version",
+		"confirmation.chunks.0.artifacts.0.filename", "confirmation.chunks.0.artifacts.0.hashes.sha256",
+		"confirmation.chunks.0.artifacts.0.hashes.sha1", "confirmation.chunks.0.artifacts.0.hashes.md5",
+		"confirmation.chunks.0.artifacts.0.size", "confirmation.chunks.0.artifacts.0._links.download-http.href"}
+	ddiConfirmationBase = []string{"autoConfirm.active", "_links"}
+)
+
+// ddiAbsent lists, by case, the fields a response must leave out because
+// the resource they belong to is not on offer.
+var ddiAbsent = map[string][]string{
+	"controller-unknown-target":        {"_links.deploymentBase", "_links.installedBase", "_links.cancelAction"},
+	"controller-installed":             {"_links.deploymentBase", "_links.cancelAction"},
+	"controller-awaiting-confirmation": {"_links.deploymentBase", "_links.cancelAction"},
+	"controller-confirmed":             {"_links.cancelAction"},
+	"confirmation-base":                {"_links.deactivateAutoConfirm"},
+	"confirmation-base-auto-confirm":   {"_links.activateAutoConfirm"},
+}
+
+// lookup walks a dotted path of object keys and array indices into v,
+// returning what it finds there.
+func lookup(v interface{}, path string) (interface{}, bool) {
+	for _, k := range strings.Split(path, ".") {
+		switch n := v.(type) {
+		case map[string]interface{}:
+			var ok bool
+			if v, ok = n[k]; !ok {
+				return nil, false
+			}
+		case []interface{}:
+			i, err := strconv.Atoi(k)
+			if err != nil || i >= len(n) {
+				return nil, false
+			}
+			v = n[i]
+		default:
+			return nil, false
+		}
+	}
+	return v, true
+}
+
+// emptyHrefs lists the paths below path of the links in v going nowhere.
+func emptyHrefs(v interface{}, path string) []string {
+	var empty []string
+	switch n := v.(type) {
+	case map[string]interface{}:
+		for k, c := range n {
+			if k == "href" && c == "" {
+				empty = append(empty, path)
+			}
+			empty = append(empty, emptyHrefs(c, path+"."+k)...)
+		}
+	case []interface{}:
+		for i, c := range n {
+			empty = append(empty, emptyHrefs(c, path+"."+strconv.Itoa(i))...)
+		}
+	}
+	return empty
+}
+
+func TestDDIConformance(t *testing.T) {
+	image := []byte("ddi conformance image")
+	img := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write(image)
+	}))
+	defer img.Close()
+	assert.Equal(t, nil, deployment.SetUpload(deployment.Upload{Name: "ddi", Version: "1.0.0", Url: img.URL}))
+	assert.Equal(t, nil, deployment.SetDistribution(deployment.Distribution{Name: "ddi", Version: "1.0.0"}, "ddi"))
+	assert.Equal(t, nil, deployment.SetDeployment("ddi-dev", "ddi", deployment.DeploymentOptions{}))
+	assert.Equal(t, nil, deployment.SetDeployment("ddi-confirm", "ddi",
+		deployment.DeploymentOptions{ConfirmationRequired: true}))
+	d, err := deployment.GetDeployment("ddi-dev")
+	assert.Equal(t, nil, err)
+	acid := d.ActionId
+
+	const (
+		dev     = "/default/controller/v1/ddi-dev/"
+		confirm = "/default/controller/v1/ddi-confirm/"
+		unknown = "/default/controller/v1/ddi-unknown/"
+		modules = "/DEFAULT/controller/v1/ddi-dev/softwareModules/"
+	)
+	feedback := func(id string, execution string, finished string) string {
+		return `{"id":"` + id + `","status":{"execution":"` + execution + `","result":{"finished":"` +
+			finished + `"}}}`
+	}
+
+	// The cases run in order against the same store, each one taking the
+	// targets from where the previous ones left them. The store outlives a
+	// run, so no case may depend on a target not having installed anything
+	// yet.
+	cases := []struct {
+		name   string
+		method string
+		path   string
+		body   string
+		code   int
+		// fields lists the DDI fields of the resource in the response.
+		fields []string
+		// raw, if set, is the response body of a non-JSON resource.
+		raw []byte
+	}{
+		{"controller-unknown-target", "GET", strings.TrimSuffix(unknown, "/"), "", 200, ddiController, nil},
+		{"config-data", "PUT", dev + "configData", `{"mode":"merge","data":{"board":"nrf52840dk"}}`, 200, nil, nil},
+		{"config-data-bad-mode", "PUT", dev + "configData", `{"mode":"append","data":{}}`, 400, nil, nil},
+		{"config-data-malformed", "PUT", dev + "configData", `{"data":`, 400, nil, nil},
+
+		{"deployment-base", "GET", dev + "deploymentBase/" + acid, "", 200, ddiDeployment, nil},
+		{"deployment-base-wrong-action", "GET", dev + "deploymentBase/0000000", "", 400, nil, nil},
+		{"deployment-base-unknown-target", "GET", unknown + "deploymentBase/" + acid, "", 404, nil, nil},
+		{"download", "GET", modules + "1.0.0", "", 200, nil, image},
+		{"download-wrong-version", "GET", modules + "2.0.0", "", 400, nil, nil},
+		{"download-unknown-artifact", "GET", modules + "1.0.0/artifacts/ddi.bin.gz", "", 404, nil, nil},
+
+		{"feedback", "POST", dev + "deploymentBase/" + acid + "/feedback",
+			`{"id":"` + acid + `","status":{"execution":"proceeding","result":{"finished":"none",` +
+				`"progress":{"cnt":1,"of":3}}}}`, 200, nil, nil},
+		{"feedback-wrong-action", "POST", dev + "deploymentBase/0000000/feedback",
+			feedback("0000000", "proceeding", "none"), 400, nil, nil},
+		{"feedback-mismatched-id", "POST", dev + "deploymentBase/" + acid + "/feedback",
+			feedback("0000000", "proceeding", "none"), 400, nil, nil},
+		{"feedback-unknown-target", "POST", unknown + "deploymentBase/" + acid + "/feedback",
+			feedback(acid, "proceeding", "none"), 404, nil, nil},
+		{"feedback-unknown-execution", "POST", dev + "deploymentBase/" + acid + "/feedback",
+			feedback(acid, "installing", "none"), 400, nil, nil},
+		{"feedback-unknown-result", "POST", dev + "deploymentBase/" + acid + "/feedback",
+			feedback(acid, "closed", "done"), 400, nil, nil},
+		{"feedback-malformed", "POST", dev + "deploymentBase/" + acid + "/feedback",
+			`{"id":"` + acid + `","status":`, 400, nil, nil},
+		{"feedback-closed", "POST", dev + "deploymentBase/" + acid + "/feedback",
+			`{"status":{"execution":"closed","result":{"finished":"success"}}}`, 200, nil, nil},
+
+		{"controller-installed", "GET", strings.TrimSuffix(dev, "/"), "", 200, ddiController, nil},
+		{"installed-base", "GET", dev + "installedBase/" + acid, "", 200, ddiDeployment, nil},
+		{"installed-base-wrong-action", "GET", dev + "installedBase/0000000", "", 400, nil, nil},
+		{"installed-base-unknown-target", "GET", unknown + "installedBase/" + acid, "", 404, nil, nil},
+
+		{"cancel-feedback", "POST", dev + "cancelAction/" + acid + "/feedback",
+			feedback(acid, "closed", "success"), 200, nil, nil},
+		{"cancel-feedback-wrong-action", "POST", dev + "cancelAction/0000000/feedback",
+			feedback("0000000", "closed", "success"), 400, nil, nil},
+		{"cancel-feedback-unknown-target", "POST", unknown + "cancelAction/" + acid + "/feedback",
+			feedback(acid, "closed", "success"), 404, nil, nil},
+		{"cancel-feedback-malformed", "POST", dev + "cancelAction/" + acid + "/feedback", `[]`, 400, nil, nil},
+
+		{"controller-awaiting-confirmation", "GET", strings.TrimSuffix(confirm, "/"), "", 200, ddiController, nil},
+		{"confirmation-base", "GET", confirm + "confirmationBase", "", 200, ddiConfirmationBase, nil},
+		{"confirmation-base-action", "GET", confirm + "confirmationBase/" + acid, "", 200, ddiConfirmation, nil},
+		{"confirmation-base-wrong-action", "GET", confirm + "confirmationBase/0000000", "", 400, nil, nil},
+		{"confirmation-base-unknown-target", "GET", unknown + "confirmationBase/" + acid, "", 404, nil, nil},
+		{"deployment-base-unconfirmed", "GET", confirm + "deploymentBase/" + acid, "", 409, nil, nil},
+		{"confirmation-feedback-wrong-action", "POST", confirm + "confirmationBase/0000000/feedback",
+			`{"confirmation":"confirmed"}`, 400, nil, nil},
+		{"confirmation-feedback-unknown-value", "POST", confirm + "confirmationBase/" + acid + "/feedback",
+			`{"confirmation":"maybe"}`, 400, nil, nil},
+		{"confirmation-feedback-unknown-target", "POST", unknown + "confirmationBase/" + acid + "/feedback",
+			`{"confirmation":"confirmed"}`, 404, nil, nil},
+		{"confirmation-feedback-malformed", "POST", confirm + "confirmationBase/" + acid + "/feedback",
+			`{"confirmation":1}`, 400, nil, nil},
+		{"confirmation-feedback", "POST", confirm + "confirmationBase/" + acid + "/feedback",
+			`{"confirmation":"confirmed","code":0,"details":["ok"]}`, 200, nil, nil},
+		{"controller-confirmed", "GET", strings.TrimSuffix(confirm, "/"), "", 200, ddiController, nil},
+
+		{"activate-auto-confirm", "POST", confirm + "confirmationBase/activateAutoConfirm",
+			`{"initiator":"ci","remark":"conformance"}`, 200, nil, nil},
+		{"activate-auto-confirm-malformed", "POST", confirm + "confirmationBase/activateAutoConfirm",
+			`{"initiator":`, 400, nil, nil},
+		{"confirmation-base-auto-confirm", "GET", confirm + "confirmationBase", "", 200, ddiConfirmationBase, nil},
+		{"deactivate-auto-confirm", "POST", confirm + "confirmationBase/deactivateAutoConfirm", "", 200, nil, nil},
+	}
+
+	h := MakeBackendHTTPHandler(NewHawkbitBackendService(), log.NewNopLogger())
+	for _, c := range cases {
+		ok := t.Run(c.name, func(t *testing.T) {
+			req := httptest.NewRequest(c.method, c.path, strings.NewReader(c.body))
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, req)
+			assert.Equal(t, c.code, w.Code)
+			if c.raw != nil {
+				assert.Equal(t, c.raw, w.Body.Bytes())
+				return
+			}
+			assert.Equal(t, "application/json; charset=utf-8", w.Header().Get("Content-Type"))
+
+			var v interface{}
+			assert.Equal(t, nil, json.Unmarshal(w.Body.Bytes(), &v))
+			got, _ := json.MarshalIndent(v, "", "  ")
+			got = append(got, '\n')
+			golden := filepath.Join("testdata", c.name+".json")
+			if *update {
+				assert.Equal(t, nil, os.WriteFile(golden, got, 0644))
+			}
+			want, err := os.ReadFile(golden)
+			assert.Equal(t, nil, err)
+			assert.Equal(t, string(want), string(got))
+
+			for _, f := range c.fields {
+				r, ok := lookup(v, f)
+				assert.True(t, ok, "missing DDI field %s", f)
+				assert.NotEqual(t, "", r, "empty DDI field %s", f)
+			}
+			for _, f := range ddiAbsent[c.name] {
+				_, ok := lookup(v, f)
+				assert.False(t, ok, "unexpected DDI field %s", f)
+			}
+			assert.Empty(t, emptyHrefs(v, ""), "links going nowhere")
+		})
+		if !ok {
+			// Later cases depend on the state this one left.
+			break
+		}
+	}
+}
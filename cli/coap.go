@@ -0,0 +1,35 @@
+package main
+
+import (
+	"crypto/tls"
+	"encoding/hex"
+	"errors"
+
+	"github.com/pion/dtls/v2"
+)
+
+// newDTLSConfig returns the DTLS configuration of the CoAP listener: a
+// pre-shared key given in hex shared by all targets, a certificate and key
+// in PEM files, or both.
+func newDTLSConfig(psk string, certFile string, keyFile string) (*dtls.Config, error) {
+	var c dtls.Config
+	if psk != "" {
+		k, err := hex.DecodeString(psk)
+		if err != nil || len(k) == 0 {
+			return nil, errors.New("invalid pre-shared key")
+		}
+		c.PSK = func([]byte) ([]byte, error) { return k, nil }
+		c.PSKIdentityHint = []byte("hawkbit-fota")
+	}
+	if certFile != "" || keyFile != "" {
+		cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+		if err != nil {
+			return nil, err
+		}
+		c.Certificates = []tls.Certificate{cert}
+	}
+	if c.PSK == nil && c.Certificates == nil {
+		return nil, errors.New("neither pre-shared key nor certificate given")
+	}
+	return &c, nil
+}
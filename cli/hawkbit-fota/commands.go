@@ -0,0 +1,294 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jonathanyhliang/hawkbit-fota/client"
+	"github.com/jonathanyhliang/hawkbit-fota/deployment"
+)
+
+// parse parses the flags of a command and checks the required ones are
+// given.
+func parse(fs *flag.FlagSet, args []string, required ...string) error {
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	for _, n := range required {
+		if fs.Lookup(n).Value.String() == "" {
+			return fmt.Errorf("-%s is required", n)
+		}
+	}
+	return nil
+}
+
+// list splits a comma separated flag value.
+func list(s string) []string {
+	if s == "" {
+		return nil
+	}
+	return strings.Split(s, ",")
+}
+
+func uploadPush(ctx context.Context, c *client.Client, p printer, args []string) error {
+	fs := flag.NewFlagSet("upload push", flag.ContinueOnError)
+	var (
+		name       = fs.String("name", "", "Upload name")
+		version    = fs.String("version", "", "Image version")
+		file       = fs.String("file", "", "URL the frontend fetches the image from")
+		sign       = fs.Bool("sign", false, "Sign the raw build with the signing key of the frontend")
+		headerSize = fs.Int("header-size", 0, "MCUboot header size of the signed image")
+		loadAddr   = fs.Uint("load-addr", 0, "Load address of the signed image")
+		compress   = fs.String("compress", "", "Comma separated encodings to store: gzip, lz4, heatshrink")
+	)
+	if err := parse(fs, args, "name", "version", "file"); err != nil {
+		return err
+	}
+	req := client.PostUploadRequest{Name: *name, Version: *version, File: *file, Compress: list(*compress)}
+	if *sign {
+		req.Sign = &deployment.SignParams{HeaderSize: *headerSize, LoadAddr: uint32(*loadAddr)}
+	}
+	if err := c.PostUpload(ctx, req); err != nil {
+		return err
+	}
+	return showUpload(ctx, c, p, *name)
+}
+
+func uploadShow(ctx context.Context, c *client.Client, p printer, args []string) error {
+	fs := flag.NewFlagSet("upload show", flag.ContinueOnError)
+	name := fs.String("name", "", "Upload name")
+	if err := parse(fs, args, "name"); err != nil {
+		return err
+	}
+	return showUpload(ctx, c, p, *name)
+}
+
+func showUpload(ctx context.Context, c *client.Client, p printer, name string) error {
+	u, err := c.GetUpload(ctx, name)
+	if err != nil {
+		return err
+	}
+	return p.print(u, []string{"NAME", "VERSION", "SIZE", "SHA256", "SIGNED BY"},
+		[][]string{{u.Name, u.Version, strconv.Itoa(u.Size), u.Sha256, u.SignedBy}})
+}
+
+func distCreate(ctx context.Context, c *client.Client, p printer, args []string) error {
+	fs := flag.NewFlagSet("dist create", flag.ContinueOnError)
+	var (
+		name    = fs.String("name", "", "Distribution name")
+		version = fs.String("version", "", "Distribution version")
+		upload  = fs.String("upload", "", "Upload to distribute")
+		key     = fs.String("key", "", "Trusted key the upload must be signed with")
+		variant = fs.String("variant", "", "Artifact variant: original or signed")
+		boards  = fs.String("boards", "", "Comma separated boards the distribution is compatible with")
+		hw      = fs.String("hw-revisions", "", "Comma separated hardware revisions the distribution is compatible with")
+	)
+	if err := parse(fs, args, "name", "version", "upload"); err != nil {
+		return err
+	}
+	req := client.PostDistributionRequest{Name: *name, Version: *version, Upload: *upload, Key: *key,
+		Variant: *variant}
+	if *boards != "" || *hw != "" {
+		req.Compatible = &deployment.Compatibility{Boards: list(*boards), HwRevisions: list(*hw)}
+	}
+	if err := c.PostDistribution(ctx, req); err != nil {
+		return err
+	}
+	return showDist(ctx, c, p, *name)
+}
+
+func distShow(ctx context.Context, c *client.Client, p printer, args []string) error {
+	fs := flag.NewFlagSet("dist show", flag.ContinueOnError)
+	name := fs.String("name", "", "Distribution name")
+	if err := parse(fs, args, "name"); err != nil {
+		return err
+	}
+	return showDist(ctx, c, p, *name)
+}
+
+func showDist(ctx context.Context, c *client.Client, p printer, name string) error {
+	d, err := c.GetDistribution(ctx, name)
+	if err != nil {
+		return err
+	}
+	return p.print(d, []string{"NAME", "VERSION", "UPLOAD", "VARIANT", "KEY"},
+		[][]string{{d.Name, d.Version, d.Upload.Name, d.Variant, d.Key}})
+}
+
+func deployAssign(ctx context.Context, c *client.Client, p printer, args []string) error {
+	fs := flag.NewFlagSet("deploy assign", flag.ContinueOnError)
+	var (
+		target    = fs.String("target", "", "Target name")
+		dist      = fs.String("dist", "", "Distribution to assign")
+		typ       = fs.String("type", "", "Action type: forced, soft, downloadonly or timeforced")
+		forceTime = fs.String("forcetime", "", "RFC 3339 time a timeforced action becomes forced")
+		confirm   = fs.Bool("confirm", false, "Require confirmation on the target")
+		schedule  = fs.String("maintenance", "", "Cron schedule of the maintenance window")
+		duration  = fs.String("maintenance-duration", "", "Duration of the maintenance window (hh:mm:ss)")
+		timezone  = fs.String("maintenance-timezone", "+00:00", "Timezone of the maintenance window")
+	)
+	if err := parse(fs, args, "target", "dist"); err != nil {
+		return err
+	}
+	req := client.PostDeploymentRequest{Target: *target, Distribution: *dist, Type: *typ,
+		ForceTime: *forceTime, ConfirmationRequired: *confirm}
+	if *schedule != "" {
+		req.Maintenance = &deployment.MaintenanceWindow{Schedule: *schedule, Duration: *duration,
+			Timezone: *timezone}
+	}
+	if err := c.PostDeployment(ctx, req); err != nil {
+		return err
+	}
+	d, err := c.GetDeployment(ctx, *target)
+	if err != nil {
+		return err
+	}
+	return printDeployments(p, d)
+}
+
+// errDeploymentFailed is the error of a watched deployment which finished
+// unsuccessfully.
+var errDeploymentFailed = errors.New("deployment failed")
+
+func deployStatus(ctx context.Context, c *client.Client, p printer, args []string) error {
+	fs := flag.NewFlagSet("deploy status", flag.ContinueOnError)
+	var (
+		target = fs.String("target", "", "Target name")
+		watch  = fs.Bool("watch", false, "Print each change until the target is done with the action")
+	)
+	if err := parse(fs, args, "target"); err != nil {
+		return err
+	}
+	if !*watch {
+		d, err := c.GetDeployment(ctx, *target)
+		if err != nil {
+			return err
+		}
+		return printDeployments(p, d)
+	}
+
+	// Subscribe before reading the deployment, so no change in between is
+	// missed.
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	es, err := c.GetEvents(ctx, deployment.EventFilter{Target: *target})
+	if err != nil {
+		return err
+	}
+	var last string
+	for {
+		d, err := c.GetDeployment(ctx, *target)
+		if err != nil && !errors.Is(err, deployment.ErrDeploymentNotFound) {
+			return err
+		}
+		if err == nil {
+			// Several events may leave the status as it was.
+			if s := fmt.Sprint(d.ActionId, d.Status.Execution, d.Status.Result.Finished,
+				d.Status.Result.Progress); s != last {
+				last = s
+				if err := printDeployments(p, d); err != nil {
+					return err
+				}
+			}
+			if d.Done() {
+				if !d.Succeeded() {
+					return errDeploymentFailed
+				}
+				return nil
+			}
+		}
+		if err := waitAction(ctx, es); err != nil {
+			return err
+		}
+	}
+}
+
+// pollInterval bounds how long a watch waits for events, which a slow
+// client may miss, before reading the deployments again.
+const pollInterval = 30 * time.Second
+
+// waitAction waits for the next action event of a stream, or pollInterval
+// at most.
+func waitAction(ctx context.Context, es <-chan deployment.Event) error {
+	t := time.NewTimer(pollInterval)
+	defer t.Stop()
+	for {
+		select {
+		case e, ok := <-es:
+			if !ok {
+				if ctx.Err() != nil {
+					return ctx.Err()
+				}
+				return errors.New("event stream closed")
+			}
+			if strings.HasPrefix(e.Type, "action.") {
+				return nil
+			}
+		case <-t.C:
+			return nil
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+func printDeployments(p printer, ds ...deployment.Deployment) error {
+	var rows [][]string
+	for _, d := range ds {
+		progress := ""
+		if g := d.Status.Result.Progress; g != nil {
+			progress = fmt.Sprintf("%d/%d", g.Cnt, g.Of)
+		}
+		rows = append(rows, []string{d.Target, d.ActionId, d.Artifact.Name, d.Artifact.Version, d.Type,
+			d.Status.Execution, d.Status.Result.Finished, progress})
+	}
+	var v interface{} = ds
+	if len(ds) == 1 {
+		v = ds[0]
+	}
+	return p.print(v, []string{"TARGET", "ACTION", "DISTRIBUTION", "VERSION", "TYPE", "EXECUTION", "FINISHED",
+		"PROGRESS"}, rows)
+}
+
+func targetsList(ctx context.Context, c *client.Client, p printer, args []string) error {
+	fs := flag.NewFlagSet("targets ls", flag.ContinueOnError)
+	if err := parse(fs, args); err != nil {
+		return err
+	}
+	ts, err := c.GetTargets(ctx)
+	if err != nil {
+		return err
+	}
+	var rows [][]string
+	for _, t := range ts {
+		assigned, installed, poll := "", "", ""
+		if t.Assigned != nil {
+			assigned = t.Assigned.Name + " " + t.Assigned.Version
+		}
+		if t.Installed != nil {
+			installed = t.Installed.Name + " " + t.Installed.Version
+		}
+		if t.LastPoll != nil {
+			poll = t.LastPoll.Format(time.RFC3339)
+		}
+		rows = append(rows, []string{t.Name, assigned, installed, poll, strings.Join(t.Tags, ",")})
+	}
+	return p.print(ts, []string{"NAME", "ASSIGNED", "INSTALLED", "LAST POLL", "TAGS"}, rows)
+}
+
+func targetsTag(ctx context.Context, c *client.Client, p printer, args []string) error {
+	fs := flag.NewFlagSet("targets tag", flag.ContinueOnError)
+	var (
+		target = fs.String("target", "", "Target name")
+		tags   = fs.String("tags", "", "Comma separated tags, none to remove them all")
+	)
+	if err := parse(fs, args, "target"); err != nil {
+		return err
+	}
+	return c.PutTags(ctx, *target, list(*tags))
+}
@@ -0,0 +1,169 @@
+// Command hawkbit-fota manages the uploads, distributions and deployments of
+// a running frontend.
+//
+//	hawkbit-fota [-config file] [-endpoint url] [-api-key key] [-o table|json] <command> [flags]
+//
+// The endpoint, API key and actor default to the JSON config file, by
+// default hawkbit-fota/config.json in the user configuration directory:
+//
+//	{"endpoint": "http://localhost:8080", "apiKey": "...", "actor": "release"}
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/jonathanyhliang/hawkbit-fota/client"
+)
+
+type config struct {
+	Endpoint string `json:"endpoint"`
+	APIKey   string `json:"apiKey"`
+	Actor    string `json:"actor"`
+}
+
+// loadConfig reads the config file at path. A missing file at the default
+// path is no error.
+func loadConfig(path string, explicit bool) (config, error) {
+	var c config
+	b, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) && !explicit {
+		return c, nil
+	}
+	if err != nil {
+		return c, err
+	}
+	if err := json.Unmarshal(b, &c); err != nil {
+		return c, fmt.Errorf("%s: %w", path, err)
+	}
+	return c, nil
+}
+
+func defaultConfigPath() string {
+	d, err := os.UserConfigDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(d, "hawkbit-fota", "config.json")
+}
+
+// printer writes results as JSON or as a table.
+type printer struct {
+	w    io.Writer
+	json bool
+}
+
+// print writes v as JSON, or else the rows under header.
+func (p printer) print(v interface{}, header []string, rows [][]string) error {
+	if p.json {
+		e := json.NewEncoder(p.w)
+		e.SetIndent("", "  ")
+		return e.Encode(v)
+	}
+	tw := tabwriter.NewWriter(p.w, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(tw, strings.Join(header, "\t"))
+	for _, r := range rows {
+		fmt.Fprintln(tw, strings.Join(r, "\t"))
+	}
+	return tw.Flush()
+}
+
+type command struct {
+	name  string
+	usage string
+	run   func(ctx context.Context, c *client.Client, p printer, args []string) error
+}
+
+var commands = []command{
+	{"upload push", "add an upload fetched by the frontend from a URL", uploadPush},
+	{"upload show", "show an upload", uploadShow},
+	{"dist create", "create a distribution of an upload", distCreate},
+	{"dist show", "show a distribution", distShow},
+	{"deploy assign", "assign a distribution to a target", deployAssign},
+	{"deploy status", "show, or with -watch follow, the deployment of a target", deployStatus},
+	{"targets ls", "list targets", targetsList},
+	{"targets tag", "replace the tags of a target", targetsTag},
+	{"rollout start", "assign a distribution to targets in waves", rolloutStart},
+	{"rollout ls", "list rollouts and their state", rolloutList},
+}
+
+func usage() {
+	fmt.Fprintf(os.Stderr, "Usage: hawkbit-fota [flags] <command> [command flags]\n\nCommands:\n")
+	for _, c := range commands {
+		fmt.Fprintf(os.Stderr, "  %-15s %s\n", c.name, c.usage)
+	}
+	fmt.Fprintf(os.Stderr, "\nFlags:\n")
+	flag.PrintDefaults()
+}
+
+func main() {
+	var (
+		ConfigFile = flag.String("config", "", "Config file (default "+defaultConfigPath()+")")
+		Endpoint   = flag.String("endpoint", "", "Frontend base URL, overriding the config file")
+		APIKey     = flag.String("api-key", "", "API key, overriding the config file")
+		Output     = flag.String("o", "table", "Output format: table or json")
+	)
+	flag.Usage = usage
+	flag.Parse()
+
+	args := flag.Args()
+	if len(args) < 2 {
+		usage()
+		os.Exit(2)
+	}
+	var cmd *command
+	for i := range commands {
+		if commands[i].name == args[0]+" "+args[1] {
+			cmd = &commands[i]
+		}
+	}
+	if cmd == nil {
+		fmt.Fprintf(os.Stderr, "hawkbit-fota: unknown command %q\n", args[0]+" "+args[1])
+		usage()
+		os.Exit(2)
+	}
+	if *Output != "table" && *Output != "json" {
+		fmt.Fprintf(os.Stderr, "hawkbit-fota: unknown output format %q\n", *Output)
+		os.Exit(2)
+	}
+
+	path := *ConfigFile
+	if path == "" {
+		path = defaultConfigPath()
+	}
+	cfg, err := loadConfig(path, *ConfigFile != "")
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "hawkbit-fota: %v\n", err)
+		os.Exit(1)
+	}
+	if *Endpoint != "" {
+		cfg.Endpoint = *Endpoint
+	}
+	if *APIKey != "" {
+		cfg.APIKey = *APIKey
+	}
+	if cfg.Endpoint == "" {
+		cfg.Endpoint = "http://localhost:8080"
+	}
+	options := []client.Option{client.WithAPIKey(cfg.APIKey)}
+	if cfg.Actor != "" {
+		options = append(options, client.WithActor(cfg.Actor))
+	}
+	c := client.New(cfg.Endpoint, options...)
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	if err := cmd.run(ctx, c, printer{w: os.Stdout, json: *Output == "json"}, args[2:]); err != nil {
+		fmt.Fprintf(os.Stderr, "hawkbit-fota %s: %v\n", cmd.name, err)
+		os.Exit(1)
+	}
+}
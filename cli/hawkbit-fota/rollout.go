@@ -0,0 +1,158 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jonathanyhliang/hawkbit-fota/client"
+	"github.com/jonathanyhliang/hawkbit-fota/deployment"
+)
+
+// rolloutStart assigns a distribution to targets in waves. A wave is
+// assigned once the targets of the previous one are done with their actions,
+// and the rollout stops when more than -max-failures actions did not succeed
+// or once -timeout elapsed. The state of the rollout is reported to the
+// server as it goes, which notifies webhooks when it pauses or finishes.
+func rolloutStart(ctx context.Context, c *client.Client, p printer, args []string) error {
+	fs := flag.NewFlagSet("rollout start", flag.ContinueOnError)
+	var (
+		name        = fs.String("name", "", "Rollout name, by default the distribution and the start time")
+		dist        = fs.String("dist", "", "Distribution to roll out")
+		targets     = fs.String("targets", "", "Comma separated targets")
+		all         = fs.Bool("all", false, "Roll out to all known targets")
+		wave        = fs.Int("wave", 10, "Targets per wave")
+		maxFailures = fs.Int("max-failures", 0, "Failed actions tolerated before the rollout stops")
+		typ         = fs.String("type", "", "Action type: forced, soft, downloadonly or timeforced")
+		confirm     = fs.Bool("confirm", false, "Require confirmation on the targets")
+		timeout     = fs.Duration("timeout", 24*time.Hour, "Time the whole rollout may take, 0 for no limit")
+	)
+	if err := parse(fs, args, "dist"); err != nil {
+		return err
+	}
+	if *wave < 1 {
+		return errors.New("-wave must be positive")
+	}
+	ts := list(*targets)
+	if *all {
+		known, err := c.GetTargets(ctx)
+		if err != nil {
+			return err
+		}
+		for _, t := range known {
+			ts = append(ts, t.Name)
+		}
+	}
+	if len(ts) == 0 {
+		return errors.New("-targets or -all is required")
+	}
+	if *name == "" {
+		*name = *dist + "-" + time.Now().Format("20060102-150405")
+	}
+
+	// Subscribe before the first assignment, so no change is missed.
+	var cancel context.CancelFunc
+	parent := ctx
+	if *timeout > 0 {
+		ctx, cancel = context.WithTimeout(ctx, *timeout)
+	} else {
+		ctx, cancel = context.WithCancel(ctx)
+	}
+	defer cancel()
+	es, err := c.GetEvents(ctx, deployment.EventFilter{Rollout: *name})
+	if err != nil {
+		return err
+	}
+	var done []deployment.Deployment
+	failures := 0
+	r := deployment.Rollout{Name: *name, Distribution: *dist, Targets: ts}
+	// report tells the server about the rollout. It uses the context of the
+	// command, so a rollout which timed out can still be reported paused.
+	report := func(state string, reason string) error {
+		r.State, r.Failures, r.Reason = state, failures, reason
+		return c.PutRollout(parent, r)
+	}
+	// stop prints the actions done so far and reports the rollout paused
+	// for err, which ended it early.
+	stop := func(err error) error {
+		printDeployments(p, done...)
+		if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			err = errors.New("rollout timed out")
+		}
+		if rerr := report(deployment.RolloutPaused, err.Error()); rerr != nil {
+			fmt.Fprintf(os.Stderr, "rollout %s: %v\n", *name, rerr)
+		}
+		return err
+	}
+	fmt.Fprintf(os.Stderr, "rollout %s\n", *name)
+	for i := 0; i < len(ts); i += *wave {
+		w := ts[i:]
+		if len(w) > *wave {
+			w = w[:*wave]
+		}
+		r.Wave = i / *wave + 1
+		if err := report(deployment.RolloutRunning, ""); err != nil {
+			return stop(err)
+		}
+		fmt.Fprintf(os.Stderr, "wave %d: %s\n", r.Wave, strings.Join(w, ", "))
+		for _, t := range w {
+			err := c.PostDeployment(ctx, client.PostDeploymentRequest{Target: t, Distribution: *dist,
+				Type: *typ, ConfirmationRequired: *confirm})
+			if err != nil {
+				return stop(fmt.Errorf("%s: %w", t, err))
+			}
+		}
+		pending := w
+		for len(pending) > 0 {
+			var open []string
+			for _, t := range pending {
+				d, err := c.GetDeployment(ctx, t)
+				if err != nil {
+					return stop(fmt.Errorf("%s: %w", t, err))
+				}
+				if !d.Done() {
+					open = append(open, t)
+					continue
+				}
+				done = append(done, d)
+				if !d.Succeeded() {
+					failures++
+				}
+			}
+			if pending = open; len(pending) > 0 {
+				if err := waitAction(ctx, es); err != nil {
+					return stop(err)
+				}
+			}
+		}
+		if failures > *maxFailures {
+			return stop(fmt.Errorf("%d actions failed, rollout stopped after wave %d", failures, r.Wave))
+		}
+	}
+	if err := report(deployment.RolloutFinished, ""); err != nil {
+		return err
+	}
+	return printDeployments(p, done...)
+}
+
+func rolloutList(ctx context.Context, c *client.Client, p printer, args []string) error {
+	fs := flag.NewFlagSet("rollout ls", flag.ContinueOnError)
+	if err := parse(fs, args); err != nil {
+		return err
+	}
+	rs, err := c.GetRollouts(ctx)
+	if err != nil {
+		return err
+	}
+	var rows [][]string
+	for _, r := range rs {
+		rows = append(rows, []string{r.Name, r.Distribution, r.State, strconv.Itoa(r.Wave),
+			strconv.Itoa(len(r.Targets)), strconv.Itoa(r.Failures), r.Reason})
+	}
+	return p.print(rs, []string{"NAME", "DISTRIBUTION", "STATE", "WAVE", "TARGETS", "FAILURES", "REASON"}, rows)
+}
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/jonathanyhliang/hawkbit-fota/client"
+	"github.com/jonathanyhliang/hawkbit-fota/deployment"
+	"github.com/jonathanyhliang/hawkbit-fota/frontend"
+	"github.com/stretchr/testify/assert"
+)
+
+// devices stands in for the targets of a rollout. Each closes the actions
+// assigned to it with its result a little later, or never if it has none.
+type devices struct {
+	mtx      sync.Mutex
+	assigned map[string]time.Time
+	closed   map[string]time.Time
+}
+
+func startDevices(t *testing.T, results map[string]string) *devices {
+	d := &devices{assigned: map[string]time.Time{}, closed: map[string]time.Time{}}
+	s := deployment.Subscribe(64, func(m deployment.Message) {
+		switch m := m.(type) {
+		case deployment.DeploymentAssigned:
+			r, ok := results[m.Deployment.Target]
+			if !ok {
+				return
+			}
+			d.mtx.Lock()
+			d.assigned[m.Deployment.Target] = m.Time
+			d.mtx.Unlock()
+			if r == "" {
+				return
+			}
+			go func(tgt string, acid string) {
+				time.Sleep(20 * time.Millisecond)
+				var st deployment.Status
+				st.Execution, st.Result.Finished = "closed", r
+				deployment.UpdateStatus(tgt, acid, st)
+			}(m.Deployment.Target, m.Deployment.ActionId)
+		case deployment.StatusChanged:
+			if _, ok := results[m.Target]; ok && m.After.Execution == "closed" {
+				d.mtx.Lock()
+				d.closed[m.Target] = m.Time
+				d.mtx.Unlock()
+			}
+		}
+	})
+	t.Cleanup(s.Close)
+	return d
+}
+
+// newRolloutTest returns a client of a frontend offering distribution
+// cli-rollout, and a name unique to the test.
+func newRolloutTest(t *testing.T) (*client.Client, string) {
+	ctx := context.Background()
+	assert.Equal(t, nil, deployment.SetUploadImage(ctx, deployment.Upload{Name: "cli-rollout", Version: "1.0.0"},
+		make([]byte, 1024)))
+	assert.Equal(t, nil, deployment.SetDistribution(deployment.Distribution{Name: "cli-rollout",
+		Version: "1.0.0"}, "cli-rollout"))
+	s := httptest.NewServer(frontend.MakeFrontendHTTPHandler(frontend.NewHawkbitFrontendService(),
+		log.NewNopLogger()))
+	t.Cleanup(s.Close)
+	return client.New(s.URL), t.Name() + "-" + time.Now().Format("150405.000000000")
+}
+
+func TestRolloutWaves(t *testing.T) {
+	c, id := newRolloutTest(t)
+	a, b, d := id+"-a", id+"-b", id+"-c"
+	devs := startDevices(t, map[string]string{a: "success", b: "success", d: "success"})
+
+	var out bytes.Buffer
+	err := rolloutStart(context.Background(), c, printer{w: &out}, []string{"-name", id, "-dist", "cli-rollout",
+		"-targets", a + "," + b + "," + d, "-wave", "2"})
+	assert.Equal(t, nil, err)
+	assert.Contains(t, out.String(), d)
+
+	// The second wave is assigned once the first is done.
+	devs.mtx.Lock()
+	assert.True(t, devs.assigned[d].After(devs.closed[a]))
+	assert.True(t, devs.assigned[d].After(devs.closed[b]))
+	devs.mtx.Unlock()
+	r, err := deployment.GetRollout(id)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, deployment.RolloutFinished, r.State)
+	assert.Equal(t, 2, r.Wave)
+	assert.Equal(t, 0, r.Failures)
+}
+
+func TestRolloutFailures(t *testing.T) {
+	c, id := newRolloutTest(t)
+	a, b, d := id+"-a", id+"-b", id+"-c"
+	devs := startDevices(t, map[string]string{a: "failure", b: "success", d: "success"})
+
+	err := rolloutStart(context.Background(), c, printer{w: &bytes.Buffer{}}, []string{"-name", id,
+		"-dist", "cli-rollout", "-targets", a + "," + b + "," + d, "-wave", "2"})
+	assert.EqualError(t, err, "1 actions failed, rollout stopped after wave 1")
+
+	devs.mtx.Lock()
+	_, assigned := devs.assigned[d]
+	devs.mtx.Unlock()
+	assert.False(t, assigned)
+	r, err := deployment.GetRollout(id)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, deployment.RolloutPaused, r.State)
+	assert.Equal(t, 1, r.Wave)
+	assert.Equal(t, 1, r.Failures)
+	assert.Equal(t, "1 actions failed, rollout stopped after wave 1", r.Reason)
+}
+
+func TestRolloutTimeout(t *testing.T) {
+	c, id := newRolloutTest(t)
+	silent := id + "-a"
+	startDevices(t, map[string]string{silent: ""})
+
+	err := rolloutStart(context.Background(), c, printer{w: &bytes.Buffer{}}, []string{"-name", id,
+		"-dist", "cli-rollout", "-targets", silent, "-timeout", "200ms"})
+	assert.EqualError(t, err, "rollout timed out")
+	r, err := deployment.GetRollout(id)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, deployment.RolloutPaused, r.State)
+	assert.Equal(t, "rollout timed out", r.Reason)
+}
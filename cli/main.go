@@ -1,17 +1,30 @@
 package main
 
 import (
+	"context"
 	"flag"
 	"fmt"
+	"net"
 	"net/http"
 	"os"
 	"os/signal"
 	"syscall"
+	"time"
 
+	paho "github.com/eclipse/paho.mqtt.golang"
+	kitprometheus "github.com/go-kit/kit/metrics/prometheus"
 	"github.com/go-kit/log"
 	backend "github.com/jonathanyhliang/hawkbit-fota/backend"
+	"github.com/jonathanyhliang/hawkbit-fota/deployment"
 	"github.com/jonathanyhliang/hawkbit-fota/docs"
 	frontend "github.com/jonathanyhliang/hawkbit-fota/frontend"
+	"github.com/jonathanyhliang/hawkbit-fota/frontend/pb"
+	"github.com/pion/dtls/v2"
+	stdprometheus "github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+	"google.golang.org/grpc"
 )
 
 //	@title		Hawkbit FOTA Service API
@@ -26,9 +39,46 @@ func main() {
 	var (
 		BackendAddr  = flag.String("b", "", "Backend HTTP listen address")
 		FrontendAddr = flag.String("f", "", "Frontend HTTP listen address")
+		GRPCAddr     = flag.String("grpc", "", "Frontend gRPC listen address")
+		FetchTimeout = flag.Duration("fetch-timeout", deployment.DefaultFetchPolicy.Timeout, "Image fetch timeout")
+		FetchRetries = flag.Int("fetch-retries", deployment.DefaultFetchPolicy.Retries, "Image fetch retries")
+		FetchBackoff = flag.Duration("fetch-backoff", deployment.DefaultFetchPolicy.Backoff, "Initial delay between image fetch retries")
+		FetchMaxSize = flag.Int64("fetch-maxsize", deployment.DefaultFetchPolicy.MaxSize, "Maximum image size in bytes")
+		HookTimeout  = flag.Duration("webhook-timeout", deployment.DefaultWebhookPolicy.Timeout, "Webhook delivery timeout")
+		HookRetries  = flag.Int("webhook-retries", deployment.DefaultWebhookPolicy.Retries, "Webhook delivery retries")
+		HookBackoff  = flag.Duration("webhook-backoff", deployment.DefaultWebhookPolicy.Backoff, "Initial delay between webhook delivery retries")
+		AuditKeep    = flag.Int("audit-retention", deployment.DefaultAuditRetention, "Number of latest audit entries kept")
+		TrustedKeys  = flag.String("keys", "", "Directory of PEM public keys uploads must be signed with")
+		SigningKey   = flag.String("signkey", "", "PEM private key used to sign raw builds")
+		AdminAddr    = flag.String("admin", "", "Admin HTTP listen address serving /metrics")
+		OnlineWindow = flag.Duration("online-window", 10*time.Minute, "Time since last poll targets count as online")
+		OtlpEndpoint = flag.String("otlp", "", "OTLP/HTTP trace collector address (host:port)")
+		OtlpInsecure = flag.Bool("otlp-insecure", false, "Export traces over plain HTTP")
+		MQTTBroker   = flag.String("mqtt", "", "MQTT broker URL serving the backend to targets (tcp://host:port)")
+		MQTTClientId = flag.String("mqtt-client-id", "hawkbit-fota", "MQTT client identifier")
+		CoAPAddr     = flag.String("coap", "", "Backend CoAP (UDP) listen address")
+		CoAPSAddr    = flag.String("coaps", "", "Backend CoAP over DTLS listen address")
+		CoAPSPsk     = flag.String("coaps-psk", "", "Hex encoded DTLS pre-shared key")
+		CoAPSCert    = flag.String("coaps-cert", "", "PEM certificate of the DTLS listener")
+		CoAPSKey     = flag.String("coaps-key", "", "PEM private key of the DTLS listener")
+		LwM2MAddr    = flag.String("lwm2m", "", "LwM2M server (UDP) listen address")
+		LwM2MPackage = flag.String("lwm2m-package-url", "", "Base URL of the backend LwM2M clients download packages from")
 	)
 	flag.Parse()
 
+	deployment.SetFetchPolicy(deployment.FetchPolicy{
+		Timeout: *FetchTimeout,
+		Retries: *FetchRetries,
+		Backoff: *FetchBackoff,
+		MaxSize: *FetchMaxSize,
+	})
+	deployment.SetWebhookPolicy(deployment.WebhookPolicy{
+		Timeout: *HookTimeout,
+		Retries: *HookRetries,
+		Backoff: *HookBackoff,
+	})
+	deployment.SetAuditRetention(*AuditKeep)
+
 	errs := make(chan error)
 
 	var logger log.Logger
@@ -38,16 +88,86 @@ func main() {
 		logger = log.With(logger, "caller", log.DefaultCaller)
 	}
 
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(
+		propagation.TraceContext{}, propagation.Baggage{}))
+	if *OtlpEndpoint != "" {
+		tp, err := newTracerProvider(context.Background(), *OtlpEndpoint, *OtlpInsecure)
+		if err != nil {
+			logger.Log("otlp", *OtlpEndpoint, "err", err)
+			os.Exit(1)
+		}
+		defer tp.Shutdown(context.Background())
+		otel.SetTracerProvider(tp)
+	}
+
+	if *TrustedKeys != "" {
+		if err := deployment.LoadTrustedKeys(*TrustedKeys); err != nil {
+			logger.Log("keys", *TrustedKeys, "err", err)
+			os.Exit(1)
+		}
+	}
+
+	if *SigningKey != "" {
+		if err := deployment.LoadSigningKey(*SigningKey); err != nil {
+			logger.Log("signkey", *SigningKey, "err", err)
+			os.Exit(1)
+		}
+	}
+
 	var bs backend.BackendService
 	{
 		bs = backend.NewHawkbitBackendService()
+		bs = backend.AuditBackendMiddleware()(bs)
+		bs = backend.TracingBackendMiddleware()(bs)
 		bs = backend.LoggingBackendMiddleware(logger)(bs)
+		if *AdminAddr != "" {
+			labels := []string{"method", "error"}
+			bs = backend.InstrumentingBackendMiddleware(
+				kitprometheus.NewCounterFrom(stdprometheus.CounterOpts{
+					Namespace: "hawkbit",
+					Subsystem: "backend",
+					Name:      "requests_total",
+					Help:      "Number of requests received.",
+				}, labels),
+				kitprometheus.NewHistogramFrom(stdprometheus.HistogramOpts{
+					Namespace: "hawkbit",
+					Subsystem: "backend",
+					Name:      "request_duration_seconds",
+					Help:      "Time spent processing requests.",
+				}, labels),
+				kitprometheus.NewCounterFrom(stdprometheus.CounterOpts{
+					Namespace: "hawkbit",
+					Subsystem: "backend",
+					Name:      "served_bytes_total",
+					Help:      "Number of artifact bytes served to targets.",
+				}, []string{}),
+			)(bs)
+		}
 	}
 
 	var fs frontend.FrontendService
 	{
 		fs = frontend.NewHawkbitFrontendService()
+		fs = frontend.AuditFrontendMiddleware()(fs)
+		fs = frontend.TracingFrontendMiddleware()(fs)
 		fs = frontend.LoggingFrontendMiddleware(logger)(fs)
+		if *AdminAddr != "" {
+			labels := []string{"method", "error"}
+			fs = frontend.InstrumentingFrontendMiddleware(
+				kitprometheus.NewCounterFrom(stdprometheus.CounterOpts{
+					Namespace: "hawkbit",
+					Subsystem: "frontend",
+					Name:      "requests_total",
+					Help:      "Number of requests received.",
+				}, labels),
+				kitprometheus.NewHistogramFrom(stdprometheus.HistogramOpts{
+					Namespace: "hawkbit",
+					Subsystem: "frontend",
+					Name:      "request_duration_seconds",
+					Help:      "Time spent processing requests.",
+				}, labels),
+			)(fs)
+		}
 	}
 
 	var bh http.Handler
@@ -77,5 +197,107 @@ func main() {
 		errs <- http.ListenAndServe(*FrontendAddr, fh)
 	}()
 
+	if *GRPCAddr != "" {
+		l, err := net.Listen("tcp", *GRPCAddr)
+		if err != nil {
+			logger.Log("grpc", *GRPCAddr, "err", err)
+			os.Exit(1)
+		}
+		gs := grpc.NewServer()
+		pb.RegisterFrontendServer(gs, frontend.MakeFrontendGRPCServer(fs, log.With(logger, "component", "gRPC")))
+		go func() {
+			logger.Log("frontend", "gRPC", "addr", *GRPCAddr)
+			errs <- gs.Serve(l)
+		}()
+	}
+
+	if *CoAPAddr != "" || *CoAPSAddr != "" {
+		cs := backend.NewCoAPServer(bs, log.With(logger, "component", "CoAP"))
+		if *CoAPAddr != "" {
+			pc, err := net.ListenPacket("udp", *CoAPAddr)
+			if err != nil {
+				logger.Log("coap", *CoAPAddr, "err", err)
+				os.Exit(1)
+			}
+			go func() {
+				logger.Log("backend", "CoAP", "addr", *CoAPAddr)
+				errs <- cs.Serve(pc)
+			}()
+		}
+		if *CoAPSAddr != "" {
+			cfg, err := newDTLSConfig(*CoAPSPsk, *CoAPSCert, *CoAPSKey)
+			if err != nil {
+				logger.Log("coaps", *CoAPSAddr, "err", err)
+				os.Exit(1)
+			}
+			addr, err := net.ResolveUDPAddr("udp", *CoAPSAddr)
+			if err != nil {
+				logger.Log("coaps", *CoAPSAddr, "err", err)
+				os.Exit(1)
+			}
+			l, err := dtls.Listen("udp", addr, cfg)
+			if err != nil {
+				logger.Log("coaps", *CoAPSAddr, "err", err)
+				os.Exit(1)
+			}
+			go func() {
+				logger.Log("backend", "CoAPS", "addr", *CoAPSAddr)
+				errs <- cs.ServeListener(l)
+			}()
+		}
+	}
+
+	if *LwM2MAddr != "" {
+		if *LwM2MPackage == "" {
+			logger.Log("lwm2m", *LwM2MAddr, "err", "-lwm2m-package-url is required")
+			os.Exit(1)
+		}
+		pc, err := net.ListenPacket("udp", *LwM2MAddr)
+		if err != nil {
+			logger.Log("lwm2m", *LwM2MAddr, "err", err)
+			os.Exit(1)
+		}
+		ls := backend.NewLwM2MServer(bs, *LwM2MPackage, log.With(logger, "component", "LwM2M"))
+		go func() {
+			logger.Log("backend", "LwM2M", "addr", *LwM2MAddr)
+			errs <- ls.Serve(pc)
+		}()
+	}
+
+	if *MQTTBroker != "" {
+		c := paho.NewClient(paho.NewClientOptions().
+			AddBroker(*MQTTBroker).
+			SetClientID(*MQTTClientId).
+			SetOrderMatters(false))
+		if t := c.Connect(); t.Wait() && t.Error() != nil {
+			logger.Log("mqtt", *MQTTBroker, "err", t.Error())
+			os.Exit(1)
+		}
+		defer c.Disconnect(250)
+		stop, err := backend.ServeMQTT(bs, c, log.With(logger, "component", "MQTT"))
+		if err != nil {
+			logger.Log("mqtt", *MQTTBroker, "err", err)
+			os.Exit(1)
+		}
+		defer stop()
+		logger.Log("backend", "MQTT", "broker", *MQTTBroker)
+	}
+
+	if *AdminAddr != "" {
+		stdprometheus.MustRegister(newStatsCollector(*OnlineWindow))
+		events := countEvents(kitprometheus.NewCounterFrom(stdprometheus.CounterOpts{
+			Namespace: "hawkbit",
+			Name:      "events_total",
+			Help:      "Number of store events by type.",
+		}, []string{"event"}))
+		defer events.Close()
+		mux := http.NewServeMux()
+		mux.Handle("/metrics", promhttp.Handler())
+		go func() {
+			logger.Log("admin", "HTTP", "addr", *AdminAddr)
+			errs <- http.ListenAndServe(*AdminAddr, mux)
+		}()
+	}
+
 	logger.Log("exit", <-errs)
 }
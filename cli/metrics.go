@@ -0,0 +1,54 @@
+package main
+
+import (
+	"time"
+
+	"github.com/go-kit/kit/metrics"
+	"github.com/jonathanyhliang/hawkbit-fota/deployment"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// statsCollector exports the deployment store statistics, read fresh on
+// every scrape.
+type statsCollector struct {
+	window  time.Duration
+	online  *prometheus.Desc
+	actions *prometheus.Desc
+	dropped *prometheus.Desc
+}
+
+func newStatsCollector(window time.Duration) *statsCollector {
+	return &statsCollector{
+		window: window,
+		online: prometheus.NewDesc("hawkbit_targets_online",
+			"Number of targets that polled within the online window.", nil, nil),
+		actions: prometheus.NewDesc("hawkbit_actions",
+			"Number of current actions by execution state and result.", []string{"execution", "result"}, nil),
+		dropped: prometheus.NewDesc("hawkbit_webhook_events_dropped_total",
+			"Number of events never posted to webhooks because their queues were full.", nil, nil),
+	}
+}
+
+func (c *statsCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.online
+	ch <- c.actions
+	ch <- c.dropped
+}
+
+func (c *statsCollector) Collect(ch chan<- prometheus.Metric) {
+	s := deployment.GetStats(time.Now(), c.window)
+	ch <- prometheus.MustNewConstMetric(c.online, prometheus.GaugeValue, float64(s.TargetsOnline))
+	for k, n := range s.Actions {
+		ch <- prometheus.MustNewConstMetric(c.actions, prometheus.GaugeValue, float64(n), k[0], k[1])
+	}
+	ch <- prometheus.MustNewConstMetric(c.dropped, prometheus.CounterValue, float64(deployment.WebhookDropped()))
+}
+
+// countEvents counts the store events by type as they are published.
+func countEvents(c metrics.Counter) *deployment.Subscription {
+	return deployment.Subscribe(1024, func(m deployment.Message) {
+		for _, e := range deployment.Events(m) {
+			c.With("event", e.Type).Add(1)
+		}
+	})
+}
@@ -0,0 +1,88 @@
+// Command simulator runs virtual DDI targets against a backend and reports
+// request latency, errors and the outcome of their updates.
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/jonathanyhliang/hawkbit-fota/deployment"
+	"github.com/jonathanyhliang/hawkbit-fota/simulator"
+)
+
+func main() {
+	var (
+		BackendURL = flag.String("url", "http://localhost:8081", "Backend base URL")
+		Targets    = flag.Int("n", 10, "Number of targets")
+		Prefix     = flag.String("prefix", "sim", "Prefix of the target names")
+		Poll       = flag.Duration("poll", 0, "Time between polls (default: as the backend tells)")
+		Jitter     = flag.Duration("jitter", time.Second, "Largest random delay added to each poll")
+		Step       = flag.Duration("step", 2*time.Second, "Time spent downloading and installing each")
+		FailRate   = flag.Float64("fail-rate", 0, "Probability an update fails")
+		CancelRate = flag.Float64("cancel-rate", 0, "Probability a target cancels an update")
+		Board      = flag.String("board", "", "Board attribute reported by the targets")
+		HwRevision = flag.String("hw-revision", "", "Hardware revision attribute reported by the targets")
+		Duration   = flag.Duration("duration", 0, "Run time (default: until interrupted)")
+		Interval   = flag.Duration("report", 10*time.Second, "Interval of the intermediate reports, 0 for none")
+		Timeout    = flag.Duration("timeout", 30*time.Second, "Timeout of each request")
+		Seed       = flag.Int64("seed", time.Now().UnixNano(), "Seed of the random failures and jitter")
+	)
+	flag.Parse()
+
+	attrs := map[string]string{}
+	if *Board != "" {
+		attrs[deployment.AttributeBoard] = *Board
+	}
+	if *HwRevision != "" {
+		attrs[deployment.AttributeHwRevision] = *HwRevision
+	}
+	s := simulator.New(simulator.Config{
+		URL:        *BackendURL,
+		Targets:    *Targets,
+		Prefix:     *Prefix,
+		Poll:       *Poll,
+		Jitter:     *Jitter,
+		Step:       *Step,
+		FailRate:   *FailRate,
+		CancelRate: *CancelRate,
+		Attributes: attrs,
+		Client: &http.Client{
+			Timeout:   *Timeout,
+			Transport: &http.Transport{MaxIdleConnsPerHost: *Targets},
+		},
+		Seed: *Seed,
+	})
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	if *Duration > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, *Duration)
+		defer cancel()
+	}
+	if *Interval > 0 {
+		go func() {
+			t := time.NewTicker(*Interval)
+			defer t.Stop()
+			for {
+				select {
+				case <-t.C:
+					fmt.Println(s.Report())
+				case <-ctx.Done():
+					return
+				}
+			}
+		}()
+	}
+
+	begin := time.Now()
+	fmt.Printf("simulating %d targets against %s\n", *Targets, *BackendURL)
+	s.Run(ctx)
+	fmt.Printf("ran %v\n%v", time.Since(begin).Round(time.Second), s.Report())
+}
@@ -0,0 +1,275 @@
+// Package client is a Go client of the frontend management API served by
+// frontend.MakeFrontendHTTPHandler.
+package client
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/jonathanyhliang/hawkbit-fota/deployment"
+)
+
+// Error is a request the frontend answered with a non-2xx status. Message
+// is the error of the JSON body, which is the text of the error the service
+// returned, so errors.Is matches it against the sentinel errors of the
+// deployment and frontend packages.
+type Error struct {
+	StatusCode int
+	Message    string
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("%d %s", e.StatusCode, e.Message)
+}
+
+// Is reports whether target is the error the frontend returned.
+func (e *Error) Is(target error) bool {
+	return target != nil && target.Error() == e.Message
+}
+
+// Client calls the frontend at a base URL such as http://localhost:8080.
+type Client struct {
+	base   string
+	http   *http.Client
+	actor  string
+	apiKey string
+}
+
+// Option configures a Client.
+type Option func(*Client)
+
+// WithHTTPClient makes the Client send its requests with c instead of
+// http.DefaultClient.
+func WithHTTPClient(c *http.Client) Option {
+	return func(cl *Client) { cl.http = c }
+}
+
+// WithActor names the operator recorded in the audit trail for the
+// requests of the Client. The frontend cannot verify the name, so it records
+// it together with the address the requests came from.
+func WithActor(a string) Option {
+	return func(cl *Client) { cl.actor = a }
+}
+
+// WithAPIKey sends k as a bearer token, for frontends behind a proxy which
+// authenticates requests.
+func WithAPIKey(k string) Option {
+	return func(cl *Client) { cl.apiKey = k }
+}
+
+func New(base string, options ...Option) *Client {
+	c := &Client{base: strings.TrimSuffix(base, "/"), http: http.DefaultClient}
+	for _, o := range options {
+		o(c)
+	}
+	return c
+}
+
+func (c *Client) PostUpload(ctx context.Context, req PostUploadRequest) error {
+	return c.do(ctx, "POST", "/hawkbit/upload", req, nil)
+}
+
+func (c *Client) GetUpload(ctx context.Context, name string) (deployment.Upload, error) {
+	var resp GetUploadResponse
+	err := c.do(ctx, "GET", "/hawkbit/upload/"+url.PathEscape(name), nil, &resp)
+	return resp.Upload, err
+}
+
+func (c *Client) PostDistribution(ctx context.Context, req PostDistributionRequest) error {
+	return c.do(ctx, "POST", "/hawkbit/dist", req, nil)
+}
+
+func (c *Client) GetDistribution(ctx context.Context, name string) (deployment.Distribution, error) {
+	var resp GetDistributionResponse
+	err := c.do(ctx, "GET", "/hawkbit/dist/"+url.PathEscape(name), nil, &resp)
+	return resp.Distribution, err
+}
+
+func (c *Client) PostDeployment(ctx context.Context, req PostDeploymentRequest) error {
+	return c.do(ctx, "POST", "/hawkbit/deploy", req, nil)
+}
+
+func (c *Client) GetDeployment(ctx context.Context, target string) (deployment.Deployment, error) {
+	var resp GetDeploymentResponse
+	err := c.do(ctx, "GET", "/hawkbit/deploy/"+url.PathEscape(target), nil, &resp)
+	return resp.Deployment, err
+}
+
+func (c *Client) GetTargets(ctx context.Context) ([]deployment.Target, error) {
+	var resp GetTargetsResponse
+	err := c.do(ctx, "GET", "/hawkbit/targets", nil, &resp)
+	return resp.Targets, err
+}
+
+func (c *Client) PutAutoConfirm(ctx context.Context, target string, a deployment.AutoConfirm) error {
+	return c.do(ctx, "PUT", "/hawkbit/targets/"+url.PathEscape(target)+"/autoconfirm", a, nil)
+}
+
+// PutTags replaces the tags of target. No tags removes them all.
+func (c *Client) PutTags(ctx context.Context, target string, tags []string) error {
+	if tags == nil {
+		tags = []string{}
+	}
+	return c.do(ctx, "PUT", "/hawkbit/targets/"+url.PathEscape(target)+"/tags", tags, nil)
+}
+
+// GetAudit returns the audit trail of entity, such as deployment/<target>,
+// or of all entities if entity is empty. The server returns the trail a
+// page at a time, so GetAudit asks for pages until it has all of it.
+func (c *Client) GetAudit(ctx context.Context, entity string) ([]deployment.AuditEntry, error) {
+	es := []deployment.AuditEntry{}
+	since := 0
+	for {
+		var resp GetAuditResponse
+		err := c.do(ctx, "GET", "/hawkbit/audit?entity="+url.QueryEscape(entity)+"&since="+
+			strconv.Itoa(since), nil, &resp)
+		if err != nil || len(resp.Entries) == 0 {
+			return es, err
+		}
+		es = append(es, resp.Entries...)
+		since = resp.Entries[len(resp.Entries)-1].Seq
+	}
+}
+
+func (c *Client) PostWebhook(ctx context.Context, w deployment.Webhook) error {
+	return c.do(ctx, "POST", "/hawkbit/webhooks", w, nil)
+}
+
+func (c *Client) GetWebhooks(ctx context.Context) ([]deployment.Webhook, error) {
+	var resp GetWebhooksResponse
+	err := c.do(ctx, "GET", "/hawkbit/webhooks", nil, &resp)
+	return resp.Webhooks, err
+}
+
+func (c *Client) DeleteWebhook(ctx context.Context, name string) error {
+	return c.do(ctx, "DELETE", "/hawkbit/webhooks/"+url.PathEscape(name), nil, nil)
+}
+
+func (c *Client) GetWebhookDeliveries(ctx context.Context, name string) ([]deployment.Delivery, error) {
+	var resp GetWebhookDeliveriesResponse
+	err := c.do(ctx, "GET", "/hawkbit/webhooks/"+url.PathEscape(name)+"/deliveries", nil, &resp)
+	return resp.Deliveries, err
+}
+
+// PutRollout reports the state of rollout r.Name, as the client running it.
+func (c *Client) PutRollout(ctx context.Context, r deployment.Rollout) error {
+	return c.do(ctx, "PUT", "/hawkbit/rollouts/"+url.PathEscape(r.Name), r, nil)
+}
+
+func (c *Client) GetRollouts(ctx context.Context) ([]deployment.Rollout, error) {
+	var resp GetRolloutsResponse
+	err := c.do(ctx, "GET", "/hawkbit/rollouts", nil, &resp)
+	return resp.Rollouts, err
+}
+
+// GetEvents streams the live events selected by f, or all of them if f is
+// empty. The channel is closed when ctx is done or the stream ends.
+func (c *Client) GetEvents(ctx context.Context, f deployment.EventFilter) (<-chan deployment.Event, error) {
+	q := url.Values{}
+	for k, v := range map[string]string{"target": f.Target, "tag": f.Tag, "rollout": f.Rollout} {
+		if v != "" {
+			q.Set(k, v)
+		}
+	}
+	r, err := c.request(ctx, "GET", "/hawkbit/events?"+q.Encode(), nil)
+	if err != nil {
+		return nil, err
+	}
+	r.Header.Set("Accept", "text/event-stream")
+	resp, err := c.http.Do(r)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode/100 != 2 {
+		defer resp.Body.Close()
+		return nil, errorFrom(resp)
+	}
+	es := make(chan deployment.Event)
+	go func() {
+		defer close(es)
+		defer resp.Body.Close()
+		s := bufio.NewScanner(resp.Body)
+		for s.Scan() {
+			// Only the data lines matter, the event type is repeated in
+			// the event itself.
+			if !strings.HasPrefix(s.Text(), "data:") {
+				continue
+			}
+			var e deployment.Event
+			if json.Unmarshal([]byte(strings.TrimPrefix(s.Text(), "data:")), &e) != nil {
+				continue
+			}
+			select {
+			case es <- e:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return es, nil
+}
+
+func (c *Client) request(ctx context.Context, method string, path string, body interface{}) (*http.Request, error) {
+	var b io.Reader
+	if body != nil {
+		j, err := json.Marshal(body)
+		if err != nil {
+			return nil, err
+		}
+		b = bytes.NewReader(j)
+	}
+	r, err := http.NewRequestWithContext(ctx, method, c.base+path, b)
+	if err != nil {
+		return nil, err
+	}
+	if body != nil {
+		r.Header.Set("Content-Type", "application/json")
+	}
+	if c.actor != "" {
+		r.Header.Set("X-Hawkbit-Actor", c.actor)
+	}
+	if c.apiKey != "" {
+		r.Header.Set("Authorization", "Bearer "+c.apiKey)
+	}
+	return r, nil
+}
+
+// do sends body as JSON and decodes the response into out, unless nil.
+func (c *Client) do(ctx context.Context, method string, path string, body interface{}, out interface{}) error {
+	r, err := c.request(ctx, method, path, body)
+	if err != nil {
+		return err
+	}
+	resp, err := c.http.Do(r)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		return errorFrom(resp)
+	}
+	if out == nil {
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+func errorFrom(resp *http.Response) error {
+	b, _ := io.ReadAll(resp.Body)
+	var e ErrorResponse
+	if json.Unmarshal(b, &e) != nil || e.Error == "" {
+		e.Error = strings.TrimSpace(string(b))
+	}
+	if e.Error == "" {
+		e.Error = http.StatusText(resp.StatusCode)
+	}
+	return &Error{StatusCode: resp.StatusCode, Message: e.Error}
+}
@@ -0,0 +1,189 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/jonathanyhliang/hawkbit-fota/deployment"
+	"github.com/jonathanyhliang/hawkbit-fota/frontend"
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestClient(t *testing.T) *Client {
+	fs := frontend.AuditFrontendMiddleware()(frontend.NewHawkbitFrontendService())
+	s := httptest.NewServer(frontend.MakeFrontendHTTPHandler(fs, log.NewNopLogger()))
+	t.Cleanup(s.Close)
+	return New(s.URL+"/", WithActor("sdk"))
+}
+
+func newImageServer(t *testing.T) *httptest.Server {
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b := make([]byte, 2048)
+		for i := range b {
+			b[i] = byte(i)
+		}
+		w.Write(b)
+	}))
+	t.Cleanup(s.Close)
+	return s
+}
+
+func TestClient(t *testing.T) {
+	c := newTestClient(t)
+	img := newImageServer(t)
+	ctx := context.Background()
+
+	assert.Equal(t, nil, c.PostUpload(ctx, PostUploadRequest{Name: "sdk", Version: "1.0.0", File: img.URL}))
+	u, err := c.GetUpload(ctx, "sdk")
+	assert.Equal(t, nil, err)
+	assert.Equal(t, 2048, u.Size)
+
+	assert.Equal(t, nil, c.PostDistribution(ctx, PostDistributionRequest{Name: "sdk", Version: "1.0.0",
+		Upload: "sdk"}))
+	d, err := c.GetDistribution(ctx, "sdk")
+	assert.Equal(t, nil, err)
+	assert.Equal(t, u.Sha256, d.Upload.Sha256)
+
+	assert.Equal(t, nil, c.PostDeployment(ctx, PostDeploymentRequest{Target: "sdk-dev", Distribution: "sdk",
+		Type: deployment.ActionSoft}))
+	dp, err := c.GetDeployment(ctx, "sdk-dev")
+	assert.Equal(t, nil, err)
+	assert.Equal(t, deployment.ActionSoft, dp.Type)
+	assert.Equal(t, "sdk", dp.Artifact.Name)
+
+	ts, err := c.GetTargets(ctx)
+	assert.Equal(t, nil, err)
+	assert.NotEmpty(t, ts)
+
+	assert.Equal(t, nil, c.PutAutoConfirm(ctx, "sdk-dev", deployment.AutoConfirm{Active: true}))
+
+	a, err := c.GetAudit(ctx, "deployment/sdk-dev")
+	assert.Equal(t, nil, err)
+	assert.Regexp(t, `^sdk@127\.0\.0\.1:\d+$`, a[len(a)-1].Actor)
+	assert.Equal(t, "PostDeployment", a[len(a)-1].Action)
+}
+
+func TestClientWebhooks(t *testing.T) {
+	c := newTestClient(t)
+	ctx := context.Background()
+
+	w := deployment.Webhook{Name: "sdk-hook", URL: "http://127.0.0.1:1/hook"}
+	assert.Equal(t, nil, c.PostWebhook(ctx, w))
+	ws, err := c.GetWebhooks(ctx)
+	assert.Equal(t, nil, err)
+	assert.Contains(t, ws, w)
+	_, err = c.GetWebhookDeliveries(ctx, "sdk-hook")
+	assert.Equal(t, nil, err)
+	assert.Equal(t, nil, c.DeleteWebhook(ctx, "sdk-hook"))
+	err = c.DeleteWebhook(ctx, "sdk-hook")
+	assert.True(t, errors.Is(err, deployment.ErrDeploymentWebhookNotFound))
+}
+
+func TestClientRollouts(t *testing.T) {
+	c := newTestClient(t)
+	img := newImageServer(t)
+	ctx := context.Background()
+
+	assert.Equal(t, nil, c.PostUpload(ctx, PostUploadRequest{Name: "sdk-ro", Version: "1.0.0", File: img.URL}))
+	assert.Equal(t, nil, c.PostDistribution(ctx, PostDistributionRequest{Name: "sdk-ro", Version: "1.0.0",
+		Upload: "sdk-ro"}))
+	r := deployment.Rollout{Name: "sdk-ro", Distribution: "sdk-ro", Targets: []string{"sdk-ro-dev"},
+		State: deployment.RolloutRunning, Wave: 1}
+	assert.Equal(t, nil, c.PutRollout(ctx, r))
+	rs, err := c.GetRollouts(ctx)
+	assert.Equal(t, nil, err)
+	var got *deployment.Rollout
+	for i := range rs {
+		if rs[i].Name == "sdk-ro" {
+			got = &rs[i]
+		}
+	}
+	if assert.NotNil(t, got) {
+		assert.Equal(t, deployment.RolloutRunning, got.State)
+		assert.Equal(t, []string{"sdk-ro-dev"}, got.Targets)
+	}
+	r.State = "aborted"
+	assert.True(t, errors.Is(c.PutRollout(ctx, r), deployment.ErrDeploymentRollout))
+
+	a, err := c.GetAudit(ctx, "rollout/sdk-ro")
+	assert.Equal(t, nil, err)
+	assert.Equal(t, "PutRollout", a[len(a)-1].Action)
+}
+
+func TestClientErrors(t *testing.T) {
+	c := newTestClient(t)
+	ctx := context.Background()
+
+	_, err := c.GetUpload(ctx, "none")
+	var e *Error
+	assert.True(t, errors.As(err, &e))
+	assert.Equal(t, http.StatusNotFound, e.StatusCode)
+	assert.True(t, errors.Is(err, deployment.ErrDeploymentUploadNotFound))
+	assert.False(t, errors.Is(err, deployment.ErrDeploymentNotFound))
+
+	err = c.PostUpload(ctx, PostUploadRequest{Name: "sdk-bad"})
+	assert.True(t, errors.Is(err, frontend.ErrFrontendUpload))
+
+	_, err = New("http://127.0.0.1:1").GetTargets(ctx)
+	assert.False(t, errors.As(err, &e))
+}
+
+func TestClientEvents(t *testing.T) {
+	c := newTestClient(t)
+	img := newImageServer(t)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	assert.Equal(t, nil, c.PostUpload(ctx, PostUploadRequest{Name: "sdk-ev", Version: "1.0.0", File: img.URL}))
+	assert.Equal(t, nil, c.PostDistribution(ctx, PostDistributionRequest{Name: "sdk-ev", Version: "1.0.0",
+		Upload: "sdk-ev"}))
+	es, err := c.GetEvents(ctx, deployment.EventFilter{Target: "sdk-ev-dev"})
+	assert.Equal(t, nil, err)
+	assert.Equal(t, nil, c.PostDeployment(ctx, PostDeploymentRequest{Target: "sdk-ev-dev",
+		Distribution: "sdk-ev"}))
+	select {
+	case e := <-es:
+		assert.Equal(t, deployment.EventActionAssigned, e.Type)
+		assert.Equal(t, "sdk-ev-dev", e.Target)
+		assert.Equal(t, "sdk-ev", e.Distribution)
+	case <-ctx.Done():
+		t.Fatal("no event")
+	}
+	cancel()
+	for range es {
+	}
+}
+
+func TestClientEventsTag(t *testing.T) {
+	c := newTestClient(t)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	assert.Equal(t, nil, c.PutTags(ctx, "sdk-tag-dev", []string{"sdk-lab"}))
+	ts, err := c.GetTargets(ctx)
+	assert.Equal(t, nil, err)
+	tagged := false
+	for _, tg := range ts {
+		tagged = tagged || tg.Name == "sdk-tag-dev" && len(tg.Tags) == 1 && tg.Tags[0] == "sdk-lab"
+	}
+	assert.True(t, tagged)
+	es, err := c.GetEvents(ctx, deployment.EventFilter{Tag: "sdk-lab"})
+	assert.Equal(t, nil, err)
+	deployment.SetPolled("sdk-untagged-dev", time.Now())
+	deployment.SetPolled("sdk-tag-dev", time.Now())
+	for e := range es {
+		if e.Type == deployment.EventTargetPolled {
+			assert.Equal(t, "sdk-tag-dev", e.Target)
+			break
+		}
+	}
+	assert.True(t, errors.Is(c.PutTags(ctx, "sdk-tag-dev", []string{""}), deployment.ErrDeploymentTag))
+	cancel()
+	for range es {
+	}
+}
@@ -0,0 +1,72 @@
+package client
+
+import "github.com/jonathanyhliang/hawkbit-fota/deployment"
+
+// The request and response types below are the bodies of the frontend
+// routes as they appear on the wire.
+
+type PostUploadRequest struct {
+	Name    string `json:"name"`
+	Version string `json:"version"`
+	File    string `json:"file"`
+
+	Sign     *deployment.SignParams `json:"sign,omitempty"`
+	Compress []string               `json:"compress,omitempty"`
+}
+
+type GetUploadResponse struct {
+	Upload deployment.Upload `json:"upload"`
+}
+
+type PostDistributionRequest struct {
+	Name    string `json:"name"`
+	Version string `json:"version"`
+	Upload  string `json:"upload"`
+	Key     string `json:"key,omitempty"`
+	Variant string `json:"variant,omitempty"`
+
+	Compatible *deployment.Compatibility `json:"compatible,omitempty"`
+}
+
+type GetDistributionResponse struct {
+	Distribution deployment.Distribution `json:"distribution"`
+}
+
+type PostDeploymentRequest struct {
+	Target       string                        `json:"target"`
+	Distribution string                        `json:"distribution"`
+	Type         string                        `json:"type,omitempty"`
+	ForceTime    string                        `json:"forcetime,omitempty"`
+	Maintenance  *deployment.MaintenanceWindow `json:"maintenanceWindow,omitempty"`
+
+	ConfirmationRequired bool `json:"confirmationRequired,omitempty"`
+}
+
+type GetDeploymentResponse struct {
+	Deployment deployment.Deployment `json:"deployment"`
+}
+
+type GetTargetsResponse struct {
+	Targets []deployment.Target `json:"targets"`
+}
+
+type GetAuditResponse struct {
+	Entries []deployment.AuditEntry `json:"entries"`
+}
+
+type GetWebhooksResponse struct {
+	Webhooks []deployment.Webhook `json:"webhooks"`
+}
+
+type GetWebhookDeliveriesResponse struct {
+	Deliveries []deployment.Delivery `json:"deliveries"`
+}
+
+type GetRolloutsResponse struct {
+	Rollouts []deployment.Rollout `json:"rollouts"`
+}
+
+// ErrorResponse is the body of a failed request.
+type ErrorResponse struct {
+	Error string `json:"error"`
+}
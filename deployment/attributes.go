@@ -0,0 +1,126 @@
+package deployment
+
+import (
+	"context"
+	"errors"
+	"strings"
+)
+
+var (
+	ErrDeploymentAttributes = errors.New("Deployment: invalid attribute update mode")
+)
+
+// Update modes of target attributes, as defined for DDI configData.
+const (
+	AttributesMerge   = "merge"
+	AttributesReplace = "replace"
+	AttributesRemove  = "remove"
+)
+
+// AttributeDecompressors lists, comma separated, the artifact encodings a
+// target is able to decode.
+const AttributeDecompressors = "decompressors"
+
+// SetAttributes updates the attributes target t reported about itself.
+func SetAttributes(t string, mode string, a map[string]string) error {
+	return SetAttributesContext(context.Background(), t, mode, a)
+}
+
+// SetAttributesContext is SetAttributes audited as requested by ctx.
+func SetAttributesContext(ctx context.Context, t string, mode string, a map[string]string) error {
+	dp.mtx.Lock()
+	defer dp.mtx.Unlock()
+	before := map[string]string{}
+	for k, v := range dp.attributes[t] {
+		before[k] = v
+	}
+	cur := map[string]string{}
+	for k, v := range before {
+		cur[k] = v
+	}
+	switch mode {
+	case "", AttributesMerge:
+		for k, v := range a {
+			cur[k] = v
+		}
+	case AttributesReplace:
+		cur = map[string]string{}
+		for k, v := range a {
+			cur[k] = v
+		}
+	case AttributesRemove:
+		for k := range a {
+			delete(cur, k)
+		}
+	default:
+		return ErrDeploymentAttributes
+	}
+	dp.attributes[t] = cur
+	audit(ctx, "attributes/"+t, before, cur)
+	return nil
+}
+
+// GetAttributes returns a copy of the attributes of target t.
+func GetAttributes(t string) map[string]string {
+	dp.mtx.Lock()
+	defer dp.mtx.Unlock()
+	a := map[string]string{}
+	for k, v := range dp.attributes[t] {
+		a[k] = v
+	}
+	return a
+}
+
+// Decompressors returns the artifact encodings target t declared support for.
+func Decompressors(t string) []string {
+	var encs []string
+	for _, e := range strings.Split(GetAttributes(t)[AttributeDecompressors], ",") {
+		if e = strings.TrimSpace(e); e != "" {
+			encs = append(encs, e)
+		}
+	}
+	return encs
+}
+
+// Target attributes describing the hardware a target runs on.
+const (
+	AttributeBoard      = "board"
+	AttributeHwRevision = "hwRevision"
+)
+
+// AttributeVersion is the version of the image a target reports running.
+// Deltas are only offered to targets running the version they apply to.
+const AttributeVersion = "version"
+
+// Compatibility restricts a distribution to targets running on one of the
+// listed boards and hardware revisions. An empty list matches any value.
+type Compatibility struct {
+	Boards      []string `json:"boards,omitempty" example:"cc3220sf_launchxl"`
+	HwRevisions []string `json:"hwRevisions,omitempty" example:"1.0"`
+}
+
+// Matches reports whether a target with attributes a is compatible. Targets
+// that have not reported a restricted attribute are not.
+func (c *Compatibility) Matches(a map[string]string) bool {
+	if c == nil {
+		return true
+	}
+	return matchAttribute(c.Boards, a, AttributeBoard) &&
+		matchAttribute(c.HwRevisions, a, AttributeHwRevision)
+}
+
+func matchAttribute(vs []string, a map[string]string, k string) bool {
+	if len(vs) == 0 {
+		return true
+	}
+	v, ok := a[k]
+	if !ok {
+		return false
+	}
+	for _, c := range vs {
+		if c == v {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,33 @@
+package deployment
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSetAttributes(t *testing.T) {
+	assert.Equal(t, nil, SetAttributes("attrs", AttributesMerge, map[string]string{
+		AttributeDecompressors: "gzip, heatshrink", AttributeBoard: "cc3220sf"}))
+	assert.Equal(t, []string{EncodingGzip, EncodingHeatshrink}, Decompressors("attrs"))
+	assert.Equal(t, nil, SetAttributes("attrs", AttributesRemove, map[string]string{AttributeDecompressors: ""}))
+	assert.Equal(t, map[string]string{AttributeBoard: "cc3220sf"}, GetAttributes("attrs"))
+	assert.Equal(t, ErrDeploymentAttributes, SetAttributes("attrs", "append", nil))
+}
+
+func TestSetDeploymentIncompatible(t *testing.T) {
+	s := newImageServer()
+	defer s.Close()
+	assert.Equal(t, nil, SetUpload(Upload{Name: "compat", Version: "1.0.0", Url: s.URL + "/dummy.bin"}))
+	assert.Equal(t, nil, SetDistribution(Distribution{Name: "compat", Version: "1.0.0",
+		Compatible: &Compatibility{Boards: []string{"cc3220sf"}, HwRevisions: []string{"1.0", "1.1"}}}, "compat"))
+
+	// Targets that never reported their hardware are rejected.
+	assert.Equal(t, ErrDeploymentIncompatible, SetDeployment("nrf", "compat", DeploymentOptions{}))
+	SetAttributes("nrf", AttributesMerge, map[string]string{AttributeBoard: "nrf52", AttributeHwRevision: "1.0"})
+	assert.Equal(t, ErrDeploymentIncompatible, SetDeployment("nrf", "compat", DeploymentOptions{}))
+	SetAttributes("cc", AttributesMerge, map[string]string{AttributeBoard: "cc3220sf", AttributeHwRevision: "1.2"})
+	assert.Equal(t, ErrDeploymentIncompatible, SetDeployment("cc", "compat", DeploymentOptions{}))
+	SetAttributes("cc", AttributesMerge, map[string]string{AttributeHwRevision: "1.1"})
+	assert.Equal(t, nil, SetDeployment("cc", "compat", DeploymentOptions{}))
+}
@@ -0,0 +1,236 @@
+package deployment
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+)
+
+var (
+	ErrDeploymentAudit = errors.New("Deployment: audit chain broken")
+)
+
+// AuditEntry records one change made to the store. Each entry carries the
+// hash of its predecessor, so removing or altering an entry breaks the chain
+// from there on. The trail is kept in memory like the rest of the store, so
+// it starts over when the server restarts; the chain proves it intact since
+// then, not since the first change ever made. Only the latest entries are
+// kept, see SetAuditRetention.
+type AuditEntry struct {
+	Seq    int             `json:"seq" example:"1"`
+	Time   time.Time       `json:"time"`
+	Actor  string          `json:"actor" example:"operator"`
+	Action string          `json:"action" example:"PostDeployment"`
+	Entity string          `json:"entity" example:"deployment/ti_cc3200wf_12345"`
+	Before json.RawMessage `json:"before,omitempty" swaggertype:"object"`
+	After  json.RawMessage `json:"after,omitempty" swaggertype:"object"`
+	Error  string          `json:"error,omitempty"`
+	Prev   string          `json:"prev" example:"hash"`
+	Hash   string          `json:"hash" example:"hash"`
+}
+
+func (e AuditEntry) digest() string {
+	e.Hash = ""
+	b, _ := json.Marshal(e)
+	return fmt.Sprintf("%x", sha256.Sum256(b))
+}
+
+type actorKey struct{}
+
+// WithActor returns a context recording a as the originator of the changes
+// made on its behalf.
+func WithActor(ctx context.Context, a string) context.Context {
+	return context.WithValue(ctx, actorKey{}, a)
+}
+
+// Actor returns the originator recorded in ctx, if any.
+func Actor(ctx context.Context) string {
+	a, _ := ctx.Value(actorKey{}).(string)
+	return a
+}
+
+type auditKey struct{}
+
+// auditRecord asks the store to audit the change it makes on behalf of a
+// context.
+type auditRecord struct {
+	actor  string
+	action string
+	done   bool
+}
+
+// WithAudit returns a context under which the store records the change it
+// makes as action of Actor(ctx). The entry is appended under the same lock
+// as the change, so before and after are exactly the state it replaced and
+// the state it left. Calls failing before they change anything leave the
+// entry to EndAudit.
+func WithAudit(ctx context.Context, action string) context.Context {
+	return context.WithValue(ctx, auditKey{}, &auditRecord{actor: Actor(ctx), action: action})
+}
+
+// EndAudit records the outcome err of the call made under ctx about entity,
+// unless the store already audited the change it made. Such entries carry
+// no state, since nothing was changed.
+func EndAudit(ctx context.Context, entity string, err error) {
+	r, ok := ctx.Value(auditKey{}).(*auditRecord)
+	if !ok {
+		return
+	}
+	dp.mtx.Lock()
+	defer dp.mtx.Unlock()
+	if r.done {
+		return
+	}
+	r.done = true
+	appendAudit(newAuditEntry(r.actor, r.action, entity, nil, nil, err))
+}
+
+// audit records a change made on behalf of ctx, if it asked for it with
+// WithAudit. The caller holds dp.mtx.
+func audit(ctx context.Context, entity string, before interface{}, after interface{}) {
+	r, ok := ctx.Value(auditKey{}).(*auditRecord)
+	if !ok {
+		return
+	}
+	r.done = true
+	appendAudit(newAuditEntry(r.actor, r.action, entity, before, after, nil))
+}
+
+// Audit appends an entry to the audit trail. before and after are the state
+// of the entity around the change, and err its outcome.
+func Audit(actor string, action string, entity string, before interface{}, after interface{},
+	err error) AuditEntry {
+	e := newAuditEntry(actor, action, entity, before, after, err)
+	dp.mtx.Lock()
+	defer dp.mtx.Unlock()
+	return appendAudit(e)
+}
+
+func newAuditEntry(actor string, action string, entity string, before interface{}, after interface{},
+	err error) AuditEntry {
+	e := AuditEntry{
+		Time:   time.Now().UTC(),
+		Actor:  actor,
+		Action: action,
+		Entity: entity,
+	}
+	if before != nil {
+		e.Before, _ = json.Marshal(before)
+	}
+	if after != nil {
+		e.After, _ = json.Marshal(after)
+	}
+	if err != nil {
+		e.Error = err.Error()
+	}
+	return e
+}
+
+// stored returns the entry of m at k as state for the audit trail, or nil if
+// there is none.
+func stored[T any](m map[string]T, k string) interface{} {
+	v, ok := m[k]
+	if !ok {
+		return nil
+	}
+	return v
+}
+
+// DefaultAuditRetention is the number of audit entries kept by default.
+const DefaultAuditRetention = 100000
+
+// SetAuditRetention sets the number of latest audit entries kept. Older
+// entries are dropped, leaving the hash of the last one dropped as the
+// checkpoint the chain of the rest is verified from.
+func SetAuditRetention(n int) {
+	dp.mtx.Lock()
+	defer dp.mtx.Unlock()
+	dp.auditRetention = n
+	trimAudit()
+}
+
+// appendAudit chains e to the trail. The caller holds dp.mtx.
+func appendAudit(e AuditEntry) AuditEntry {
+	e.Seq = dp.auditDropped + len(dp.audit) + 1
+	e.Prev = dp.auditCheckpoint
+	if n := len(dp.audit); n > 0 {
+		e.Prev = dp.audit[n-1].Hash
+	}
+	e.Hash = e.digest()
+	dp.audit = append(dp.audit, e)
+	trimAudit()
+	return e
+}
+
+// trimAudit drops the entries beyond the retention. The caller holds dp.mtx.
+func trimAudit() {
+	n := len(dp.audit) - dp.auditRetention
+	if n <= 0 {
+		return
+	}
+	// Dropping a tenth more than needed spares moving the whole trail for
+	// every entry added.
+	if n += dp.auditRetention / 10; n > len(dp.audit) {
+		n = len(dp.audit)
+	}
+	dp.auditCheckpoint = dp.audit[n-1].Hash
+	dp.auditDropped += n
+	dp.audit = append([]AuditEntry(nil), dp.audit[n:]...)
+}
+
+// AuditQuery selects entries of the audit trail.
+type AuditQuery struct {
+	// Entity selects the entries about it, or all entries if empty.
+	Entity string
+	// Since selects the entries after the one with this sequence number.
+	Since int
+	// Limit is the most entries returned, if non-zero.
+	Limit int
+}
+
+// GetAudit returns the audit entries q selects, oldest first. It verifies
+// the chain from the first entry after q.Since up to the last one returned.
+func GetAudit(q AuditQuery) ([]AuditEntry, error) {
+	dp.mtx.Lock()
+	defer dp.mtx.Unlock()
+	es := []AuditEntry{}
+	i := q.Since - dp.auditDropped
+	if i < 0 {
+		i = 0
+	}
+	for ; i < len(dp.audit) && (q.Limit == 0 || len(es) < q.Limit); i++ {
+		if !chained(i) {
+			return nil, ErrDeploymentAudit
+		}
+		if e := dp.audit[i]; q.Entity == "" || e.Entity == q.Entity {
+			es = append(es, e)
+		}
+	}
+	return es, nil
+}
+
+// VerifyAudit checks the hash chain of the audit trail kept.
+func VerifyAudit() error {
+	dp.mtx.Lock()
+	defer dp.mtx.Unlock()
+	for i := range dp.audit {
+		if !chained(i) {
+			return ErrDeploymentAudit
+		}
+	}
+	return nil
+}
+
+// chained reports whether entry i of the trail is intact and follows its
+// predecessor. The caller holds dp.mtx.
+func chained(i int) bool {
+	e := dp.audit[i]
+	prev := dp.auditCheckpoint
+	if i > 0 {
+		prev = dp.audit[i-1].Hash
+	}
+	return e.Seq == dp.auditDropped+i+1 && e.Prev == prev && e.Hash == e.digest()
+}
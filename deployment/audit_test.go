@@ -0,0 +1,129 @@
+package deployment
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// auditOf returns the audit entries about entity.
+func auditOf(entity string) []AuditEntry {
+	es, _ := GetAudit(AuditQuery{Entity: entity})
+	return es
+}
+
+func TestAudit(t *testing.T) {
+	ctx := WithActor(context.Background(), "operator")
+	n := len(auditOf("deployment/audit"))
+	Audit(Actor(ctx), "PostDeployment", "deployment/audit", nil, Status{Execution: "proceeding"}, nil)
+	e := Audit("target/audit", "PostDeploymentBaseFeedback", "deployment/audit",
+		Status{Execution: "proceeding"}, Status{Execution: "closed"}, nil)
+	Audit(Actor(ctx), "PostUpload", "upload/audit", nil, nil, errors.New("failed"))
+
+	es := auditOf("deployment/audit")[n:]
+	assert.Equal(t, 2, len(es))
+	assert.Equal(t, "operator", es[0].Actor)
+	assert.Equal(t, es[0].Hash, es[1].Prev)
+	assert.JSONEq(t, `{"execution":"closed","result":{"finished":""}}`, string(es[1].After))
+	assert.Equal(t, nil, VerifyAudit())
+
+	// Rewriting history breaks the chain.
+	dp.mtx.Lock()
+	dp.audit[e.Seq-1-dp.auditDropped].Actor = "someone else"
+	dp.mtx.Unlock()
+	assert.Equal(t, ErrDeploymentAudit, VerifyAudit())
+	dp.mtx.Lock()
+	dp.audit[e.Seq-1-dp.auditDropped].Actor = "target/audit"
+	dp.mtx.Unlock()
+	assert.Equal(t, nil, VerifyAudit())
+}
+
+func TestAuditStore(t *testing.T) {
+	s := newImageServer()
+	defer s.Close()
+	assert.Equal(t, nil, SetUpload(Upload{Name: "audit-store", Version: "1.0.0", Url: s.URL + "/dummy.bin"}))
+	assert.Equal(t, nil, SetDistribution(Distribution{Name: "audit-store", Version: "1"}, "audit-store"))
+	assert.Equal(t, nil, SetDeployment("audit-store-dev", "audit-store", DeploymentOptions{}))
+	d, _ := GetDeployment("audit-store-dev")
+	ctx := WithActor(context.Background(), "operator")
+	n := len(auditOf("deployment/audit-store-dev"))
+
+	// The store records the change under the lock it makes it with.
+	actx := WithAudit(ctx, "PostDeploymentBaseFeedback")
+	assert.Equal(t, nil, UpdateStatusContext(actx, "audit-store-dev", d.ActionId, Status{Execution: "closed"}))
+	EndAudit(actx, "deployment/audit-store-dev", nil)
+	es := auditOf("deployment/audit-store-dev")[n:]
+	assert.Equal(t, 1, len(es))
+	assert.Equal(t, "operator", es[0].Actor)
+	assert.Equal(t, "PostDeploymentBaseFeedback", es[0].Action)
+	var before, after Deployment
+	assert.Equal(t, nil, json.Unmarshal(es[0].Before, &before))
+	assert.Equal(t, nil, json.Unmarshal(es[0].After, &after))
+	assert.Equal(t, "", before.Status.Execution)
+	assert.Equal(t, "closed", after.Status.Execution)
+
+	// A call failing before it changes anything is recorded by EndAudit.
+	actx = WithAudit(ctx, "PostWebhook")
+	err := SetWebhookContext(actx, Webhook{Name: "audit-store"})
+	EndAudit(actx, "webhook/audit-store", err)
+	es = auditOf("webhook/audit-store")
+	assert.Equal(t, ErrDeploymentWebhook.Error(), es[len(es)-1].Error)
+	assert.Nil(t, es[len(es)-1].Before)
+	assert.Nil(t, es[len(es)-1].After)
+
+	// Secrets stay out of the trail.
+	actx = WithAudit(ctx, "PostWebhook")
+	assert.Equal(t, nil, SetWebhookContext(actx, Webhook{Name: "audit-store", URL: "http://localhost/", Secret: "s3cret"}))
+	EndAudit(actx, "webhook/audit-store", nil)
+	assert.Equal(t, nil, DeleteWebhookContext(WithAudit(ctx, "DeleteWebhook"), "audit-store"))
+	es = auditOf("webhook/audit-store")
+	assert.Equal(t, "PostWebhook", es[len(es)-2].Action)
+	assert.NotContains(t, string(es[len(es)-2].After), "s3cret")
+	assert.Equal(t, "DeleteWebhook", es[len(es)-1].Action)
+	assert.NotContains(t, string(es[len(es)-1].Before), "s3cret")
+	assert.Nil(t, es[len(es)-1].After)
+	assert.Equal(t, nil, VerifyAudit())
+}
+
+func TestAuditRetention(t *testing.T) {
+	defer SetAuditRetention(DefaultAuditRetention)
+	for i := 0; i < 30; i++ {
+		Audit("operator", "PostUpload", "upload/retention", nil, nil, nil)
+	}
+	SetAuditRetention(20)
+	for i := 0; i < 30; i++ {
+		Audit("operator", "PostUpload", "upload/retention", nil, nil, nil)
+	}
+	dp.mtx.Lock()
+	n, dropped := len(dp.audit), dp.auditDropped
+	dp.mtx.Unlock()
+	assert.True(t, n <= 20)
+	assert.True(t, dropped > 0)
+	// The chain of the entries kept starts from the last one dropped.
+	assert.Equal(t, nil, VerifyAudit())
+
+	es, err := GetAudit(AuditQuery{Limit: 5})
+	assert.Equal(t, nil, err)
+	assert.Equal(t, 5, len(es))
+	assert.Equal(t, dropped+1, es[0].Seq)
+	next, err := GetAudit(AuditQuery{Since: es[4].Seq, Limit: 5})
+	assert.Equal(t, nil, err)
+	assert.Equal(t, es[4].Hash, next[0].Prev)
+	assert.Equal(t, es[4].Seq+1, next[0].Seq)
+	rest, _ := GetAudit(AuditQuery{Since: next[4].Seq})
+	assert.Equal(t, n-10, len(rest))
+
+	dp.mtx.Lock()
+	dp.audit[7].Entity = "upload/forged"
+	dp.mtx.Unlock()
+	_, err = GetAudit(AuditQuery{Limit: 5})
+	assert.Equal(t, nil, err)
+	_, err = GetAudit(AuditQuery{Since: es[4].Seq})
+	assert.Equal(t, ErrDeploymentAudit, err)
+	dp.mtx.Lock()
+	dp.audit[7].Entity = "upload/retention"
+	dp.mtx.Unlock()
+}
@@ -0,0 +1,180 @@
+package deployment
+
+import (
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"io"
+
+	"github.com/pierrec/lz4/v4"
+)
+
+var (
+	ErrDeploymentEncoding = errors.New("Deployment: unsupported artifact encoding")
+)
+
+// Encodings an upload can additionally be stored in.
+const (
+	EncodingGzip       = "gzip"
+	EncodingLZ4        = "lz4"
+	EncodingHeatshrink = "heatshrink"
+)
+
+// Heatshrink parameters used for EncodingHeatshrink. Devices must configure
+// their decoder with the same window and lookahead sizes.
+const (
+	HeatshrinkWindow    = 8
+	HeatshrinkLookahead = 4
+)
+
+// Encoding is a compressed copy of an artifact.
+type Encoding struct {
+	Sha256 string `json:"sha256" example:"hash"`
+	Size   int    `json:"size" example:"1234"`
+}
+
+func compress(enc string, f []byte) ([]byte, error) {
+	var b bytes.Buffer
+	switch enc {
+	case EncodingGzip:
+		w, _ := gzip.NewWriterLevel(&b, gzip.BestCompression)
+		w.Write(f)
+		w.Close()
+	case EncodingLZ4:
+		w := lz4.NewWriter(&b)
+		w.Apply(lz4.CompressionLevelOption(lz4.Level9))
+		w.Write(f)
+		w.Close()
+	case EncodingHeatshrink:
+		return heatshrinkEncode(f), nil
+	default:
+		return nil, ErrDeploymentEncoding
+	}
+	return b.Bytes(), nil
+}
+
+// Decompress reverses the given encoding of an artifact.
+func Decompress(enc string, f []byte) ([]byte, error) {
+	var r io.Reader
+	switch enc {
+	case EncodingGzip:
+		zr, err := gzip.NewReader(bytes.NewReader(f))
+		if err != nil {
+			return nil, err
+		}
+		r = zr
+	case EncodingLZ4:
+		r = lz4.NewReader(bytes.NewReader(f))
+	case EncodingHeatshrink:
+		return heatshrinkDecode(f), nil
+	default:
+		return nil, ErrDeploymentEncoding
+	}
+	return io.ReadAll(r)
+}
+
+// heatshrinkEncode produces the bit stream of the heatshrink LZSS encoder:
+// a set tag bit followed by a literal byte, or a clear tag bit followed by
+// the back-reference offset and length, each biased by one.
+func heatshrinkEncode(f []byte) []byte {
+	const window = 1 << HeatshrinkWindow
+	const lookahead = 1 << HeatshrinkLookahead
+	var w bitWriter
+	for i := 0; i < len(f); {
+		best, off := 0, 0
+		for j := i - 1; j >= 0 && i-j <= window; j-- {
+			n := 0
+			for n < lookahead && i+n < len(f) && f[j+n] == f[i+n] {
+				n++
+			}
+			if n > best {
+				best, off = n, i-j
+				if n == lookahead {
+					break
+				}
+			}
+		}
+		// A back-reference only pays off from two bytes onwards.
+		if best >= 2 {
+			w.write(0, 1)
+			w.write(uint(off-1), HeatshrinkWindow)
+			w.write(uint(best-1), HeatshrinkLookahead)
+			i += best
+		} else {
+			w.write(1, 1)
+			w.write(uint(f[i]), 8)
+			i++
+		}
+	}
+	return w.bytes()
+}
+
+func heatshrinkDecode(f []byte) []byte {
+	r := bitReader{buf: f}
+	var out []byte
+	for {
+		tag, ok := r.read(1)
+		if !ok {
+			return out
+		}
+		if tag == 1 {
+			c, ok := r.read(8)
+			if !ok {
+				return out
+			}
+			out = append(out, byte(c))
+			continue
+		}
+		off, ok := r.read(HeatshrinkWindow)
+		if !ok {
+			return out
+		}
+		n, ok := r.read(HeatshrinkLookahead)
+		if !ok || int(off)+1 > len(out) {
+			return out
+		}
+		for i := 0; i <= int(n); i++ {
+			out = append(out, out[len(out)-int(off)-1])
+		}
+	}
+}
+
+type bitWriter struct {
+	buf  []byte
+	bits uint
+}
+
+func (w *bitWriter) write(v uint, n uint) {
+	for i := n; i > 0; i-- {
+		if w.bits%8 == 0 {
+			w.buf = append(w.buf, 0)
+		}
+		if v&(1<<(i-1)) != 0 {
+			w.buf[len(w.buf)-1] |= 0x80 >> (w.bits % 8)
+		}
+		w.bits++
+	}
+}
+
+func (w *bitWriter) bytes() []byte { return w.buf }
+
+type bitReader struct {
+	buf []byte
+	pos uint
+}
+
+func (r *bitReader) read(n uint) (uint, bool) {
+	if r.pos+n > uint(len(r.buf))*8 {
+		return 0, false
+	}
+	var v uint
+	for i := uint(0); i < n; i++ {
+		b := r.buf[r.pos/8] & (0x80 >> (r.pos % 8))
+		v <<= 1
+		if b != 0 {
+			v |= 1
+		}
+		r.pos++
+	}
+	return v, true
+}
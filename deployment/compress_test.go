@@ -0,0 +1,22 @@
+package deployment
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCompress(t *testing.T) {
+	f := append(bytes.Repeat([]byte("zephyr hawkbit "), 200), dummy[:1000]...)
+	for _, e := range []string{EncodingGzip, EncodingLZ4, EncodingHeatshrink} {
+		c, err := compress(e, f)
+		assert.Equal(t, nil, err, e)
+		assert.Less(t, len(c), len(f), e)
+		d, err := Decompress(e, c)
+		assert.Equal(t, nil, err, e)
+		assert.Equal(t, f, d, e)
+	}
+	_, err := compress("zstd", f)
+	assert.Equal(t, ErrDeploymentEncoding, err)
+}
@@ -0,0 +1,88 @@
+package deployment
+
+import (
+	"context"
+	"errors"
+)
+
+var (
+	ErrDeploymentConfirmation = errors.New("Deployment: invalid confirmation")
+)
+
+// Confirmation states of a deployment created with ConfirmationRequired.
+const (
+	ConfirmationPending   = "pending"
+	ConfirmationConfirmed = "confirmed"
+	ConfirmationDenied    = "denied"
+)
+
+// AutoConfirm describes whether new deployments of a target are confirmed
+// on its behalf, and by whom this was requested.
+type AutoConfirm struct {
+	Active    bool   `json:"active"`
+	Initiator string `json:"initiator,omitempty" example:"operator"`
+	Remark    string `json:"remark,omitempty" example:"kiosk unattended overnight"`
+}
+
+// AwaitingConfirmation reports whether the deployment must not be installed
+// until it has been confirmed.
+func (d Deployment) AwaitingConfirmation() bool {
+	return d.ConfirmationRequired && d.Confirmation != ConfirmationConfirmed
+}
+
+// Confirm records the answer of target t to the confirmation request of
+// action acid.
+func Confirm(t string, acid string, c string) error {
+	return ConfirmContext(context.Background(), t, acid, c)
+}
+
+// ConfirmContext is Confirm audited as requested by ctx.
+func ConfirmContext(ctx context.Context, t string, acid string, c string) error {
+	if c != ConfirmationConfirmed && c != ConfirmationDenied {
+		return ErrDeploymentConfirmation
+	}
+	dp.mtx.Lock()
+	defer dp.mtx.Unlock()
+	d, ok := dp.deployments[t]
+	if !ok {
+		return ErrDeploymentNotFound
+	}
+	if acid != d.ActionId || !d.ConfirmationRequired {
+		return ErrDeploymentConfirmation
+	}
+	before := d
+	d.Confirmation = c
+	dp.deployments[t] = d
+	audit(ctx, "deployment/"+t, before, d)
+	return nil
+}
+
+// SetAutoConfirm toggles auto-confirmation of target t. Activating it also
+// confirms an action which is still waiting for an answer.
+func SetAutoConfirm(t string, a AutoConfirm) {
+	SetAutoConfirmContext(context.Background(), t, a)
+}
+
+// SetAutoConfirmContext is SetAutoConfirm audited as requested by ctx.
+func SetAutoConfirmContext(ctx context.Context, t string, a AutoConfirm) {
+	dp.mtx.Lock()
+	defer dp.mtx.Unlock()
+	before := dp.autoconfirm[t]
+	if !a.Active {
+		delete(dp.autoconfirm, t)
+		audit(ctx, "autoconfirm/"+t, before, AutoConfirm{})
+		return
+	}
+	dp.autoconfirm[t] = a
+	audit(ctx, "autoconfirm/"+t, before, a)
+	if d, ok := dp.deployments[t]; ok && d.AwaitingConfirmation() {
+		d.Confirmation = ConfirmationConfirmed
+		dp.deployments[t] = d
+	}
+}
+
+func GetAutoConfirm(t string) AutoConfirm {
+	dp.mtx.Lock()
+	defer dp.mtx.Unlock()
+	return dp.autoconfirm[t]
+}
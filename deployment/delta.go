@@ -0,0 +1,460 @@
+package deployment
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+
+	"go.opentelemetry.io/otel/trace"
+)
+
+var (
+	ErrDeploymentDelta = errors.New("Deployment: delta generation failed")
+	ErrDeploymentPatch = errors.New("Deployment: corrupt delta")
+)
+
+// DeltaFormat identifies the patch format produced by GetDelta. It is the
+// streaming bsdiff format understood by the ENDSLEY bspatch implementation
+// commonly used on embedded targets. The format carries no compression of its
+// own, so deltas are stored gzip compressed.
+const DeltaFormat = "ENDSLEY/BSDIFF43"
+
+// Delta is a binary patch turning the artifact with hash Base into the one
+// with hash Target.
+type Delta struct {
+	Base   string `json:"base" example:"hash"`
+	Target string `json:"target" example:"hash"`
+	Sha256 string `json:"sha256" example:"hash"`
+	Size   int    `json:"size" example:"1234"`
+}
+
+// GetDelta returns the delta between two stored artifacts, generating and
+// caching it on first use.
+func GetDelta(base string, target string) (Delta, error) {
+	return GetDeltaContext(context.Background(), base, target)
+}
+
+// GetDeltaContext is GetDelta traced as part of ctx.
+func GetDeltaContext(ctx context.Context, base string, target string) (_ Delta, err error) {
+	ctx, span := startSpan(ctx, "GetDelta", SpanBase.String(base), SpanArtifact.String(target))
+	defer func() { EndSpan(span, err) }()
+	dp.mtx.Lock()
+	d, ok := dp.deltas[base+":"+target]
+	var j *deltaJob
+	if !ok {
+		j, err = startDelta(ctx, base, target)
+	}
+	dp.mtx.Unlock()
+	if ok || err != nil {
+		return d, err
+	}
+	select {
+	case <-j.done:
+		return j.d, nil
+	case <-ctx.Done():
+		return Delta{}, ctx.Err()
+	}
+}
+
+// deltaWorkers bounds the deltas generated at once, as diffing takes
+// memory of several times the size of the base image.
+const deltaWorkers = 2
+
+// deltaSlots holds a token for each delta being generated.
+var deltaSlots = make(chan struct{}, deltaWorkers)
+
+// deltaJob is a delta being generated. Everyone asking for the same delta
+// in the meantime waits for it rather than diffing again.
+type deltaJob struct {
+	done chan struct{}
+	d    Delta
+}
+
+// startDelta returns the job generating the delta from base to target,
+// starting one unless it is under way. The caller holds dp.mtx.
+func startDelta(ctx context.Context, base string, target string) (*deltaJob, error) {
+	k := base + ":" + target
+	if j, ok := dp.deltaJobs[k]; ok {
+		return j, nil
+	}
+	old, okb := dp.blobs[base]
+	cur, okt := dp.blobs[target]
+	if !okb || !okt || base == target {
+		return nil, ErrDeploymentDelta
+	}
+	j := &deltaJob{done: make(chan struct{})}
+	dp.deltaJobs[k] = j
+	go func() {
+		// The job outlives the request that started it, but not its trace.
+		_, span := startSpan(trace.ContextWithSpanContext(context.Background(), trace.SpanContextFromContext(ctx)),
+			"GenerateDelta", SpanBase.String(base), SpanArtifact.String(target))
+		defer span.End()
+		// Diffing is expensive, so it runs without holding the store lock.
+		deltaSlots <- struct{}{}
+		var b bytes.Buffer
+		w, _ := gzip.NewWriterLevel(&b, gzip.BestCompression)
+		w.Write(diff(old, cur))
+		w.Close()
+		<-deltaSlots
+		p := b.Bytes()
+		j.d = Delta{
+			Base:   base,
+			Target: target,
+			Sha256: fmt.Sprintf("%x", sha256.Sum256(p)),
+			Size:   len(p),
+		}
+		dp.mtx.Lock()
+		dp.blobs[j.d.Sha256] = p
+		dp.deltas[k] = j.d
+		delete(dp.deltaJobs, k)
+		dp.mtx.Unlock()
+		close(j.done)
+	}()
+	return j, nil
+}
+
+// FindDelta returns the delta between two stored artifacts if it has been
+// generated already. Unlike GetDelta it never diffs, so it is cheap enough
+// for the poll of a target.
+func FindDelta(base string, target string) (Delta, error) {
+	dp.mtx.Lock()
+	defer dp.mtx.Unlock()
+	d, ok := dp.deltas[base+":"+target]
+	if !ok {
+		return Delta{}, ErrDeploymentDelta
+	}
+	return d, nil
+}
+
+// Patch applies a delta produced by GetDelta to old.
+func Patch(old []byte, delta []byte) ([]byte, error) {
+	zr, err := gzip.NewReader(bytes.NewReader(delta))
+	if err != nil {
+		return nil, ErrDeploymentPatch
+	}
+	patch, err := io.ReadAll(zr)
+	if err != nil {
+		return nil, ErrDeploymentPatch
+	}
+	r := bytes.NewReader(patch)
+	hdr := make([]byte, len(DeltaFormat)+8)
+	if _, err := io.ReadFull(r, hdr); err != nil || string(hdr[:len(DeltaFormat)]) != DeltaFormat {
+		return nil, ErrDeploymentPatch
+	}
+	size := offtin(hdr[len(DeltaFormat):])
+	if size < 0 || size > int64(len(patch))<<8 {
+		return nil, ErrDeploymentPatch
+	}
+	cur := make([]byte, size)
+	var ctrl [24]byte
+	var oldpos, newpos int64
+	for newpos < size {
+		if _, err := io.ReadFull(r, ctrl[:]); err != nil {
+			return nil, ErrDeploymentPatch
+		}
+		add, extra, seek := offtin(ctrl[0:]), offtin(ctrl[8:]), offtin(ctrl[16:])
+		if add < 0 || extra < 0 || newpos+add+extra > size {
+			return nil, ErrDeploymentPatch
+		}
+		if _, err := io.ReadFull(r, cur[newpos:newpos+add]); err != nil {
+			return nil, ErrDeploymentPatch
+		}
+		for i := int64(0); i < add; i++ {
+			if oldpos+i >= 0 && oldpos+i < int64(len(old)) {
+				cur[newpos+i] += old[oldpos+i]
+			}
+		}
+		newpos += add
+		oldpos += add
+		if _, err := io.ReadFull(r, cur[newpos:newpos+extra]); err != nil {
+			return nil, ErrDeploymentPatch
+		}
+		newpos += extra
+		oldpos += seek
+	}
+	return cur, nil
+}
+
+func offtout(x int64, b []byte) {
+	y := x
+	if y < 0 {
+		y = -y
+	}
+	binary.LittleEndian.PutUint64(b, uint64(y))
+	if x < 0 {
+		b[7] |= 0x80
+	}
+}
+
+func offtin(b []byte) int64 {
+	y := int64(binary.LittleEndian.Uint64(b) &^ (1 << 63))
+	if b[7]&0x80 != 0 {
+		y = -y
+	}
+	return y
+}
+
+// diff is a port of Colin Percival's bsdiff, emitting the streaming format
+// in which control, diff and extra data are interleaved.
+func diff(old []byte, cur []byte) []byte {
+	oldsize, newsize := len(old), len(cur)
+	I := qsufsort(old)
+
+	var out bytes.Buffer
+	out.WriteString(DeltaFormat)
+	var buf [24]byte
+	offtout(int64(newsize), buf[:8])
+	out.Write(buf[:8])
+
+	var scan, pos, length int
+	var lastscan, lastpos, lastoffset int
+	for scan < newsize {
+		oldscore := 0
+		scan += length
+		scsc := scan
+		for ; scan < newsize; scan++ {
+			length, pos = search(I, old, cur[scan:], 0, oldsize)
+			for ; scsc < scan+length; scsc++ {
+				if scsc+lastoffset < oldsize && old[scsc+lastoffset] == cur[scsc] {
+					oldscore++
+				}
+			}
+			if (length == oldscore && length != 0) || length > oldscore+8 {
+				break
+			}
+			if scan+lastoffset < oldsize && old[scan+lastoffset] == cur[scan] {
+				oldscore--
+			}
+		}
+
+		if length != oldscore || scan == newsize {
+			s, sf, lenf := 0, 0, 0
+			for i := 0; lastscan+i < scan && lastpos+i < oldsize; {
+				if old[lastpos+i] == cur[lastscan+i] {
+					s++
+				}
+				i++
+				if s*2-i > sf*2-lenf {
+					sf = s
+					lenf = i
+				}
+			}
+
+			lenb := 0
+			if scan < newsize {
+				s, sb := 0, 0
+				for i := 1; scan >= lastscan+i && pos >= i; i++ {
+					if old[pos-i] == cur[scan-i] {
+						s++
+					}
+					if s*2-i > sb*2-lenb {
+						sb = s
+						lenb = i
+					}
+				}
+			}
+
+			if lastscan+lenf > scan-lenb {
+				overlap := (lastscan + lenf) - (scan - lenb)
+				s, ss, lens := 0, 0, 0
+				for i := 0; i < overlap; i++ {
+					if cur[lastscan+lenf-overlap+i] == old[lastpos+lenf-overlap+i] {
+						s++
+					}
+					if cur[scan-lenb+i] == old[pos-lenb+i] {
+						s--
+					}
+					if s > ss {
+						ss = s
+						lens = i + 1
+					}
+				}
+				lenf += lens - overlap
+				lenb -= lens
+			}
+
+			extra := (scan - lenb) - (lastscan + lenf)
+			offtout(int64(lenf), buf[0:])
+			offtout(int64(extra), buf[8:])
+			offtout(int64((pos-lenb)-(lastpos+lenf)), buf[16:])
+			out.Write(buf[:])
+			for i := 0; i < lenf; i++ {
+				out.WriteByte(cur[lastscan+i] - old[lastpos+i])
+			}
+			out.Write(cur[lastscan+lenf : lastscan+lenf+extra])
+
+			lastscan = scan - lenb
+			lastpos = pos - lenb
+			lastoffset = pos - scan
+		}
+	}
+	return out.Bytes()
+}
+
+func matchlen(a []byte, b []byte) int {
+	i := 0
+	for i < len(a) && i < len(b) && a[i] == b[i] {
+		i++
+	}
+	return i
+}
+
+func search(I []int, old []byte, cur []byte, st int, en int) (int, int) {
+	for en-st >= 2 {
+		x := st + (en-st)/2
+		n := len(old) - I[x]
+		if n > len(cur) {
+			n = len(cur)
+		}
+		if bytes.Compare(old[I[x]:I[x]+n], cur[:n]) < 0 {
+			st = x
+		} else {
+			en = x
+		}
+	}
+	x := matchlen(old[I[st]:], cur)
+	y := matchlen(old[I[en]:], cur)
+	if x > y {
+		return x, I[st]
+	}
+	return y, I[en]
+}
+
+// qsufsort builds the suffix array of old with the Larsson-Sadakane
+// algorithm. The result has len(old)+1 entries including the empty suffix.
+func qsufsort(old []byte) []int {
+	n := len(old)
+	I := make([]int, n+1)
+	V := make([]int, n+1)
+	var buckets [256]int
+	for _, c := range old {
+		buckets[c]++
+	}
+	for i := 1; i < 256; i++ {
+		buckets[i] += buckets[i-1]
+	}
+	for i := 255; i > 0; i-- {
+		buckets[i] = buckets[i-1]
+	}
+	buckets[0] = 0
+	for i, c := range old {
+		buckets[c]++
+		I[buckets[c]] = i
+	}
+	I[0] = n
+	for i, c := range old {
+		V[i] = buckets[c]
+	}
+	V[n] = 0
+	for i := 1; i < 256; i++ {
+		if buckets[i] == buckets[i-1]+1 {
+			I[buckets[i]] = -1
+		}
+	}
+	I[0] = -1
+
+	for h := 1; I[0] != -(n + 1); h += h {
+		length := 0
+		i := 0
+		for i < n+1 {
+			if I[i] < 0 {
+				length -= I[i]
+				i -= I[i]
+			} else {
+				if length != 0 {
+					I[i-length] = -length
+				}
+				length = V[I[i]] + 1 - i
+				split(I, V, i, length, h)
+				i += length
+				length = 0
+			}
+		}
+		if length != 0 {
+			I[i-length] = -length
+		}
+	}
+	for i := 0; i < n+1; i++ {
+		I[V[i]] = i
+	}
+	return I
+}
+
+func split(I []int, V []int, start int, length int, h int) {
+	if length < 16 {
+		for k := start; k < start+length; {
+			j := 1
+			x := V[I[k]+h]
+			for i := 1; k+i < start+length; i++ {
+				if V[I[k+i]+h] < x {
+					x = V[I[k+i]+h]
+					j = 0
+				}
+				if V[I[k+i]+h] == x {
+					I[k+j], I[k+i] = I[k+i], I[k+j]
+					j++
+				}
+			}
+			for i := 0; i < j; i++ {
+				V[I[k+i]] = k + j - 1
+			}
+			if j == 1 {
+				I[k] = -1
+			}
+			k += j
+		}
+		return
+	}
+
+	x := V[I[start+length/2]+h]
+	jj, kk := 0, 0
+	for i := start; i < start+length; i++ {
+		if V[I[i]+h] < x {
+			jj++
+		}
+		if V[I[i]+h] == x {
+			kk++
+		}
+	}
+	jj += start
+	kk += jj
+
+	i, j, k := start, 0, 0
+	for i < jj {
+		if V[I[i]+h] < x {
+			i++
+		} else if V[I[i]+h] == x {
+			I[i], I[jj+j] = I[jj+j], I[i]
+			j++
+		} else {
+			I[i], I[kk+k] = I[kk+k], I[i]
+			k++
+		}
+	}
+	for jj+j < kk {
+		if V[I[jj+j]+h] == x {
+			j++
+		} else {
+			I[jj+j], I[kk+k] = I[kk+k], I[jj+j]
+			k++
+		}
+	}
+
+	if jj > start {
+		split(I, V, start, jj-start, h)
+	}
+	for i := 0; i < kk-jj; i++ {
+		V[I[jj+i]] = kk - 1
+	}
+	if jj == kk-1 {
+		I[jj] = -1
+	}
+	if start+length > kk {
+		split(I, V, kk, start+length-kk, h)
+	}
+}
@@ -0,0 +1,89 @@
+package deployment
+
+import (
+	"context"
+	"math/rand"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGetDelta(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	old := make([]byte, 64<<10)
+	r.Read(old)
+	cur := append([]byte{}, old[:20000]...)
+	cur = append(cur, []byte("inserted by the new release")...)
+	cur = append(cur, old[20000:50000]...)
+	for i := 0; i < 100; i++ {
+		cur[r.Intn(len(cur))] ^= 0x5a
+	}
+	dp.blobs["old"] = old
+	dp.blobs["cur"] = cur
+	dp.mtx.Lock()
+	delete(dp.deltas, "old:cur")
+	dp.mtx.Unlock()
+	_, err := FindDelta("old", "cur")
+	assert.Equal(t, ErrDeploymentDelta, err)
+	d, err := GetDelta("old", "cur")
+	assert.Equal(t, nil, err)
+	found, err := FindDelta("old", "cur")
+	assert.Equal(t, nil, err)
+	assert.Equal(t, d, found)
+	assert.Less(t, d.Size, len(cur)/4)
+	p, err := GetArtifact(d.Sha256)
+	assert.Equal(t, nil, err)
+	f, err := Patch(old, p)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, cur, f)
+
+	_, err = GetDelta("old", "missing")
+	assert.Equal(t, ErrDeploymentDelta, err)
+}
+
+func TestPatchCorrupt(t *testing.T) {
+	dp.blobs["base"] = []byte("hawkbit fota delta base image")
+	dp.blobs["next"] = []byte("hawkbit fota delta next image")
+	d, _ := GetDelta("base", "next")
+	p, _ := GetArtifact(d.Sha256)
+	_, err := Patch(dp.blobs["base"], p[:len(p)-1])
+	assert.Equal(t, ErrDeploymentPatch, err)
+	_, err = Patch(dp.blobs["base"], []byte("BSDIFF40"))
+	assert.Equal(t, ErrDeploymentPatch, err)
+}
+
+func TestGetDeltaShared(t *testing.T) {
+	r := rand.New(rand.NewSource(2))
+	old := make([]byte, 32<<10)
+	r.Read(old)
+	cur := append([]byte("a new header"), old...)
+	dp.mtx.Lock()
+	dp.blobs["shared-old"] = old
+	dp.blobs["shared-cur"] = cur
+	delete(dp.deltas, "shared-old:shared-cur")
+	j, err := startDelta(context.Background(), "shared-old", "shared-cur")
+	assert.Equal(t, nil, err)
+	again, _ := startDelta(context.Background(), "shared-old", "shared-cur")
+	dp.mtx.Unlock()
+	assert.True(t, j == again)
+
+	var wg sync.WaitGroup
+	ds := make([]Delta, 8)
+	for i := range ds {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			ds[i], _ = GetDelta("shared-old", "shared-cur")
+		}(i)
+	}
+	wg.Wait()
+	<-j.done
+	for _, d := range ds {
+		assert.Equal(t, j.d, d)
+	}
+	dp.mtx.Lock()
+	_, running := dp.deltaJobs["shared-old:shared-cur"]
+	dp.mtx.Unlock()
+	assert.False(t, running)
+}
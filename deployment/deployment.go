@@ -1,11 +1,13 @@
 package deployment
 
 import (
+	"context"
 	"crypto/sha256"
 	"errors"
 	"fmt"
-	"net/http"
+	"sort"
 	"sync"
+	"time"
 )
 
 var (
@@ -13,8 +15,27 @@ var (
 	ErrDeploymentUploadNotFound = errors.New("Deployment: upload not found")
 	ErrDeploymentDist           = errors.New("Deployment: distribution set failed")
 	ErrDeploymentDistNotFound   = errors.New("Deployment: distribution not found")
+	ErrDeploymentDistKey        = errors.New("Deployment: upload not signed by required key")
 	ErrDeployment               = errors.New("Deployment: deployment set failed")
 	ErrDeploymentNotFound       = errors.New("Deployment: deployment not found")
+	ErrDeploymentActionType     = errors.New("Deployment: invalid action type")
+	ErrDeploymentNotInstalled   = errors.New("Deployment: no installed distribution")
+	ErrDeploymentArtifact       = errors.New("Deployment: artifact not found")
+	ErrDeploymentIncompatible   = errors.New("Deployment: distribution incompatible with target hardware")
+)
+
+// Artifact variants a distribution can ship of its upload.
+const (
+	VariantOriginal = "original"
+	VariantSigned   = "signed"
+)
+
+// Action types of a deployment, following the hawkBit management API.
+const (
+	ActionForced       = "forced"
+	ActionSoft         = "soft"
+	ActionDownloadOnly = "downloadonly"
+	ActionTimeForced   = "timeforced"
 )
 
 type Upload struct {
@@ -23,26 +44,156 @@ type Upload struct {
 	Url     string `json:"url" example:"http://demo.svc/artifact.bin"`
 	Sha256  string `json:"sha256" example:"hash"`
 	Size    int    `json:"size" exameple:"12345"`
+
+	Mcuboot  *ImageInfo `json:"mcuboot,omitempty"`
+	SignedBy string     `json:"signedBy,omitempty" example:"release"`
+
+	Sign   *SignParams `json:"sign,omitempty"`
+	Signed *Artifact   `json:"signed,omitempty"`
+
+	Compress  []string            `json:"compress,omitempty" example:"gzip,lz4"`
+	Encodings map[string]Encoding `json:"encodings,omitempty"`
+}
+
+// Artifact describes a stored image derived from an upload.
+type Artifact struct {
+	Sha256    string              `json:"sha256" example:"hash"`
+	Size      int                 `json:"size" example:"12345"`
+	Mcuboot   *ImageInfo          `json:"mcuboot,omitempty"`
+	SignedBy  string              `json:"signedBy,omitempty" example:"release"`
+	Encodings map[string]Encoding `json:"encodings,omitempty"`
 }
 
 type Distribution struct {
 	Name    string `json:"name" example:"hawkbit"`
 	Version string `json:"version" example:"1.0.0+1"`
+	Key     string `json:"key,omitempty" example:"release"`
+	Variant string `json:"variant" example:"signed"`
 	Upload  Upload `json:"image"`
+
+	Compatible *Compatibility `json:"compatible,omitempty"`
+}
+
+// Image returns the artifact of the upload which the distribution ships.
+func (d Distribution) Image() Artifact {
+	if d.Variant == VariantSigned && d.Upload.Signed != nil {
+		return *d.Upload.Signed
+	}
+	return Artifact{
+		Sha256:    d.Upload.Sha256,
+		Size:      d.Upload.Size,
+		Mcuboot:   d.Upload.Mcuboot,
+		SignedBy:  d.Upload.SignedBy,
+		Encodings: d.Upload.Encodings,
+	}
 }
 
 type Status struct {
 	Execution string `json:"execution"`
 	Result    struct {
-		Finished string `json:"finished"`
+		Finished string    `json:"finished"`
+		Progress *Progress `json:"progress,omitempty"`
 	} `json:"result"`
 }
 
+// Terminal reports whether the target is done with the action, whatever the
+// result.
+func (s Status) Terminal() bool {
+	return s.Execution == "closed" || s.Execution == "canceled" || s.Execution == "rejected"
+}
+
+// Progress reports how many of the steps of an action a target completed.
+type Progress struct {
+	Cnt int `json:"cnt" example:"2"`
+	Of  int `json:"of" example:"5"`
+}
+
 type Deployment struct {
-	Target   string       `json:"target"`
-	ActionId string       `json:"actionid"`
-	Artifact Distribution `json:"artifact"`
-	Status   Status       `json:"status"`
+	Target      string             `json:"target"`
+	ActionId    string             `json:"actionid"`
+	Artifact    Distribution       `json:"artifact"`
+	Status      Status             `json:"status"`
+	Type        string             `json:"type"`
+	ForceTime   string             `json:"forcetime,omitempty"`
+	Maintenance *MaintenanceWindow `json:"maintenanceWindow,omitempty"`
+
+	ConfirmationRequired bool   `json:"confirmationRequired"`
+	Confirmation         string `json:"confirmation,omitempty"`
+}
+
+// DeploymentOptions carries the optional settings of a new deployment.
+// Type defaults to ActionForced; ForceTime is an RFC 3339 deadline and only
+// applies to ActionTimeForced. ConfirmationRequired holds the deployment back
+// until the target confirms it, unless auto-confirmation is active.
+type DeploymentOptions struct {
+	Type                 string
+	ForceTime            string
+	Maintenance          *MaintenanceWindow
+	ConfirmationRequired bool
+}
+
+// Done reports whether the target is done with the action: it closed,
+// canceled or rejected it, or downloaded the image of a download only one.
+func (d Deployment) Done() bool {
+	return d.Status.Terminal() || (d.Type == ActionDownloadOnly && d.Status.Execution == "downloaded")
+}
+
+// Succeeded reports whether the target is done with the action and did what
+// it asked for. Targets report the download of a download only action with
+// no result yet, so it succeeded unless they reported a failure.
+func (d Deployment) Succeeded() bool {
+	if !d.Done() {
+		return false
+	}
+	if d.Status.Execution == "downloaded" {
+		return d.Status.Result.Finished != "failure"
+	}
+	return d.Status.Execution == "closed" && d.Status.Result.Finished == "success"
+}
+
+// Forced reports whether the device is expected to install the update
+// without further consent at time t.
+func (d Deployment) Forced(t time.Time) bool {
+	switch d.Type {
+	case ActionSoft, ActionDownloadOnly:
+		return false
+	case ActionTimeForced:
+		ft, err := time.Parse(time.RFC3339, d.ForceTime)
+		return err == nil && !t.Before(ft)
+	default:
+		return true
+	}
+}
+
+func (o *DeploymentOptions) validate() error {
+	switch o.Type {
+	case "":
+		o.Type = ActionForced
+	case ActionForced, ActionSoft, ActionDownloadOnly:
+	case ActionTimeForced:
+		if _, err := time.Parse(time.RFC3339, o.ForceTime); err != nil {
+			return ErrDeploymentActionType
+		}
+	default:
+		return ErrDeploymentActionType
+	}
+	if o.Type != ActionTimeForced {
+		o.ForceTime = ""
+	}
+	if o.Maintenance != nil {
+		return o.Maintenance.validate()
+	}
+	return nil
+}
+
+// Target summarises the distribution assigned to a target and the one it
+// last reported as successfully installed.
+type Target struct {
+	Name      string        `json:"name" example:"ti_cc3200wf_12345"`
+	Assigned  *Distribution `json:"assigned,omitempty"`
+	Installed *Distribution `json:"installed,omitempty"`
+	LastPoll  *time.Time    `json:"lastPoll,omitempty"`
+	Tags      []string      `json:"tags,omitempty" example:"lab"`
 }
 
 type hawkbitDeployment struct {
@@ -50,28 +201,155 @@ type hawkbitDeployment struct {
 	uploads     map[string]Upload
 	artifacts   map[string]Distribution
 	deployments map[string]Deployment
+	installed   map[string]Deployment
+	autoconfirm map[string]AutoConfirm
+	fetch       FetchPolicy
+	keys        map[string]trustedKey
+	signer      *signingKey
+	blobs       map[string][]byte
+	deltas      map[string]Delta
+	deltaJobs   map[string]*deltaJob
+	attributes  map[string]map[string]string
+	polled      map[string]time.Time
+	audit       []AuditEntry
+	hooks       map[string]Webhook
+	hookPolicy  WebhookPolicy
+	deliveries  map[string][]Delivery
+	hookWorkers map[string]*hookWorker
+	subs        map[int]*Subscription
+	nextSub     int
+
+	// auditDropped entries were dropped from the audit trail, the last of
+	// them with hash auditCheckpoint.
+	auditDropped    int
+	auditCheckpoint string
+	auditRetention  int
+
+	rollouts map[string]Rollout
+	tags     map[string][]string
 }
 
 func SetUpload(u Upload) error {
-	var f []byte
+	return SetUploadContext(context.Background(), u)
+}
+
+// SetUploadContext is SetUpload with the image fetch carried out on behalf
+// of ctx, so it is traced and cancelled along with it.
+func SetUploadContext(ctx context.Context, u Upload) (err error) {
+	ctx, span := startSpan(ctx, "SetUpload", SpanUpload.String(u.Name))
+	defer func() { EndSpan(span, err) }()
 	if u.Name == "" || u.Version == "" {
 		return ErrDeploymentUpload
 	}
-	resp, err := http.Get(u.Url)
+	f, err := FetchContext(ctx, u.Url)
 	if err != nil {
-		return ErrDeploymentUpload
+		return err
 	}
-	defer resp.Body.Close()
-	n, err := resp.Body.Read(f)
-	if err != nil {
+	return storeUpload(ctx, u, f)
+}
+
+// SetUploadImage is SetUploadContext with the image given as f rather than
+// fetched from u.Url. Images are subject to the MaxSize of the FetchPolicy
+// all the same.
+func SetUploadImage(ctx context.Context, u Upload, f []byte) (err error) {
+	_, span := startSpan(ctx, "SetUploadImage", SpanUpload.String(u.Name))
+	defer func() { EndSpan(span, err) }()
+	if u.Name == "" || u.Version == "" {
 		return ErrDeploymentUpload
 	}
-	u.Size = n
+	if int64(len(f)) > GetFetchPolicy().MaxSize {
+		return ErrDeploymentFetchSize
+	}
+	return storeUpload(ctx, u, f)
+}
+
+// storeUpload verifies or signs image f of u and stores both.
+func storeUpload(ctx context.Context, u Upload, f []byte) error {
+	for _, e := range u.Compress {
+		if e != EncodingGzip && e != EncodingLZ4 && e != EncodingHeatshrink {
+			return ErrDeploymentEncoding
+		}
+	}
+	dp.mtx.Lock()
+	signer := dp.signer
+	keys := make(map[string]trustedKey, len(dp.keys))
+	for id, k := range dp.keys {
+		keys[id] = k
+	}
+	dp.mtx.Unlock()
+
+	// Signing, verification and compression run without the store lock,
+	// which every poll of a target needs.
+	var img []byte
+	if u.Sign != nil {
+		// Raw builds are signed here; MCUboot images already carry their
+		// own header and must be signed by the build system.
+		if isMcuboot(f) {
+			return ErrDeploymentSign
+		}
+		var err error
+		if img, err = signImage(f, u.Version, *u.Sign, signer); err != nil {
+			return err
+		}
+		m, err := parseMcuboot(img)
+		if err != nil {
+			return err
+		}
+		by := signer.id
+		// The signing key is held to the trusted keys like any other.
+		if len(keys) > 0 {
+			if by, err = m.verify(keys); err != nil {
+				return err
+			}
+		}
+		u.Signed = &Artifact{
+			Sha256:   fmt.Sprintf("%x", sha256.Sum256(img)),
+			Size:     len(img),
+			Mcuboot:  m.info(),
+			SignedBy: by,
+		}
+	} else if isMcuboot(f) {
+		m, err := parseMcuboot(f)
+		if err != nil {
+			return err
+		}
+		if err := m.check(u.Version); err != nil {
+			return err
+		}
+		u.Mcuboot = m.info()
+		if len(keys) > 0 {
+			if u.SignedBy, err = m.verify(keys); err != nil {
+				return err
+			}
+		}
+	} else if len(keys) > 0 {
+		return ErrDeploymentUnsigned
+	}
+	u.Size = len(f)
 	hash := sha256.Sum256(f)
 	u.Sha256 = fmt.Sprintf("%x", hash)
+	blobs := map[string][]byte{u.Sha256: f}
+	var encoded map[string][]byte
+	u.Encodings, encoded = compressEncodings(f, u.Compress)
+	for sha, c := range encoded {
+		blobs[sha] = c
+	}
+	if img != nil {
+		blobs[u.Signed.Sha256] = img
+		u.Signed.Encodings, encoded = compressEncodings(img, u.Compress)
+		for sha, c := range encoded {
+			blobs[sha] = c
+		}
+	}
+
 	dp.mtx.Lock()
 	defer dp.mtx.Unlock()
+	for sha, b := range blobs {
+		dp.blobs[sha] = b
+	}
+	audit(ctx, "upload/"+u.Name, stored(dp.uploads, u.Name), u)
 	dp.uploads[u.Name] = u
+	publish(UploadCreated{Time: time.Now().UTC(), Upload: u})
 
 	return nil
 }
@@ -86,17 +364,79 @@ func GetUpload(n string) (Upload, error) {
 	return u, nil
 }
 
+// compressEncodings compresses f with each of encs, returning the encodings
+// and the compressed blobs by hash. Compression is slow, heatshrink in
+// particular, so it runs without the store lock.
+func compressEncodings(f []byte, encs []string) (map[string]Encoding, map[string][]byte) {
+	if len(encs) == 0 {
+		return nil, nil
+	}
+	m := map[string]Encoding{}
+	blobs := map[string][]byte{}
+	for _, e := range encs {
+		c, err := compress(e, f)
+		if err != nil {
+			continue
+		}
+		sha := fmt.Sprintf("%x", sha256.Sum256(c))
+		blobs[sha] = c
+		m[e] = Encoding{Sha256: sha, Size: len(c)}
+	}
+	return m, blobs
+}
+
+// GetArtifact returns the stored image with the given SHA-256 hash.
+func GetArtifact(sha string) ([]byte, error) {
+	dp.mtx.Lock()
+	defer dp.mtx.Unlock()
+	f, ok := dp.blobs[sha]
+	if !ok {
+		return nil, ErrDeploymentArtifact
+	}
+	return f, nil
+}
+
 func SetDistribution(d Distribution, u string) error {
+	return SetDistributionContext(context.Background(), d, u)
+}
+
+// SetDistributionContext is SetDistribution traced as part of ctx.
+func SetDistributionContext(ctx context.Context, d Distribution, u string) (err error) {
+	_, span := startSpan(ctx, "SetDistribution", SpanDistribution.String(d.Name), SpanUpload.String(u))
+	defer func() { EndSpan(span, err) }()
 	if d.Name == "" || d.Version == "" {
 		return ErrDeploymentDist
 	}
+	dp.mtx.Lock()
+	defer dp.mtx.Unlock()
 	upl, ok := dp.uploads[u]
 	if !ok {
 		return ErrDeploymentDist
 	}
 	d.Upload = upl
-	dp.mtx.Lock()
-	defer dp.mtx.Unlock()
+	switch d.Variant {
+	case "":
+		d.Variant = VariantOriginal
+		if upl.Signed != nil {
+			d.Variant = VariantSigned
+		}
+	case VariantOriginal:
+	case VariantSigned:
+		if upl.Signed == nil {
+			return ErrDeploymentDist
+		}
+	default:
+		return ErrDeploymentDist
+	}
+	if d.Key != "" && d.Key != d.Image().SignedBy {
+		return ErrDeploymentDistKey
+	}
+	// The original of an upload signed on the server is the raw build,
+	// which must not be shipped once keys are trusted.
+	if len(dp.keys) > 0 && d.Image().SignedBy == "" {
+		return ErrDeploymentUnsigned
+	}
+	audit(ctx, "distribution/"+d.Name, stored(dp.artifacts, d.Name), d)
 	dp.artifacts[d.Name] = d
 
 	return nil
@@ -112,23 +452,64 @@ func GetDistribution(n string) (Distribution, error) {
 	return d, nil
 }
 
-func SetDeployment(t string, d string) error {
+func SetDeployment(t string, d string, o DeploymentOptions) error {
+	return SetDeploymentContext(context.Background(), t, d, o)
+}
+
+// SetDeploymentContext is SetDeployment traced as part of ctx.
+func SetDeploymentContext(ctx context.Context, t string, d string, o DeploymentOptions) (err error) {
+	ctx, span := startSpan(ctx, "SetDeployment", SpanTarget.String(t), SpanDistribution.String(d))
+	defer func() { EndSpan(span, err) }()
+	if err := o.validate(); err != nil {
+		return err
+	}
 	dp.mtx.Lock()
 	defer dp.mtx.Unlock()
 	a, ok := dp.artifacts[d]
 	if !ok {
 		return ErrDeployment
 	}
+	if !a.Compatible.Matches(dp.attributes[t]) {
+		return ErrDeploymentIncompatible
+	}
 	var n Deployment
 	n.Target = t
 	n.Artifact = a
 	n.ActionId = a.Upload.Sha256[0:7]
+	n.Type = o.Type
+	n.ForceTime = o.ForceTime
+	n.Maintenance = o.Maintenance
+	if o.ConfirmationRequired {
+		n.ConfirmationRequired = true
+		n.Confirmation = ConfirmationPending
+		if dp.autoconfirm[t].Active {
+			n.Confirmation = ConfirmationConfirmed
+		}
+	}
+	audit(ctx, "deployment/"+t, stored(dp.deployments, t), n)
 	dp.deployments[t] = n
+	if i, ok := dp.installed[t]; ok {
+		// Diffing takes long, so the delta from the installed image is
+		// prepared now rather than on the next poll of the target. Targets
+		// assigned the same update share the job.
+		base, target := i.Artifact.Image().Sha256, a.Image().Sha256
+		if _, ok := dp.deltas[base+":"+target]; !ok {
+			startDelta(ctx, base, target)
+		}
+	}
+	publish(DeploymentAssigned{Time: time.Now().UTC(), Deployment: n})
 
 	return nil
 }
 
 func GetDeployment(t string) (Deployment, error) {
+	return GetDeploymentContext(context.Background(), t)
+}
+
+// GetDeploymentContext is GetDeployment traced as part of ctx.
+func GetDeploymentContext(ctx context.Context, t string) (_ Deployment, err error) {
+	_, span := startSpan(ctx, "GetDeployment", SpanTarget.String(t))
+	defer func() { EndSpan(span, err) }()
 	dp.mtx.Lock()
 	defer dp.mtx.Unlock()
 	d, ok := dp.deployments[t]
@@ -139,6 +520,13 @@ func GetDeployment(t string) (Deployment, error) {
 }
 
 func UpdateStatus(t string, acid string, s Status) error {
+	return UpdateStatusContext(context.Background(), t, acid, s)
+}
+
+// UpdateStatusContext is UpdateStatus traced as part of ctx.
+func UpdateStatusContext(ctx context.Context, t string, acid string, s Status) (err error) {
+	_, span := startSpan(ctx, "UpdateStatus", SpanTarget.String(t), SpanAction.String(acid))
+	defer func() { EndSpan(span, err) }()
 	dp.mtx.Lock()
 	defer dp.mtx.Unlock()
 	d, ok := dp.deployments[t]
@@ -146,14 +534,91 @@ func UpdateStatus(t string, acid string, s Status) error {
 		return ErrDeploymentNotFound
 	}
 	if acid == d.ActionId {
+		if d.Status.Execution != s.Execution || d.Status.Result.Finished != s.Result.Finished ||
+			s.Result.Progress != nil {
+			publish(StatusChanged{Time: time.Now().UTC(), Target: t, ActionId: acid,
+				Distribution: d.Artifact.Name, Before: d.Status, After: s})
+		}
+		before := d
 		d.Status = s
 		dp.deployments[t] = d
+		audit(ctx, "deployment/"+t, before, d)
+		if s.Execution == "closed" && s.Result.Finished == "success" {
+			dp.installed[t] = d
+		}
 	}
 	return nil
 }
 
+// GetInstalled returns the deployment which target t last finished with success.
+func GetInstalled(t string) (Deployment, error) {
+	dp.mtx.Lock()
+	defer dp.mtx.Unlock()
+	d, ok := dp.installed[t]
+	if !ok {
+		return Deployment{}, ErrDeploymentNotInstalled
+	}
+	return d, nil
+}
+
+// GetTargets lists every known target ordered by name.
+func GetTargets() []Target {
+	dp.mtx.Lock()
+	defer dp.mtx.Unlock()
+	m := map[string]*Target{}
+	for n, d := range dp.deployments {
+		a := d.Artifact
+		m[n] = &Target{Name: n, Assigned: &a}
+	}
+	for n, d := range dp.installed {
+		if _, ok := m[n]; !ok {
+			m[n] = &Target{Name: n}
+		}
+		i := d.Artifact
+		m[n].Installed = &i
+	}
+	for n, at := range dp.polled {
+		if _, ok := m[n]; !ok {
+			m[n] = &Target{Name: n}
+		}
+		p := at
+		m[n].LastPoll = &p
+	}
+	for n, tags := range dp.tags {
+		if _, ok := m[n]; !ok {
+			m[n] = &Target{Name: n}
+		}
+		m[n].Tags = append([]string{}, tags...)
+	}
+	ts := make([]Target, 0, len(m))
+	for _, t := range m {
+		ts = append(ts, *t)
+	}
+	sort.Slice(ts, func(i, j int) bool { return ts[i].Name < ts[j].Name })
+	return ts
+}
+
 var dp = &hawkbitDeployment{
 	uploads:     map[string]Upload{},
 	artifacts:   map[string]Distribution{},
 	deployments: map[string]Deployment{},
+	installed:   map[string]Deployment{},
+	autoconfirm: map[string]AutoConfirm{},
+	fetch:       DefaultFetchPolicy,
+	keys:        map[string]trustedKey{},
+	blobs:       map[string][]byte{},
+	deltas:      map[string]Delta{},
+	deltaJobs:   map[string]*deltaJob{},
+	attributes:  map[string]map[string]string{},
+	polled:      map[string]time.Time{},
+	hooks:       map[string]Webhook{},
+	hookPolicy:  DefaultWebhookPolicy,
+	deliveries:  map[string][]Delivery{},
+	hookWorkers: map[string]*hookWorker{},
+	subs:        map[int]*Subscription{},
+
+	auditRetention: DefaultAuditRetention,
+
+	rollouts: map[string]Rollout{},
+	tags:     map[string][]string{},
 }
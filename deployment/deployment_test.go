@@ -1,35 +1,57 @@
 package deployment
 
 import (
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 )
 
+var dummy = make([]byte, 27876)
+
+func newImageServer() *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/dummy.bin" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write(dummy)
+	}))
+}
+
 func TestSetUpload(t *testing.T) {
+	s := newImageServer()
+	defer s.Close()
 	var u Upload
-	u.File = "./dummy.bin"
+	u.Url = s.URL + "/dummy.bin"
 	u.Version = "1.2.3"
 	u.Name = "test"
 	err := SetUpload(u)
 	assert.Equal(t, nil, err)
 	u = dp.uploads["test"]
 	assert.Equal(t, 27876, u.Size)
-	assert.Equal(t, "dcb4462ed887656327579517f5dfc88daf7f6db5afdece7c945de5243d0fc305", u.Sha256)
+	assert.Equal(t, fmt.Sprintf("%x", sha256.Sum256(dummy)), u.Sha256)
 }
 
 func TestSetUploadInvalidFile(t *testing.T) {
+	s := newImageServer()
+	defer s.Close()
 	var u Upload
-	u.File = "./dum.bin"
+	u.Url = s.URL + "/dum.bin"
 	u.Version = "1.2.3"
 	u.Name = "test"
 	err := SetUpload(u)
-	assert.NotEqual(t, nil, err)
+	assert.Equal(t, ErrDeploymentFetchStatus, err)
 }
 
 func TestSetUploadEmptyVersion(t *testing.T) {
 	var u Upload
-	u.File = "./dummy.bin"
+	u.Url = "http://localhost/dummy.bin"
 	u.Version = ""
 	u.Name = "test"
 	err := SetUpload(u)
@@ -38,9 +60,113 @@ func TestSetUploadEmptyVersion(t *testing.T) {
 
 func TestSetUploadEmptyName(t *testing.T) {
 	var u Upload
-	u.File = "./dummy.bin"
+	u.Url = "http://localhost/dummy.bin"
 	u.Version = "1.2.3"
 	u.Name = ""
 	err := SetUpload(u)
 	assert.NotEqual(t, nil, err)
 }
+
+func TestSetUploadImage(t *testing.T) {
+	var u Upload
+	u.Version = "1.2.3"
+	u.Name = "test-image"
+	err := SetUploadImage(context.Background(), u, dummy)
+	assert.Equal(t, nil, err)
+	u = dp.uploads["test-image"]
+	assert.Equal(t, len(dummy), u.Size)
+	assert.Equal(t, fmt.Sprintf("%x", sha256.Sum256(dummy)), u.Sha256)
+
+	SetFetchPolicy(FetchPolicy{Timeout: time.Second, MaxSize: 1024})
+	defer SetFetchPolicy(DefaultFetchPolicy)
+	err = SetUploadImage(context.Background(), u, dummy)
+	assert.Equal(t, ErrDeploymentFetchSize, err)
+}
+
+func TestFetchMaxSize(t *testing.T) {
+	s := newImageServer()
+	defer s.Close()
+	SetFetchPolicy(FetchPolicy{Timeout: time.Second, MaxSize: 1024})
+	defer SetFetchPolicy(DefaultFetchPolicy)
+	_, err := Fetch(s.URL + "/dummy.bin")
+	assert.Equal(t, ErrDeploymentFetchSize, err)
+}
+
+func TestFetchRetry(t *testing.T) {
+	n := 0
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if n++; n < 3 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.Write(dummy)
+	}))
+	defer s.Close()
+	SetFetchPolicy(FetchPolicy{Timeout: time.Second, Retries: 2, Backoff: time.Millisecond})
+	defer SetFetchPolicy(DefaultFetchPolicy)
+	f, err := Fetch(s.URL)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, len(dummy), len(f))
+	assert.Equal(t, 3, n)
+}
+
+func TestFetchRetryCanceled(t *testing.T) {
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer s.Close()
+	SetFetchPolicy(FetchPolicy{Timeout: time.Second, Retries: 3, Backoff: time.Hour})
+	defer SetFetchPolicy(DefaultFetchPolicy)
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	begin := time.Now()
+	_, err := FetchContext(ctx, s.URL)
+	assert.Equal(t, ErrDeploymentFetchStatus, err)
+	assert.True(t, time.Since(begin) < time.Minute)
+}
+
+func TestGetStats(t *testing.T) {
+	now := time.Now()
+	dp.mtx.Lock()
+	delete(dp.polled, "stats-online")
+	dp.mtx.Unlock()
+	online := GetStats(now, 10*time.Minute).TargetsOnline
+	SetPolled("stats-online", now.Add(-time.Minute))
+	SetPolled("stats-offline", now.Add(-time.Hour))
+	s := GetStats(now, 10*time.Minute)
+	assert.Equal(t, online+1, s.TargetsOnline)
+
+	var found bool
+	for _, tg := range GetTargets() {
+		if tg.Name == "stats-offline" {
+			found = true
+			assert.Equal(t, now.Add(-time.Hour), *tg.LastPoll)
+		}
+	}
+	assert.True(t, found)
+}
+
+func TestDeploymentDone(t *testing.T) {
+	for _, c := range []struct {
+		typ, execution, finished string
+		done, succeeded          bool
+	}{
+		{ActionForced, "proceeding", "none", false, false},
+		{ActionForced, "closed", "success", true, true},
+		{ActionForced, "closed", "failure", true, false},
+		{ActionForced, "canceled", "success", true, false},
+		{ActionForced, "rejected", "success", true, false},
+		{ActionForced, "downloaded", "success", false, false},
+		{ActionDownloadOnly, "downloaded", "success", true, true},
+		{ActionDownloadOnly, "downloaded", "none", true, true},
+		{ActionDownloadOnly, "closed", "success", true, true},
+		{ActionDownloadOnly, "downloaded", "failure", true, false},
+	} {
+		var d Deployment
+		d.Type = c.typ
+		d.Status.Execution = c.execution
+		d.Status.Result.Finished = c.finished
+		assert.Equal(t, c.done, d.Done(), "%s %s", c.typ, c.execution)
+		assert.Equal(t, c.succeeded, d.Succeeded(), "%s %s %s", c.typ, c.execution, c.finished)
+	}
+}
@@ -0,0 +1,181 @@
+package deployment
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// Message is an event published on the bus whenever the store changes.
+// Messages are published in the order the changes were made.
+type Message interface {
+	isMessage()
+}
+
+// UploadCreated is published once an upload has been stored.
+type UploadCreated struct {
+	Time   time.Time
+	Upload Upload
+}
+
+// DeploymentAssigned is published when a distribution is assigned to a
+// target.
+type DeploymentAssigned struct {
+	Time       time.Time
+	Deployment Deployment
+}
+
+// StatusChanged is published when a target reports a new execution state,
+// result or progress for its current action.
+type StatusChanged struct {
+	Time         time.Time
+	Target       string
+	ActionId     string
+	Distribution string
+	Before       Status
+	After        Status
+}
+
+// TargetPolled is published whenever a target polls for updates. First is
+// set on the first poll of a target.
+type TargetPolled struct {
+	Time   time.Time
+	Target string
+	First  bool
+}
+
+// TargetTagged is published when the tags of a target are replaced. Tags
+// are sorted.
+type TargetTagged struct {
+	Time   time.Time
+	Target string
+	Tags   []string
+}
+
+// Has reports whether the target carries tag now.
+func (m TargetTagged) Has(tag string) bool {
+	return hasTag(m.Tags, tag)
+}
+
+// RolloutChanged is published when the client running a rollout reports
+// its state. Before is the zero Rollout on the first report.
+type RolloutChanged struct {
+	Time    time.Time
+	Before  Rollout
+	Rollout Rollout
+}
+
+func (UploadCreated) isMessage()      {}
+func (DeploymentAssigned) isMessage() {}
+func (StatusChanged) isMessage()      {}
+func (TargetPolled) isMessage()       {}
+func (TargetTagged) isMessage()       {}
+func (RolloutChanged) isMessage()     {}
+
+// Subscription hands bus messages to a handler in publish order.
+type Subscription struct {
+	id      int
+	ch      chan Message
+	done    chan struct{}
+	dropped uint64
+}
+
+// Subscribe calls h for every message published from now on, one at a time
+// and in publish order, from a goroutine of its own. Up to queue messages
+// are buffered; while the buffer is full further messages are dropped so a
+// slow subscriber never stalls the store.
+func Subscribe(queue int, h func(Message)) *Subscription {
+	s := &Subscription{ch: make(chan Message, queue), done: make(chan struct{})}
+	dp.mtx.Lock()
+	dp.nextSub++
+	s.id = dp.nextSub
+	dp.subs[s.id] = s
+	dp.mtx.Unlock()
+	go func() {
+		defer close(s.done)
+		for m := range s.ch {
+			h(m)
+		}
+	}()
+	return s
+}
+
+// Close ends the subscription once the buffered messages are handled. It
+// must not be called from the handler.
+func (s *Subscription) Close() {
+	dp.mtx.Lock()
+	if _, ok := dp.subs[s.id]; ok {
+		delete(dp.subs, s.id)
+		close(s.ch)
+	}
+	dp.mtx.Unlock()
+	<-s.done
+}
+
+// Dropped returns the number of messages dropped because the queue of s was
+// full.
+func (s *Subscription) Dropped() uint64 {
+	return atomic.LoadUint64(&s.dropped)
+}
+
+// publish hands m to every subscriber. The store lock must be held.
+func publish(m Message) {
+	for _, s := range dp.subs {
+		select {
+		case s.ch <- m:
+		default:
+			atomic.AddUint64(&s.dropped, 1)
+		}
+	}
+}
+
+// EventFilter selects the events streamed to an operator: those of Target,
+// of the targets tagged Tag and of rollout Rollout and its targets. Empty
+// fields select every event.
+type EventFilter struct {
+	Target  string
+	Tag     string
+	Rollout string
+}
+
+// Events translates m into the events posted to webhooks and streamed to
+// operators.
+func Events(m Message) []Event {
+	switch m := m.(type) {
+	case UploadCreated:
+		return []Event{{Type: EventUploadCreated, Time: m.Time, Upload: m.Upload.Name}}
+	case DeploymentAssigned:
+		d := m.Deployment
+		return []Event{{Type: EventActionAssigned, Time: m.Time, Target: d.Target, ActionId: d.ActionId,
+			Distribution: d.Artifact.Name}}
+	case StatusChanged:
+		e := Event{Type: EventActionProgress, Time: m.Time, Target: m.Target, ActionId: m.ActionId,
+			Distribution: m.Distribution, Status: &m.After}
+		if m.Before.Execution != m.After.Execution || m.Before.Result.Finished != m.After.Result.Finished {
+			e.Type = EventActionStatus
+		}
+		return []Event{e}
+	case TargetPolled:
+		e := Event{Type: EventTargetPolled, Time: m.Time, Target: m.Target}
+		if m.First {
+			r := e
+			r.Type = EventTargetRegistered
+			return []Event{r, e}
+		}
+		return []Event{e}
+	case TargetTagged:
+		return []Event{{Type: EventTargetTagged, Time: m.Time, Target: m.Target}}
+	case RolloutChanged:
+		r := m.Rollout
+		e := Event{Type: EventRolloutProgress, Time: m.Time, Rollout: r.Name, Distribution: r.Distribution}
+		if r.State != m.Before.State {
+			switch r.State {
+			case RolloutPaused:
+				e.Type = EventRolloutPaused
+			case RolloutFinished:
+				e.Type = EventRolloutFinished
+			}
+		}
+		return []Event{e}
+	}
+	return nil
+}
@@ -0,0 +1,57 @@
+package deployment
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSubscribe(t *testing.T) {
+	dp.mtx.Lock()
+	delete(dp.polled, "sub-a")
+	dp.mtx.Unlock()
+	var got []string
+	s := Subscribe(16, func(m Message) {
+		for _, e := range Events(m) {
+			if e.Target == "sub-a" {
+				got = append(got, e.Type)
+			}
+		}
+	})
+
+	SetPolled("sub-b", time.Now())
+	SetPolled("sub-a", time.Now())
+	dp.mtx.Lock()
+	dp.deployments["sub-a"] = Deployment{Target: "sub-a", ActionId: "1a2b3c4"}
+	dp.mtx.Unlock()
+	st := Status{Execution: "proceeding"}
+	UpdateStatus("sub-a", "1a2b3c4", st)
+	st.Result.Progress = &Progress{Cnt: 1, Of: 3}
+	UpdateStatus("sub-a", "1a2b3c4", st)
+	// Unchanged status without progress is not an event.
+	UpdateStatus("sub-a", "1a2b3c4", Status{Execution: "proceeding"})
+	SetPolled("sub-a", time.Now())
+
+	s.Close()
+	assert.Equal(t, []string{EventTargetRegistered, EventTargetPolled, EventActionStatus,
+		EventActionProgress, EventTargetPolled}, got)
+	assert.Equal(t, uint64(0), s.Dropped())
+}
+
+func TestSubscribeBounded(t *testing.T) {
+	block := make(chan struct{})
+	n := 0
+	s := Subscribe(2, func(m Message) {
+		<-block
+		n++
+	})
+	for i := 0; i < 5; i++ {
+		SetPolled("bounded", time.Now())
+	}
+	close(block)
+	s.Close()
+	// One message is being handled and two are queued, the rest is dropped.
+	assert.Equal(t, uint64(5-n), s.Dropped())
+	assert.LessOrEqual(t, n, 3)
+}
@@ -0,0 +1,119 @@
+package deployment
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"time"
+
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+)
+
+var (
+	ErrDeploymentFetch       = errors.New("Deployment: image fetch failed")
+	ErrDeploymentFetchStatus = errors.New("Deployment: image server returned non-2xx status")
+	ErrDeploymentFetchSize   = errors.New("Deployment: image exceeds maximum size")
+	ErrDeploymentFetchLength = errors.New("Deployment: image length does not match Content-Length")
+)
+
+// FetchPolicy controls how images are retrieved from the URL given at
+// upload time. A request is attempted Retries+1 times; the delay between
+// attempts starts at Backoff and doubles after each failure.
+type FetchPolicy struct {
+	Timeout time.Duration
+	Retries int
+	Backoff time.Duration
+	MaxSize int64
+}
+
+var DefaultFetchPolicy = FetchPolicy{
+	Timeout: 30 * time.Second,
+	Retries: 3,
+	Backoff: time.Second,
+	MaxSize: 16 << 20,
+}
+
+func SetFetchPolicy(p FetchPolicy) {
+	dp.mtx.Lock()
+	defer dp.mtx.Unlock()
+	dp.fetch = p
+}
+
+func GetFetchPolicy() FetchPolicy {
+	dp.mtx.Lock()
+	defer dp.mtx.Unlock()
+	return dp.fetch
+}
+
+// Fetch downloads the image at url according to the current FetchPolicy.
+func Fetch(url string) ([]byte, error) {
+	return FetchContext(context.Background(), url)
+}
+
+// FetchContext is Fetch with the requests made on behalf of ctx. The trace
+// context of ctx is propagated to the image server.
+func FetchContext(ctx context.Context, url string) ([]byte, error) {
+	p := GetFetchPolicy()
+	c := &http.Client{
+		Timeout:   p.Timeout,
+		Transport: otelhttp.NewTransport(http.DefaultTransport),
+	}
+	backoff := p.Backoff
+	var err error
+	for i := 0; i <= p.Retries; i++ {
+		if i > 0 {
+			select {
+			case <-time.After(backoff):
+			case <-ctx.Done():
+				return nil, err
+			}
+			backoff *= 2
+		}
+		var f []byte
+		var retry bool
+		f, retry, err = fetchOnce(ctx, c, url, p.MaxSize)
+		if err == nil {
+			return f, nil
+		}
+		if !retry {
+			break
+		}
+	}
+	return nil, err
+}
+
+func fetchOnce(ctx context.Context, c *http.Client, url string, max int64) ([]byte, bool, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, false, ErrDeploymentFetch
+	}
+	resp, err := c.Do(req)
+	if err != nil {
+		return nil, true, ErrDeploymentFetch
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		// Only server side and throttling failures are worth another try.
+		retry := resp.StatusCode >= 500 || resp.StatusCode == http.StatusTooManyRequests
+		return nil, retry, ErrDeploymentFetchStatus
+	}
+	if max > 0 && resp.ContentLength > max {
+		return nil, false, ErrDeploymentFetchSize
+	}
+	r := io.Reader(resp.Body)
+	if max > 0 {
+		r = io.LimitReader(resp.Body, max+1)
+	}
+	f, err := io.ReadAll(r)
+	if err != nil {
+		return nil, true, ErrDeploymentFetch
+	}
+	if max > 0 && int64(len(f)) > max {
+		return nil, false, ErrDeploymentFetchSize
+	}
+	if resp.ContentLength >= 0 && int64(len(f)) != resp.ContentLength {
+		return nil, true, ErrDeploymentFetchLength
+	}
+	return f, false, nil
+}
@@ -0,0 +1,152 @@
+package deployment
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+var (
+	ErrDeploymentKey       = errors.New("Deployment: invalid public key")
+	ErrDeploymentUnsigned  = errors.New("Deployment: image not signed by a trusted key")
+	ErrDeploymentSignature = errors.New("Deployment: image signature verification failed")
+)
+
+type trustedKey struct {
+	id   string
+	pub  crypto.PublicKey
+	hash []byte
+}
+
+// AddTrustedKey adds the PEM encoded public key p to the set of keys which
+// uploads must be signed with. Once at least one key is trusted, uploads
+// which are not MCUboot images signed by a trusted key are refused.
+func AddTrustedKey(id string, p []byte) error {
+	b, _ := pem.Decode(p)
+	if b == nil || id == "" {
+		return ErrDeploymentKey
+	}
+	var pub crypto.PublicKey
+	var err error
+	switch b.Type {
+	case "PUBLIC KEY":
+		pub, err = x509.ParsePKIXPublicKey(b.Bytes)
+	case "RSA PUBLIC KEY":
+		pub, err = x509.ParsePKCS1PublicKey(b.Bytes)
+	default:
+		return ErrDeploymentKey
+	}
+	if err != nil {
+		return ErrDeploymentKey
+	}
+	h, err := keyHash(pub)
+	if err != nil {
+		return err
+	}
+	dp.mtx.Lock()
+	defer dp.mtx.Unlock()
+	dp.keys[id] = trustedKey{id: id, pub: pub, hash: h}
+	return nil
+}
+
+// LoadTrustedKeys adds every *.pem file in dir as a trusted key, named
+// after the file without its extension.
+func LoadTrustedKeys(dir string) error {
+	files, err := filepath.Glob(filepath.Join(dir, "*.pem"))
+	if err != nil {
+		return err
+	}
+	for _, f := range files {
+		p, err := os.ReadFile(f)
+		if err != nil {
+			return err
+		}
+		id := strings.TrimSuffix(filepath.Base(f), ".pem")
+		if err := AddTrustedKey(id, p); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// keyHash returns the hash MCUboot embeds in the KEYHASH TLV, which covers
+// the public key encoded the way imgtool does.
+func keyHash(pub crypto.PublicKey) ([]byte, error) {
+	var der []byte
+	var err error
+	switch k := pub.(type) {
+	case *ecdsa.PublicKey:
+		if k.Curve != elliptic.P256() {
+			return nil, ErrDeploymentKey
+		}
+		der, err = x509.MarshalPKIXPublicKey(k)
+	case *rsa.PublicKey:
+		if k.Size() != 256 {
+			return nil, ErrDeploymentKey
+		}
+		der = x509.MarshalPKCS1PublicKey(k)
+	case ed25519.PublicKey:
+		der, err = x509.MarshalPKIXPublicKey(k)
+	default:
+		return nil, ErrDeploymentKey
+	}
+	if err != nil {
+		return nil, ErrDeploymentKey
+	}
+	h := sha256.Sum256(der)
+	return h[:], nil
+}
+
+// verify checks the signature TLV of m against the trusted keys and returns
+// the id of the key which signed the image.
+func (m *mcubootImage) verify(keys map[string]trustedKey) (string, error) {
+	kh := m.find(tlvKeyHash)
+	if kh == nil {
+		if pk := m.find(tlvPubKey); pk != nil {
+			h := sha256.Sum256(pk)
+			kh = h[:]
+		}
+	}
+	if kh == nil {
+		return "", ErrDeploymentUnsigned
+	}
+	var k *trustedKey
+	for _, v := range keys {
+		if bytes.Equal(v.hash, kh) {
+			v := v
+			k = &v
+			break
+		}
+	}
+	if k == nil {
+		return "", ErrDeploymentUnsigned
+	}
+	digest := sha256.Sum256(m.payload)
+	var ok bool
+	switch pub := k.pub.(type) {
+	case *ecdsa.PublicKey:
+		sig := m.find(tlvEcdsaSig)
+		ok = sig != nil && ecdsa.VerifyASN1(pub, digest[:], sig)
+	case *rsa.PublicKey:
+		sig := m.find(tlvRsa2048Pss)
+		ok = sig != nil && rsa.VerifyPSS(pub, crypto.SHA256, digest[:], sig,
+			&rsa.PSSOptions{SaltLength: sha256.Size}) == nil
+	case ed25519.PublicKey:
+		sig := m.find(tlvEd25519)
+		ok = sig != nil && ed25519.Verify(pub, digest[:], sig)
+	}
+	if !ok {
+		return "", ErrDeploymentSignature
+	}
+	return k.id, nil
+}
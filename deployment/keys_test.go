@@ -0,0 +1,56 @@
+package deployment
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSetUploadSigned(t *testing.T) {
+	k, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	der, _ := x509.MarshalPKIXPublicKey(&k.PublicKey)
+	assert.Equal(t, nil, AddTrustedKey("release", pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der})))
+	defer func() { dp.keys = map[string]trustedKey{} }()
+	kh, _ := keyHash(&k.PublicKey)
+	sign := func(digest []byte) []tlv {
+		sig, _ := ecdsa.SignASN1(rand.Reader, k, digest)
+		return []tlv{{Type: tlvKeyHash, Data: kh}, {Type: tlvEcdsaSig, Data: sig}}
+	}
+
+	var f []byte
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write(f)
+	}))
+	defer s.Close()
+
+	f = makeTestImage(imageVersion{1, 0, 0, 0}, dummy, sign)
+	assert.Equal(t, nil, SetUpload(Upload{Name: "signed", Version: "1.0.0", Url: s.URL}))
+	assert.Equal(t, "release", dp.uploads["signed"].SignedBy)
+	assert.Equal(t, "ECDSA-P256", dp.uploads["signed"].Mcuboot.Signature)
+	assert.Equal(t, nil, SetDistribution(Distribution{Name: "d", Version: "1", Key: "release"}, "signed"))
+
+	f = makeTestImage(imageVersion{1, 0, 0, 0}, dummy, sign)
+	f[len(f)-1] ^= 0xff
+	assert.Equal(t, ErrDeploymentSignature, SetUpload(Upload{Name: "tampered", Version: "1.0.0", Url: s.URL}))
+
+	f = makeTestImage(imageVersion{1, 0, 0, 0}, dummy)
+	assert.Equal(t, ErrDeploymentUnsigned, SetUpload(Upload{Name: "unsigned", Version: "1.0.0", Url: s.URL}))
+
+	f = dummy
+	assert.Equal(t, ErrDeploymentUnsigned, SetUpload(Upload{Name: "raw", Version: "1.0.0", Url: s.URL}))
+}
+
+func TestSetDistributionKeyMismatch(t *testing.T) {
+	s := newImageServer()
+	defer s.Close()
+	assert.Equal(t, nil, SetUpload(Upload{Name: "raw", Version: "1.0.0", Url: s.URL + "/dummy.bin"}))
+	err := SetDistribution(Distribution{Name: "d", Version: "1", Key: "release"}, "raw")
+	assert.Equal(t, ErrDeploymentDistKey, err)
+}
@@ -0,0 +1,79 @@
+package deployment
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/robfig/cron/v3"
+)
+
+var (
+	ErrDeploymentMaintenance = errors.New("Deployment: invalid maintenance window")
+)
+
+// MaintenanceWindow restricts when a target is allowed to install an update.
+// Schedule is a standard 5-field cron expression marking the start of each
+// window, Duration is given as "HH:MM:SS" and Timezone is either an IANA
+// location name or a "+HH:MM" offset from UTC.
+type MaintenanceWindow struct {
+	Schedule string `json:"schedule" example:"0 2 * * *"`
+	Duration string `json:"duration" example:"02:00:00"`
+	Timezone string `json:"timezone" example:"+00:00"`
+}
+
+// Available reports whether t falls inside one of the scheduled windows.
+func (m *MaintenanceWindow) Available(t time.Time) bool {
+	s, d, loc, err := m.parse()
+	if err != nil {
+		return false
+	}
+	t = t.In(loc)
+	// The most recent window that could still be open started no earlier
+	// than t-d, so it is the first activation after that instant.
+	start := s.Next(t.Add(-d))
+	return !start.After(t)
+}
+
+func (m *MaintenanceWindow) validate() error {
+	_, _, _, err := m.parse()
+	return err
+}
+
+func (m *MaintenanceWindow) parse() (cron.Schedule, time.Duration, *time.Location, error) {
+	s, err := cron.ParseStandard(m.Schedule)
+	if err != nil {
+		return nil, 0, nil, ErrDeploymentMaintenance
+	}
+	var h, min, sec int
+	if _, err := fmt.Sscanf(m.Duration, "%d:%d:%d", &h, &min, &sec); err != nil {
+		return nil, 0, nil, ErrDeploymentMaintenance
+	}
+	d := time.Duration(h)*time.Hour + time.Duration(min)*time.Minute + time.Duration(sec)*time.Second
+	if d <= 0 {
+		return nil, 0, nil, ErrDeploymentMaintenance
+	}
+	loc, err := parseTimezone(m.Timezone)
+	if err != nil {
+		return nil, 0, nil, ErrDeploymentMaintenance
+	}
+	return s, d, loc, nil
+}
+
+func parseTimezone(tz string) (*time.Location, error) {
+	if tz == "" {
+		return time.UTC, nil
+	}
+	if tz[0] == '+' || tz[0] == '-' {
+		var h, m int
+		if _, err := fmt.Sscanf(tz[1:], "%d:%d", &h, &m); err != nil {
+			return nil, err
+		}
+		off := h*3600 + m*60
+		if tz[0] == '-' {
+			off = -off
+		}
+		return time.FixedZone(tz, off), nil
+	}
+	return time.LoadLocation(tz)
+}
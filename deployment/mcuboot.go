@@ -0,0 +1,197 @@
+package deployment
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+var (
+	ErrDeploymentImage        = errors.New("Deployment: malformed MCUboot image")
+	ErrDeploymentImageHash    = errors.New("Deployment: MCUboot image hash mismatch")
+	ErrDeploymentImageVersion = errors.New("Deployment: MCUboot image version mismatch")
+)
+
+const (
+	mcubootMagic        = 0x96f3b83d
+	mcubootHeaderLen    = 32
+	mcubootTlvInfoMagic = 0x6907
+	mcubootTlvProtMagic = 0x6908
+	mcubootTlvInfoLen   = 4
+)
+
+// MCUboot TLV types, see bootutil/image.h.
+const (
+	tlvKeyHash    = 0x01
+	tlvPubKey     = 0x02
+	tlvSha256     = 0x10
+	tlvRsa2048Pss = 0x20
+	tlvEcdsa224   = 0x21
+	tlvEcdsaSig   = 0x22
+	tlvRsa3072Pss = 0x23
+	tlvEd25519    = 0x24
+)
+
+var tlvSignatures = map[uint16]string{
+	tlvRsa2048Pss: "RSA-2048",
+	tlvEcdsa224:   "ECDSA-P224",
+	tlvEcdsaSig:   "ECDSA-P256",
+	tlvRsa3072Pss: "RSA-3072",
+	tlvEd25519:    "Ed25519",
+}
+
+// ImageInfo is the metadata parsed from the header and TLV trailer of an
+// MCUboot image.
+type ImageInfo struct {
+	Version    string `json:"version" example:"1.0.0+1"`
+	LoadAddr   uint32 `json:"loadAddr"`
+	HeaderSize int    `json:"headerSize" example:"512"`
+	ImageSize  int    `json:"imageSize" example:"27364"`
+	Flags      uint32 `json:"flags"`
+	Hash       string `json:"hash" example:"hash"`
+	KeyHash    string `json:"keyHash,omitempty" example:"hash"`
+	Signature  string `json:"signature,omitempty" example:"ECDSA-P256"`
+}
+
+type imageVersion struct {
+	Major    uint8
+	Minor    uint8
+	Revision uint16
+	Build    uint32
+}
+
+func (v imageVersion) String() string {
+	return fmt.Sprintf("%d.%d.%d+%d", v.Major, v.Minor, v.Revision, v.Build)
+}
+
+type imageHeader struct {
+	Magic       uint32
+	LoadAddr    uint32
+	HdrSize     uint16
+	ProtTlvSize uint16
+	ImgSize     uint32
+	Flags       uint32
+	Ver         imageVersion
+	Pad         uint32
+}
+
+type tlv struct {
+	Type uint16
+	Data []byte
+}
+
+// mcubootImage keeps the parts of an image needed for verification.
+type mcubootImage struct {
+	hdr     imageHeader
+	payload []byte // header, image and protected TLVs, i.e. the hashed region
+	tlvs    []tlv
+}
+
+func isMcuboot(f []byte) bool {
+	return len(f) >= 4 && binary.LittleEndian.Uint32(f) == mcubootMagic
+}
+
+func parseMcuboot(f []byte) (*mcubootImage, error) {
+	var m mcubootImage
+	if len(f) < mcubootHeaderLen {
+		return nil, ErrDeploymentImage
+	}
+	if err := binary.Read(bytes.NewReader(f), binary.LittleEndian, &m.hdr); err != nil {
+		return nil, ErrDeploymentImage
+	}
+	if m.hdr.Magic != mcubootMagic || int(m.hdr.HdrSize) < mcubootHeaderLen {
+		return nil, ErrDeploymentImage
+	}
+	off := int(m.hdr.HdrSize) + int(m.hdr.ImgSize)
+	if off > len(f) {
+		return nil, ErrDeploymentImage
+	}
+	if m.hdr.ProtTlvSize > 0 {
+		tlvs, n, err := parseTlvArea(f[off:], mcubootTlvProtMagic)
+		if err != nil || n != int(m.hdr.ProtTlvSize) {
+			return nil, ErrDeploymentImage
+		}
+		m.tlvs = append(m.tlvs, tlvs...)
+		off += n
+	}
+	m.payload = f[:off]
+	// Images signed with --pad carry 0xff padding and the image trailer
+	// after the TLVs, which is none of the business of the server.
+	tlvs, _, err := parseTlvArea(f[off:], mcubootTlvInfoMagic)
+	if err != nil {
+		return nil, ErrDeploymentImage
+	}
+	m.tlvs = append(m.tlvs, tlvs...)
+	return &m, nil
+}
+
+func parseTlvArea(f []byte, magic uint16) ([]tlv, int, error) {
+	if len(f) < mcubootTlvInfoLen || binary.LittleEndian.Uint16(f) != magic {
+		return nil, 0, ErrDeploymentImage
+	}
+	tot := int(binary.LittleEndian.Uint16(f[2:]))
+	if tot < mcubootTlvInfoLen || tot > len(f) {
+		return nil, 0, ErrDeploymentImage
+	}
+	var tlvs []tlv
+	for i := mcubootTlvInfoLen; i < tot; {
+		if i+4 > tot {
+			return nil, 0, ErrDeploymentImage
+		}
+		l := int(binary.LittleEndian.Uint16(f[i+2:]))
+		if i+4+l > tot {
+			return nil, 0, ErrDeploymentImage
+		}
+		tlvs = append(tlvs, tlv{Type: binary.LittleEndian.Uint16(f[i:]), Data: f[i+4 : i+4+l]})
+		i += 4 + l
+	}
+	return tlvs, tot, nil
+}
+
+func (m *mcubootImage) find(t uint16) []byte {
+	for _, v := range m.tlvs {
+		if v.Type == t {
+			return v.Data
+		}
+	}
+	return nil
+}
+
+// check verifies the hash TLV against the image contents and the embedded
+// version against the one given at upload time.
+func (m *mcubootImage) check(ver string) error {
+	h := m.find(tlvSha256)
+	sum := sha256.Sum256(m.payload)
+	if h == nil || !bytes.Equal(h, sum[:]) {
+		return ErrDeploymentImageHash
+	}
+	v := m.hdr.Ver.String()
+	if ver != v && !(m.hdr.Ver.Build == 0 && ver == strings.TrimSuffix(v, "+0")) {
+		return ErrDeploymentImageVersion
+	}
+	return nil
+}
+
+func (m *mcubootImage) info() *ImageInfo {
+	i := &ImageInfo{
+		Version:    m.hdr.Ver.String(),
+		LoadAddr:   m.hdr.LoadAddr,
+		HeaderSize: int(m.hdr.HdrSize),
+		ImageSize:  int(m.hdr.ImgSize),
+		Flags:      m.hdr.Flags,
+		Hash:       fmt.Sprintf("%x", m.find(tlvSha256)),
+	}
+	if k := m.find(tlvKeyHash); k != nil {
+		i.KeyHash = fmt.Sprintf("%x", k)
+	}
+	for _, v := range m.tlvs {
+		if s, ok := tlvSignatures[v.Type]; ok {
+			i.Signature = s
+			break
+		}
+	}
+	return i
+}
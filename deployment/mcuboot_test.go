@@ -0,0 +1,82 @@
+package deployment
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// makeTestImage builds an MCUboot image around body; sign, if given,
+// returns extra TLVs computed over the image digest.
+func makeTestImage(v imageVersion, body []byte, sign ...func(digest []byte) []tlv) []byte {
+	h := imageHeader{
+		Magic:   mcubootMagic,
+		HdrSize: 0x200,
+		ImgSize: uint32(len(body)),
+		Ver:     v,
+	}
+	f, _ := encodeMcuboot(h, body, func(digest []byte) ([]tlv, error) {
+		var tlvs []tlv
+		for _, s := range sign {
+			tlvs = append(tlvs, s(digest)...)
+		}
+		return tlvs, nil
+	})
+	return f
+}
+
+func TestParseMcuboot(t *testing.T) {
+	f := makeTestImage(imageVersion{1, 2, 3, 4}, dummy)
+	m, err := parseMcuboot(f)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, nil, m.check("1.2.3+4"))
+	assert.Equal(t, ErrDeploymentImageVersion, m.check("1.2.3"))
+	i := m.info()
+	assert.Equal(t, "1.2.3+4", i.Version)
+	assert.Equal(t, len(dummy), i.ImageSize)
+	assert.Equal(t, 0x200, i.HeaderSize)
+}
+
+func TestParseMcubootTlvType(t *testing.T) {
+	// TLV types are 16 bits wide; 0x0124 is no Ed25519 signature.
+	f := makeTestImage(imageVersion{1, 0, 0, 0}, dummy, func([]byte) []tlv {
+		return []tlv{{Type: 0x0100 | tlvEd25519, Data: []byte{1, 2, 3}}}
+	})
+	m, err := parseMcuboot(f)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, uint16(0x0124), m.tlvs[1].Type)
+	assert.Equal(t, []byte(nil), m.find(tlvEd25519))
+	assert.Equal(t, "", m.info().Signature)
+}
+
+func TestParseMcubootPadded(t *testing.T) {
+	f := makeTestImage(imageVersion{1, 0, 0, 0}, dummy)
+	n := len(f)
+	f = append(f, bytes.Repeat([]byte{0xff}, 4096)...)
+	// The image trailer ends in the boot magic.
+	f = append(f, 0x77, 0xc2, 0x95, 0xf3, 0x60, 0xd2, 0xef, 0x7f, 0x35, 0x52, 0x50, 0x0f, 0x2c, 0xb6, 0x79, 0x80)
+	m, err := parseMcuboot(f)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, nil, m.check("1.0.0"))
+	assert.True(t, len(m.payload) < n)
+}
+
+func TestParseMcubootTruncated(t *testing.T) {
+	f := makeTestImage(imageVersion{1, 0, 0, 0}, dummy)
+	_, err := parseMcuboot(f[:len(f)-1])
+	assert.Equal(t, ErrDeploymentImage, err)
+}
+
+func TestSetUploadMcubootHashMismatch(t *testing.T) {
+	f := makeTestImage(imageVersion{1, 0, 0, 0}, dummy)
+	f[0x200] ^= 0xff
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write(f)
+	}))
+	defer s.Close()
+	err := SetUpload(Upload{Name: "mcuboot", Version: "1.0.0", Url: s.URL})
+	assert.Equal(t, ErrDeploymentImageHash, err)
+}
@@ -0,0 +1,89 @@
+package deployment
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"time"
+)
+
+var (
+	ErrDeploymentRollout         = errors.New("Deployment: invalid rollout")
+	ErrDeploymentRolloutNotFound = errors.New("Deployment: rollout not found")
+)
+
+// States of a rollout. A rollout is running while its waves are assigned,
+// paused once it stopped early, after too many failed actions or when it
+// ran out of time, and finished once every wave is done.
+const (
+	RolloutRunning  = "running"
+	RolloutPaused   = "paused"
+	RolloutFinished = "finished"
+)
+
+// Rollout is the state of a rollout of Distribution to Targets. Rollouts are
+// run by the client, wave by wave, which reports their state as it goes.
+type Rollout struct {
+	Name         string    `json:"name" example:"spring-release"`
+	Distribution string    `json:"distribution" example:"hawkbit"`
+	Targets      []string  `json:"targets" example:"ti_cc3200wf_12345"`
+	State        string    `json:"state" example:"running"`
+	Wave         int       `json:"wave" example:"1"`
+	Failures     int       `json:"failures" example:"0"`
+	Reason       string    `json:"reason,omitempty" example:"3 actions failed"`
+	Updated      time.Time `json:"updated"`
+}
+
+// SetRollout records the state of rollout r.Name as reported by the client
+// running it.
+func SetRollout(r Rollout) error {
+	return SetRolloutContext(context.Background(), r)
+}
+
+// SetRolloutContext is SetRollout audited as requested by ctx.
+func SetRolloutContext(ctx context.Context, r Rollout) error {
+	if r.Name == "" || r.Wave < 0 || r.Failures < 0 {
+		return ErrDeploymentRollout
+	}
+	if r.State != RolloutRunning && r.State != RolloutPaused && r.State != RolloutFinished {
+		return ErrDeploymentRollout
+	}
+	dp.mtx.Lock()
+	defer dp.mtx.Unlock()
+	if _, ok := dp.artifacts[r.Distribution]; !ok {
+		return ErrDeploymentDistNotFound
+	}
+	prev, ok := dp.rollouts[r.Name]
+	var before interface{}
+	if ok {
+		before = prev
+	}
+	r.Updated = time.Now().UTC()
+	dp.rollouts[r.Name] = r
+	audit(ctx, "rollout/"+r.Name, before, r)
+	publish(RolloutChanged{Time: r.Updated, Before: prev, Rollout: r})
+	return nil
+}
+
+// GetRollout returns the last reported state of rollout n.
+func GetRollout(n string) (Rollout, error) {
+	dp.mtx.Lock()
+	defer dp.mtx.Unlock()
+	r, ok := dp.rollouts[n]
+	if !ok {
+		return Rollout{}, ErrDeploymentRolloutNotFound
+	}
+	return r, nil
+}
+
+// GetRollouts returns the rollouts reported so far, sorted by name.
+func GetRollouts() []Rollout {
+	dp.mtx.Lock()
+	defer dp.mtx.Unlock()
+	rs := []Rollout{}
+	for _, r := range dp.rollouts {
+		rs = append(rs, r)
+	}
+	sort.Slice(rs, func(i, j int) bool { return rs[i].Name < rs[j].Name })
+	return rs
+}
@@ -0,0 +1,74 @@
+package deployment
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRolloutWebhook(t *testing.T) {
+	var mtx sync.Mutex
+	var got []Event
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var e Event
+		json.NewDecoder(r.Body).Decode(&e)
+		mtx.Lock()
+		got = append(got, e)
+		mtx.Unlock()
+	}))
+	defer s.Close()
+	assert.Equal(t, nil, SetWebhook(Webhook{Name: "rollouts", URL: s.URL,
+		Events: []string{EventRolloutPaused, EventRolloutFinished}}))
+	defer DeleteWebhook("rollouts")
+
+	name := "rollout-" + time.Now().Format("150405.000000000")
+	dp.mtx.Lock()
+	dp.artifacts["rollout-dist"] = Distribution{Name: "rollout-dist"}
+	dp.mtx.Unlock()
+	r := Rollout{Name: name, Distribution: "rollout-dist", Targets: []string{"a", "b"}}
+	for _, st := range []string{RolloutRunning, RolloutRunning, RolloutPaused, RolloutPaused,
+		RolloutRunning, RolloutFinished} {
+		r.State = st
+		r.Wave++
+		assert.Equal(t, nil, SetRollout(r))
+	}
+	last, err := GetRollout(name)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, RolloutFinished, last.State)
+	assert.Equal(t, 6, last.Wave)
+
+	// Only changes into paused and finished are posted, once each.
+	assert.Eventually(t, func() bool {
+		mtx.Lock()
+		defer mtx.Unlock()
+		return len(got) == 2
+	}, 5*time.Second, 10*time.Millisecond)
+	mtx.Lock()
+	defer mtx.Unlock()
+	assert.Equal(t, EventRolloutPaused, got[0].Type)
+	assert.Equal(t, EventRolloutFinished, got[1].Type)
+	assert.Equal(t, name, got[0].Rollout)
+	assert.Equal(t, "rollout-dist", got[0].Distribution)
+}
+
+func TestSetRolloutInvalid(t *testing.T) {
+	dp.mtx.Lock()
+	dp.artifacts["rollout-dist"] = Distribution{Name: "rollout-dist"}
+	dp.mtx.Unlock()
+	for _, r := range []Rollout{
+		{Distribution: "rollout-dist", State: RolloutRunning},
+		{Name: "r", Distribution: "rollout-dist", State: "aborted"},
+		{Name: "r", Distribution: "rollout-dist", State: RolloutRunning, Wave: -1},
+	} {
+		assert.Equal(t, ErrDeploymentRollout, SetRollout(r))
+	}
+	assert.Equal(t, ErrDeploymentDistNotFound, SetRollout(Rollout{Name: "r", Distribution: "nope",
+		State: RolloutRunning}))
+	_, err := GetRollout("nope")
+	assert.Equal(t, ErrDeploymentRolloutNotFound, err)
+}
@@ -0,0 +1,174 @@
+package deployment
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/binary"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+var (
+	ErrDeploymentSign       = errors.New("Deployment: image signing failed")
+	ErrDeploymentSigningKey = errors.New("Deployment: invalid signing key")
+)
+
+// SignParams are the MCUboot header parameters used when signing a raw
+// build on the server. HeaderSize defaults to 0x200.
+type SignParams struct {
+	HeaderSize int    `json:"headerSize,omitempty" example:"512"`
+	LoadAddr   uint32 `json:"loadAddr,omitempty"`
+}
+
+type signingKey struct {
+	id   string
+	priv crypto.Signer
+}
+
+// SetSigningKey sets the PEM encoded private key used to sign raw builds.
+func SetSigningKey(id string, p []byte) error {
+	b, _ := pem.Decode(p)
+	if b == nil || id == "" {
+		return ErrDeploymentSigningKey
+	}
+	var k interface{}
+	var err error
+	switch b.Type {
+	case "PRIVATE KEY":
+		k, err = x509.ParsePKCS8PrivateKey(b.Bytes)
+	case "EC PRIVATE KEY":
+		k, err = x509.ParseECPrivateKey(b.Bytes)
+	case "RSA PRIVATE KEY":
+		k, err = x509.ParsePKCS1PrivateKey(b.Bytes)
+	default:
+		return ErrDeploymentSigningKey
+	}
+	if err != nil {
+		return ErrDeploymentSigningKey
+	}
+	s, ok := k.(crypto.Signer)
+	if !ok {
+		return ErrDeploymentSigningKey
+	}
+	if _, err := keyHash(s.Public()); err != nil {
+		return ErrDeploymentSigningKey
+	}
+	dp.mtx.Lock()
+	defer dp.mtx.Unlock()
+	dp.signer = &signingKey{id: id, priv: s}
+	return nil
+}
+
+// LoadSigningKey reads the signing key from file f, named after the file
+// without its extension.
+func LoadSigningKey(f string) error {
+	p, err := os.ReadFile(f)
+	if err != nil {
+		return err
+	}
+	return SetSigningKey(strings.TrimSuffix(filepath.Base(f), filepath.Ext(f)), p)
+}
+
+func parseVersion(v string) (imageVersion, error) {
+	var iv imageVersion
+	var build uint32
+	n, _ := fmt.Sscanf(v, "%d.%d.%d+%d", &iv.Major, &iv.Minor, &iv.Revision, &build)
+	if n < 3 {
+		return imageVersion{}, ErrDeploymentSign
+	}
+	iv.Build = build
+	if iv.String() != v && strings.TrimSuffix(iv.String(), "+0") != v {
+		return imageVersion{}, ErrDeploymentSign
+	}
+	return iv, nil
+}
+
+// signImage wraps the raw build in an MCUboot header and appends a TLV
+// trailer holding its hash, the key hash and a signature made with k.
+func signImage(raw []byte, ver string, p SignParams, k *signingKey) ([]byte, error) {
+	if k == nil {
+		return nil, ErrDeploymentSign
+	}
+	v, err := parseVersion(ver)
+	if err != nil {
+		return nil, err
+	}
+	if p.HeaderSize == 0 {
+		p.HeaderSize = 0x200
+	}
+	if p.HeaderSize < mcubootHeaderLen || p.HeaderSize > 0xffff {
+		return nil, ErrDeploymentSign
+	}
+	kh, err := keyHash(k.priv.Public())
+	if err != nil {
+		return nil, err
+	}
+	hdr := imageHeader{
+		Magic:    mcubootMagic,
+		LoadAddr: p.LoadAddr,
+		HdrSize:  uint16(p.HeaderSize),
+		ImgSize:  uint32(len(raw)),
+		Ver:      v,
+	}
+	return encodeMcuboot(hdr, raw, func(digest []byte) ([]tlv, error) {
+		var t uint16
+		var sig []byte
+		var err error
+		switch priv := k.priv.(type) {
+		case *ecdsa.PrivateKey:
+			t = tlvEcdsaSig
+			sig, err = ecdsa.SignASN1(rand.Reader, priv, digest)
+		case *rsa.PrivateKey:
+			t = tlvRsa2048Pss
+			sig, err = rsa.SignPSS(rand.Reader, priv, crypto.SHA256, digest,
+				&rsa.PSSOptions{SaltLength: sha256.Size})
+		case ed25519.PrivateKey:
+			t = tlvEd25519
+			sig = ed25519.Sign(priv, digest)
+		default:
+			err = ErrDeploymentSigningKey
+		}
+		if err != nil {
+			return nil, ErrDeploymentSign
+		}
+		return []tlv{{Type: tlvKeyHash, Data: kh}, {Type: t, Data: sig}}, nil
+	})
+}
+
+// encodeMcuboot lays out header, body and an unprotected TLV area holding
+// the image hash followed by the TLVs returned by sign, if any.
+func encodeMcuboot(hdr imageHeader, body []byte, sign func(digest []byte) ([]tlv, error)) ([]byte, error) {
+	var b bytes.Buffer
+	binary.Write(&b, binary.LittleEndian, hdr)
+	b.Write(make([]byte, int(hdr.HdrSize)-mcubootHeaderLen))
+	b.Write(body)
+	sum := sha256.Sum256(b.Bytes())
+	tlvs := []tlv{{Type: tlvSha256, Data: sum[:]}}
+	if sign != nil {
+		t, err := sign(sum[:])
+		if err != nil {
+			return nil, err
+		}
+		tlvs = append(tlvs, t...)
+	}
+	tot := mcubootTlvInfoLen
+	for _, t := range tlvs {
+		tot += 4 + len(t.Data)
+	}
+	binary.Write(&b, binary.LittleEndian, []uint16{mcubootTlvInfoMagic, uint16(tot)})
+	for _, t := range tlvs {
+		binary.Write(&b, binary.LittleEndian, []uint16{t.Type, uint16(len(t.Data))})
+		b.Write(t.Data)
+	}
+	return b.Bytes(), nil
+}
@@ -0,0 +1,77 @@
+package deployment
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/pem"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSetUploadSign(t *testing.T) {
+	pub, priv, _ := ed25519.GenerateKey(rand.Reader)
+	p, _ := x509.MarshalPKCS8PrivateKey(priv)
+	assert.Equal(t, nil, SetSigningKey("dev", pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: p})))
+	der, _ := x509.MarshalPKIXPublicKey(pub)
+	assert.Equal(t, nil, AddTrustedKey("dev", pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der})))
+	defer func() {
+		dp.signer = nil
+		dp.keys = map[string]trustedKey{}
+	}()
+	s := newImageServer()
+	defer s.Close()
+
+	err := SetUpload(Upload{Name: "dev", Version: "1.2.3+4", Url: s.URL + "/dummy.bin", Sign: &SignParams{}})
+	assert.Equal(t, nil, err)
+	u := dp.uploads["dev"]
+	assert.Equal(t, len(dummy), u.Size)
+	assert.NotEqual(t, (*Artifact)(nil), u.Signed)
+	assert.Equal(t, "dev", u.Signed.SignedBy)
+	assert.Equal(t, "1.2.3+4", u.Signed.Mcuboot.Version)
+
+	img, err := GetArtifact(u.Signed.Sha256)
+	assert.Equal(t, nil, err)
+	m, err := parseMcuboot(img)
+	assert.Equal(t, nil, err)
+	id, err := m.verify(dp.keys)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, "dev", id)
+
+	assert.Equal(t, nil, SetDistribution(Distribution{Name: "dev", Version: "1", Key: "dev"}, "dev"))
+	d, _ := GetDistribution("dev")
+	assert.Equal(t, VariantSigned, d.Variant)
+	assert.Equal(t, u.Signed.Sha256, d.Image().Sha256)
+	err = SetDistribution(Distribution{Name: "raw", Version: "1", Key: "dev", Variant: VariantOriginal}, "dev")
+	assert.Equal(t, ErrDeploymentDistKey, err)
+	err = SetDistribution(Distribution{Name: "raw", Version: "1", Variant: VariantOriginal}, "dev")
+	assert.Equal(t, ErrDeploymentUnsigned, err)
+}
+
+func TestSetUploadSignUntrusted(t *testing.T) {
+	_, priv, _ := ed25519.GenerateKey(rand.Reader)
+	p, _ := x509.MarshalPKCS8PrivateKey(priv)
+	assert.Equal(t, nil, SetSigningKey("dev", pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: p})))
+	other, _, _ := ed25519.GenerateKey(rand.Reader)
+	der, _ := x509.MarshalPKIXPublicKey(other)
+	assert.Equal(t, nil, AddTrustedKey("release", pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der})))
+	defer func() {
+		dp.signer = nil
+		dp.keys = map[string]trustedKey{}
+	}()
+	s := newImageServer()
+	defer s.Close()
+
+	err := SetUpload(Upload{Name: "untrusted", Version: "1.0.0", Url: s.URL + "/dummy.bin", Sign: &SignParams{}})
+	assert.Equal(t, ErrDeploymentUnsigned, err)
+	_, ok := dp.uploads["untrusted"]
+	assert.False(t, ok)
+}
+
+func TestSetUploadSignWithoutKey(t *testing.T) {
+	s := newImageServer()
+	defer s.Close()
+	err := SetUpload(Upload{Name: "dev", Version: "1.0.0", Url: s.URL + "/dummy.bin", Sign: &SignParams{}})
+	assert.Equal(t, ErrDeploymentSign, err)
+}
@@ -0,0 +1,43 @@
+package deployment
+
+import "time"
+
+// Stats summarises the deployment store for monitoring.
+type Stats struct {
+	TargetsOnline int
+	// Actions counts current actions by execution state and result.
+	Actions map[[2]string]int
+}
+
+// SetPolled records that target t polled for updates at time at.
+func SetPolled(t string, at time.Time) {
+	dp.mtx.Lock()
+	defer dp.mtx.Unlock()
+	_, seen := dp.polled[t]
+	dp.polled[t] = at
+	publish(TargetPolled{Time: at.UTC(), Target: t, First: !seen})
+}
+
+// GetStats returns the store statistics as of now. Targets are considered
+// online when they polled within window.
+func GetStats(now time.Time, window time.Duration) Stats {
+	dp.mtx.Lock()
+	defer dp.mtx.Unlock()
+	s := Stats{Actions: map[[2]string]int{}}
+	for _, at := range dp.polled {
+		if now.Sub(at) <= window {
+			s.TargetsOnline++
+		}
+	}
+	for _, d := range dp.deployments {
+		e := d.Status.Execution
+		if e == "" {
+			e = "scheduled"
+			if d.AwaitingConfirmation() {
+				e = "wait_for_confirmation"
+			}
+		}
+		s.Actions[[2]string{e, d.Status.Result.Finished}]++
+	}
+	return s
+}
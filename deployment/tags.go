@@ -0,0 +1,74 @@
+package deployment
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"time"
+)
+
+var (
+	ErrDeploymentTag = errors.New("Deployment: invalid tag")
+)
+
+// SetTags replaces the tags of target t, the labels operators group targets
+// by. No tags removes them all.
+func SetTags(t string, tags []string) error {
+	return SetTagsContext(context.Background(), t, tags)
+}
+
+// SetTagsContext is SetTags audited as requested by ctx.
+func SetTagsContext(ctx context.Context, t string, tags []string) error {
+	if t == "" {
+		return ErrDeploymentTag
+	}
+	set := map[string]bool{}
+	for _, tag := range tags {
+		if tag == "" {
+			return ErrDeploymentTag
+		}
+		set[tag] = true
+	}
+	ts := make([]string, 0, len(set))
+	for tag := range set {
+		ts = append(ts, tag)
+	}
+	sort.Strings(ts)
+	dp.mtx.Lock()
+	defer dp.mtx.Unlock()
+	before := dp.tags[t]
+	if len(ts) == 0 {
+		delete(dp.tags, t)
+	} else {
+		dp.tags[t] = ts
+	}
+	audit(ctx, "tags/"+t, before, ts)
+	publish(TargetTagged{Time: time.Now().UTC(), Target: t, Tags: ts})
+	return nil
+}
+
+// GetTags returns the tags of target t, sorted.
+func GetTags(t string) []string {
+	dp.mtx.Lock()
+	defer dp.mtx.Unlock()
+	return append([]string{}, dp.tags[t]...)
+}
+
+// Tagged returns the targets carrying tag, sorted.
+func Tagged(tag string) []string {
+	dp.mtx.Lock()
+	defer dp.mtx.Unlock()
+	ts := []string{}
+	for t, tags := range dp.tags {
+		if hasTag(tags, tag) {
+			ts = append(ts, t)
+		}
+	}
+	sort.Strings(ts)
+	return ts
+}
+
+func hasTag(tags []string, tag string) bool {
+	i := sort.SearchStrings(tags, tag)
+	return i < len(tags) && tags[i] == tag
+}
@@ -0,0 +1,24 @@
+package deployment
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSetTags(t *testing.T) {
+	assert.Equal(t, nil, SetTags("tags-a", []string{"lab", "east", "lab"}))
+	assert.Equal(t, nil, SetTags("tags-b", []string{"west"}))
+	assert.Equal(t, []string{"east", "lab"}, GetTags("tags-a"))
+	assert.Contains(t, Tagged("lab"), "tags-a")
+	assert.NotContains(t, Tagged("lab"), "tags-b")
+	assert.Contains(t, GetTargets(), Target{Name: "tags-b", Tags: []string{"west"}})
+
+	assert.Equal(t, ErrDeploymentTag, SetTags("", []string{"lab"}))
+	assert.Equal(t, ErrDeploymentTag, SetTags("tags-a", []string{""}))
+	assert.Equal(t, []string{"east", "lab"}, GetTags("tags-a"))
+
+	assert.Equal(t, nil, SetTags("tags-a", nil))
+	assert.Equal(t, []string{}, GetTags("tags-a"))
+	assert.NotContains(t, Tagged("lab"), "tags-a")
+}
@@ -0,0 +1,37 @@
+package deployment
+
+import (
+	"context"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Span attributes identifying what a traced request is about.
+const (
+	SpanTarget       = attribute.Key("hawkbit.bid")
+	SpanAction       = attribute.Key("hawkbit.acid")
+	SpanDistribution = attribute.Key("hawkbit.distribution")
+	SpanUpload       = attribute.Key("hawkbit.upload")
+	SpanArtifact     = attribute.Key("hawkbit.artifact")
+	SpanBase         = attribute.Key("hawkbit.base")
+)
+
+// Tracer is the tracer spans of this service are created with. It uses the
+// global tracer provider, so tracing is a no-op until one is installed.
+var Tracer = otel.Tracer("github.com/jonathanyhliang/hawkbit-fota")
+
+// EndSpan records err on span, if any, and ends it.
+func EndSpan(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+func startSpan(ctx context.Context, name string, attrs ...attribute.KeyValue) (context.Context, trace.Span) {
+	return Tracer.Start(ctx, "deployment."+name, trace.WithAttributes(attrs...))
+}
@@ -0,0 +1,119 @@
+package deployment
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+)
+
+// Tracer delegates to the first global tracer provider for good, so all
+// tests share one provider and each gets the spans exported while it runs.
+var (
+	traceOnce     sync.Once
+	traceProvider *sdktrace.TracerProvider
+	traceSink     testSink
+)
+
+// testSink passes spans on to the exporter of the running test, if any.
+type testSink struct {
+	mtx sync.Mutex
+	exp sdktrace.SpanExporter
+	out *bytes.Buffer
+}
+
+func (s *testSink) ExportSpans(ctx context.Context, spans []sdktrace.ReadOnlySpan) error {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	if s.exp == nil {
+		return nil
+	}
+	return s.exp.ExportSpans(ctx, spans)
+}
+
+func (s *testSink) Shutdown(context.Context) error { return nil }
+
+func (s *testSink) String() string {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	return s.out.String()
+}
+
+// installTracer exports the spans of t until it ends, and then puts the
+// previous global tracer provider back.
+func installTracer(t *testing.T) *testSink {
+	traceOnce.Do(func() {
+		traceProvider = sdktrace.NewTracerProvider(sdktrace.WithSyncer(&traceSink))
+	})
+	prev := otel.GetTracerProvider()
+	otel.SetTracerProvider(traceProvider)
+	out := &bytes.Buffer{}
+	exp, _ := stdouttrace.New(stdouttrace.WithWriter(out))
+	traceSink.mtx.Lock()
+	traceSink.exp, traceSink.out = exp, out
+	traceSink.mtx.Unlock()
+	t.Cleanup(func() {
+		traceSink.mtx.Lock()
+		traceSink.exp = nil
+		traceSink.mtx.Unlock()
+		otel.SetTracerProvider(prev)
+	})
+	return &traceSink
+}
+
+func TestSetUploadTracePropagation(t *testing.T) {
+	traceOut := installTracer(t)
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	defer otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator())
+
+	var traceparent string
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		traceparent = r.Header.Get("Traceparent")
+		w.Write(dummy)
+	}))
+	defer s.Close()
+
+	ctx, span := Tracer.Start(context.Background(), "test")
+	err := SetUploadContext(ctx, Upload{Name: "traced", Version: "1.0.0", Url: s.URL})
+	span.End()
+	assert.Equal(t, nil, err)
+
+	assert.Contains(t, traceparent, span.SpanContext().TraceID().String())
+	assert.Contains(t, traceOut.String(), `"Name":"deployment.SetUpload"`)
+	assert.Contains(t, traceOut.String(), `"Key":"hawkbit.upload"`)
+}
+
+func TestStoreTrace(t *testing.T) {
+	traceOut := installTracer(t)
+	s := newImageServer()
+	defer s.Close()
+	assert.Equal(t, nil, SetUpload(Upload{Name: "traced-store", Version: "1.0.0", Url: s.URL + "/dummy.bin"}))
+
+	ctx, span := Tracer.Start(context.Background(), "test")
+	assert.Equal(t, nil, SetDistributionContext(ctx, Distribution{Name: "traced-store", Version: "1"}, "traced-store"))
+	assert.Equal(t, nil, SetDeploymentContext(ctx, "traced-dev", "traced-store", DeploymentOptions{}))
+	d, err := GetDeploymentContext(ctx, "traced-dev")
+	assert.Equal(t, nil, err)
+	assert.Equal(t, nil, UpdateStatusContext(ctx, "traced-dev", d.ActionId, Status{Execution: "proceeding"}))
+	_, err = GetDeploymentContext(ctx, "traced-none")
+	assert.Equal(t, ErrDeploymentNotFound, err)
+	span.End()
+
+	out := traceOut.String()
+	for _, n := range []string{"SetDistribution", "SetDeployment", "GetDeployment", "UpdateStatus"} {
+		assert.Contains(t, out, `"Name":"deployment.`+n+`"`)
+	}
+	assert.Contains(t, out, `"Key":"hawkbit.bid"`)
+	assert.Contains(t, out, `"Key":"hawkbit.acid"`)
+	assert.Contains(t, out, `"Key":"hawkbit.distribution"`)
+	assert.Contains(t, out, span.SpanContext().TraceID().String())
+	assert.Contains(t, out, ErrDeploymentNotFound.Error())
+}
@@ -0,0 +1,362 @@
+package deployment
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/url"
+	"sort"
+	"sync/atomic"
+	"time"
+)
+
+var (
+	ErrDeploymentWebhook         = errors.New("Deployment: invalid webhook")
+	ErrDeploymentWebhookNotFound = errors.New("Deployment: webhook not found")
+)
+
+// Lifecycle events webhooks can subscribe to.
+const (
+	EventTargetRegistered = "target.registered"
+	EventActionAssigned   = "action.assigned"
+	EventActionStatus     = "action.status"
+	EventRolloutPaused    = "rollout.paused"
+	EventRolloutFinished  = "rollout.finished"
+)
+
+// Events too frequent for webhooks, only streamed to operators.
+const (
+	EventUploadCreated   = "upload.created"
+	EventTargetPolled    = "target.polled"
+	EventTargetTagged    = "target.tagged"
+	EventActionProgress  = "action.progress"
+	EventRolloutProgress = "rollout.progress"
+)
+
+// lifecycle reports whether webhooks can subscribe to event.
+func lifecycle(event string) bool {
+	switch event {
+	case EventTargetRegistered, EventActionAssigned, EventActionStatus, EventRolloutPaused,
+		EventRolloutFinished:
+		return true
+	}
+	return false
+}
+
+// EventsDropped tells an operator stream that it fell behind and missed
+// events, as many as Dropped counts at most.
+const EventsDropped = "events.dropped"
+
+// Event describes a change in the store, as posted to webhooks and streamed
+// to operators.
+type Event struct {
+	Type         string    `json:"event" example:"action.status"`
+	Time         time.Time `json:"time"`
+	Target       string    `json:"target,omitempty" example:"ti_cc3200wf_12345"`
+	Upload       string    `json:"upload,omitempty" example:"zephyr_cc3220sf_signed"`
+	ActionId     string    `json:"actionId,omitempty" example:"1a2b3c4"`
+	Distribution string    `json:"distribution,omitempty" example:"hawkbit"`
+	Rollout      string    `json:"rollout,omitempty" example:"spring-release"`
+	Status       *Status   `json:"status,omitempty"`
+	Dropped      uint64    `json:"dropped,omitempty" example:"3"`
+}
+
+// Webhook posts the events listed in Events, or all of them if empty, to
+// URL. With a Secret set, the X-Hawkbit-Signature header carries the hex
+// encoded HMAC-SHA256 of the body keyed with it.
+type Webhook struct {
+	Name   string   `json:"name" example:"ops-chat"`
+	URL    string   `json:"url" example:"https://chat.example.com/hooks/fota"`
+	Secret string   `json:"secret,omitempty" example:"s3cr3t"`
+	Events []string `json:"events,omitempty" example:"action.status"`
+}
+
+func (w Webhook) wants(event string) bool {
+	if !lifecycle(event) {
+		return false
+	}
+	if len(w.Events) == 0 {
+		return true
+	}
+	for _, e := range w.Events {
+		if e == event {
+			return true
+		}
+	}
+	return false
+}
+
+// Delivery records the outcome of posting one event to a webhook.
+type Delivery struct {
+	Webhook    string    `json:"webhook" example:"ops-chat"`
+	Event      Event     `json:"event"`
+	Attempts   int       `json:"attempts" example:"1"`
+	StatusCode int       `json:"statusCode,omitempty" example:"200"`
+	Error      string    `json:"error,omitempty"`
+	Delivered  bool      `json:"delivered"`
+	Time       time.Time `json:"time"`
+}
+
+// WebhookPolicy controls webhook delivery. A delivery is attempted Retries+1
+// times; the delay between attempts starts at Backoff and doubles after each
+// failure.
+type WebhookPolicy struct {
+	Timeout time.Duration
+	Retries int
+	Backoff time.Duration
+}
+
+var DefaultWebhookPolicy = WebhookPolicy{
+	Timeout: 10 * time.Second,
+	Retries: 5,
+	Backoff: time.Second,
+}
+
+// maxDeliveries bounds the delivery log kept per webhook.
+const maxDeliveries = 100
+
+// webhookQueue bounds the bus messages awaiting dispatch to webhooks, and
+// webhookBacklog the events awaiting delivery to each webhook.
+const (
+	webhookQueue   = 1024
+	webhookBacklog = 256
+)
+
+var (
+	webhookSub *Subscription
+	// webhookDropped counts the events dropped from full webhook backlogs.
+	webhookDropped uint64
+)
+
+func init() {
+	webhookSub = Subscribe(webhookQueue, dispatch)
+}
+
+// WebhookDropped returns the number of events which were never posted to
+// webhooks because their queues were full.
+func WebhookDropped() uint64 {
+	return webhookSub.Dropped() + atomic.LoadUint64(&webhookDropped)
+}
+
+// hookWorker posts the events of one webhook in the order they were
+// published, one at a time, so a receiver never sees an action closed
+// before it was assigned.
+type hookWorker struct {
+	events chan Event
+}
+
+// startWorker starts the worker of webhook n. The caller holds dp.mtx.
+func startWorker(n string) {
+	k := &hookWorker{events: make(chan Event, webhookBacklog)}
+	dp.hookWorkers[n] = k
+	go func() {
+		for e := range k.events {
+			dp.mtx.Lock()
+			w, p, cur := dp.hooks[n], dp.hookPolicy, dp.hookWorkers[n] == k
+			dp.mtx.Unlock()
+			if cur {
+				deliver(k, w, p, e)
+			}
+		}
+	}()
+}
+
+func SetWebhookPolicy(p WebhookPolicy) {
+	dp.mtx.Lock()
+	defer dp.mtx.Unlock()
+	dp.hookPolicy = p
+}
+
+// SetWebhook adds webhook w or replaces the one with the same name.
+func SetWebhook(w Webhook) error {
+	return SetWebhookContext(context.Background(), w)
+}
+
+// SetWebhookContext is SetWebhook audited as requested by ctx. Secrets are
+// withheld from the audit trail.
+func SetWebhookContext(ctx context.Context, w Webhook) error {
+	if w.Name == "" {
+		return ErrDeploymentWebhook
+	}
+	if u, err := url.Parse(w.URL); err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+		return ErrDeploymentWebhook
+	}
+	for _, e := range w.Events {
+		if !lifecycle(e) {
+			return ErrDeploymentWebhook
+		}
+	}
+	dp.mtx.Lock()
+	defer dp.mtx.Unlock()
+	before := withheld(dp.hooks, w.Name)
+	dp.hooks[w.Name] = w
+	if _, ok := dp.hookWorkers[w.Name]; !ok {
+		startWorker(w.Name)
+	}
+	audit(ctx, "webhook/"+w.Name, before, withheld(dp.hooks, w.Name))
+	return nil
+}
+
+// GetWebhooks returns the configured webhooks with their secrets withheld.
+func GetWebhooks() []Webhook {
+	dp.mtx.Lock()
+	defer dp.mtx.Unlock()
+	ws := []Webhook{}
+	for _, w := range dp.hooks {
+		w.Secret = ""
+		ws = append(ws, w)
+	}
+	sort.Slice(ws, func(i, j int) bool { return ws[i].Name < ws[j].Name })
+	return ws
+}
+
+// GetWebhook returns webhook n with its secret withheld.
+func GetWebhook(n string) (Webhook, error) {
+	dp.mtx.Lock()
+	defer dp.mtx.Unlock()
+	w, ok := dp.hooks[n]
+	if !ok {
+		return Webhook{}, ErrDeploymentWebhookNotFound
+	}
+	w.Secret = ""
+	return w, nil
+}
+
+func DeleteWebhook(n string) error {
+	return DeleteWebhookContext(context.Background(), n)
+}
+
+// DeleteWebhookContext is DeleteWebhook audited as requested by ctx.
+func DeleteWebhookContext(ctx context.Context, n string) error {
+	dp.mtx.Lock()
+	defer dp.mtx.Unlock()
+	if _, ok := dp.hooks[n]; !ok {
+		return ErrDeploymentWebhookNotFound
+	}
+	before := withheld(dp.hooks, n)
+	delete(dp.hooks, n)
+	delete(dp.deliveries, n)
+	close(dp.hookWorkers[n].events)
+	delete(dp.hookWorkers, n)
+	audit(ctx, "webhook/"+n, before, nil)
+	return nil
+}
+
+// withheld returns webhook n with its secret withheld as state for the audit
+// trail, or nil if there is none.
+func withheld(hooks map[string]Webhook, n string) interface{} {
+	w, ok := hooks[n]
+	if !ok {
+		return nil
+	}
+	w.Secret = ""
+	return w
+}
+
+// GetDeliveries returns the most recent deliveries to webhook n, oldest
+// first.
+func GetDeliveries(n string) ([]Delivery, error) {
+	dp.mtx.Lock()
+	defer dp.mtx.Unlock()
+	if _, ok := dp.hooks[n]; !ok {
+		return nil, ErrDeploymentWebhookNotFound
+	}
+	return append([]Delivery{}, dp.deliveries[n]...), nil
+}
+
+// dispatch queues the events of m to the worker of every webhook subscribed
+// to them. Events finding the queue full are dropped and logged as failed
+// deliveries.
+func dispatch(m Message) {
+	dp.mtx.Lock()
+	defer dp.mtx.Unlock()
+	for _, e := range Events(m) {
+		for n, w := range dp.hooks {
+			if !w.wants(e.Type) {
+				continue
+			}
+			select {
+			case dp.hookWorkers[n].events <- e:
+			default:
+				atomic.AddUint64(&webhookDropped, 1)
+				logDelivery(n, Delivery{Webhook: n, Event: e, Error: "queue full, event dropped",
+					Time: time.Now().UTC()})
+			}
+		}
+	}
+}
+
+// deliver posts e to w on behalf of worker k.
+func deliver(k *hookWorker, w Webhook, p WebhookPolicy, e Event) {
+	body, _ := json.Marshal(e)
+	c := &http.Client{Timeout: p.Timeout}
+	d := Delivery{Webhook: w.Name, Event: e}
+	backoff := p.Backoff
+	for d.Attempts <= p.Retries {
+		if d.Attempts > 0 {
+			time.Sleep(backoff)
+			backoff *= 2
+		}
+		d.Attempts++
+		d.StatusCode, d.Error = 0, ""
+		code, err := post(c, w, e.Type, body)
+		d.StatusCode = code
+		if err != nil {
+			d.Error = err.Error()
+			continue
+		}
+		if code >= 200 && code <= 299 {
+			d.Delivered = true
+			break
+		}
+	}
+	d.Time = time.Now().UTC()
+
+	dp.mtx.Lock()
+	defer dp.mtx.Unlock()
+	if dp.hookWorkers[w.Name] != k {
+		return
+	}
+	logDelivery(w.Name, d)
+}
+
+// logDelivery appends d to the delivery log of webhook n. The caller holds
+// dp.mtx.
+func logDelivery(n string, d Delivery) {
+	ds := append(dp.deliveries[n], d)
+	if len(ds) > maxDeliveries {
+		ds = ds[len(ds)-maxDeliveries:]
+	}
+	dp.deliveries[n] = ds
+}
+
+func post(c *http.Client, w Webhook, event string, body []byte) (int, error) {
+	req, err := http.NewRequest(http.MethodPost, w.URL, bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Hawkbit-Event", event)
+	if w.Secret != "" {
+		req.Header.Set("X-Hawkbit-Signature", "sha256="+SignPayload(w.Secret, body))
+	}
+	resp, err := c.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	resp.Body.Close()
+	return resp.StatusCode, nil
+}
+
+// SignPayload returns the hex encoded HMAC-SHA256 of body keyed with secret,
+// as sent in the X-Hawkbit-Signature header.
+func SignPayload(secret string, body []byte) string {
+	m := hmac.New(sha256.New, []byte(secret))
+	m.Write(body)
+	return hex.EncodeToString(m.Sum(nil))
+}
@@ -0,0 +1,119 @@
+package deployment
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWebhook(t *testing.T) {
+	SetWebhookPolicy(WebhookPolicy{Timeout: time.Second, Retries: 2, Backoff: time.Millisecond})
+	defer SetWebhookPolicy(DefaultWebhookPolicy)
+
+	var mtx sync.Mutex
+	var events []Event
+	calls := 0
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mtx.Lock()
+		defer mtx.Unlock()
+		calls++
+		if calls == 1 {
+			// The first attempt fails and must be retried.
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		b, _ := io.ReadAll(r.Body)
+		assert.Equal(t, "sha256="+SignPayload("s3cr3t", b), r.Header.Get("X-Hawkbit-Signature"))
+		var e Event
+		json.Unmarshal(b, &e)
+		assert.Equal(t, e.Type, r.Header.Get("X-Hawkbit-Event"))
+		events = append(events, e)
+	}))
+	defer s.Close()
+
+	assert.Equal(t, ErrDeploymentWebhook, SetWebhook(Webhook{Name: "ops", URL: "ftp://example.com"}))
+	assert.Equal(t, ErrDeploymentWebhook, SetWebhook(Webhook{Name: "ops", URL: s.URL, Events: []string{"nope"}}))
+	assert.Equal(t, nil, SetWebhook(Webhook{Name: "ops", URL: s.URL, Secret: "s3cr3t",
+		Events: []string{EventActionStatus}}))
+	defer DeleteWebhook("ops")
+	assert.Equal(t, "", GetWebhooks()[0].Secret)
+
+	SetPolled("hooked", time.Now())
+	dp.mtx.Lock()
+	dp.deployments["hooked"] = Deployment{Target: "hooked", ActionId: "1a2b3c4"}
+	dp.mtx.Unlock()
+	s1 := Status{Execution: "closed"}
+	s1.Result.Finished = "success"
+	assert.Equal(t, nil, UpdateStatus("hooked", "1a2b3c4", s1))
+
+	assert.Eventually(t, func() bool {
+		ds, _ := GetDeliveries("ops")
+		return len(ds) == 1
+	}, 5*time.Second, 10*time.Millisecond)
+	ds, err := GetDeliveries("ops")
+	assert.Equal(t, nil, err)
+	assert.Equal(t, true, ds[0].Delivered)
+	assert.Equal(t, 2, ds[0].Attempts)
+	assert.Equal(t, http.StatusOK, ds[0].StatusCode)
+
+	mtx.Lock()
+	defer mtx.Unlock()
+	// Registration was filtered out, only the status change arrives.
+	assert.Equal(t, 1, len(events))
+	assert.Equal(t, EventActionStatus, events[0].Type)
+	assert.Equal(t, "hooked", events[0].Target)
+	assert.Equal(t, "success", events[0].Status.Result.Finished)
+}
+
+func TestWebhookOrder(t *testing.T) {
+	var mtx sync.Mutex
+	var got []string
+	release := make(chan struct{})
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+		var e Event
+		json.NewDecoder(r.Body).Decode(&e)
+		mtx.Lock()
+		got = append(got, e.Target)
+		mtx.Unlock()
+	}))
+	defer s.Close()
+	assert.Equal(t, nil, SetWebhook(Webhook{Name: "ordered", URL: s.URL, Events: []string{EventTargetRegistered}}))
+	defer DeleteWebhook("ordered")
+
+	// The receiver holds the first delivery, so the backlog fills up and
+	// the events beyond it are dropped.
+	run := time.Now().Format("150405.000000000")
+	dropped := WebhookDropped()
+	var want []string
+	for i := 0; i < webhookBacklog+10; i++ {
+		n := fmt.Sprintf("ordered-%s-%03d", run, i)
+		want = append(want, n)
+		SetPolled(n, time.Now())
+	}
+	assert.Eventually(t, func() bool {
+		return WebhookDropped() >= dropped+9
+	}, 5*time.Second, 10*time.Millisecond)
+	ds, _ := GetDeliveries("ordered")
+	assert.NotEmpty(t, ds)
+	assert.Equal(t, false, ds[len(ds)-1].Delivered)
+	assert.Contains(t, ds[len(ds)-1].Error, "dropped")
+	close(release)
+
+	// Every event queued arrives, in publish order.
+	assert.Eventually(t, func() bool {
+		mtx.Lock()
+		defer mtx.Unlock()
+		return len(got) >= webhookBacklog
+	}, 10*time.Second, 10*time.Millisecond)
+	mtx.Lock()
+	defer mtx.Unlock()
+	assert.Equal(t, want[:len(got)], got)
+}
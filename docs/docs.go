@@ -20,6 +20,55 @@ const docTemplate = `{
     "host": "{{.Host}}",
     "basePath": "{{.BasePath}}",
     "paths": {
+        "/hawkbit/audit": {
+            "get": {
+                "description": "Retrieve the hash chained audit trail of changes, optionally about a single entity such as deployment/{target}, oldest first and at most 1000 entries at a time. Pass the seq of the last entry returned as since to get the next page. The trail is kept in memory with the rest of the store, keeps only the latest entries and starts over when the server restarts. Actors named by clients are recorded as name@address, since the server does not authenticate them",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Hawkbit FOTA"
+                ],
+                "summary": "Retrieve audit trail",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Entity",
+                        "name": "entity",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Sequence number of the entry to start after",
+                        "name": "since",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Most entries returned, at most 1000",
+                        "name": "limit",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/deployment.AuditEntry"
+                            }
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error"
+                    }
+                }
+            }
+        },
         "/hawkbit/deploy": {
             "post": {
                 "description": "Create new deployment with distribution specified which is to be retrived",
@@ -50,6 +99,9 @@ const docTemplate = `{
                     "400": {
                         "description": "Bad Request"
                     },
+                    "409": {
+                        "description": "Conflict"
+                    },
                     "500": {
                         "description": "Internal Server Error"
                     }
@@ -180,9 +232,245 @@ const docTemplate = `{
                 }
             }
         },
+        "/hawkbit/events": {
+            "get": {
+                "description": "Stream target polls, action assignments, status changes, progress and rollout changes as server-sent events, optionally only those of a target, of the targets carrying a tag or of a rollout and its targets. A stream falling behind gets an events.dropped event counting the events it missed",
+                "produces": [
+                    "text/event-stream"
+                ],
+                "tags": [
+                    "Hawkbit FOTA"
+                ],
+                "summary": "Stream live events",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Target",
+                        "name": "target",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Target tag",
+                        "name": "tag",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Rollout",
+                        "name": "rollout",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/deployment.Event"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error"
+                    }
+                }
+            }
+        },
+        "/hawkbit/rollouts": {
+            "get": {
+                "description": "List the rollouts with the state last reported for them",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Hawkbit FOTA"
+                ],
+                "summary": "List rollouts",
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/deployment.Rollout"
+                            }
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error"
+                    }
+                }
+            }
+        },
+        "/hawkbit/rollouts/{name}": {
+            "put": {
+                "description": "Record the state of a rollout as reported by the client running it, wave by wave. Webhooks are notified when the rollout pauses or finishes",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Hawkbit FOTA"
+                ],
+                "summary": "Report rollout state",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Rollout name",
+                        "name": "name",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "description": "Rollout state",
+                        "name": "array",
+                        "in": "body",
+                        "schema": {
+                            "$ref": "#/definitions/deployment.Rollout"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK"
+                    },
+                    "400": {
+                        "description": "Bad Request"
+                    },
+                    "404": {
+                        "description": "Not Found"
+                    },
+                    "500": {
+                        "description": "Internal Server Error"
+                    }
+                }
+            }
+        },
+        "/hawkbit/targets": {
+            "get": {
+                "description": "List known targets with their assigned and installed distributions",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Hawkbit FOTA"
+                ],
+                "summary": "List targets",
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/deployment.Target"
+                            }
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error"
+                    }
+                }
+            }
+        },
+        "/hawkbit/targets/{target}/autoconfirm": {
+            "put": {
+                "description": "Activate or deactivate auto-confirmation of deployments which require confirmation on target",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Hawkbit FOTA"
+                ],
+                "summary": "Toggle auto-confirmation",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Target name",
+                        "name": "target",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "description": "Auto-confirmation state",
+                        "name": "array",
+                        "in": "body",
+                        "schema": {
+                            "$ref": "#/definitions/deployment.AutoConfirm"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK"
+                    },
+                    "400": {
+                        "description": "Bad Request"
+                    },
+                    "500": {
+                        "description": "Internal Server Error"
+                    }
+                }
+            }
+        },
+        "/hawkbit/targets/{target}/tags": {
+            "put": {
+                "description": "Replace the tags of a target, which group targets for event streams. No tags removes them all",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Hawkbit FOTA"
+                ],
+                "summary": "Tag target",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Target name",
+                        "name": "target",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "description": "Tags",
+                        "name": "array",
+                        "in": "body",
+                        "schema": {
+                            "type": "array",
+                            "items": {
+                                "type": "string"
+                            }
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK"
+                    },
+                    "400": {
+                        "description": "Bad Request"
+                    },
+                    "500": {
+                        "description": "Internal Server Error"
+                    }
+                }
+            }
+        },
         "/hawkbit/upload": {
             "post": {
-                "description": "Upload new image profile which is to be added to a distribution",
+                "description": "Upload new image profile which is to be added to a distribution, optionally signing a raw build and storing compressed variants",
                 "consumes": [
                     "application/json"
                 ],
@@ -210,8 +498,14 @@ const docTemplate = `{
                     "400": {
                         "description": "Bad Request"
                     },
+                    "413": {
+                        "description": "Request Entity Too Large"
+                    },
                     "500": {
                         "description": "Internal Server Error"
+                    },
+                    "502": {
+                        "description": "Bad Gateway"
                     }
                 }
             }
@@ -259,42 +553,512 @@ const docTemplate = `{
                     }
                 }
             }
-        }
-    },
-    "definitions": {
-        "deployment.Deployment": {
-            "type": "object",
-            "properties": {
-                "actionid": {
-                    "type": "string"
-                },
-                "artifact": {
-                    "$ref": "#/definitions/deployment.Distribution"
-                },
-                "status": {
-                    "$ref": "#/definitions/deployment.Status"
-                },
-                "target": {
-                    "type": "string"
-                }
-            }
         },
-        "deployment.Distribution": {
-            "type": "object",
-            "properties": {
-                "image": {
-                    "$ref": "#/definitions/deployment.Upload"
-                },
-                "name": {
-                    "type": "string",
-                    "example": "hawkbit"
-                },
+        "/hawkbit/webhooks": {
+            "get": {
+                "description": "List configured webhooks, without their secrets",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Hawkbit FOTA"
+                ],
+                "summary": "List webhooks",
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/deployment.Webhook"
+                            }
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error"
+                    }
+                }
+            },
+            "post": {
+                "description": "Create or replace a webhook notified of target registration, action assignment, action status changes and rollouts pausing or finishing",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Hawkbit FOTA"
+                ],
+                "summary": "Create or replace webhook",
+                "parameters": [
+                    {
+                        "description": "Webhook",
+                        "name": "array",
+                        "in": "body",
+                        "schema": {
+                            "$ref": "#/definitions/deployment.Webhook"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK"
+                    },
+                    "400": {
+                        "description": "Bad Request"
+                    },
+                    "500": {
+                        "description": "Internal Server Error"
+                    }
+                }
+            }
+        },
+        "/hawkbit/webhooks/{name}": {
+            "delete": {
+                "description": "Delete webhook along with its delivery log",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Hawkbit FOTA"
+                ],
+                "summary": "Delete webhook",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Webhook name",
+                        "name": "name",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK"
+                    },
+                    "404": {
+                        "description": "Not Found"
+                    },
+                    "500": {
+                        "description": "Internal Server Error"
+                    }
+                }
+            }
+        },
+        "/hawkbit/webhooks/{name}/deliveries": {
+            "get": {
+                "description": "Retrieve the most recent deliveries to a webhook, oldest first",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Hawkbit FOTA"
+                ],
+                "summary": "Retrieve webhook deliveries",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Webhook name",
+                        "name": "name",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/deployment.Delivery"
+                            }
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found"
+                    },
+                    "500": {
+                        "description": "Internal Server Error"
+                    }
+                }
+            }
+        }
+    },
+    "definitions": {
+        "deployment.Artifact": {
+            "type": "object",
+            "properties": {
+                "encodings": {
+                    "type": "object",
+                    "additionalProperties": {
+                        "$ref": "#/definitions/deployment.Encoding"
+                    }
+                },
+                "mcuboot": {
+                    "$ref": "#/definitions/deployment.ImageInfo"
+                },
+                "sha256": {
+                    "type": "string",
+                    "example": "hash"
+                },
+                "signedBy": {
+                    "type": "string",
+                    "example": "release"
+                },
+                "size": {
+                    "type": "integer",
+                    "example": 12345
+                }
+            }
+        },
+        "deployment.AuditEntry": {
+            "type": "object",
+            "properties": {
+                "action": {
+                    "type": "string",
+                    "example": "PostDeployment"
+                },
+                "actor": {
+                    "type": "string",
+                    "example": "operator"
+                },
+                "after": {
+                    "type": "object"
+                },
+                "before": {
+                    "type": "object"
+                },
+                "entity": {
+                    "type": "string",
+                    "example": "deployment/ti_cc3200wf_12345"
+                },
+                "error": {
+                    "type": "string"
+                },
+                "hash": {
+                    "type": "string",
+                    "example": "hash"
+                },
+                "prev": {
+                    "type": "string",
+                    "example": "hash"
+                },
+                "seq": {
+                    "type": "integer",
+                    "example": 1
+                },
+                "time": {
+                    "type": "string"
+                }
+            }
+        },
+        "deployment.AutoConfirm": {
+            "type": "object",
+            "properties": {
+                "active": {
+                    "type": "boolean"
+                },
+                "initiator": {
+                    "type": "string",
+                    "example": "operator"
+                },
+                "remark": {
+                    "type": "string",
+                    "example": "kiosk unattended overnight"
+                }
+            }
+        },
+        "deployment.Compatibility": {
+            "type": "object",
+            "properties": {
+                "boards": {
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    },
+                    "example": [
+                        "cc3220sf_launchxl"
+                    ]
+                },
+                "hwRevisions": {
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    },
+                    "example": [
+                        "1.0"
+                    ]
+                }
+            }
+        },
+        "deployment.Delivery": {
+            "type": "object",
+            "properties": {
+                "attempts": {
+                    "type": "integer",
+                    "example": 1
+                },
+                "delivered": {
+                    "type": "boolean"
+                },
+                "error": {
+                    "type": "string"
+                },
+                "event": {
+                    "$ref": "#/definitions/deployment.Event"
+                },
+                "statusCode": {
+                    "type": "integer",
+                    "example": 200
+                },
+                "time": {
+                    "type": "string"
+                },
+                "webhook": {
+                    "type": "string",
+                    "example": "ops-chat"
+                }
+            }
+        },
+        "deployment.Deployment": {
+            "type": "object",
+            "properties": {
+                "actionid": {
+                    "type": "string"
+                },
+                "artifact": {
+                    "$ref": "#/definitions/deployment.Distribution"
+                },
+                "confirmation": {
+                    "type": "string"
+                },
+                "confirmationRequired": {
+                    "type": "boolean"
+                },
+                "forcetime": {
+                    "type": "string"
+                },
+                "maintenanceWindow": {
+                    "$ref": "#/definitions/deployment.MaintenanceWindow"
+                },
+                "status": {
+                    "$ref": "#/definitions/deployment.Status"
+                },
+                "target": {
+                    "type": "string"
+                },
+                "type": {
+                    "type": "string"
+                }
+            }
+        },
+        "deployment.Distribution": {
+            "type": "object",
+            "properties": {
+                "compatible": {
+                    "$ref": "#/definitions/deployment.Compatibility"
+                },
+                "image": {
+                    "$ref": "#/definitions/deployment.Upload"
+                },
+                "key": {
+                    "type": "string",
+                    "example": "release"
+                },
+                "name": {
+                    "type": "string",
+                    "example": "hawkbit"
+                },
+                "variant": {
+                    "type": "string",
+                    "example": "signed"
+                },
                 "version": {
                     "type": "string",
                     "example": "1.0.0+1"
                 }
             }
         },
+        "deployment.Encoding": {
+            "type": "object",
+            "properties": {
+                "sha256": {
+                    "type": "string",
+                    "example": "hash"
+                },
+                "size": {
+                    "type": "integer",
+                    "example": 1234
+                }
+            }
+        },
+        "deployment.Event": {
+            "type": "object",
+            "properties": {
+                "actionId": {
+                    "type": "string",
+                    "example": "1a2b3c4"
+                },
+                "distribution": {
+                    "type": "string",
+                    "example": "hawkbit"
+                },
+                "dropped": {
+                    "type": "integer",
+                    "example": 3
+                },
+                "event": {
+                    "type": "string",
+                    "example": "action.status"
+                },
+                "rollout": {
+                    "type": "string",
+                    "example": "spring-release"
+                },
+                "status": {
+                    "$ref": "#/definitions/deployment.Status"
+                },
+                "target": {
+                    "type": "string",
+                    "example": "ti_cc3200wf_12345"
+                },
+                "time": {
+                    "type": "string"
+                },
+                "upload": {
+                    "type": "string",
+                    "example": "zephyr_cc3220sf_signed"
+                }
+            }
+        },
+        "deployment.ImageInfo": {
+            "type": "object",
+            "properties": {
+                "flags": {
+                    "type": "integer"
+                },
+                "hash": {
+                    "type": "string",
+                    "example": "hash"
+                },
+                "headerSize": {
+                    "type": "integer",
+                    "example": 512
+                },
+                "imageSize": {
+                    "type": "integer",
+                    "example": 27364
+                },
+                "keyHash": {
+                    "type": "string",
+                    "example": "hash"
+                },
+                "loadAddr": {
+                    "type": "integer"
+                },
+                "signature": {
+                    "type": "string",
+                    "example": "ECDSA-P256"
+                },
+                "version": {
+                    "type": "string",
+                    "example": "1.0.0+1"
+                }
+            }
+        },
+        "deployment.MaintenanceWindow": {
+            "type": "object",
+            "properties": {
+                "duration": {
+                    "type": "string",
+                    "example": "02:00:00"
+                },
+                "schedule": {
+                    "type": "string",
+                    "example": "0 2 * * *"
+                },
+                "timezone": {
+                    "type": "string",
+                    "example": "+00:00"
+                }
+            }
+        },
+        "deployment.Progress": {
+            "type": "object",
+            "properties": {
+                "cnt": {
+                    "type": "integer",
+                    "example": 2
+                },
+                "of": {
+                    "type": "integer",
+                    "example": 5
+                }
+            }
+        },
+        "deployment.Rollout": {
+            "type": "object",
+            "properties": {
+                "distribution": {
+                    "type": "string",
+                    "example": "hawkbit"
+                },
+                "failures": {
+                    "type": "integer",
+                    "example": 0
+                },
+                "name": {
+                    "type": "string",
+                    "example": "spring-release"
+                },
+                "reason": {
+                    "type": "string",
+                    "example": "3 actions failed"
+                },
+                "state": {
+                    "type": "string",
+                    "example": "running"
+                },
+                "targets": {
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    },
+                    "example": [
+                        "ti_cc3200wf_12345"
+                    ]
+                },
+                "updated": {
+                    "type": "string"
+                },
+                "wave": {
+                    "type": "integer",
+                    "example": 1
+                }
+            }
+        },
+        "deployment.SignParams": {
+            "type": "object",
+            "properties": {
+                "headerSize": {
+                    "type": "integer",
+                    "example": 512
+                },
+                "loadAddr": {
+                    "type": "integer"
+                }
+            }
+        },
         "deployment.Status": {
             "type": "object",
             "properties": {
@@ -306,14 +1070,63 @@ const docTemplate = `{
                     "properties": {
                         "finished": {
                             "type": "string"
+                        },
+                        "progress": {
+                            "$ref": "#/definitions/deployment.Progress"
                         }
                     }
                 }
             }
         },
+        "deployment.Target": {
+            "type": "object",
+            "properties": {
+                "assigned": {
+                    "$ref": "#/definitions/deployment.Distribution"
+                },
+                "installed": {
+                    "$ref": "#/definitions/deployment.Distribution"
+                },
+                "lastPoll": {
+                    "type": "string"
+                },
+                "name": {
+                    "type": "string",
+                    "example": "ti_cc3200wf_12345"
+                },
+                "tags": {
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    },
+                    "example": [
+                        "lab"
+                    ]
+                }
+            }
+        },
         "deployment.Upload": {
             "type": "object",
             "properties": {
+                "compress": {
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    },
+                    "example": [
+                        "gzip",
+                        "lz4"
+                    ]
+                },
+                "encodings": {
+                    "type": "object",
+                    "additionalProperties": {
+                        "$ref": "#/definitions/deployment.Encoding"
+                    }
+                },
+                "mcuboot": {
+                    "$ref": "#/definitions/deployment.ImageInfo"
+                },
                 "name": {
                     "type": "string",
                     "example": "zephyr_cc3220sf_signed"
@@ -322,6 +1135,16 @@ const docTemplate = `{
                     "type": "string",
                     "example": "hash"
                 },
+                "sign": {
+                    "$ref": "#/definitions/deployment.SignParams"
+                },
+                "signed": {
+                    "$ref": "#/definitions/deployment.Artifact"
+                },
+                "signedBy": {
+                    "type": "string",
+                    "example": "release"
+                },
                 "size": {
                     "type": "integer"
                 },
@@ -335,22 +1158,76 @@ const docTemplate = `{
                 }
             }
         },
+        "deployment.Webhook": {
+            "type": "object",
+            "properties": {
+                "events": {
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    },
+                    "example": [
+                        "action.status"
+                    ]
+                },
+                "name": {
+                    "type": "string",
+                    "example": "ops-chat"
+                },
+                "secret": {
+                    "type": "string",
+                    "example": "s3cr3t"
+                },
+                "url": {
+                    "type": "string",
+                    "example": "https://chat.example.com/hooks/fota"
+                }
+            }
+        },
         "frontend.postDeploymentRequest": {
             "type": "object",
             "properties": {
+                "confirmationRequired": {
+                    "type": "boolean",
+                    "example": false
+                },
                 "distribution": {
                     "type": "string",
                     "example": "hawkbit"
                 },
+                "forcetime": {
+                    "type": "string",
+                    "example": "2023-08-01T02:00:00Z"
+                },
+                "maintenanceWindow": {
+                    "$ref": "#/definitions/deployment.MaintenanceWindow"
+                },
                 "target": {
                     "type": "string",
                     "example": "ti_cc3200wf_12345"
+                },
+                "type": {
+                    "type": "string",
+                    "enum": [
+                        "forced",
+                        "soft",
+                        "downloadonly",
+                        "timeforced"
+                    ],
+                    "example": "forced"
                 }
             }
         },
         "frontend.postDistributionRequest": {
             "type": "object",
             "properties": {
+                "compatible": {
+                    "$ref": "#/definitions/deployment.Compatibility"
+                },
+                "key": {
+                    "type": "string",
+                    "example": "release"
+                },
                 "name": {
                     "type": "string",
                     "example": "hawkbit"
@@ -359,6 +1236,14 @@ const docTemplate = `{
                     "type": "string",
                     "example": "zephyr_cc3220sf_signed"
                 },
+                "variant": {
+                    "type": "string",
+                    "enum": [
+                        "original",
+                        "signed"
+                    ],
+                    "example": "signed"
+                },
                 "version": {
                     "type": "string",
                     "example": "1.0.0+1"
@@ -368,6 +1253,17 @@ const docTemplate = `{
         "frontend.postUploadRequest": {
             "type": "object",
             "properties": {
+                "compress": {
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    },
+                    "example": [
+                        "gzip",
+                        "lz4",
+                        "heatshrink"
+                    ]
+                },
                 "file": {
                     "type": "string",
                     "example": "/workdir/build/artifact.bin"
@@ -376,6 +1272,9 @@ const docTemplate = `{
                     "type": "string",
                     "example": "zephyr_cc3220sf_signed"
                 },
+                "sign": {
+                    "$ref": "#/definitions/deployment.SignParams"
+                },
                 "version": {
                     "type": "string",
                     "example": "1.0.0+1"
@@ -9,28 +9,62 @@ import (
 
 type Endpoints struct {
 	PostUpload       endpoint.Endpoint
+	PostUploadImage  endpoint.Endpoint
 	GetUpload        endpoint.Endpoint
 	PostDistribution endpoint.Endpoint
 	GetDistribution  endpoint.Endpoint
 	PostDeployment   endpoint.Endpoint
 	GetDeployment    endpoint.Endpoint
+	GetTargets       endpoint.Endpoint
+	PutAutoConfirm   endpoint.Endpoint
+	PutTags          endpoint.Endpoint
+	GetAudit         endpoint.Endpoint
+
+	PostWebhook          endpoint.Endpoint
+	GetWebhooks          endpoint.Endpoint
+	DeleteWebhook        endpoint.Endpoint
+	GetWebhookDeliveries endpoint.Endpoint
+
+	PutRollout  endpoint.Endpoint
+	GetRollouts endpoint.Endpoint
 }
 
 func MakeFrontendServerEndpoints(s FrontendService) Endpoints {
 	return Endpoints{
-		PostUpload:       MakePostUpload(s),
-		GetUpload:        MakeGetUpload(s),
-		PostDistribution: MakePostDistribution(s),
-		GetDistribution:  MakeGetDistribution(s),
-		PostDeployment:   MakePostDeployment(s),
-		GetDeployment:    MakeGetDeployment(s),
+		PostUpload:       traced("PostUpload", MakePostUpload(s)),
+		PostUploadImage:  traced("PostUploadImage", MakePostUploadImage(s)),
+		GetUpload:        traced("GetUpload", MakeGetUpload(s)),
+		PostDistribution: traced("PostDistribution", MakePostDistribution(s)),
+		GetDistribution:  traced("GetDistribution", MakeGetDistribution(s)),
+		PostDeployment:   traced("PostDeployment", MakePostDeployment(s)),
+		GetDeployment:    traced("GetDeployment", MakeGetDeployment(s)),
+		GetTargets:       traced("GetTargets", MakeGetTargets(s)),
+		PutAutoConfirm:   traced("PutAutoConfirm", MakePutAutoConfirm(s)),
+		PutTags:          traced("PutTags", MakePutTags(s)),
+		GetAudit:         traced("GetAudit", MakeGetAudit(s)),
+
+		PostWebhook:          traced("PostWebhook", MakePostWebhook(s)),
+		GetWebhooks:          traced("GetWebhooks", MakeGetWebhooks(s)),
+		DeleteWebhook:        traced("DeleteWebhook", MakeDeleteWebhook(s)),
+		GetWebhookDeliveries: traced("GetWebhookDeliveries", MakeGetWebhookDeliveries(s)),
+
+		PutRollout:  traced("PutRollout", MakePutRollout(s)),
+		GetRollouts: traced("GetRollouts", MakeGetRollouts(s)),
 	}
 }
 
 func MakePostUpload(s FrontendService) endpoint.Endpoint {
 	return func(ctx context.Context, request interface{}) (response interface{}, err error) {
 		req := request.(postUploadRequest)
-		e := s.PostUpload(ctx, req.Name, req.Version, req.File)
+		e := s.PostUpload(ctx, req.Name, req.Version, req.File, req.Sign, req.Compress)
+		return postUploadResponse{Err: e}, nil
+	}
+}
+
+func MakePostUploadImage(s FrontendService) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (response interface{}, err error) {
+		req := request.(postUploadImageRequest)
+		e := s.PostUploadImage(ctx, req.Name, req.Version, req.Image, req.Sign, req.Compress)
 		return postUploadResponse{Err: e}, nil
 	}
 }
@@ -46,7 +80,7 @@ func MakeGetUpload(s FrontendService) endpoint.Endpoint {
 func MakePostDistribution(s FrontendService) endpoint.Endpoint {
 	return func(ctx context.Context, request interface{}) (response interface{}, err error) {
 		req := request.(postDistributionRequest)
-		e := s.PostDistribution(ctx, req.Name, req.Version, req.Upload)
+		e := s.PostDistribution(ctx, req.Name, req.Version, req.Upload, req.Key, req.Variant, req.Compatible)
 		return postDistributionResponse{Err: e}, nil
 	}
 }
@@ -62,7 +96,13 @@ func MakeGetDistribution(s FrontendService) endpoint.Endpoint {
 func MakePostDeployment(s FrontendService) endpoint.Endpoint {
 	return func(ctx context.Context, request interface{}) (response interface{}, err error) {
 		req := request.(postDeploymentRequest)
-		e := s.PostDeployment(ctx, req.Target, req.Distribution)
+		o := deployment.DeploymentOptions{
+			Type:                 req.Type,
+			ForceTime:            req.ForceTime,
+			Maintenance:          req.Maintenance,
+			ConfirmationRequired: req.ConfirmationRequired,
+		}
+		e := s.PostDeployment(ctx, req.Target, req.Distribution, o)
 		return postDeploymentResponse{Err: e}, nil
 	}
 }
@@ -75,16 +115,106 @@ func MakeGetDeployment(s FrontendService) endpoint.Endpoint {
 	}
 }
 
+func MakeGetTargets(s FrontendService) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (response interface{}, err error) {
+		ts, e := s.GetTargets(ctx)
+		return getTargetsResponse{Targets: ts, Err: e}, nil
+	}
+}
+
+func MakePutAutoConfirm(s FrontendService) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (response interface{}, err error) {
+		req := request.(putAutoConfirmRequest)
+		e := s.PutAutoConfirm(ctx, req.Target, req.AutoConfirm)
+		return putAutoConfirmResponse{Err: e}, nil
+	}
+}
+
+func MakePutTags(s FrontendService) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (response interface{}, err error) {
+		req := request.(putTagsRequest)
+		e := s.PutTags(ctx, req.Target, req.Tags)
+		return putTagsResponse{Err: e}, nil
+	}
+}
+
+func MakeGetAudit(s FrontendService) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (response interface{}, err error) {
+		req := request.(getAuditRequest)
+		es, e := s.GetAudit(ctx, deployment.AuditQuery{Entity: req.Entity, Since: req.Since, Limit: req.Limit})
+		return getAuditResponse{Entries: es, Err: e}, nil
+	}
+}
+
+func MakePostWebhook(s FrontendService) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (response interface{}, err error) {
+		req := request.(postWebhookRequest)
+		e := s.PostWebhook(ctx, req.Webhook)
+		return postWebhookResponse{Err: e}, nil
+	}
+}
+
+func MakeGetWebhooks(s FrontendService) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (response interface{}, err error) {
+		ws, e := s.GetWebhooks(ctx)
+		return getWebhooksResponse{Webhooks: ws, Err: e}, nil
+	}
+}
+
+func MakeDeleteWebhook(s FrontendService) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (response interface{}, err error) {
+		req := request.(deleteWebhookRequest)
+		e := s.DeleteWebhook(ctx, req.Name)
+		return deleteWebhookResponse{Err: e}, nil
+	}
+}
+
+func MakeGetWebhookDeliveries(s FrontendService) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (response interface{}, err error) {
+		req := request.(getWebhookDeliveriesRequest)
+		ds, e := s.GetWebhookDeliveries(ctx, req.Name)
+		return getWebhookDeliveriesResponse{Deliveries: ds, Err: e}, nil
+	}
+}
+
+func MakePutRollout(s FrontendService) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (response interface{}, err error) {
+		req := request.(putRolloutRequest)
+		e := s.PutRollout(ctx, req.Rollout)
+		return putRolloutResponse{Err: e}, nil
+	}
+}
+
+func MakeGetRollouts(s FrontendService) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (response interface{}, err error) {
+		rs, e := s.GetRollouts(ctx)
+		return getRolloutsResponse{Rollouts: rs, Err: e}, nil
+	}
+}
+
 type postUploadRequest struct {
 	Name    string `json:"name" example:"zephyr_cc3220sf_signed"`
 	Version string `json:"version" example:"1.0.0+1"`
 	File    string `json:"file" example:"/workdir/build/artifact.bin"`
+
+	Sign     *deployment.SignParams `json:"sign,omitempty"`
+	Compress []string               `json:"compress,omitempty" example:"gzip,lz4,heatshrink"`
 }
 
 type postUploadResponse struct {
 	Err error `json:"error,omitempty"`
 }
 
+func (r postUploadResponse) error() error { return r.Err }
+
+type postUploadImageRequest struct {
+	Name     string
+	Version  string
+	Image    []byte
+	Sign     *deployment.SignParams
+	Compress []string
+}
+
 type getUploadRequest struct {
 	Name string `json:"name"`
 }
@@ -94,16 +224,24 @@ type getUploadResponse struct {
 	Err    error             `json:"error,omitempty"`
 }
 
+func (r getUploadResponse) error() error { return r.Err }
+
 type postDistributionRequest struct {
 	Name    string `json:"name" example:"hawkbit"`
 	Version string `json:"version" example:"1.0.0+1"`
 	Upload  string `json:"upload" example:"zephyr_cc3220sf_signed"`
+	Key     string `json:"key,omitempty" example:"release"`
+	Variant string `json:"variant,omitempty" example:"signed" enums:"original,signed"`
+
+	Compatible *deployment.Compatibility `json:"compatible,omitempty"`
 }
 
 type postDistributionResponse struct {
 	Err error `json:"error,omitempty"`
 }
 
+func (r postDistributionResponse) error() error { return r.Err }
+
 type getDistributionRequest struct {
 	Name string `json:"name"`
 }
@@ -113,15 +251,24 @@ type getDistributionResponse struct {
 	Err          error                   `json:"error,omitempty"`
 }
 
+func (r getDistributionResponse) error() error { return r.Err }
+
 type postDeploymentRequest struct {
-	Target       string `json:"target" example:"ti_cc3200wf_12345"`
-	Distribution string `json:"distribution" example:"hawkbit"`
+	Target       string                        `json:"target" example:"ti_cc3200wf_12345"`
+	Distribution string                        `json:"distribution" example:"hawkbit"`
+	Type         string                        `json:"type,omitempty" example:"forced" enums:"forced,soft,downloadonly,timeforced"`
+	ForceTime    string                        `json:"forcetime,omitempty" example:"2023-08-01T02:00:00Z"`
+	Maintenance  *deployment.MaintenanceWindow `json:"maintenanceWindow,omitempty"`
+
+	ConfirmationRequired bool `json:"confirmationRequired,omitempty" example:"false"`
 }
 
 type postDeploymentResponse struct {
 	Err error `json:"error,omitempty"`
 }
 
+func (r postDeploymentResponse) error() error { return r.Err }
+
 type getDeploymentRequest struct {
 	Target string `json:"target"`
 }
@@ -130,3 +277,123 @@ type getDeploymentResponse struct {
 	Deployment deployment.Deployment `json:"deployment,omitempty"`
 	Err        error                 `json:"error,omitempty"`
 }
+
+func (r getDeploymentResponse) error() error { return r.Err }
+
+type getTargetsRequest struct{}
+
+type getTargetsResponse struct {
+	Targets []deployment.Target `json:"targets"`
+	Err     error               `json:"error,omitempty"`
+}
+
+func (r getTargetsResponse) error() error { return r.Err }
+
+type putAutoConfirmRequest struct {
+	Target      string `json:"target"`
+	AutoConfirm deployment.AutoConfirm
+}
+
+type putAutoConfirmResponse struct {
+	Err error `json:"error,omitempty"`
+}
+
+func (r putAutoConfirmResponse) error() error { return r.Err }
+
+type putTagsRequest struct {
+	Target string   `json:"target"`
+	Tags   []string `json:"tags"`
+}
+
+type putTagsResponse struct {
+	Err error `json:"error,omitempty"`
+}
+
+func (r putTagsResponse) error() error { return r.Err }
+
+type getAuditRequest struct {
+	Entity string `json:"entity"`
+	Since  int    `json:"since"`
+	Limit  int    `json:"limit"`
+}
+
+type getAuditResponse struct {
+	Entries []deployment.AuditEntry `json:"entries"`
+	Err     error                   `json:"error,omitempty"`
+}
+
+func (r getAuditResponse) error() error { return r.Err }
+
+type postWebhookRequest struct {
+	Webhook deployment.Webhook
+}
+
+type postWebhookResponse struct {
+	Err error `json:"error,omitempty"`
+}
+
+func (r postWebhookResponse) error() error { return r.Err }
+
+type getWebhooksRequest struct{}
+
+type getWebhooksResponse struct {
+	Webhooks []deployment.Webhook `json:"webhooks"`
+	Err      error                `json:"error,omitempty"`
+}
+
+func (r getWebhooksResponse) error() error { return r.Err }
+
+type deleteWebhookRequest struct {
+	Name string `json:"name"`
+}
+
+type deleteWebhookResponse struct {
+	Err error `json:"error,omitempty"`
+}
+
+func (r deleteWebhookResponse) error() error { return r.Err }
+
+type getWebhookDeliveriesRequest struct {
+	Name string `json:"name"`
+}
+
+type getWebhookDeliveriesResponse struct {
+	Deliveries []deployment.Delivery `json:"deliveries"`
+	Err        error                 `json:"error,omitempty"`
+}
+
+func (r getWebhookDeliveriesResponse) error() error { return r.Err }
+
+type putRolloutRequest struct {
+	Rollout deployment.Rollout
+}
+
+type putRolloutResponse struct {
+	Err error `json:"error,omitempty"`
+}
+
+func (r putRolloutResponse) error() error { return r.Err }
+
+type getRolloutsRequest struct{}
+
+type getRolloutsResponse struct {
+	Rollouts []deployment.Rollout `json:"rollouts"`
+	Err      error                `json:"error,omitempty"`
+}
+
+func (r getRolloutsResponse) error() error { return r.Err }
+
+// traced wraps e in a span named after the endpoint.
+func traced(name string, e endpoint.Endpoint) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (response interface{}, err error) {
+		ctx, span := deployment.Tracer.Start(ctx, "endpoint."+name)
+		defer func() {
+			rerr := err
+			if r, ok := response.(errorer); ok && rerr == nil {
+				rerr = r.error()
+			}
+			deployment.EndSpan(span, rerr)
+		}()
+		return e(ctx, request)
+	}
+}
@@ -2,10 +2,13 @@ package frontend
 
 import (
 	"context"
+	"fmt"
 	"time"
 
 	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/metrics"
 	"github.com/jonathanyhliang/hawkbit-fota/deployment"
+	"go.opentelemetry.io/otel/trace"
 )
 
 // Middleware describes a service (as opposed to endpoint) middleware.
@@ -25,12 +28,22 @@ type loggingMiddleware struct {
 	logger log.Logger
 }
 
-func (mw loggingMiddleware) PostUpload(ctx context.Context, n string, v string, f string) (err error) {
+func (mw loggingMiddleware) PostUpload(ctx context.Context, n string, v string, f string,
+	s *deployment.SignParams, c []string) (err error) {
 	defer func(begin time.Time) {
-		mw.logger.Log("method", "PostUpload", "name", n, "version", v, "file", f,
+		mw.logger.Log("method", "PostUpload", "name", n, "version", v, "file", f, "sign", s != nil, "compress", c,
 			"took", time.Since(begin), "err", err)
 	}(time.Now())
-	return mw.next.PostUpload(ctx, n, v, f)
+	return mw.next.PostUpload(ctx, n, v, f, s, c)
+}
+
+func (mw loggingMiddleware) PostUploadImage(ctx context.Context, n string, v string, img []byte,
+	s *deployment.SignParams, c []string) (err error) {
+	defer func(begin time.Time) {
+		mw.logger.Log("method", "PostUploadImage", "name", n, "version", v, "size", len(img), "sign", s != nil,
+			"compress", c, "took", time.Since(begin), "err", err)
+	}(time.Now())
+	return mw.next.PostUploadImage(ctx, n, v, img, s, c)
 }
 
 func (mw loggingMiddleware) GetUpload(ctx context.Context, n string) (u deployment.Upload, err error) {
@@ -40,12 +53,13 @@ func (mw loggingMiddleware) GetUpload(ctx context.Context, n string) (u deployme
 	return mw.next.GetUpload(ctx, n)
 }
 
-func (mw loggingMiddleware) PostDistribution(ctx context.Context, n string, v string, u string) (err error) {
+func (mw loggingMiddleware) PostDistribution(ctx context.Context, n string, v string, u string,
+	k string, a string, c *deployment.Compatibility) (err error) {
 	defer func(begin time.Time) {
-		mw.logger.Log("method", "PostDistribution", "name", n, "version", v, "upload", u,
-			"took", time.Since(begin), "err", err)
+		mw.logger.Log("method", "PostDistribution", "name", n, "version", v, "upload", u, "key", k,
+			"variant", a, "compatible", c != nil, "took", time.Since(begin), "err", err)
 	}(time.Now())
-	return mw.next.PostDistribution(ctx, n, v, u)
+	return mw.next.PostDistribution(ctx, n, v, u, k, a, c)
 }
 
 func (mw loggingMiddleware) GetDistribution(ctx context.Context, n string) (d deployment.Distribution, err error) {
@@ -55,12 +69,13 @@ func (mw loggingMiddleware) GetDistribution(ctx context.Context, n string) (d de
 	return mw.next.GetDistribution(ctx, n)
 }
 
-func (mw loggingMiddleware) PostDeployment(ctx context.Context, t string, d string) (err error) {
+func (mw loggingMiddleware) PostDeployment(ctx context.Context, t string, d string,
+	o deployment.DeploymentOptions) (err error) {
 	defer func(begin time.Time) {
-		mw.logger.Log("method", "PostDeployment", "target", t, "distribution", d,
+		mw.logger.Log("method", "PostDeployment", "target", t, "distribution", d, "type", o.Type,
 			"took", time.Since(begin), "err", err)
 	}(time.Now())
-	return mw.next.PostDeployment(ctx, t, d)
+	return mw.next.PostDeployment(ctx, t, d, o)
 }
 
 func (mw loggingMiddleware) GetDeployment(ctx context.Context, t string) (dp deployment.Deployment, err error) {
@@ -69,3 +84,481 @@ func (mw loggingMiddleware) GetDeployment(ctx context.Context, t string) (dp dep
 	}(time.Now())
 	return mw.next.GetDeployment(ctx, t)
 }
+
+func (mw loggingMiddleware) GetTargets(ctx context.Context) (ts []deployment.Target, err error) {
+	defer func(begin time.Time) {
+		mw.logger.Log("method", "GetTargets", "took", time.Since(begin), "err", err)
+	}(time.Now())
+	return mw.next.GetTargets(ctx)
+}
+
+func (mw loggingMiddleware) PutAutoConfirm(ctx context.Context, t string, a deployment.AutoConfirm) (err error) {
+	defer func(begin time.Time) {
+		mw.logger.Log("method", "PutAutoConfirm", "target", t, "active", a.Active,
+			"took", time.Since(begin), "err", err)
+	}(time.Now())
+	return mw.next.PutAutoConfirm(ctx, t, a)
+}
+
+func (mw loggingMiddleware) PutTags(ctx context.Context, t string, tags []string) (err error) {
+	defer func(begin time.Time) {
+		mw.logger.Log("method", "PutTags", "target", t, "tags", len(tags), "took", time.Since(begin), "err", err)
+	}(time.Now())
+	return mw.next.PutTags(ctx, t, tags)
+}
+
+func (mw loggingMiddleware) GetAudit(ctx context.Context, q deployment.AuditQuery) (es []deployment.AuditEntry, err error) {
+	defer func(begin time.Time) {
+		mw.logger.Log("method", "GetAudit", "entity", q.Entity, "since", q.Since, "limit", q.Limit,
+			"took", time.Since(begin), "err", err)
+	}(time.Now())
+	return mw.next.GetAudit(ctx, q)
+}
+
+func (mw loggingMiddleware) PostWebhook(ctx context.Context, w deployment.Webhook) (err error) {
+	defer func(begin time.Time) {
+		mw.logger.Log("method", "PostWebhook", "name", w.Name, "url", w.URL, "events", len(w.Events),
+			"took", time.Since(begin), "err", err)
+	}(time.Now())
+	return mw.next.PostWebhook(ctx, w)
+}
+
+func (mw loggingMiddleware) GetWebhooks(ctx context.Context) (ws []deployment.Webhook, err error) {
+	defer func(begin time.Time) {
+		mw.logger.Log("method", "GetWebhooks", "took", time.Since(begin), "err", err)
+	}(time.Now())
+	return mw.next.GetWebhooks(ctx)
+}
+
+func (mw loggingMiddleware) DeleteWebhook(ctx context.Context, n string) (err error) {
+	defer func(begin time.Time) {
+		mw.logger.Log("method", "DeleteWebhook", "name", n, "took", time.Since(begin), "err", err)
+	}(time.Now())
+	return mw.next.DeleteWebhook(ctx, n)
+}
+
+func (mw loggingMiddleware) GetWebhookDeliveries(ctx context.Context, n string) (ds []deployment.Delivery, err error) {
+	defer func(begin time.Time) {
+		mw.logger.Log("method", "GetWebhookDeliveries", "name", n, "took", time.Since(begin), "err", err)
+	}(time.Now())
+	return mw.next.GetWebhookDeliveries(ctx, n)
+}
+
+func (mw loggingMiddleware) GetEvents(ctx context.Context, f deployment.EventFilter) (es <-chan deployment.Event, err error) {
+	defer func(begin time.Time) {
+		mw.logger.Log("method", "GetEvents", "target", f.Target, "tag", f.Tag, "rollout", f.Rollout,
+			"took", time.Since(begin), "err", err)
+	}(time.Now())
+	return mw.next.GetEvents(ctx, f)
+}
+
+func (mw loggingMiddleware) PutRollout(ctx context.Context, r deployment.Rollout) (err error) {
+	defer func(begin time.Time) {
+		mw.logger.Log("method", "PutRollout", "name", r.Name, "state", r.State, "wave", r.Wave,
+			"took", time.Since(begin), "err", err)
+	}(time.Now())
+	return mw.next.PutRollout(ctx, r)
+}
+
+func (mw loggingMiddleware) GetRollouts(ctx context.Context) (rs []deployment.Rollout, err error) {
+	defer func(begin time.Time) {
+		mw.logger.Log("method", "GetRollouts", "took", time.Since(begin), "err", err)
+	}(time.Now())
+	return mw.next.GetRollouts(ctx)
+}
+
+// InstrumentingFrontendMiddleware records request counts and latencies, labelled by method and
+// whether an error was returned.
+func InstrumentingFrontendMiddleware(requestCount metrics.Counter, requestLatency metrics.Histogram) Middleware {
+	return func(next FrontendService) FrontendService {
+		return &instrumentingMiddleware{
+			next:           next,
+			requestCount:   requestCount,
+			requestLatency: requestLatency,
+		}
+	}
+}
+
+type instrumentingMiddleware struct {
+	next           FrontendService
+	requestCount   metrics.Counter
+	requestLatency metrics.Histogram
+}
+
+func (mw instrumentingMiddleware) observe(method string, begin time.Time, err error) {
+	lvs := []string{"method", method, "error", fmt.Sprint(err != nil)}
+	mw.requestCount.With(lvs...).Add(1)
+	mw.requestLatency.With(lvs...).Observe(time.Since(begin).Seconds())
+}
+
+func (mw instrumentingMiddleware) PostUpload(ctx context.Context, n string, v string, f string,
+	s *deployment.SignParams, c []string) (err error) {
+	defer func(begin time.Time) {
+		mw.observe("PostUpload", begin, err)
+	}(time.Now())
+	return mw.next.PostUpload(ctx, n, v, f, s, c)
+}
+
+func (mw instrumentingMiddleware) PostUploadImage(ctx context.Context, n string, v string, img []byte,
+	s *deployment.SignParams, c []string) (err error) {
+	defer func(begin time.Time) {
+		mw.observe("PostUploadImage", begin, err)
+	}(time.Now())
+	return mw.next.PostUploadImage(ctx, n, v, img, s, c)
+}
+
+func (mw instrumentingMiddleware) GetUpload(ctx context.Context, n string) (u deployment.Upload, err error) {
+	defer func(begin time.Time) {
+		mw.observe("GetUpload", begin, err)
+	}(time.Now())
+	return mw.next.GetUpload(ctx, n)
+}
+
+func (mw instrumentingMiddleware) PostDistribution(ctx context.Context, n string, v string, u string,
+	k string, a string, c *deployment.Compatibility) (err error) {
+	defer func(begin time.Time) {
+		mw.observe("PostDistribution", begin, err)
+	}(time.Now())
+	return mw.next.PostDistribution(ctx, n, v, u, k, a, c)
+}
+
+func (mw instrumentingMiddleware) GetDistribution(ctx context.Context, n string) (d deployment.Distribution, err error) {
+	defer func(begin time.Time) {
+		mw.observe("GetDistribution", begin, err)
+	}(time.Now())
+	return mw.next.GetDistribution(ctx, n)
+}
+
+func (mw instrumentingMiddleware) PostDeployment(ctx context.Context, t string, d string,
+	o deployment.DeploymentOptions) (err error) {
+	defer func(begin time.Time) {
+		mw.observe("PostDeployment", begin, err)
+	}(time.Now())
+	return mw.next.PostDeployment(ctx, t, d, o)
+}
+
+func (mw instrumentingMiddleware) GetDeployment(ctx context.Context, t string) (dp deployment.Deployment, err error) {
+	defer func(begin time.Time) {
+		mw.observe("GetDeployment", begin, err)
+	}(time.Now())
+	return mw.next.GetDeployment(ctx, t)
+}
+
+func (mw instrumentingMiddleware) GetTargets(ctx context.Context) (ts []deployment.Target, err error) {
+	defer func(begin time.Time) {
+		mw.observe("GetTargets", begin, err)
+	}(time.Now())
+	return mw.next.GetTargets(ctx)
+}
+
+func (mw instrumentingMiddleware) PutAutoConfirm(ctx context.Context, t string, a deployment.AutoConfirm) (err error) {
+	defer func(begin time.Time) {
+		mw.observe("PutAutoConfirm", begin, err)
+	}(time.Now())
+	return mw.next.PutAutoConfirm(ctx, t, a)
+}
+
+func (mw instrumentingMiddleware) PutTags(ctx context.Context, t string, tags []string) (err error) {
+	defer func(begin time.Time) {
+		mw.observe("PutTags", begin, err)
+	}(time.Now())
+	return mw.next.PutTags(ctx, t, tags)
+}
+
+func (mw instrumentingMiddleware) GetAudit(ctx context.Context, q deployment.AuditQuery) (es []deployment.AuditEntry, err error) {
+	defer func(begin time.Time) {
+		mw.observe("GetAudit", begin, err)
+	}(time.Now())
+	return mw.next.GetAudit(ctx, q)
+}
+
+func (mw instrumentingMiddleware) PostWebhook(ctx context.Context, w deployment.Webhook) (err error) {
+	defer func(begin time.Time) {
+		mw.observe("PostWebhook", begin, err)
+	}(time.Now())
+	return mw.next.PostWebhook(ctx, w)
+}
+
+func (mw instrumentingMiddleware) GetWebhooks(ctx context.Context) (ws []deployment.Webhook, err error) {
+	defer func(begin time.Time) {
+		mw.observe("GetWebhooks", begin, err)
+	}(time.Now())
+	return mw.next.GetWebhooks(ctx)
+}
+
+func (mw instrumentingMiddleware) DeleteWebhook(ctx context.Context, n string) (err error) {
+	defer func(begin time.Time) {
+		mw.observe("DeleteWebhook", begin, err)
+	}(time.Now())
+	return mw.next.DeleteWebhook(ctx, n)
+}
+
+func (mw instrumentingMiddleware) GetWebhookDeliveries(ctx context.Context, n string) (ds []deployment.Delivery, err error) {
+	defer func(begin time.Time) {
+		mw.observe("GetWebhookDeliveries", begin, err)
+	}(time.Now())
+	return mw.next.GetWebhookDeliveries(ctx, n)
+}
+
+func (mw instrumentingMiddleware) GetEvents(ctx context.Context, f deployment.EventFilter) (es <-chan deployment.Event, err error) {
+	defer func(begin time.Time) {
+		mw.observe("GetEvents", begin, err)
+	}(time.Now())
+	return mw.next.GetEvents(ctx, f)
+}
+
+func (mw instrumentingMiddleware) PutRollout(ctx context.Context, r deployment.Rollout) (err error) {
+	defer func(begin time.Time) {
+		mw.observe("PutRollout", begin, err)
+	}(time.Now())
+	return mw.next.PutRollout(ctx, r)
+}
+
+func (mw instrumentingMiddleware) GetRollouts(ctx context.Context) (rs []deployment.Rollout, err error) {
+	defer func(begin time.Time) {
+		mw.observe("GetRollouts", begin, err)
+	}(time.Now())
+	return mw.next.GetRollouts(ctx)
+}
+
+// TracingFrontendMiddleware wraps every call in a span named after the method, carrying
+// the target, action and distribution the call is about.
+func TracingFrontendMiddleware() Middleware {
+	return func(next FrontendService) FrontendService {
+		return &tracingMiddleware{next: next}
+	}
+}
+
+type tracingMiddleware struct {
+	next FrontendService
+}
+
+func (mw tracingMiddleware) PostUpload(ctx context.Context, n string, v string, f string,
+	s *deployment.SignParams, c []string) (err error) {
+	ctx, span := deployment.Tracer.Start(ctx, "frontend.PostUpload",
+		trace.WithAttributes(deployment.SpanUpload.String(n)))
+	defer func() { deployment.EndSpan(span, err) }()
+	return mw.next.PostUpload(ctx, n, v, f, s, c)
+}
+
+func (mw tracingMiddleware) PostUploadImage(ctx context.Context, n string, v string, img []byte,
+	s *deployment.SignParams, c []string) (err error) {
+	ctx, span := deployment.Tracer.Start(ctx, "frontend.PostUploadImage",
+		trace.WithAttributes(deployment.SpanUpload.String(n)))
+	defer func() { deployment.EndSpan(span, err) }()
+	return mw.next.PostUploadImage(ctx, n, v, img, s, c)
+}
+
+func (mw tracingMiddleware) GetUpload(ctx context.Context, n string) (u deployment.Upload, err error) {
+	ctx, span := deployment.Tracer.Start(ctx, "frontend.GetUpload",
+		trace.WithAttributes(deployment.SpanUpload.String(n)))
+	defer func() { deployment.EndSpan(span, err) }()
+	return mw.next.GetUpload(ctx, n)
+}
+
+func (mw tracingMiddleware) PostDistribution(ctx context.Context, n string, v string, u string,
+	k string, a string, c *deployment.Compatibility) (err error) {
+	ctx, span := deployment.Tracer.Start(ctx, "frontend.PostDistribution",
+		trace.WithAttributes(deployment.SpanDistribution.String(n), deployment.SpanUpload.String(u)))
+	defer func() { deployment.EndSpan(span, err) }()
+	return mw.next.PostDistribution(ctx, n, v, u, k, a, c)
+}
+
+func (mw tracingMiddleware) GetDistribution(ctx context.Context, n string) (d deployment.Distribution, err error) {
+	ctx, span := deployment.Tracer.Start(ctx, "frontend.GetDistribution",
+		trace.WithAttributes(deployment.SpanDistribution.String(n)))
+	defer func() { deployment.EndSpan(span, err) }()
+	return mw.next.GetDistribution(ctx, n)
+}
+
+func (mw tracingMiddleware) PostDeployment(ctx context.Context, t string, d string,
+	o deployment.DeploymentOptions) (err error) {
+	ctx, span := deployment.Tracer.Start(ctx, "frontend.PostDeployment",
+		trace.WithAttributes(deployment.SpanTarget.String(t), deployment.SpanDistribution.String(d)))
+	defer func() { deployment.EndSpan(span, err) }()
+	return mw.next.PostDeployment(ctx, t, d, o)
+}
+
+func (mw tracingMiddleware) GetDeployment(ctx context.Context, t string) (dp deployment.Deployment, err error) {
+	ctx, span := deployment.Tracer.Start(ctx, "frontend.GetDeployment",
+		trace.WithAttributes(deployment.SpanTarget.String(t)))
+	defer func() { deployment.EndSpan(span, err) }()
+	return mw.next.GetDeployment(ctx, t)
+}
+
+func (mw tracingMiddleware) GetTargets(ctx context.Context) (ts []deployment.Target, err error) {
+	ctx, span := deployment.Tracer.Start(ctx, "frontend.GetTargets")
+	defer func() { deployment.EndSpan(span, err) }()
+	return mw.next.GetTargets(ctx)
+}
+
+func (mw tracingMiddleware) PutAutoConfirm(ctx context.Context, t string, a deployment.AutoConfirm) (err error) {
+	ctx, span := deployment.Tracer.Start(ctx, "frontend.PutAutoConfirm",
+		trace.WithAttributes(deployment.SpanTarget.String(t)))
+	defer func() { deployment.EndSpan(span, err) }()
+	return mw.next.PutAutoConfirm(ctx, t, a)
+}
+
+func (mw tracingMiddleware) PutTags(ctx context.Context, t string, tags []string) (err error) {
+	ctx, span := deployment.Tracer.Start(ctx, "frontend.PutTags",
+		trace.WithAttributes(deployment.SpanTarget.String(t)))
+	defer func() { deployment.EndSpan(span, err) }()
+	return mw.next.PutTags(ctx, t, tags)
+}
+
+func (mw tracingMiddleware) GetAudit(ctx context.Context, q deployment.AuditQuery) (es []deployment.AuditEntry, err error) {
+	ctx, span := deployment.Tracer.Start(ctx, "frontend.GetAudit")
+	defer func() { deployment.EndSpan(span, err) }()
+	return mw.next.GetAudit(ctx, q)
+}
+
+func (mw tracingMiddleware) PostWebhook(ctx context.Context, w deployment.Webhook) (err error) {
+	ctx, span := deployment.Tracer.Start(ctx, "frontend.PostWebhook")
+	defer func() { deployment.EndSpan(span, err) }()
+	return mw.next.PostWebhook(ctx, w)
+}
+
+func (mw tracingMiddleware) GetWebhooks(ctx context.Context) (ws []deployment.Webhook, err error) {
+	ctx, span := deployment.Tracer.Start(ctx, "frontend.GetWebhooks")
+	defer func() { deployment.EndSpan(span, err) }()
+	return mw.next.GetWebhooks(ctx)
+}
+
+func (mw tracingMiddleware) DeleteWebhook(ctx context.Context, n string) (err error) {
+	ctx, span := deployment.Tracer.Start(ctx, "frontend.DeleteWebhook")
+	defer func() { deployment.EndSpan(span, err) }()
+	return mw.next.DeleteWebhook(ctx, n)
+}
+
+func (mw tracingMiddleware) GetWebhookDeliveries(ctx context.Context, n string) (ds []deployment.Delivery, err error) {
+	ctx, span := deployment.Tracer.Start(ctx, "frontend.GetWebhookDeliveries")
+	defer func() { deployment.EndSpan(span, err) }()
+	return mw.next.GetWebhookDeliveries(ctx, n)
+}
+
+func (mw tracingMiddleware) GetEvents(ctx context.Context, f deployment.EventFilter) (es <-chan deployment.Event, err error) {
+	ctx, span := deployment.Tracer.Start(ctx, "frontend.GetEvents",
+		trace.WithAttributes(deployment.SpanTarget.String(f.Target)))
+	defer func() { deployment.EndSpan(span, err) }()
+	return mw.next.GetEvents(ctx, f)
+}
+
+func (mw tracingMiddleware) PutRollout(ctx context.Context, r deployment.Rollout) (err error) {
+	ctx, span := deployment.Tracer.Start(ctx, "frontend.PutRollout",
+		trace.WithAttributes(deployment.SpanDistribution.String(r.Distribution)))
+	defer func() { deployment.EndSpan(span, err) }()
+	return mw.next.PutRollout(ctx, r)
+}
+
+func (mw tracingMiddleware) GetRollouts(ctx context.Context) (rs []deployment.Rollout, err error) {
+	ctx, span := deployment.Tracer.Start(ctx, "frontend.GetRollouts")
+	defer func() { deployment.EndSpan(span, err) }()
+	return mw.next.GetRollouts(ctx)
+}
+
+// AuditFrontendMiddleware records every mutating call in the audit trail.
+// The store records the affected entity as it was before and after the
+// change; failed calls are recorded here.
+func AuditFrontendMiddleware() Middleware {
+	return func(next FrontendService) FrontendService {
+		return &auditMiddleware{next: next}
+	}
+}
+
+type auditMiddleware struct {
+	next FrontendService
+}
+
+func (mw auditMiddleware) PostUpload(ctx context.Context, n string, v string, f string,
+	s *deployment.SignParams, c []string) (err error) {
+	ctx = deployment.WithAudit(ctx, "PostUpload")
+	defer func() { deployment.EndAudit(ctx, "upload/"+n, err) }()
+	return mw.next.PostUpload(ctx, n, v, f, s, c)
+}
+
+func (mw auditMiddleware) PostUploadImage(ctx context.Context, n string, v string, img []byte,
+	s *deployment.SignParams, c []string) (err error) {
+	ctx = deployment.WithAudit(ctx, "PostUploadImage")
+	defer func() { deployment.EndAudit(ctx, "upload/"+n, err) }()
+	return mw.next.PostUploadImage(ctx, n, v, img, s, c)
+}
+
+func (mw auditMiddleware) GetUpload(ctx context.Context, n string) (deployment.Upload, error) {
+	return mw.next.GetUpload(ctx, n)
+}
+
+func (mw auditMiddleware) PostDistribution(ctx context.Context, n string, v string, u string,
+	k string, a string, c *deployment.Compatibility) (err error) {
+	ctx = deployment.WithAudit(ctx, "PostDistribution")
+	defer func() { deployment.EndAudit(ctx, "distribution/"+n, err) }()
+	return mw.next.PostDistribution(ctx, n, v, u, k, a, c)
+}
+
+func (mw auditMiddleware) GetDistribution(ctx context.Context, n string) (deployment.Distribution, error) {
+	return mw.next.GetDistribution(ctx, n)
+}
+
+func (mw auditMiddleware) PostDeployment(ctx context.Context, t string, d string,
+	o deployment.DeploymentOptions) (err error) {
+	ctx = deployment.WithAudit(ctx, "PostDeployment")
+	defer func() { deployment.EndAudit(ctx, "deployment/"+t, err) }()
+	return mw.next.PostDeployment(ctx, t, d, o)
+}
+
+func (mw auditMiddleware) GetDeployment(ctx context.Context, t string) (deployment.Deployment, error) {
+	return mw.next.GetDeployment(ctx, t)
+}
+
+func (mw auditMiddleware) GetTargets(ctx context.Context) ([]deployment.Target, error) {
+	return mw.next.GetTargets(ctx)
+}
+
+func (mw auditMiddleware) PutAutoConfirm(ctx context.Context, t string, a deployment.AutoConfirm) (err error) {
+	ctx = deployment.WithAudit(ctx, "PutAutoConfirm")
+	defer func() { deployment.EndAudit(ctx, "autoconfirm/"+t, err) }()
+	return mw.next.PutAutoConfirm(ctx, t, a)
+}
+
+func (mw auditMiddleware) PutTags(ctx context.Context, t string, tags []string) (err error) {
+	ctx = deployment.WithAudit(ctx, "PutTags")
+	defer func() { deployment.EndAudit(ctx, "tags/"+t, err) }()
+	return mw.next.PutTags(ctx, t, tags)
+}
+
+func (mw auditMiddleware) GetAudit(ctx context.Context, q deployment.AuditQuery) ([]deployment.AuditEntry, error) {
+	return mw.next.GetAudit(ctx, q)
+}
+
+func (mw auditMiddleware) PostWebhook(ctx context.Context, w deployment.Webhook) (err error) {
+	ctx = deployment.WithAudit(ctx, "PostWebhook")
+	defer func() { deployment.EndAudit(ctx, "webhook/"+w.Name, err) }()
+	return mw.next.PostWebhook(ctx, w)
+}
+
+func (mw auditMiddleware) GetWebhooks(ctx context.Context) ([]deployment.Webhook, error) {
+	return mw.next.GetWebhooks(ctx)
+}
+
+func (mw auditMiddleware) DeleteWebhook(ctx context.Context, n string) (err error) {
+	ctx = deployment.WithAudit(ctx, "DeleteWebhook")
+	defer func() { deployment.EndAudit(ctx, "webhook/"+n, err) }()
+	return mw.next.DeleteWebhook(ctx, n)
+}
+
+func (mw auditMiddleware) GetWebhookDeliveries(ctx context.Context, n string) ([]deployment.Delivery, error) {
+	return mw.next.GetWebhookDeliveries(ctx, n)
+}
+
+func (mw auditMiddleware) GetEvents(ctx context.Context, f deployment.EventFilter) (<-chan deployment.Event, error) {
+	return mw.next.GetEvents(ctx, f)
+}
+
+func (mw auditMiddleware) PutRollout(ctx context.Context, r deployment.Rollout) (err error) {
+	ctx = deployment.WithAudit(ctx, "PutRollout")
+	defer func() { deployment.EndAudit(ctx, "rollout/"+r.Name, err) }()
+	return mw.next.PutRollout(ctx, r)
+}
+
+func (mw auditMiddleware) GetRollouts(ctx context.Context) ([]deployment.Rollout, error) {
+	return mw.next.GetRollouts(ctx)
+}
@@ -0,0 +1,880 @@
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+// versions:
+// - protoc-gen-go-grpc v1.3.0
+// - protoc             v3.21.12
+// source: frontend.proto
+
+package pb
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.32.0 or later.
+const _ = grpc.SupportPackageIsVersion7
+
+const (
+	Frontend_PostUpload_FullMethodName           = "/hawkbit.frontend.Frontend/PostUpload"
+	Frontend_UploadImage_FullMethodName          = "/hawkbit.frontend.Frontend/UploadImage"
+	Frontend_GetUpload_FullMethodName            = "/hawkbit.frontend.Frontend/GetUpload"
+	Frontend_PostDistribution_FullMethodName     = "/hawkbit.frontend.Frontend/PostDistribution"
+	Frontend_GetDistribution_FullMethodName      = "/hawkbit.frontend.Frontend/GetDistribution"
+	Frontend_PostDeployment_FullMethodName       = "/hawkbit.frontend.Frontend/PostDeployment"
+	Frontend_GetDeployment_FullMethodName        = "/hawkbit.frontend.Frontend/GetDeployment"
+	Frontend_WatchDeployment_FullMethodName      = "/hawkbit.frontend.Frontend/WatchDeployment"
+	Frontend_GetTargets_FullMethodName           = "/hawkbit.frontend.Frontend/GetTargets"
+	Frontend_PutAutoConfirm_FullMethodName       = "/hawkbit.frontend.Frontend/PutAutoConfirm"
+	Frontend_PutTags_FullMethodName              = "/hawkbit.frontend.Frontend/PutTags"
+	Frontend_GetAudit_FullMethodName             = "/hawkbit.frontend.Frontend/GetAudit"
+	Frontend_PostWebhook_FullMethodName          = "/hawkbit.frontend.Frontend/PostWebhook"
+	Frontend_GetWebhooks_FullMethodName          = "/hawkbit.frontend.Frontend/GetWebhooks"
+	Frontend_DeleteWebhook_FullMethodName        = "/hawkbit.frontend.Frontend/DeleteWebhook"
+	Frontend_GetWebhookDeliveries_FullMethodName = "/hawkbit.frontend.Frontend/GetWebhookDeliveries"
+	Frontend_GetEvents_FullMethodName            = "/hawkbit.frontend.Frontend/GetEvents"
+	Frontend_PutRollout_FullMethodName           = "/hawkbit.frontend.Frontend/PutRollout"
+	Frontend_GetRollouts_FullMethodName          = "/hawkbit.frontend.Frontend/GetRollouts"
+)
+
+// FrontendClient is the client API for Frontend service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+type FrontendClient interface {
+	PostUpload(ctx context.Context, in *PostUploadRequest, opts ...grpc.CallOption) (*PostUploadResponse, error)
+	// UploadImage streams the image bytes instead of naming a file to fetch.
+	// The first message carries the header, the following ones the chunks.
+	UploadImage(ctx context.Context, opts ...grpc.CallOption) (Frontend_UploadImageClient, error)
+	GetUpload(ctx context.Context, in *GetUploadRequest, opts ...grpc.CallOption) (*Upload, error)
+	PostDistribution(ctx context.Context, in *PostDistributionRequest, opts ...grpc.CallOption) (*PostDistributionResponse, error)
+	GetDistribution(ctx context.Context, in *GetDistributionRequest, opts ...grpc.CallOption) (*Distribution, error)
+	PostDeployment(ctx context.Context, in *PostDeploymentRequest, opts ...grpc.CallOption) (*PostDeploymentResponse, error)
+	GetDeployment(ctx context.Context, in *GetDeploymentRequest, opts ...grpc.CallOption) (*Deployment, error)
+	// WatchDeployment sends the deployment of a target, then again each time
+	// it is assigned or its status changes, and whenever the stream fell
+	// behind and may have missed such a change.
+	WatchDeployment(ctx context.Context, in *GetDeploymentRequest, opts ...grpc.CallOption) (Frontend_WatchDeploymentClient, error)
+	GetTargets(ctx context.Context, in *GetTargetsRequest, opts ...grpc.CallOption) (*GetTargetsResponse, error)
+	PutAutoConfirm(ctx context.Context, in *PutAutoConfirmRequest, opts ...grpc.CallOption) (*PutAutoConfirmResponse, error)
+	// PutTags replaces the tags of a target.
+	PutTags(ctx context.Context, in *PutTagsRequest, opts ...grpc.CallOption) (*PutTagsResponse, error)
+	GetAudit(ctx context.Context, in *GetAuditRequest, opts ...grpc.CallOption) (*GetAuditResponse, error)
+	PostWebhook(ctx context.Context, in *Webhook, opts ...grpc.CallOption) (*PostWebhookResponse, error)
+	GetWebhooks(ctx context.Context, in *GetWebhooksRequest, opts ...grpc.CallOption) (*GetWebhooksResponse, error)
+	DeleteWebhook(ctx context.Context, in *DeleteWebhookRequest, opts ...grpc.CallOption) (*DeleteWebhookResponse, error)
+	GetWebhookDeliveries(ctx context.Context, in *GetWebhookDeliveriesRequest, opts ...grpc.CallOption) (*GetWebhookDeliveriesResponse, error)
+	GetEvents(ctx context.Context, in *GetEventsRequest, opts ...grpc.CallOption) (Frontend_GetEventsClient, error)
+	// PutRollout records the state of a rollout as reported by the client
+	// running it.
+	PutRollout(ctx context.Context, in *Rollout, opts ...grpc.CallOption) (*PutRolloutResponse, error)
+	GetRollouts(ctx context.Context, in *GetRolloutsRequest, opts ...grpc.CallOption) (*GetRolloutsResponse, error)
+}
+
+type frontendClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewFrontendClient(cc grpc.ClientConnInterface) FrontendClient {
+	return &frontendClient{cc}
+}
+
+func (c *frontendClient) PostUpload(ctx context.Context, in *PostUploadRequest, opts ...grpc.CallOption) (*PostUploadResponse, error) {
+	out := new(PostUploadResponse)
+	err := c.cc.Invoke(ctx, Frontend_PostUpload_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *frontendClient) UploadImage(ctx context.Context, opts ...grpc.CallOption) (Frontend_UploadImageClient, error) {
+	stream, err := c.cc.NewStream(ctx, &Frontend_ServiceDesc.Streams[0], Frontend_UploadImage_FullMethodName, opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &frontendUploadImageClient{stream}
+	return x, nil
+}
+
+type Frontend_UploadImageClient interface {
+	Send(*UploadImageRequest) error
+	CloseAndRecv() (*PostUploadResponse, error)
+	grpc.ClientStream
+}
+
+type frontendUploadImageClient struct {
+	grpc.ClientStream
+}
+
+func (x *frontendUploadImageClient) Send(m *UploadImageRequest) error {
+	return x.ClientStream.SendMsg(m)
+}
+
+func (x *frontendUploadImageClient) CloseAndRecv() (*PostUploadResponse, error) {
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	m := new(PostUploadResponse)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func (c *frontendClient) GetUpload(ctx context.Context, in *GetUploadRequest, opts ...grpc.CallOption) (*Upload, error) {
+	out := new(Upload)
+	err := c.cc.Invoke(ctx, Frontend_GetUpload_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *frontendClient) PostDistribution(ctx context.Context, in *PostDistributionRequest, opts ...grpc.CallOption) (*PostDistributionResponse, error) {
+	out := new(PostDistributionResponse)
+	err := c.cc.Invoke(ctx, Frontend_PostDistribution_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *frontendClient) GetDistribution(ctx context.Context, in *GetDistributionRequest, opts ...grpc.CallOption) (*Distribution, error) {
+	out := new(Distribution)
+	err := c.cc.Invoke(ctx, Frontend_GetDistribution_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *frontendClient) PostDeployment(ctx context.Context, in *PostDeploymentRequest, opts ...grpc.CallOption) (*PostDeploymentResponse, error) {
+	out := new(PostDeploymentResponse)
+	err := c.cc.Invoke(ctx, Frontend_PostDeployment_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *frontendClient) GetDeployment(ctx context.Context, in *GetDeploymentRequest, opts ...grpc.CallOption) (*Deployment, error) {
+	out := new(Deployment)
+	err := c.cc.Invoke(ctx, Frontend_GetDeployment_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *frontendClient) WatchDeployment(ctx context.Context, in *GetDeploymentRequest, opts ...grpc.CallOption) (Frontend_WatchDeploymentClient, error) {
+	stream, err := c.cc.NewStream(ctx, &Frontend_ServiceDesc.Streams[1], Frontend_WatchDeployment_FullMethodName, opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &frontendWatchDeploymentClient{stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+type Frontend_WatchDeploymentClient interface {
+	Recv() (*Deployment, error)
+	grpc.ClientStream
+}
+
+type frontendWatchDeploymentClient struct {
+	grpc.ClientStream
+}
+
+func (x *frontendWatchDeploymentClient) Recv() (*Deployment, error) {
+	m := new(Deployment)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func (c *frontendClient) GetTargets(ctx context.Context, in *GetTargetsRequest, opts ...grpc.CallOption) (*GetTargetsResponse, error) {
+	out := new(GetTargetsResponse)
+	err := c.cc.Invoke(ctx, Frontend_GetTargets_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *frontendClient) PutAutoConfirm(ctx context.Context, in *PutAutoConfirmRequest, opts ...grpc.CallOption) (*PutAutoConfirmResponse, error) {
+	out := new(PutAutoConfirmResponse)
+	err := c.cc.Invoke(ctx, Frontend_PutAutoConfirm_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *frontendClient) PutTags(ctx context.Context, in *PutTagsRequest, opts ...grpc.CallOption) (*PutTagsResponse, error) {
+	out := new(PutTagsResponse)
+	err := c.cc.Invoke(ctx, Frontend_PutTags_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *frontendClient) GetAudit(ctx context.Context, in *GetAuditRequest, opts ...grpc.CallOption) (*GetAuditResponse, error) {
+	out := new(GetAuditResponse)
+	err := c.cc.Invoke(ctx, Frontend_GetAudit_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *frontendClient) PostWebhook(ctx context.Context, in *Webhook, opts ...grpc.CallOption) (*PostWebhookResponse, error) {
+	out := new(PostWebhookResponse)
+	err := c.cc.Invoke(ctx, Frontend_PostWebhook_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *frontendClient) GetWebhooks(ctx context.Context, in *GetWebhooksRequest, opts ...grpc.CallOption) (*GetWebhooksResponse, error) {
+	out := new(GetWebhooksResponse)
+	err := c.cc.Invoke(ctx, Frontend_GetWebhooks_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *frontendClient) DeleteWebhook(ctx context.Context, in *DeleteWebhookRequest, opts ...grpc.CallOption) (*DeleteWebhookResponse, error) {
+	out := new(DeleteWebhookResponse)
+	err := c.cc.Invoke(ctx, Frontend_DeleteWebhook_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *frontendClient) GetWebhookDeliveries(ctx context.Context, in *GetWebhookDeliveriesRequest, opts ...grpc.CallOption) (*GetWebhookDeliveriesResponse, error) {
+	out := new(GetWebhookDeliveriesResponse)
+	err := c.cc.Invoke(ctx, Frontend_GetWebhookDeliveries_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *frontendClient) GetEvents(ctx context.Context, in *GetEventsRequest, opts ...grpc.CallOption) (Frontend_GetEventsClient, error) {
+	stream, err := c.cc.NewStream(ctx, &Frontend_ServiceDesc.Streams[2], Frontend_GetEvents_FullMethodName, opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &frontendGetEventsClient{stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+type Frontend_GetEventsClient interface {
+	Recv() (*Event, error)
+	grpc.ClientStream
+}
+
+type frontendGetEventsClient struct {
+	grpc.ClientStream
+}
+
+func (x *frontendGetEventsClient) Recv() (*Event, error) {
+	m := new(Event)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func (c *frontendClient) PutRollout(ctx context.Context, in *Rollout, opts ...grpc.CallOption) (*PutRolloutResponse, error) {
+	out := new(PutRolloutResponse)
+	err := c.cc.Invoke(ctx, Frontend_PutRollout_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *frontendClient) GetRollouts(ctx context.Context, in *GetRolloutsRequest, opts ...grpc.CallOption) (*GetRolloutsResponse, error) {
+	out := new(GetRolloutsResponse)
+	err := c.cc.Invoke(ctx, Frontend_GetRollouts_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// FrontendServer is the server API for Frontend service.
+// All implementations must embed UnimplementedFrontendServer
+// for forward compatibility
+type FrontendServer interface {
+	PostUpload(context.Context, *PostUploadRequest) (*PostUploadResponse, error)
+	// UploadImage streams the image bytes instead of naming a file to fetch.
+	// The first message carries the header, the following ones the chunks.
+	UploadImage(Frontend_UploadImageServer) error
+	GetUpload(context.Context, *GetUploadRequest) (*Upload, error)
+	PostDistribution(context.Context, *PostDistributionRequest) (*PostDistributionResponse, error)
+	GetDistribution(context.Context, *GetDistributionRequest) (*Distribution, error)
+	PostDeployment(context.Context, *PostDeploymentRequest) (*PostDeploymentResponse, error)
+	GetDeployment(context.Context, *GetDeploymentRequest) (*Deployment, error)
+	// WatchDeployment sends the deployment of a target, then again each time
+	// it is assigned or its status changes, and whenever the stream fell
+	// behind and may have missed such a change.
+	WatchDeployment(*GetDeploymentRequest, Frontend_WatchDeploymentServer) error
+	GetTargets(context.Context, *GetTargetsRequest) (*GetTargetsResponse, error)
+	PutAutoConfirm(context.Context, *PutAutoConfirmRequest) (*PutAutoConfirmResponse, error)
+	// PutTags replaces the tags of a target.
+	PutTags(context.Context, *PutTagsRequest) (*PutTagsResponse, error)
+	GetAudit(context.Context, *GetAuditRequest) (*GetAuditResponse, error)
+	PostWebhook(context.Context, *Webhook) (*PostWebhookResponse, error)
+	GetWebhooks(context.Context, *GetWebhooksRequest) (*GetWebhooksResponse, error)
+	DeleteWebhook(context.Context, *DeleteWebhookRequest) (*DeleteWebhookResponse, error)
+	GetWebhookDeliveries(context.Context, *GetWebhookDeliveriesRequest) (*GetWebhookDeliveriesResponse, error)
+	GetEvents(*GetEventsRequest, Frontend_GetEventsServer) error
+	// PutRollout records the state of a rollout as reported by the client
+	// running it.
+	PutRollout(context.Context, *Rollout) (*PutRolloutResponse, error)
+	GetRollouts(context.Context, *GetRolloutsRequest) (*GetRolloutsResponse, error)
+	mustEmbedUnimplementedFrontendServer()
+}
+
+// UnimplementedFrontendServer must be embedded to have forward compatible implementations.
+type UnimplementedFrontendServer struct {
+}
+
+func (UnimplementedFrontendServer) PostUpload(context.Context, *PostUploadRequest) (*PostUploadResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method PostUpload not implemented")
+}
+func (UnimplementedFrontendServer) UploadImage(Frontend_UploadImageServer) error {
+	return status.Errorf(codes.Unimplemented, "method UploadImage not implemented")
+}
+func (UnimplementedFrontendServer) GetUpload(context.Context, *GetUploadRequest) (*Upload, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetUpload not implemented")
+}
+func (UnimplementedFrontendServer) PostDistribution(context.Context, *PostDistributionRequest) (*PostDistributionResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method PostDistribution not implemented")
+}
+func (UnimplementedFrontendServer) GetDistribution(context.Context, *GetDistributionRequest) (*Distribution, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetDistribution not implemented")
+}
+func (UnimplementedFrontendServer) PostDeployment(context.Context, *PostDeploymentRequest) (*PostDeploymentResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method PostDeployment not implemented")
+}
+func (UnimplementedFrontendServer) GetDeployment(context.Context, *GetDeploymentRequest) (*Deployment, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetDeployment not implemented")
+}
+func (UnimplementedFrontendServer) WatchDeployment(*GetDeploymentRequest, Frontend_WatchDeploymentServer) error {
+	return status.Errorf(codes.Unimplemented, "method WatchDeployment not implemented")
+}
+func (UnimplementedFrontendServer) GetTargets(context.Context, *GetTargetsRequest) (*GetTargetsResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetTargets not implemented")
+}
+func (UnimplementedFrontendServer) PutAutoConfirm(context.Context, *PutAutoConfirmRequest) (*PutAutoConfirmResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method PutAutoConfirm not implemented")
+}
+func (UnimplementedFrontendServer) PutTags(context.Context, *PutTagsRequest) (*PutTagsResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method PutTags not implemented")
+}
+func (UnimplementedFrontendServer) GetAudit(context.Context, *GetAuditRequest) (*GetAuditResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetAudit not implemented")
+}
+func (UnimplementedFrontendServer) PostWebhook(context.Context, *Webhook) (*PostWebhookResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method PostWebhook not implemented")
+}
+func (UnimplementedFrontendServer) GetWebhooks(context.Context, *GetWebhooksRequest) (*GetWebhooksResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetWebhooks not implemented")
+}
+func (UnimplementedFrontendServer) DeleteWebhook(context.Context, *DeleteWebhookRequest) (*DeleteWebhookResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method DeleteWebhook not implemented")
+}
+func (UnimplementedFrontendServer) GetWebhookDeliveries(context.Context, *GetWebhookDeliveriesRequest) (*GetWebhookDeliveriesResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetWebhookDeliveries not implemented")
+}
+func (UnimplementedFrontendServer) GetEvents(*GetEventsRequest, Frontend_GetEventsServer) error {
+	return status.Errorf(codes.Unimplemented, "method GetEvents not implemented")
+}
+func (UnimplementedFrontendServer) PutRollout(context.Context, *Rollout) (*PutRolloutResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method PutRollout not implemented")
+}
+func (UnimplementedFrontendServer) GetRollouts(context.Context, *GetRolloutsRequest) (*GetRolloutsResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetRollouts not implemented")
+}
+func (UnimplementedFrontendServer) mustEmbedUnimplementedFrontendServer() {}
+
+// UnsafeFrontendServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to FrontendServer will
+// result in compilation errors.
+type UnsafeFrontendServer interface {
+	mustEmbedUnimplementedFrontendServer()
+}
+
+func RegisterFrontendServer(s grpc.ServiceRegistrar, srv FrontendServer) {
+	s.RegisterService(&Frontend_ServiceDesc, srv)
+}
+
+func _Frontend_PostUpload_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(PostUploadRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(FrontendServer).PostUpload(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Frontend_PostUpload_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(FrontendServer).PostUpload(ctx, req.(*PostUploadRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Frontend_UploadImage_Handler(srv interface{}, stream grpc.ServerStream) error {
+	return srv.(FrontendServer).UploadImage(&frontendUploadImageServer{stream})
+}
+
+type Frontend_UploadImageServer interface {
+	SendAndClose(*PostUploadResponse) error
+	Recv() (*UploadImageRequest, error)
+	grpc.ServerStream
+}
+
+type frontendUploadImageServer struct {
+	grpc.ServerStream
+}
+
+func (x *frontendUploadImageServer) SendAndClose(m *PostUploadResponse) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+func (x *frontendUploadImageServer) Recv() (*UploadImageRequest, error) {
+	m := new(UploadImageRequest)
+	if err := x.ServerStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func _Frontend_GetUpload_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetUploadRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(FrontendServer).GetUpload(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Frontend_GetUpload_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(FrontendServer).GetUpload(ctx, req.(*GetUploadRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Frontend_PostDistribution_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(PostDistributionRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(FrontendServer).PostDistribution(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Frontend_PostDistribution_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(FrontendServer).PostDistribution(ctx, req.(*PostDistributionRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Frontend_GetDistribution_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetDistributionRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(FrontendServer).GetDistribution(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Frontend_GetDistribution_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(FrontendServer).GetDistribution(ctx, req.(*GetDistributionRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Frontend_PostDeployment_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(PostDeploymentRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(FrontendServer).PostDeployment(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Frontend_PostDeployment_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(FrontendServer).PostDeployment(ctx, req.(*PostDeploymentRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Frontend_GetDeployment_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetDeploymentRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(FrontendServer).GetDeployment(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Frontend_GetDeployment_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(FrontendServer).GetDeployment(ctx, req.(*GetDeploymentRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Frontend_WatchDeployment_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(GetDeploymentRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(FrontendServer).WatchDeployment(m, &frontendWatchDeploymentServer{stream})
+}
+
+type Frontend_WatchDeploymentServer interface {
+	Send(*Deployment) error
+	grpc.ServerStream
+}
+
+type frontendWatchDeploymentServer struct {
+	grpc.ServerStream
+}
+
+func (x *frontendWatchDeploymentServer) Send(m *Deployment) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+func _Frontend_GetTargets_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetTargetsRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(FrontendServer).GetTargets(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Frontend_GetTargets_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(FrontendServer).GetTargets(ctx, req.(*GetTargetsRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Frontend_PutAutoConfirm_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(PutAutoConfirmRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(FrontendServer).PutAutoConfirm(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Frontend_PutAutoConfirm_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(FrontendServer).PutAutoConfirm(ctx, req.(*PutAutoConfirmRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Frontend_PutTags_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(PutTagsRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(FrontendServer).PutTags(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Frontend_PutTags_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(FrontendServer).PutTags(ctx, req.(*PutTagsRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Frontend_GetAudit_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetAuditRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(FrontendServer).GetAudit(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Frontend_GetAudit_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(FrontendServer).GetAudit(ctx, req.(*GetAuditRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Frontend_PostWebhook_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(Webhook)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(FrontendServer).PostWebhook(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Frontend_PostWebhook_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(FrontendServer).PostWebhook(ctx, req.(*Webhook))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Frontend_GetWebhooks_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetWebhooksRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(FrontendServer).GetWebhooks(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Frontend_GetWebhooks_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(FrontendServer).GetWebhooks(ctx, req.(*GetWebhooksRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Frontend_DeleteWebhook_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(DeleteWebhookRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(FrontendServer).DeleteWebhook(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Frontend_DeleteWebhook_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(FrontendServer).DeleteWebhook(ctx, req.(*DeleteWebhookRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Frontend_GetWebhookDeliveries_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetWebhookDeliveriesRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(FrontendServer).GetWebhookDeliveries(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Frontend_GetWebhookDeliveries_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(FrontendServer).GetWebhookDeliveries(ctx, req.(*GetWebhookDeliveriesRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Frontend_GetEvents_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(GetEventsRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(FrontendServer).GetEvents(m, &frontendGetEventsServer{stream})
+}
+
+type Frontend_GetEventsServer interface {
+	Send(*Event) error
+	grpc.ServerStream
+}
+
+type frontendGetEventsServer struct {
+	grpc.ServerStream
+}
+
+func (x *frontendGetEventsServer) Send(m *Event) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+func _Frontend_PutRollout_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(Rollout)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(FrontendServer).PutRollout(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Frontend_PutRollout_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(FrontendServer).PutRollout(ctx, req.(*Rollout))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Frontend_GetRollouts_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetRolloutsRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(FrontendServer).GetRollouts(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Frontend_GetRollouts_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(FrontendServer).GetRollouts(ctx, req.(*GetRolloutsRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+// Frontend_ServiceDesc is the grpc.ServiceDesc for Frontend service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var Frontend_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "hawkbit.frontend.Frontend",
+	HandlerType: (*FrontendServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "PostUpload",
+			Handler:    _Frontend_PostUpload_Handler,
+		},
+		{
+			MethodName: "GetUpload",
+			Handler:    _Frontend_GetUpload_Handler,
+		},
+		{
+			MethodName: "PostDistribution",
+			Handler:    _Frontend_PostDistribution_Handler,
+		},
+		{
+			MethodName: "GetDistribution",
+			Handler:    _Frontend_GetDistribution_Handler,
+		},
+		{
+			MethodName: "PostDeployment",
+			Handler:    _Frontend_PostDeployment_Handler,
+		},
+		{
+			MethodName: "GetDeployment",
+			Handler:    _Frontend_GetDeployment_Handler,
+		},
+		{
+			MethodName: "GetTargets",
+			Handler:    _Frontend_GetTargets_Handler,
+		},
+		{
+			MethodName: "PutAutoConfirm",
+			Handler:    _Frontend_PutAutoConfirm_Handler,
+		},
+		{
+			MethodName: "PutTags",
+			Handler:    _Frontend_PutTags_Handler,
+		},
+		{
+			MethodName: "GetAudit",
+			Handler:    _Frontend_GetAudit_Handler,
+		},
+		{
+			MethodName: "PostWebhook",
+			Handler:    _Frontend_PostWebhook_Handler,
+		},
+		{
+			MethodName: "GetWebhooks",
+			Handler:    _Frontend_GetWebhooks_Handler,
+		},
+		{
+			MethodName: "DeleteWebhook",
+			Handler:    _Frontend_DeleteWebhook_Handler,
+		},
+		{
+			MethodName: "GetWebhookDeliveries",
+			Handler:    _Frontend_GetWebhookDeliveries_Handler,
+		},
+		{
+			MethodName: "PutRollout",
+			Handler:    _Frontend_PutRollout_Handler,
+		},
+		{
+			MethodName: "GetRollouts",
+			Handler:    _Frontend_GetRollouts_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "UploadImage",
+			Handler:       _Frontend_UploadImage_Handler,
+			ClientStreams: true,
+		},
+		{
+			StreamName:    "WatchDeployment",
+			Handler:       _Frontend_WatchDeployment_Handler,
+			ServerStreams: true,
+		},
+		{
+			StreamName:    "GetEvents",
+			Handler:       _Frontend_GetEvents_Handler,
+			ServerStreams: true,
+		},
+	},
+	Metadata: "frontend.proto",
+}
@@ -15,14 +15,29 @@ var (
 )
 
 type FrontendService interface {
-	PostUpload(ctx context.Context, n string, v string, f string) error
+	PostUpload(ctx context.Context, n string, v string, f string, s *deployment.SignParams,
+		c []string) error
+	PostUploadImage(ctx context.Context, n string, v string, img []byte, s *deployment.SignParams,
+		c []string) error
 	GetUpload(ctx context.Context, n string) (deployment.Upload, error)
 	// DeleteUpload(ctx context.Context, n string) error
-	PostDistribution(ctx context.Context, n string, v string, u string) error
+	PostDistribution(ctx context.Context, n string, v string, u string, k string, a string,
+		c *deployment.Compatibility) error
 	GetDistribution(ctx context.Context, n string) (deployment.Distribution, error)
 	// DeleteDistribution(ctx context.Context, n string) error
-	PostDeployment(ctx context.Context, t string, d string) error
+	PostDeployment(ctx context.Context, t string, d string, o deployment.DeploymentOptions) error
 	GetDeployment(ctx context.Context, t string) (deployment.Deployment, error)
+	GetTargets(ctx context.Context) ([]deployment.Target, error)
+	GetAudit(ctx context.Context, q deployment.AuditQuery) ([]deployment.AuditEntry, error)
+	PostWebhook(ctx context.Context, w deployment.Webhook) error
+	GetWebhooks(ctx context.Context) ([]deployment.Webhook, error)
+	DeleteWebhook(ctx context.Context, n string) error
+	GetWebhookDeliveries(ctx context.Context, n string) ([]deployment.Delivery, error)
+	GetEvents(ctx context.Context, f deployment.EventFilter) (<-chan deployment.Event, error)
+	PutRollout(ctx context.Context, r deployment.Rollout) error
+	GetRollouts(ctx context.Context) ([]deployment.Rollout, error)
+	PutAutoConfirm(ctx context.Context, t string, a deployment.AutoConfirm) error
+	PutTags(ctx context.Context, t string, tags []string) error
 }
 
 type hawkbitFrontendService struct{}
@@ -35,22 +50,49 @@ func NewHawkbitFrontendService() FrontendService {
 //
 //	@Summary	Upload new image
 //	@Schemes
-//	@Description	Upload new image profile which is to be added to a distribution
+//	@Description	Upload new image profile which is to be added to a distribution, optionally signing a raw build and storing compressed variants
 //	@Tags			Hawkbit FOTA
 //	@Param			array	body	frontend.postUploadRequest	false	"New image profile"
 //	@Accept			json
 //	@Produce		json
 //	@Success		200
 //	@Failure		400
+//	@Failure		413
 //	@Failure		500
+//	@Failure		502
 //	@Router			/hawkbit/upload [post]
-func (h *hawkbitFrontendService) PostUpload(ctx context.Context, n string, v string, f string) error {
+func (h *hawkbitFrontendService) PostUpload(ctx context.Context, n string, v string, f string,
+	s *deployment.SignParams, c []string) error {
 	var u deployment.Upload
 	u.Name = n
 	u.Version = v
 	u.Url = f
-	if err := deployment.SetUpload(u); err != nil {
-		return ErrFrontendUpload
+	u.Sign = s
+	u.Compress = c
+	if err := deployment.SetUploadContext(ctx, u); err != nil {
+		if err == deployment.ErrDeploymentUpload {
+			return ErrFrontendUpload
+		}
+		return err
+	}
+	return nil
+}
+
+// PostUploadImage adds an upload like PostUpload, with the image bytes
+// given by the caller instead of fetched from a URL. It backs the streaming
+// upload of the gRPC transport.
+func (h *hawkbitFrontendService) PostUploadImage(ctx context.Context, n string, v string, img []byte,
+	s *deployment.SignParams, c []string) error {
+	var u deployment.Upload
+	u.Name = n
+	u.Version = v
+	u.Sign = s
+	u.Compress = c
+	if err := deployment.SetUploadImage(ctx, u, img); err != nil {
+		if err == deployment.ErrDeploymentUpload {
+			return ErrFrontendUpload
+		}
+		return err
 	}
 	return nil
 }
@@ -90,11 +132,18 @@ func (h *hawkbitFrontendService) GetUpload(ctx context.Context, n string) (deplo
 //	@Failure		400
 //	@Failure		500
 //	@Router			/hawkbit/dist [post]
-func (h *hawkbitFrontendService) PostDistribution(ctx context.Context, n string, v string, u string) error {
+func (h *hawkbitFrontendService) PostDistribution(ctx context.Context, n string, v string, u string,
+	k string, a string, c *deployment.Compatibility) error {
 	var d deployment.Distribution
 	d.Name = n
 	d.Version = v
-	if err := deployment.SetDistribution(d, u); err != nil {
+	d.Key = k
+	d.Variant = a
+	d.Compatible = c
+	if err := deployment.SetDistributionContext(ctx, d, u); err != nil {
+		if err == deployment.ErrDeploymentDistKey {
+			return err
+		}
 		return ErrFrontendDistribution
 	}
 	return nil
@@ -133,13 +182,18 @@ func (h *hawkbitFrontendService) GetDistribution(ctx context.Context, n string)
 //	@Produce		json
 //	@Success		200
 //	@Failure		400
+//	@Failure		409
 //	@Failure		500
 //	@Router			/hawkbit/deploy [post]
-func (h *hawkbitFrontendService) PostDeployment(ctx context.Context, t string, d string) error {
+func (h *hawkbitFrontendService) PostDeployment(ctx context.Context, t string, d string,
+	o deployment.DeploymentOptions) error {
 	if t == "" {
 		return ErrFrontendBadRequest
 	}
-	if err := deployment.SetDeployment(t, d); err != nil {
+	if err := deployment.SetDeploymentContext(ctx, t, d, o); err != nil {
+		if err == deployment.ErrDeploymentIncompatible {
+			return err
+		}
 		return ErrFrontendDeployment
 	}
 	return nil
@@ -160,9 +214,313 @@ func (h *hawkbitFrontendService) PostDeployment(ctx context.Context, t string, d
 //	@Failure		500
 //	@Router			/hawkbit/deploy/{name} [get]
 func (h *hawkbitFrontendService) GetDeployment(ctx context.Context, t string) (deployment.Deployment, error) {
-	dp, err := deployment.GetDeployment(t)
+	dp, err := deployment.GetDeploymentContext(ctx, t)
 	if err != nil {
 		return deployment.Deployment{}, err
 	}
 	return dp, nil
 }
+
+// GetTargets godoc
+//
+//	@Summary	List targets
+//	@Schemes
+//	@Description	List known targets with their assigned and installed distributions
+//	@Tags			Hawkbit FOTA
+//	@Accept			json
+//	@Produce		json
+//	@Success		200	{array}	deployment.Target
+//	@Failure		500
+//	@Router			/hawkbit/targets [get]
+func (h *hawkbitFrontendService) GetTargets(ctx context.Context) ([]deployment.Target, error) {
+	return deployment.GetTargets(), nil
+}
+
+// GetAudit godoc
+//
+//	@Summary	Retrieve audit trail
+//	@Schemes
+//	@Description	Retrieve the hash chained audit trail of changes, optionally about a single entity such as deployment/{target}, oldest first and at most 1000 entries at a time. Pass the seq of the last entry returned as since to get the next page. The trail is kept in memory with the rest of the store, keeps only the latest entries and starts over when the server restarts. Actors named by clients are recorded as name@address, since the server does not authenticate them
+//	@Tags			Hawkbit FOTA
+//	@Param			entity	query	string	false	"Entity"
+//	@Param			since	query	int		false	"Sequence number of the entry to start after"
+//	@Param			limit	query	int		false	"Most entries returned, at most 1000"
+//	@Accept			json
+//	@Produce		json
+//	@Success		200	{array}	deployment.AuditEntry
+//	@Failure		500
+//	@Router			/hawkbit/audit [get]
+func (h *hawkbitFrontendService) GetAudit(ctx context.Context, q deployment.AuditQuery) ([]deployment.AuditEntry, error) {
+	if q.Since < 0 || q.Limit < 0 {
+		return nil, ErrFrontendBadRequest
+	}
+	if q.Limit == 0 || q.Limit > auditPage {
+		q.Limit = auditPage
+	}
+	return deployment.GetAudit(q)
+}
+
+// auditPage is the most audit entries returned at once.
+const auditPage = 1000
+
+// PostWebhook godoc
+//
+//	@Summary	Create or replace webhook
+//	@Schemes
+//	@Description	Create or replace a webhook notified of target registration, action assignment, action status changes and rollouts pausing or finishing
+//	@Tags			Hawkbit FOTA
+//	@Param			array	body	deployment.Webhook	false	"Webhook"
+//	@Accept			json
+//	@Produce		json
+//	@Success		200
+//	@Failure		400
+//	@Failure		500
+//	@Router			/hawkbit/webhooks [post]
+func (h *hawkbitFrontendService) PostWebhook(ctx context.Context, w deployment.Webhook) error {
+	return deployment.SetWebhookContext(ctx, w)
+}
+
+// GetWebhooks godoc
+//
+//	@Summary	List webhooks
+//	@Schemes
+//	@Description	List configured webhooks, without their secrets
+//	@Tags			Hawkbit FOTA
+//	@Accept			json
+//	@Produce		json
+//	@Success		200	{array}	deployment.Webhook
+//	@Failure		500
+//	@Router			/hawkbit/webhooks [get]
+func (h *hawkbitFrontendService) GetWebhooks(ctx context.Context) ([]deployment.Webhook, error) {
+	return deployment.GetWebhooks(), nil
+}
+
+// DeleteWebhook godoc
+//
+//	@Summary	Delete webhook
+//	@Schemes
+//	@Description	Delete webhook along with its delivery log
+//	@Tags			Hawkbit FOTA
+//	@Param			name	path	string	true	"Webhook name"
+//	@Accept			json
+//	@Produce		json
+//	@Success		200
+//	@Failure		404
+//	@Failure		500
+//	@Router			/hawkbit/webhooks/{name} [delete]
+func (h *hawkbitFrontendService) DeleteWebhook(ctx context.Context, n string) error {
+	return deployment.DeleteWebhookContext(ctx, n)
+}
+
+// GetWebhookDeliveries godoc
+//
+//	@Summary	Retrieve webhook deliveries
+//	@Schemes
+//	@Description	Retrieve the most recent deliveries to a webhook, oldest first
+//	@Tags			Hawkbit FOTA
+//	@Param			name	path	string	true	"Webhook name"
+//	@Accept			json
+//	@Produce		json
+//	@Success		200	{array}	deployment.Delivery
+//	@Failure		404
+//	@Failure		500
+//	@Router			/hawkbit/webhooks/{name}/deliveries [get]
+func (h *hawkbitFrontendService) GetWebhookDeliveries(ctx context.Context, n string) ([]deployment.Delivery, error) {
+	return deployment.GetDeliveries(n)
+}
+
+// eventsQueue bounds the events buffered for a stream. A client falling
+// further behind misses events, and is told so by an events.dropped event
+// once it catches up.
+const eventsQueue = 64
+
+// GetEvents godoc
+//
+//	@Summary	Stream live events
+//	@Schemes
+//	@Description	Stream target polls, action assignments, status changes, progress and rollout changes as server-sent events, optionally only those of a target, of the targets carrying a tag or of a rollout and its targets. A stream falling behind gets an events.dropped event counting the events it missed
+//	@Tags			Hawkbit FOTA
+//	@Param			target	query	string	false	"Target"
+//	@Param			tag		query	string	false	"Target tag"
+//	@Param			rollout	query	string	false	"Rollout"
+//	@Produce		text/event-stream
+//	@Success		200	{object}	deployment.Event
+//	@Failure		500
+//	@Router			/hawkbit/events [get]
+func (h *hawkbitFrontendService) GetEvents(ctx context.Context, f deployment.EventFilter) (<-chan deployment.Event, error) {
+	es := make(chan deployment.Event, eventsQueue)
+	var s *deployment.Subscription
+	var m *eventMatcher
+	subscribed := make(chan struct{})
+	// missed counts the events dropped since the last report, here or by
+	// the bus when the handler fell behind.
+	var missed, busDropped uint64
+	send := func(e deployment.Event) bool {
+		select {
+		case es <- e:
+			return true
+		default:
+			return false
+		}
+	}
+	s = deployment.Subscribe(eventsQueue, func(msg deployment.Message) {
+		<-subscribed
+		if d := s.Dropped(); d > busDropped {
+			missed += d - busDropped
+			busDropped = d
+		}
+		m.update(msg)
+		for _, e := range deployment.Events(msg) {
+			if !m.match(e) {
+				continue
+			}
+			if missed > 0 {
+				if !send(deployment.Event{Type: deployment.EventsDropped, Time: e.Time, Dropped: missed}) {
+					missed++
+					continue
+				}
+				missed = 0
+			}
+			if !send(e) {
+				missed++
+			}
+		}
+	})
+	// The matcher starts from the store as it is once subscribed, so the
+	// changes it follows from then on are never missed.
+	m = newEventMatcher(f)
+	close(subscribed)
+	go func() {
+		<-ctx.Done()
+		s.Close()
+		close(es)
+	}()
+	return es, nil
+}
+
+// eventMatcher selects the events of filter f. It follows the targets
+// carrying the tag and those of the rollout as the bus reports them
+// changing.
+type eventMatcher struct {
+	f       deployment.EventFilter
+	tagged  map[string]bool
+	rollout map[string]bool
+}
+
+func newEventMatcher(f deployment.EventFilter) *eventMatcher {
+	m := &eventMatcher{f: f, tagged: map[string]bool{}, rollout: map[string]bool{}}
+	if f.Tag != "" {
+		for _, t := range deployment.Tagged(f.Tag) {
+			m.tagged[t] = true
+		}
+	}
+	if f.Rollout != "" {
+		if r, err := deployment.GetRollout(f.Rollout); err == nil {
+			m.update(deployment.RolloutChanged{Rollout: r})
+		}
+	}
+	return m
+}
+
+func (m *eventMatcher) update(msg deployment.Message) {
+	switch msg := msg.(type) {
+	case deployment.TargetTagged:
+		if m.f.Tag != "" {
+			m.tagged[msg.Target] = msg.Has(m.f.Tag)
+		}
+	case deployment.RolloutChanged:
+		if m.f.Rollout != "" && msg.Rollout.Name == m.f.Rollout {
+			m.rollout = map[string]bool{}
+			for _, t := range msg.Rollout.Targets {
+				m.rollout[t] = true
+			}
+		}
+	}
+}
+
+func (m *eventMatcher) match(e deployment.Event) bool {
+	if m.f.Target != "" && e.Target != m.f.Target {
+		return false
+	}
+	if m.f.Tag != "" && !m.tagged[e.Target] {
+		return false
+	}
+	if m.f.Rollout != "" && e.Rollout != m.f.Rollout && !m.rollout[e.Target] {
+		return false
+	}
+	return true
+}
+
+// PutRollout godoc
+//
+//	@Summary	Report rollout state
+//	@Schemes
+//	@Description	Record the state of a rollout as reported by the client running it, wave by wave. Webhooks are notified when the rollout pauses or finishes
+//	@Tags			Hawkbit FOTA
+//	@Param			name	path	string				true	"Rollout name"
+//	@Param			array	body	deployment.Rollout	false	"Rollout state"
+//	@Accept			json
+//	@Produce		json
+//	@Success		200
+//	@Failure		400
+//	@Failure		404
+//	@Failure		500
+//	@Router			/hawkbit/rollouts/{name} [put]
+func (h *hawkbitFrontendService) PutRollout(ctx context.Context, r deployment.Rollout) error {
+	return deployment.SetRolloutContext(ctx, r)
+}
+
+// GetRollouts godoc
+//
+//	@Summary	List rollouts
+//	@Schemes
+//	@Description	List the rollouts with the state last reported for them
+//	@Tags			Hawkbit FOTA
+//	@Accept			json
+//	@Produce		json
+//	@Success		200	{array}	deployment.Rollout
+//	@Failure		500
+//	@Router			/hawkbit/rollouts [get]
+func (h *hawkbitFrontendService) GetRollouts(ctx context.Context) ([]deployment.Rollout, error) {
+	return deployment.GetRollouts(), nil
+}
+
+// PutAutoConfirm godoc
+//
+//	@Summary	Toggle auto-confirmation
+//	@Schemes
+//	@Description	Activate or deactivate auto-confirmation of deployments which require confirmation on target
+//	@Tags			Hawkbit FOTA
+//	@Param			target	path	string					true	"Target name"
+//	@Param			array	body	deployment.AutoConfirm	false	"Auto-confirmation state"
+//	@Accept			json
+//	@Produce		json
+//	@Success		200
+//	@Failure		400
+//	@Failure		500
+//	@Router			/hawkbit/targets/{target}/autoconfirm [put]
+func (h *hawkbitFrontendService) PutAutoConfirm(ctx context.Context, t string, a deployment.AutoConfirm) error {
+	if t == "" {
+		return ErrFrontendBadRequest
+	}
+	deployment.SetAutoConfirmContext(ctx, t, a)
+	return nil
+}
+
+// PutTags godoc
+//
+//	@Summary	Tag target
+//	@Schemes
+//	@Description	Replace the tags of a target, which group targets for event streams. No tags removes them all
+//	@Tags			Hawkbit FOTA
+//	@Param			target	path	string		true	"Target name"
+//	@Param			array	body	[]string	false	"Tags"
+//	@Accept			json
+//	@Produce		json
+//	@Success		200
+//	@Failure		400
+//	@Failure		500
+//	@Router			/hawkbit/targets/{target}/tags [put]
+func (h *hawkbitFrontendService) PutTags(ctx context.Context, t string, tags []string) error {
+	return deployment.SetTagsContext(ctx, t, tags)
+}
@@ -0,0 +1,135 @@
+package frontend
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/jonathanyhliang/hawkbit-fota/deployment"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGetEventsDropped(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	tgt := "events-" + time.Now().Format("150405.000000000")
+	es, err := NewHawkbitFrontendService().GetEvents(ctx, deployment.EventFilter{Target: tgt})
+	assert.Equal(t, nil, err)
+
+	// Nobody reads the stream, so it falls behind.
+	for i := 0; i < 2*eventsQueue; i++ {
+		deployment.SetPolled(tgt, time.Now())
+	}
+	assert.Eventually(t, func() bool { return len(es) == eventsQueue }, 5*time.Second, time.Millisecond)
+	got, dropped := 0, uint64(0)
+	for n := 0; got+int(dropped) < 2*eventsQueue+2; n++ {
+		if n == eventsQueue {
+			// Once the stream caught up, the next event of the target
+			// comes after the report of those it missed.
+			deployment.SetPolled("other-"+tgt, time.Now())
+			deployment.SetPolled(tgt, time.Now())
+		}
+		select {
+		case e := <-es:
+			if e.Type == deployment.EventsDropped {
+				dropped += e.Dropped
+				continue
+			}
+			assert.Equal(t, tgt, e.Target)
+			got++
+		case <-ctx.Done():
+			t.Fatal("stream ended early")
+		}
+	}
+	// Every event of the target either arrived or was reported missing.
+	assert.Less(t, uint64(0), dropped)
+	assert.Equal(t, 2*eventsQueue+2, got+int(dropped))
+}
+
+func TestGetEventsFilters(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	id := time.Now().Format("150405.000000000")
+	lab, other, late := "lab-"+id, "other-"+id, "late-"+id
+	assert.Equal(t, nil, deployment.SetTags(lab, []string{"lab", "east"}))
+	assert.Equal(t, nil, deployment.SetUploadImage(ctx, deployment.Upload{Name: "filters", Version: "1.0.0"},
+		make([]byte, 1024)))
+	assert.Equal(t, nil, deployment.SetDistribution(deployment.Distribution{Name: "filters", Version: "1.0.0"},
+		"filters"))
+
+	s := NewHawkbitFrontendService()
+	tagged, err := s.GetEvents(ctx, deployment.EventFilter{Tag: "lab"})
+	assert.Equal(t, nil, err)
+	rolled, err := s.GetEvents(ctx, deployment.EventFilter{Rollout: "r-" + id})
+	assert.Equal(t, nil, err)
+	both, err := s.GetEvents(ctx, deployment.EventFilter{Tag: "lab", Rollout: "r-" + id})
+	assert.Equal(t, nil, err)
+
+	deployment.SetPolled(other, time.Now())
+	deployment.SetPolled(lab, time.Now())
+	// The stream follows targets as they are tagged and join the rollout.
+	assert.Equal(t, nil, deployment.SetTags(late, []string{"lab"}))
+	assert.Equal(t, nil, deployment.SetRollout(deployment.Rollout{Name: "r-" + id, Distribution: "filters",
+		Targets: []string{late, other}, State: deployment.RolloutRunning, Wave: 1}))
+	deployment.SetPolled(late, time.Now())
+	deployment.SetPolled(other, time.Now())
+	deployment.SetPolled(lab, time.Now())
+
+	next := func(es <-chan deployment.Event) string {
+		for {
+			select {
+			case e := <-es:
+				if e.Target != "" && e.Target != lab && e.Target != other && e.Target != late {
+					continue
+				}
+				return e.Type + " " + strings.TrimSuffix(e.Target+e.Rollout, "-"+id)
+			case <-ctx.Done():
+				t.Fatal("stream ended early")
+				return ""
+			}
+		}
+	}
+	for _, want := range []string{"target.registered lab", "target.polled lab", "target.tagged late",
+		"target.registered late", "target.polled late", "target.polled lab"} {
+		assert.Equal(t, want, next(tagged))
+	}
+	for _, want := range []string{"rollout.progress r", "target.registered late", "target.polled late",
+		"target.polled other"} {
+		assert.Equal(t, want, next(rolled))
+	}
+	for _, want := range []string{"target.registered late", "target.polled late"} {
+		assert.Equal(t, want, next(both))
+	}
+}
+
+func TestGetAuditPaging(t *testing.T) {
+	entity := "upload/paging-" + time.Now().Format("150405.000000000")
+	for i := 0; i < 3; i++ {
+		deployment.Audit("operator", "PostUpload", entity, nil, nil, nil)
+	}
+	h := MakeFrontendHTTPHandler(NewHawkbitFrontendService(), log.NewNopLogger())
+	get := func(q string) (int, []deployment.AuditEntry) {
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest("GET", "/hawkbit/audit?entity="+entity+q, nil))
+		var resp getAuditResponse
+		json.NewDecoder(w.Body).Decode(&resp)
+		return w.Code, resp.Entries
+	}
+	code, es := get("&limit=2")
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, 2, len(es))
+	code, rest := get("&since=" + strconv.Itoa(es[1].Seq))
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, 1, len(rest))
+	assert.Equal(t, es[1].Hash, rest[0].Prev)
+	for _, q := range []string{"&limit=many", "&since=-1", "&limit=-1"} {
+		code, _ = get(q)
+		assert.Equal(t, http.StatusBadRequest, code, q)
+	}
+}
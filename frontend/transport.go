@@ -4,7 +4,10 @@ import (
 	"context"
 	"encoding/json"
 	"errors"
+	"fmt"
 	"net/http"
+	"strconv"
+	"time"
 
 	"github.com/gorilla/mux"
 	"github.com/jonathanyhliang/hawkbit-fota/deployment"
@@ -13,6 +16,7 @@ import (
 	"github.com/go-kit/kit/transport"
 	httptransport "github.com/go-kit/kit/transport/http"
 	httpSwagger "github.com/swaggo/http-swagger/v2"
+	"go.opentelemetry.io/contrib/instrumentation/github.com/gorilla/mux/otelmux"
 )
 
 var (
@@ -23,10 +27,12 @@ var (
 
 func MakeFrontendHTTPHandler(s FrontendService, logger log.Logger) http.Handler {
 	r := mux.NewRouter()
+	r.Use(otelmux.Middleware("hawkbit-frontend"))
 	e := MakeFrontendServerEndpoints(s)
 	options := []httptransport.ServerOption{
 		httptransport.ServerErrorHandler(transport.NewLogErrorHandler(logger)),
 		httptransport.ServerErrorEncoder(encodeError),
+		httptransport.ServerBefore(actorFromRequest),
 	}
 
 	r.Methods("POST").Path("/hawkbit/upload").Handler(httptransport.NewServer(
@@ -65,6 +71,67 @@ func MakeFrontendHTTPHandler(s FrontendService, logger log.Logger) http.Handler
 		encodeResponse,
 		options...,
 	))
+	r.Methods("GET").Path("/hawkbit/targets").Handler(httptransport.NewServer(
+		e.GetTargets,
+		decodeGetTargetsEndpoint,
+		encodeResponse,
+		options...,
+	))
+	r.Methods("PUT").Path("/hawkbit/targets/{target}/autoconfirm").Handler(httptransport.NewServer(
+		e.PutAutoConfirm,
+		decodePutAutoConfirmEndpoint,
+		encodeResponse,
+		options...,
+	))
+	r.Methods("PUT").Path("/hawkbit/targets/{target}/tags").Handler(httptransport.NewServer(
+		e.PutTags,
+		decodePutTagsEndpoint,
+		encodeResponse,
+		options...,
+	))
+	r.Methods("GET").Path("/hawkbit/audit").Handler(httptransport.NewServer(
+		e.GetAudit,
+		decodeGetAuditEndpoint,
+		encodeResponse,
+		options...,
+	))
+	r.Methods("POST").Path("/hawkbit/webhooks").Handler(httptransport.NewServer(
+		e.PostWebhook,
+		decodePostWebhookEndpoint,
+		encodeResponse,
+		options...,
+	))
+	r.Methods("GET").Path("/hawkbit/webhooks").Handler(httptransport.NewServer(
+		e.GetWebhooks,
+		decodeGetWebhooksEndpoint,
+		encodeResponse,
+		options...,
+	))
+	r.Methods("DELETE").Path("/hawkbit/webhooks/{name}").Handler(httptransport.NewServer(
+		e.DeleteWebhook,
+		decodeDeleteWebhookEndpoint,
+		encodeResponse,
+		options...,
+	))
+	r.Methods("GET").Path("/hawkbit/webhooks/{name}/deliveries").Handler(httptransport.NewServer(
+		e.GetWebhookDeliveries,
+		decodeGetWebhookDeliveriesEndpoint,
+		encodeResponse,
+		options...,
+	))
+	r.Methods("PUT").Path("/hawkbit/rollouts/{name}").Handler(httptransport.NewServer(
+		e.PutRollout,
+		decodePutRolloutEndpoint,
+		encodeResponse,
+		options...,
+	))
+	r.Methods("GET").Path("/hawkbit/rollouts").Handler(httptransport.NewServer(
+		e.GetRollouts,
+		decodeGetRolloutsEndpoint,
+		encodeResponse,
+		options...,
+	))
+	r.Methods("GET").Path("/hawkbit/events").Handler(makeEventsHandler(s, logger))
 	r.PathPrefix("/hawkbit/docs").Handler(httpSwagger.WrapHandler)
 	return r
 }
@@ -75,7 +142,8 @@ func decodePostUploadEndpoint(_ context.Context, r *http.Request) (request inter
 	if e != nil {
 		return nil, e
 	}
-	return postUploadRequest{Name: u.Name, Version: u.Version, File: u.File}, nil
+	return postUploadRequest{Name: u.Name, Version: u.Version, File: u.File, Sign: u.Sign,
+		Compress: u.Compress}, nil
 }
 
 func decodeGetUploadEndpoint(_ context.Context, r *http.Request) (request interface{}, err error) {
@@ -93,7 +161,8 @@ func decodePostDistributionEndpoint(_ context.Context, r *http.Request) (request
 	if e != nil {
 		return nil, e
 	}
-	return postDistributionRequest{Name: d.Name, Version: d.Version, Upload: d.Upload}, nil
+	return postDistributionRequest{Name: d.Name, Version: d.Version, Upload: d.Upload, Key: d.Key,
+		Variant: d.Variant, Compatible: d.Compatible}, nil
 }
 
 func decodeGetDistributionEndpoint(_ context.Context, r *http.Request) (request interface{}, err error) {
@@ -111,7 +180,9 @@ func decodePostDeploymentEndpoint(_ context.Context, r *http.Request) (request i
 	if e != nil {
 		return nil, e
 	}
-	return postDeploymentRequest{Target: d.Target, Distribution: d.Distribution}, nil
+	return postDeploymentRequest{Target: d.Target, Distribution: d.Distribution, Type: d.Type,
+		ForceTime: d.ForceTime, Maintenance: d.Maintenance,
+		ConfirmationRequired: d.ConfirmationRequired}, nil
 }
 
 func decodeGetDeploymentEndpoint(_ context.Context, r *http.Request) (request interface{}, err error) {
@@ -123,6 +194,115 @@ func decodeGetDeploymentEndpoint(_ context.Context, r *http.Request) (request in
 	return getDeploymentRequest{Target: t}, nil
 }
 
+func decodeGetTargetsEndpoint(_ context.Context, r *http.Request) (request interface{}, err error) {
+	return getTargetsRequest{}, nil
+}
+
+func decodeGetAuditEndpoint(_ context.Context, r *http.Request) (request interface{}, err error) {
+	q := r.URL.Query()
+	req := getAuditRequest{Entity: q.Get("entity")}
+	for k, v := range map[string]*int{"since": &req.Since, "limit": &req.Limit} {
+		if !q.Has(k) {
+			continue
+		}
+		if *v, err = strconv.Atoi(q.Get(k)); err != nil {
+			return nil, ErrFrontendBadRequest
+		}
+	}
+	return req, nil
+}
+
+func decodePostWebhookEndpoint(_ context.Context, r *http.Request) (request interface{}, err error) {
+	var w deployment.Webhook
+	if e := json.NewDecoder(r.Body).Decode(&w); e != nil {
+		return nil, e
+	}
+	return postWebhookRequest{Webhook: w}, nil
+}
+
+func decodeGetWebhooksEndpoint(_ context.Context, r *http.Request) (request interface{}, err error) {
+	return getWebhooksRequest{}, nil
+}
+
+func decodeDeleteWebhookEndpoint(_ context.Context, r *http.Request) (request interface{}, err error) {
+	vars := mux.Vars(r)
+	n, ok := vars["name"]
+	if !ok {
+		return nil, ErrBadRouting
+	}
+	return deleteWebhookRequest{Name: n}, nil
+}
+
+func decodeGetWebhookDeliveriesEndpoint(_ context.Context, r *http.Request) (request interface{}, err error) {
+	vars := mux.Vars(r)
+	n, ok := vars["name"]
+	if !ok {
+		return nil, ErrBadRouting
+	}
+	return getWebhookDeliveriesRequest{Name: n}, nil
+}
+
+func decodePutRolloutEndpoint(_ context.Context, r *http.Request) (request interface{}, err error) {
+	vars := mux.Vars(r)
+	n, ok := vars["name"]
+	if !ok {
+		return nil, ErrBadRouting
+	}
+	var ro deployment.Rollout
+	if e := json.NewDecoder(r.Body).Decode(&ro); e != nil {
+		return nil, e
+	}
+	ro.Name = n
+	return putRolloutRequest{Rollout: ro}, nil
+}
+
+func decodeGetRolloutsEndpoint(_ context.Context, r *http.Request) (request interface{}, err error) {
+	return getRolloutsRequest{}, nil
+}
+
+// actorFromRequest records who made a request for the audit trail: the
+// operator named in the X-Hawkbit-Actor header at the client address, or
+// else the client address alone. The frontend does not authenticate the
+// header, so the address it came from is always kept alongside the name.
+func actorFromRequest(ctx context.Context, r *http.Request) context.Context {
+	return deployment.WithActor(ctx, claimedActor(r.Header.Get("X-Hawkbit-Actor"), r.RemoteAddr))
+}
+
+// claimedActor names actor a as claimed by a client at addr.
+func claimedActor(a string, addr string) string {
+	if a == "" {
+		return addr
+	}
+	return a + "@" + addr
+}
+
+func decodePutAutoConfirmEndpoint(_ context.Context, r *http.Request) (request interface{}, err error) {
+	vars := mux.Vars(r)
+	t, ok := vars["target"]
+	if !ok {
+		return nil, ErrBadRouting
+	}
+	var a deployment.AutoConfirm
+	e := json.NewDecoder(r.Body).Decode(&a)
+	if e != nil {
+		return nil, e
+	}
+	return putAutoConfirmRequest{Target: t, AutoConfirm: a}, nil
+}
+
+func decodePutTagsEndpoint(_ context.Context, r *http.Request) (request interface{}, err error) {
+	vars := mux.Vars(r)
+	t, ok := vars["target"]
+	if !ok {
+		return nil, ErrBadRouting
+	}
+	var tags []string
+	if e := json.NewDecoder(r.Body).Decode(&tags); e != nil {
+		return nil, e
+	}
+	return putTagsRequest{Target: t, Tags: tags}, nil
+}
+
 type errorer interface {
 	error() error
 }
@@ -172,13 +352,84 @@ func codeFrom(err error) int {
 	switch err {
 	case deployment.ErrDeploymentNotFound,
 		deployment.ErrDeploymentUploadNotFound,
-		deployment.ErrDeploymentDistNotFound:
+		deployment.ErrDeploymentDistNotFound,
+		deployment.ErrDeploymentWebhookNotFound,
+		deployment.ErrDeploymentRolloutNotFound:
 		return http.StatusNotFound
 	case ErrFrontendUpload,
 		ErrFrontendDistribution,
-		ErrFrontendDeployment:
+		ErrFrontendDeployment,
+		ErrFrontendBadRequest,
+		deployment.ErrDeploymentImage,
+		deployment.ErrDeploymentImageHash,
+		deployment.ErrDeploymentImageVersion,
+		deployment.ErrDeploymentDistKey,
+		deployment.ErrDeploymentSign,
+		deployment.ErrDeploymentEncoding,
+		deployment.ErrDeploymentWebhook,
+		deployment.ErrDeploymentRollout,
+		deployment.ErrDeploymentTag:
 		return http.StatusBadRequest
+	case deployment.ErrDeploymentUnsigned,
+		deployment.ErrDeploymentSignature:
+		return http.StatusForbidden
+	case deployment.ErrDeploymentIncompatible:
+		return http.StatusConflict
+	case deployment.ErrDeploymentFetchSize:
+		return http.StatusRequestEntityTooLarge
+	case deployment.ErrDeploymentFetch,
+		deployment.ErrDeploymentFetchStatus,
+		deployment.ErrDeploymentFetchLength:
+		return http.StatusBadGateway
 	default:
 		return http.StatusInternalServerError
 	}
 }
+
+// eventsKeepAlive is how often an idle event stream sends a comment, keeping
+// proxies from closing the connection.
+const eventsKeepAlive = 30 * time.Second
+
+// makeEventsHandler streams the events of GetEvents as server-sent events
+// named after the event type. Streaming does not fit a go-kit endpoint, so
+// the handler calls the service directly.
+func makeEventsHandler(s FrontendService, logger log.Logger) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		f, ok := w.(http.Flusher)
+		if !ok {
+			encodeError(r.Context(), errors.New("streaming unsupported"), w)
+			return
+		}
+		q := r.URL.Query()
+		ef := deployment.EventFilter{Target: q.Get("target"), Tag: q.Get("tag"), Rollout: q.Get("rollout")}
+		es, err := s.GetEvents(actorFromRequest(r.Context(), r), ef)
+		if err != nil {
+			encodeError(r.Context(), err, w)
+			return
+		}
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Header().Set("Cache-Control", "no-cache")
+		w.WriteHeader(http.StatusOK)
+		f.Flush()
+		t := time.NewTicker(eventsKeepAlive)
+		defer t.Stop()
+		for {
+			select {
+			case e, ok := <-es:
+				if !ok {
+					return
+				}
+				b, _ := json.Marshal(e)
+				if _, err := fmt.Fprintf(w, "event: %s\ndata: %s\n\n", e.Type, b); err != nil {
+					logger.Log("events", r.RemoteAddr, "err", err)
+					return
+				}
+			case <-t.C:
+				fmt.Fprint(w, ": keep-alive\n\n")
+			case <-r.Context().Done():
+				return
+			}
+			f.Flush()
+		}
+	})
+}
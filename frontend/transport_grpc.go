@@ -0,0 +1,818 @@
+package frontend
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/transport"
+	grpctransport "github.com/go-kit/kit/transport/grpc"
+	"github.com/jonathanyhliang/hawkbit-fota/deployment"
+	"github.com/jonathanyhliang/hawkbit-fota/frontend/pb"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+type grpcServer struct {
+	pb.UnimplementedFrontendServer
+	s      FrontendService
+	logger log.Logger
+
+	postUpload           grpctransport.Handler
+	uploadImage          grpctransport.Handler
+	getUpload            grpctransport.Handler
+	postDistribution     grpctransport.Handler
+	getDistribution      grpctransport.Handler
+	postDeployment       grpctransport.Handler
+	getDeployment        grpctransport.Handler
+	getTargets           grpctransport.Handler
+	putAutoConfirm       grpctransport.Handler
+	putTags              grpctransport.Handler
+	getAudit             grpctransport.Handler
+	postWebhook          grpctransport.Handler
+	getWebhooks          grpctransport.Handler
+	deleteWebhook        grpctransport.Handler
+	getWebhookDeliveries grpctransport.Handler
+	putRollout           grpctransport.Handler
+	getRollouts          grpctransport.Handler
+}
+
+// MakeFrontendGRPCServer serves the endpoints of MakeFrontendHTTPHandler as
+// the Frontend service of frontend.proto. Register it with
+// pb.RegisterFrontendServer.
+func MakeFrontendGRPCServer(s FrontendService, logger log.Logger) pb.FrontendServer {
+	e := MakeFrontendServerEndpoints(s)
+	options := []grpctransport.ServerOption{
+		grpctransport.ServerErrorHandler(transport.NewLogErrorHandler(logger)),
+		grpctransport.ServerBefore(actorFromMetadata),
+	}
+	return &grpcServer{
+		s:      s,
+		logger: logger,
+		postUpload: grpctransport.NewServer(
+			e.PostUpload,
+			decodeGRPCPostUploadRequest,
+			encodeGRPCEmptyResponse(&pb.PostUploadResponse{}),
+			options...,
+		),
+		uploadImage: grpctransport.NewServer(
+			e.PostUploadImage,
+			decodeGRPCUploadImageRequest,
+			encodeGRPCEmptyResponse(&pb.PostUploadResponse{}),
+			options...,
+		),
+		getUpload: grpctransport.NewServer(
+			e.GetUpload,
+			decodeGRPCGetUploadRequest,
+			encodeGRPCGetUploadResponse,
+			options...,
+		),
+		postDistribution: grpctransport.NewServer(
+			e.PostDistribution,
+			decodeGRPCPostDistributionRequest,
+			encodeGRPCEmptyResponse(&pb.PostDistributionResponse{}),
+			options...,
+		),
+		getDistribution: grpctransport.NewServer(
+			e.GetDistribution,
+			decodeGRPCGetDistributionRequest,
+			encodeGRPCGetDistributionResponse,
+			options...,
+		),
+		postDeployment: grpctransport.NewServer(
+			e.PostDeployment,
+			decodeGRPCPostDeploymentRequest,
+			encodeGRPCEmptyResponse(&pb.PostDeploymentResponse{}),
+			options...,
+		),
+		getDeployment: grpctransport.NewServer(
+			e.GetDeployment,
+			decodeGRPCGetDeploymentRequest,
+			encodeGRPCGetDeploymentResponse,
+			options...,
+		),
+		getTargets: grpctransport.NewServer(
+			e.GetTargets,
+			decodeGRPCGetTargetsRequest,
+			encodeGRPCGetTargetsResponse,
+			options...,
+		),
+		putAutoConfirm: grpctransport.NewServer(
+			e.PutAutoConfirm,
+			decodeGRPCPutAutoConfirmRequest,
+			encodeGRPCEmptyResponse(&pb.PutAutoConfirmResponse{}),
+			options...,
+		),
+		putTags: grpctransport.NewServer(
+			e.PutTags,
+			decodeGRPCPutTagsRequest,
+			encodeGRPCEmptyResponse(&pb.PutTagsResponse{}),
+			options...,
+		),
+		getAudit: grpctransport.NewServer(
+			e.GetAudit,
+			decodeGRPCGetAuditRequest,
+			encodeGRPCGetAuditResponse,
+			options...,
+		),
+		postWebhook: grpctransport.NewServer(
+			e.PostWebhook,
+			decodeGRPCPostWebhookRequest,
+			encodeGRPCEmptyResponse(&pb.PostWebhookResponse{}),
+			options...,
+		),
+		getWebhooks: grpctransport.NewServer(
+			e.GetWebhooks,
+			decodeGRPCGetWebhooksRequest,
+			encodeGRPCGetWebhooksResponse,
+			options...,
+		),
+		deleteWebhook: grpctransport.NewServer(
+			e.DeleteWebhook,
+			decodeGRPCDeleteWebhookRequest,
+			encodeGRPCEmptyResponse(&pb.DeleteWebhookResponse{}),
+			options...,
+		),
+		getWebhookDeliveries: grpctransport.NewServer(
+			e.GetWebhookDeliveries,
+			decodeGRPCGetWebhookDeliveriesRequest,
+			encodeGRPCGetWebhookDeliveriesResponse,
+			options...,
+		),
+		putRollout: grpctransport.NewServer(
+			e.PutRollout,
+			decodeGRPCPutRolloutRequest,
+			encodeGRPCEmptyResponse(&pb.PutRolloutResponse{}),
+			options...,
+		),
+		getRollouts: grpctransport.NewServer(
+			e.GetRollouts,
+			decodeGRPCGetRolloutsRequest,
+			encodeGRPCGetRolloutsResponse,
+			options...,
+		),
+	}
+}
+
+func (g *grpcServer) PostUpload(ctx context.Context, req *pb.PostUploadRequest) (*pb.PostUploadResponse, error) {
+	_, resp, err := g.postUpload.ServeGRPC(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	return resp.(*pb.PostUploadResponse), nil
+}
+
+// UploadImage collects the chunks following the header of the stream, up to
+// the MaxSize of the fetch policy, and adds the upload once the client
+// closes its side.
+func (g *grpcServer) UploadImage(stream pb.Frontend_UploadImageServer) error {
+	first, err := stream.Recv()
+	if err != nil {
+		return err
+	}
+	h := first.GetHeader()
+	if h == nil {
+		return status.Error(codes.InvalidArgument, "first message must carry the header")
+	}
+	max := deployment.GetFetchPolicy().MaxSize
+	var img []byte
+	for {
+		m, err := stream.Recv()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		if int64(len(img)+len(m.GetChunk())) > max {
+			return grpcError(deployment.ErrDeploymentFetchSize)
+		}
+		img = append(img, m.GetChunk()...)
+	}
+	req := postUploadImageRequest{
+		Name:     h.Name,
+		Version:  h.Version,
+		Image:    img,
+		Sign:     signParamsFromPB(h.Sign),
+		Compress: h.Compress,
+	}
+	_, resp, err := g.uploadImage.ServeGRPC(stream.Context(), req)
+	if err != nil {
+		return err
+	}
+	return stream.SendAndClose(resp.(*pb.PostUploadResponse))
+}
+
+func (g *grpcServer) GetUpload(ctx context.Context, req *pb.GetUploadRequest) (*pb.Upload, error) {
+	_, resp, err := g.getUpload.ServeGRPC(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	return resp.(*pb.Upload), nil
+}
+
+func (g *grpcServer) PostDistribution(ctx context.Context, req *pb.PostDistributionRequest) (*pb.PostDistributionResponse, error) {
+	_, resp, err := g.postDistribution.ServeGRPC(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	return resp.(*pb.PostDistributionResponse), nil
+}
+
+func (g *grpcServer) GetDistribution(ctx context.Context, req *pb.GetDistributionRequest) (*pb.Distribution, error) {
+	_, resp, err := g.getDistribution.ServeGRPC(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	return resp.(*pb.Distribution), nil
+}
+
+func (g *grpcServer) PostDeployment(ctx context.Context, req *pb.PostDeploymentRequest) (*pb.PostDeploymentResponse, error) {
+	_, resp, err := g.postDeployment.ServeGRPC(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	return resp.(*pb.PostDeploymentResponse), nil
+}
+
+func (g *grpcServer) GetDeployment(ctx context.Context, req *pb.GetDeploymentRequest) (*pb.Deployment, error) {
+	_, resp, err := g.getDeployment.ServeGRPC(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	return resp.(*pb.Deployment), nil
+}
+
+// WatchDeployment sends the deployment of the target whenever an action
+// event of the target arrives, or the stream missed events which may have
+// been some. Like the event stream of the HTTP transport,
+// it calls the service directly.
+func (g *grpcServer) WatchDeployment(req *pb.GetDeploymentRequest, stream pb.Frontend_WatchDeploymentServer) error {
+	if req.Target == "" {
+		return grpcError(ErrFrontendBadRequest)
+	}
+	ctx := actorFromStream(stream.Context())
+	// Subscribe before reading the deployment, so no change in between is
+	// missed.
+	es, err := g.s.GetEvents(ctx, deployment.EventFilter{Target: req.Target})
+	if err != nil {
+		return grpcError(err)
+	}
+	send := func() error {
+		d, err := g.s.GetDeployment(ctx, req.Target)
+		if err == deployment.ErrDeploymentNotFound {
+			return nil
+		}
+		if err != nil {
+			return grpcError(err)
+		}
+		return stream.Send(deploymentToPB(d))
+	}
+	if err := send(); err != nil {
+		return err
+	}
+	for e := range es {
+		if !strings.HasPrefix(e.Type, "action.") && e.Type != deployment.EventsDropped {
+			continue
+		}
+		if err := send(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (g *grpcServer) GetTargets(ctx context.Context, req *pb.GetTargetsRequest) (*pb.GetTargetsResponse, error) {
+	_, resp, err := g.getTargets.ServeGRPC(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	return resp.(*pb.GetTargetsResponse), nil
+}
+
+func (g *grpcServer) PutAutoConfirm(ctx context.Context, req *pb.PutAutoConfirmRequest) (*pb.PutAutoConfirmResponse, error) {
+	_, resp, err := g.putAutoConfirm.ServeGRPC(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	return resp.(*pb.PutAutoConfirmResponse), nil
+}
+
+func (g *grpcServer) PutTags(ctx context.Context, req *pb.PutTagsRequest) (*pb.PutTagsResponse, error) {
+	_, resp, err := g.putTags.ServeGRPC(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	return resp.(*pb.PutTagsResponse), nil
+}
+
+func (g *grpcServer) GetAudit(ctx context.Context, req *pb.GetAuditRequest) (*pb.GetAuditResponse, error) {
+	_, resp, err := g.getAudit.ServeGRPC(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	return resp.(*pb.GetAuditResponse), nil
+}
+
+func (g *grpcServer) PostWebhook(ctx context.Context, req *pb.Webhook) (*pb.PostWebhookResponse, error) {
+	_, resp, err := g.postWebhook.ServeGRPC(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	return resp.(*pb.PostWebhookResponse), nil
+}
+
+func (g *grpcServer) GetWebhooks(ctx context.Context, req *pb.GetWebhooksRequest) (*pb.GetWebhooksResponse, error) {
+	_, resp, err := g.getWebhooks.ServeGRPC(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	return resp.(*pb.GetWebhooksResponse), nil
+}
+
+func (g *grpcServer) DeleteWebhook(ctx context.Context, req *pb.DeleteWebhookRequest) (*pb.DeleteWebhookResponse, error) {
+	_, resp, err := g.deleteWebhook.ServeGRPC(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	return resp.(*pb.DeleteWebhookResponse), nil
+}
+
+func (g *grpcServer) GetWebhookDeliveries(ctx context.Context, req *pb.GetWebhookDeliveriesRequest) (*pb.GetWebhookDeliveriesResponse, error) {
+	_, resp, err := g.getWebhookDeliveries.ServeGRPC(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	return resp.(*pb.GetWebhookDeliveriesResponse), nil
+}
+
+func (g *grpcServer) PutRollout(ctx context.Context, req *pb.Rollout) (*pb.PutRolloutResponse, error) {
+	_, resp, err := g.putRollout.ServeGRPC(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	return resp.(*pb.PutRolloutResponse), nil
+}
+
+func (g *grpcServer) GetRollouts(ctx context.Context, req *pb.GetRolloutsRequest) (*pb.GetRolloutsResponse, error) {
+	_, resp, err := g.getRollouts.ServeGRPC(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	return resp.(*pb.GetRolloutsResponse), nil
+}
+
+// GetEvents streams the events of GetEvents until the client goes away.
+func (g *grpcServer) GetEvents(req *pb.GetEventsRequest, stream pb.Frontend_GetEventsServer) error {
+	f := deployment.EventFilter{Target: req.Target, Tag: req.Tag, Rollout: req.Rollout}
+	es, err := g.s.GetEvents(actorFromStream(stream.Context()), f)
+	if err != nil {
+		return grpcError(err)
+	}
+	for e := range es {
+		if err := stream.Send(eventToPB(e)); err != nil {
+			g.logger.Log("events", "grpc", "err", err)
+			return err
+		}
+	}
+	return nil
+}
+
+// actorFromMetadata is actorFromRequest for gRPC: the operator named in the
+// x-hawkbit-actor metadata at the client address, or else the client
+// address alone.
+func actorFromMetadata(ctx context.Context, md metadata.MD) context.Context {
+	var a, addr string
+	if v := md.Get("x-hawkbit-actor"); len(v) > 0 {
+		a = v[0]
+	}
+	if p, ok := peer.FromContext(ctx); ok {
+		addr = p.Addr.String()
+	}
+	if a == "" && addr == "" {
+		return ctx
+	}
+	return deployment.WithActor(ctx, claimedActor(a, addr))
+}
+
+func actorFromStream(ctx context.Context) context.Context {
+	md, _ := metadata.FromIncomingContext(ctx)
+	return actorFromMetadata(ctx, md)
+}
+
+// grpcError is encodeError for gRPC, with the status code following the
+// HTTP one of codeFrom.
+func grpcError(err error) error {
+	var c codes.Code
+	switch codeFrom(err) {
+	case http.StatusNotFound:
+		c = codes.NotFound
+	case http.StatusBadRequest:
+		c = codes.InvalidArgument
+	case http.StatusForbidden:
+		c = codes.PermissionDenied
+	case http.StatusConflict:
+		c = codes.FailedPrecondition
+	case http.StatusRequestEntityTooLarge:
+		c = codes.ResourceExhausted
+	case http.StatusBadGateway:
+		c = codes.Unavailable
+	default:
+		c = codes.Internal
+	}
+	return status.Error(c, err.Error())
+}
+
+func decodeGRPCPostUploadRequest(_ context.Context, grpcReq interface{}) (interface{}, error) {
+	req := grpcReq.(*pb.PostUploadRequest)
+	return postUploadRequest{
+		Name:     req.Name,
+		Version:  req.Version,
+		File:     req.File,
+		Sign:     signParamsFromPB(req.Sign),
+		Compress: req.Compress,
+	}, nil
+}
+
+// decodeGRPCUploadImageRequest passes through the request UploadImage
+// assembled from the stream.
+func decodeGRPCUploadImageRequest(_ context.Context, grpcReq interface{}) (interface{}, error) {
+	return grpcReq.(postUploadImageRequest), nil
+}
+
+func decodeGRPCGetUploadRequest(_ context.Context, grpcReq interface{}) (interface{}, error) {
+	return getUploadRequest{Name: grpcReq.(*pb.GetUploadRequest).Name}, nil
+}
+
+func decodeGRPCPostDistributionRequest(_ context.Context, grpcReq interface{}) (interface{}, error) {
+	req := grpcReq.(*pb.PostDistributionRequest)
+	r := postDistributionRequest{
+		Name:    req.Name,
+		Version: req.Version,
+		Upload:  req.Upload,
+		Key:     req.Key,
+		Variant: req.Variant,
+	}
+	if req.Compatible != nil {
+		r.Compatible = &deployment.Compatibility{
+			Boards:      req.Compatible.Boards,
+			HwRevisions: req.Compatible.HwRevisions,
+		}
+	}
+	return r, nil
+}
+
+func decodeGRPCGetDistributionRequest(_ context.Context, grpcReq interface{}) (interface{}, error) {
+	return getDistributionRequest{Name: grpcReq.(*pb.GetDistributionRequest).Name}, nil
+}
+
+func decodeGRPCPostDeploymentRequest(_ context.Context, grpcReq interface{}) (interface{}, error) {
+	req := grpcReq.(*pb.PostDeploymentRequest)
+	r := postDeploymentRequest{
+		Target:               req.Target,
+		Distribution:         req.Distribution,
+		Type:                 req.Type,
+		ForceTime:            req.ForceTime,
+		ConfirmationRequired: req.ConfirmationRequired,
+	}
+	if m := req.Maintenance; m != nil {
+		r.Maintenance = &deployment.MaintenanceWindow{
+			Schedule: m.Schedule,
+			Duration: m.Duration,
+			Timezone: m.Timezone,
+		}
+	}
+	return r, nil
+}
+
+func decodeGRPCGetDeploymentRequest(_ context.Context, grpcReq interface{}) (interface{}, error) {
+	return getDeploymentRequest{Target: grpcReq.(*pb.GetDeploymentRequest).Target}, nil
+}
+
+func decodeGRPCGetTargetsRequest(_ context.Context, _ interface{}) (interface{}, error) {
+	return getTargetsRequest{}, nil
+}
+
+func decodeGRPCPutAutoConfirmRequest(_ context.Context, grpcReq interface{}) (interface{}, error) {
+	req := grpcReq.(*pb.PutAutoConfirmRequest)
+	r := putAutoConfirmRequest{Target: req.Target}
+	if a := req.AutoConfirm; a != nil {
+		r.AutoConfirm = deployment.AutoConfirm{
+			Active:    a.Active,
+			Initiator: a.Initiator,
+			Remark:    a.Remark,
+		}
+	}
+	return r, nil
+}
+
+func decodeGRPCPutTagsRequest(_ context.Context, grpcReq interface{}) (interface{}, error) {
+	req := grpcReq.(*pb.PutTagsRequest)
+	return putTagsRequest{Target: req.Target, Tags: req.Tags}, nil
+}
+
+func decodeGRPCGetAuditRequest(_ context.Context, grpcReq interface{}) (interface{}, error) {
+	req := grpcReq.(*pb.GetAuditRequest)
+	return getAuditRequest{Entity: req.Entity, Since: int(req.Since), Limit: int(req.Limit)}, nil
+}
+
+func decodeGRPCPostWebhookRequest(_ context.Context, grpcReq interface{}) (interface{}, error) {
+	req := grpcReq.(*pb.Webhook)
+	return postWebhookRequest{Webhook: deployment.Webhook{
+		Name:   req.Name,
+		URL:    req.Url,
+		Secret: req.Secret,
+		Events: req.Events,
+	}}, nil
+}
+
+func decodeGRPCGetWebhooksRequest(_ context.Context, _ interface{}) (interface{}, error) {
+	return getWebhooksRequest{}, nil
+}
+
+func decodeGRPCDeleteWebhookRequest(_ context.Context, grpcReq interface{}) (interface{}, error) {
+	return deleteWebhookRequest{Name: grpcReq.(*pb.DeleteWebhookRequest).Name}, nil
+}
+
+func decodeGRPCGetWebhookDeliveriesRequest(_ context.Context, grpcReq interface{}) (interface{}, error) {
+	return getWebhookDeliveriesRequest{Name: grpcReq.(*pb.GetWebhookDeliveriesRequest).Name}, nil
+}
+
+func decodeGRPCPutRolloutRequest(_ context.Context, grpcReq interface{}) (interface{}, error) {
+	req := grpcReq.(*pb.Rollout)
+	return putRolloutRequest{Rollout: deployment.Rollout{
+		Name:         req.Name,
+		Distribution: req.Distribution,
+		Targets:      req.Targets,
+		State:        req.State,
+		Wave:         int(req.Wave),
+		Failures:     int(req.Failures),
+		Reason:       req.Reason,
+	}}, nil
+}
+
+func decodeGRPCGetRolloutsRequest(_ context.Context, _ interface{}) (interface{}, error) {
+	return getRolloutsRequest{}, nil
+}
+
+// encodeGRPCEmptyResponse encodes the responses carrying nothing but an
+// error.
+func encodeGRPCEmptyResponse(empty interface{}) grpctransport.EncodeResponseFunc {
+	return func(_ context.Context, response interface{}) (interface{}, error) {
+		if err := response.(errorer).error(); err != nil {
+			return nil, grpcError(err)
+		}
+		return empty, nil
+	}
+}
+
+func encodeGRPCGetUploadResponse(_ context.Context, response interface{}) (interface{}, error) {
+	resp := response.(getUploadResponse)
+	if resp.Err != nil {
+		return nil, grpcError(resp.Err)
+	}
+	return uploadToPB(resp.Upload), nil
+}
+
+func encodeGRPCGetDistributionResponse(_ context.Context, response interface{}) (interface{}, error) {
+	resp := response.(getDistributionResponse)
+	if resp.Err != nil {
+		return nil, grpcError(resp.Err)
+	}
+	return distributionToPB(&resp.Distribution), nil
+}
+
+func encodeGRPCGetDeploymentResponse(_ context.Context, response interface{}) (interface{}, error) {
+	resp := response.(getDeploymentResponse)
+	if resp.Err != nil {
+		return nil, grpcError(resp.Err)
+	}
+	return deploymentToPB(resp.Deployment), nil
+}
+
+func encodeGRPCGetTargetsResponse(_ context.Context, response interface{}) (interface{}, error) {
+	resp := response.(getTargetsResponse)
+	if resp.Err != nil {
+		return nil, grpcError(resp.Err)
+	}
+	r := &pb.GetTargetsResponse{}
+	for _, t := range resp.Targets {
+		p := &pb.Target{
+			Name:      t.Name,
+			Assigned:  distributionToPB(t.Assigned),
+			Installed: distributionToPB(t.Installed),
+			Tags:      t.Tags,
+		}
+		if t.LastPoll != nil {
+			p.LastPoll = timestamppb.New(*t.LastPoll)
+		}
+		r.Targets = append(r.Targets, p)
+	}
+	return r, nil
+}
+
+func encodeGRPCGetAuditResponse(_ context.Context, response interface{}) (interface{}, error) {
+	resp := response.(getAuditResponse)
+	if resp.Err != nil {
+		return nil, grpcError(resp.Err)
+	}
+	r := &pb.GetAuditResponse{}
+	for _, a := range resp.Entries {
+		r.Entries = append(r.Entries, &pb.AuditEntry{
+			Seq:    int32(a.Seq),
+			Time:   timestamppb.New(a.Time),
+			Actor:  a.Actor,
+			Action: a.Action,
+			Entity: a.Entity,
+			Before: a.Before,
+			After:  a.After,
+			Error:  a.Error,
+			Prev:   a.Prev,
+			Hash:   a.Hash,
+		})
+	}
+	return r, nil
+}
+
+func encodeGRPCGetWebhooksResponse(_ context.Context, response interface{}) (interface{}, error) {
+	resp := response.(getWebhooksResponse)
+	if resp.Err != nil {
+		return nil, grpcError(resp.Err)
+	}
+	r := &pb.GetWebhooksResponse{}
+	for _, w := range resp.Webhooks {
+		r.Webhooks = append(r.Webhooks, &pb.Webhook{
+			Name:   w.Name,
+			Url:    w.URL,
+			Secret: w.Secret,
+			Events: w.Events,
+		})
+	}
+	return r, nil
+}
+
+func encodeGRPCGetWebhookDeliveriesResponse(_ context.Context, response interface{}) (interface{}, error) {
+	resp := response.(getWebhookDeliveriesResponse)
+	if resp.Err != nil {
+		return nil, grpcError(resp.Err)
+	}
+	r := &pb.GetWebhookDeliveriesResponse{}
+	for _, d := range resp.Deliveries {
+		r.Deliveries = append(r.Deliveries, &pb.Delivery{
+			Webhook:    d.Webhook,
+			Event:      eventToPB(d.Event),
+			Attempts:   int32(d.Attempts),
+			StatusCode: int32(d.StatusCode),
+			Error:      d.Error,
+			Delivered:  d.Delivered,
+			Time:       timestamppb.New(d.Time),
+		})
+	}
+	return r, nil
+}
+
+func encodeGRPCGetRolloutsResponse(_ context.Context, response interface{}) (interface{}, error) {
+	resp := response.(getRolloutsResponse)
+	if resp.Err != nil {
+		return nil, grpcError(resp.Err)
+	}
+	r := &pb.GetRolloutsResponse{}
+	for _, ro := range resp.Rollouts {
+		r.Rollouts = append(r.Rollouts, &pb.Rollout{
+			Name:         ro.Name,
+			Distribution: ro.Distribution,
+			Targets:      ro.Targets,
+			State:        ro.State,
+			Wave:         int32(ro.Wave),
+			Failures:     int32(ro.Failures),
+			Reason:       ro.Reason,
+			Updated:      timestamppb.New(ro.Updated),
+		})
+	}
+	return r, nil
+}
+
+func signParamsFromPB(s *pb.SignParams) *deployment.SignParams {
+	if s == nil {
+		return nil
+	}
+	return &deployment.SignParams{HeaderSize: int(s.HeaderSize), LoadAddr: s.LoadAddr}
+}
+
+func imageInfoToPB(i *deployment.ImageInfo) *pb.ImageInfo {
+	if i == nil {
+		return nil
+	}
+	return &pb.ImageInfo{
+		Version:    i.Version,
+		LoadAddr:   i.LoadAddr,
+		HeaderSize: int32(i.HeaderSize),
+		ImageSize:  int32(i.ImageSize),
+		Flags:      i.Flags,
+		Hash:       i.Hash,
+		KeyHash:    i.KeyHash,
+		Signature:  i.Signature,
+	}
+}
+
+func encodingsToPB(m map[string]deployment.Encoding) map[string]*pb.Encoding {
+	if m == nil {
+		return nil
+	}
+	r := make(map[string]*pb.Encoding, len(m))
+	for k, e := range m {
+		r[k] = &pb.Encoding{Sha256: e.Sha256, Size: int32(e.Size)}
+	}
+	return r
+}
+
+func uploadToPB(u deployment.Upload) *pb.Upload {
+	p := &pb.Upload{
+		Name:      u.Name,
+		Version:   u.Version,
+		Url:       u.Url,
+		Sha256:    u.Sha256,
+		Size:      int32(u.Size),
+		Mcuboot:   imageInfoToPB(u.Mcuboot),
+		SignedBy:  u.SignedBy,
+		Compress:  u.Compress,
+		Encodings: encodingsToPB(u.Encodings),
+	}
+	if u.Sign != nil {
+		p.Sign = &pb.SignParams{HeaderSize: int32(u.Sign.HeaderSize), LoadAddr: u.Sign.LoadAddr}
+	}
+	if a := u.Signed; a != nil {
+		p.Signed = &pb.Artifact{
+			Sha256:    a.Sha256,
+			Size:      int32(a.Size),
+			Mcuboot:   imageInfoToPB(a.Mcuboot),
+			SignedBy:  a.SignedBy,
+			Encodings: encodingsToPB(a.Encodings),
+		}
+	}
+	return p
+}
+
+func distributionToPB(d *deployment.Distribution) *pb.Distribution {
+	if d == nil {
+		return nil
+	}
+	p := &pb.Distribution{
+		Name:    d.Name,
+		Version: d.Version,
+		Key:     d.Key,
+		Variant: d.Variant,
+		Upload:  uploadToPB(d.Upload),
+	}
+	if c := d.Compatible; c != nil {
+		p.Compatible = &pb.Compatibility{Boards: c.Boards, HwRevisions: c.HwRevisions}
+	}
+	return p
+}
+
+func statusToPB(s deployment.Status) *pb.Status {
+	p := &pb.Status{Execution: s.Execution, Finished: s.Result.Finished}
+	if g := s.Result.Progress; g != nil {
+		p.Progress = &pb.Progress{Cnt: int32(g.Cnt), Of: int32(g.Of)}
+	}
+	return p
+}
+
+func deploymentToPB(d deployment.Deployment) *pb.Deployment {
+	p := &pb.Deployment{
+		Target:               d.Target,
+		ActionId:             d.ActionId,
+		Artifact:             distributionToPB(&d.Artifact),
+		Status:               statusToPB(d.Status),
+		Type:                 d.Type,
+		ForceTime:            d.ForceTime,
+		ConfirmationRequired: d.ConfirmationRequired,
+		Confirmation:         d.Confirmation,
+	}
+	if m := d.Maintenance; m != nil {
+		p.Maintenance = &pb.MaintenanceWindow{Schedule: m.Schedule, Duration: m.Duration, Timezone: m.Timezone}
+	}
+	return p
+}
+
+func eventToPB(e deployment.Event) *pb.Event {
+	p := &pb.Event{
+		Type:         e.Type,
+		Time:         timestamppb.New(e.Time),
+		Target:       e.Target,
+		Upload:       e.Upload,
+		ActionId:     e.ActionId,
+		Distribution: e.Distribution,
+		Rollout:      e.Rollout,
+		Dropped:      e.Dropped,
+	}
+	if e.Status != nil {
+		p.Status = statusToPB(*e.Status)
+	}
+	return p
+}
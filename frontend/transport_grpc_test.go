@@ -0,0 +1,207 @@
+package frontend
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/jonathanyhliang/hawkbit-fota/deployment"
+	"github.com/jonathanyhliang/hawkbit-fota/frontend/pb"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+func newGRPCTestClient(t *testing.T) pb.FrontendClient {
+	l := bufconn.Listen(1 << 20)
+	s := grpc.NewServer()
+	fs := AuditFrontendMiddleware()(NewHawkbitFrontendService())
+	pb.RegisterFrontendServer(s, MakeFrontendGRPCServer(fs, log.NewNopLogger()))
+	go s.Serve(l)
+	t.Cleanup(s.Stop)
+
+	conn, err := grpc.Dial("bufnet",
+		grpc.WithContextDialer(func(context.Context, string) (net.Conn, error) { return l.Dial() }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()))
+	assert.Equal(t, nil, err)
+	t.Cleanup(func() { conn.Close() })
+	return pb.NewFrontendClient(conn)
+}
+
+func uploadImage(ctx context.Context, c pb.FrontendClient, name string, img []byte) error {
+	stream, err := c.UploadImage(ctx)
+	if err != nil {
+		return err
+	}
+	err = stream.Send(&pb.UploadImageRequest{Part: &pb.UploadImageRequest_Header_{
+		Header: &pb.UploadImageRequest_Header{Name: name, Version: "1.0.0"},
+	}})
+	if err != nil {
+		return err
+	}
+	for len(img) > 0 {
+		n := 1000
+		if n > len(img) {
+			n = len(img)
+		}
+		if err := stream.Send(&pb.UploadImageRequest{Part: &pb.UploadImageRequest_Chunk{Chunk: img[:n]}}); err != nil {
+			break
+		}
+		img = img[n:]
+	}
+	_, err = stream.CloseAndRecv()
+	return err
+}
+
+func TestGRPCTransport(t *testing.T) {
+	c := newGRPCTestClient(t)
+	ctx := metadata.AppendToOutgoingContext(context.Background(), "x-hawkbit-actor", "grpc-operator")
+
+	img := make([]byte, 2500)
+	for i := range img {
+		img[i] = byte(i)
+	}
+	assert.Equal(t, nil, uploadImage(ctx, c, "grpc", img))
+	u, err := c.GetUpload(ctx, &pb.GetUploadRequest{Name: "grpc"})
+	assert.Equal(t, nil, err)
+	assert.Equal(t, int32(len(img)), u.Size)
+	a, err := c.GetAudit(ctx, &pb.GetAuditRequest{Entity: "upload/grpc"})
+	assert.Equal(t, nil, err)
+	assert.Regexp(t, "^grpc-operator@.+", a.Entries[len(a.Entries)-1].Actor)
+	assert.Equal(t, "PostUploadImage", a.Entries[len(a.Entries)-1].Action)
+
+	_, err = c.GetUpload(ctx, &pb.GetUploadRequest{Name: "none"})
+	assert.Equal(t, codes.NotFound, status.Code(err))
+	_, err = c.PostDeployment(ctx, &pb.PostDeploymentRequest{Target: "grpc-dev"})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+
+	_, err = c.PostDistribution(ctx, &pb.PostDistributionRequest{Name: "grpc", Version: "1.0.0", Upload: "grpc"})
+	assert.Equal(t, nil, err)
+	d, err := c.GetDistribution(ctx, &pb.GetDistributionRequest{Name: "grpc"})
+	assert.Equal(t, nil, err)
+	assert.Equal(t, u.Sha256, d.Upload.Sha256)
+
+	_, err = c.PutRollout(ctx, &pb.Rollout{Name: "grpc", Distribution: "grpc", Targets: []string{"grpc-dev"},
+		State: deployment.RolloutPaused, Reason: "1 actions failed"})
+	assert.Equal(t, nil, err)
+	rs, err := c.GetRollouts(ctx, &pb.GetRolloutsRequest{})
+	assert.Equal(t, nil, err)
+	found := false
+	for _, r := range rs.Rollouts {
+		if r.Name == "grpc" {
+			found = true
+			assert.Equal(t, deployment.RolloutPaused, r.State)
+			assert.Equal(t, "1 actions failed", r.Reason)
+		}
+	}
+	assert.True(t, found)
+	_, err = c.PutRollout(ctx, &pb.Rollout{Name: "grpc", Distribution: "none", State: deployment.RolloutRunning})
+	assert.Equal(t, codes.NotFound, status.Code(err))
+}
+
+func TestGRPCUploadImageSize(t *testing.T) {
+	p := deployment.GetFetchPolicy()
+	defer deployment.SetFetchPolicy(p)
+	q := p
+	q.MaxSize = 1500
+	deployment.SetFetchPolicy(q)
+
+	c := newGRPCTestClient(t)
+	err := uploadImage(context.Background(), c, "grpc-large", make([]byte, 2000))
+	assert.Equal(t, codes.ResourceExhausted, status.Code(err))
+
+	stream, err := c.UploadImage(context.Background())
+	assert.Equal(t, nil, err)
+	stream.Send(&pb.UploadImageRequest{Part: &pb.UploadImageRequest_Chunk{Chunk: []byte{1}}})
+	_, err = stream.CloseAndRecv()
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+}
+
+func TestGRPCWatchDeployment(t *testing.T) {
+	c := newGRPCTestClient(t)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	assert.Equal(t, nil, uploadImage(ctx, c, "grpc-watch", make([]byte, 1000)))
+	_, err := c.PostDistribution(ctx, &pb.PostDistributionRequest{Name: "grpc-watch", Version: "1.0.0",
+		Upload: "grpc-watch"})
+	assert.Equal(t, nil, err)
+
+	w, err := c.WatchDeployment(ctx, &pb.GetDeploymentRequest{Target: "grpc-watch-dev"})
+	assert.Equal(t, nil, err)
+	// Wait for the subscription before the target gets its deployment.
+	time.Sleep(50 * time.Millisecond)
+	_, err = c.PostDeployment(ctx, &pb.PostDeploymentRequest{Target: "grpc-watch-dev", Distribution: "grpc-watch"})
+	assert.Equal(t, nil, err)
+	d, err := w.Recv()
+	assert.Equal(t, nil, err)
+	assert.Equal(t, "grpc-watch", d.Artifact.Name)
+	assert.NotEqual(t, "", d.ActionId)
+
+	var s deployment.Status
+	s.Execution = "closed"
+	s.Result.Finished = "success"
+	assert.Equal(t, nil, deployment.UpdateStatus("grpc-watch-dev", d.ActionId, s))
+	for d.Status.Execution != "closed" {
+		d, err = w.Recv()
+		assert.Equal(t, nil, err)
+	}
+	assert.Equal(t, "success", d.Status.Finished)
+}
+
+// eventsService streams the events of es instead of those of the store.
+type eventsService struct {
+	FrontendService
+	es chan deployment.Event
+}
+
+func (s eventsService) GetEvents(context.Context, deployment.EventFilter) (<-chan deployment.Event, error) {
+	return s.es, nil
+}
+
+type watchStream struct {
+	grpc.ServerStream
+	sent chan *pb.Deployment
+}
+
+func (w watchStream) Context() context.Context { return context.Background() }
+
+func (w watchStream) Send(d *pb.Deployment) error {
+	w.sent <- d
+	return nil
+}
+
+func TestGRPCWatchDeploymentDropped(t *testing.T) {
+	ctx := context.Background()
+	assert.Equal(t, nil, deployment.SetUploadImage(ctx, deployment.Upload{Name: "grpc-drop", Version: "1.0.0"},
+		make([]byte, 1000)))
+	assert.Equal(t, nil, deployment.SetDistribution(deployment.Distribution{Name: "grpc-drop", Version: "1.0.0"},
+		"grpc-drop"))
+	assert.Equal(t, nil, deployment.SetDeployment("grpc-drop-dev", "grpc-drop", deployment.DeploymentOptions{}))
+
+	s := eventsService{FrontendService: NewHawkbitFrontendService(), es: make(chan deployment.Event)}
+	w := watchStream{sent: make(chan *pb.Deployment, 4)}
+	done := make(chan error)
+	go func() {
+		done <- MakeFrontendGRPCServer(s, log.NewNopLogger()).WatchDeployment(
+			&pb.GetDeploymentRequest{Target: "grpc-drop-dev"}, w)
+	}()
+	assert.Equal(t, "grpc-drop", (<-w.sent).Artifact.Name)
+
+	// A poll leaves the deployment as it was, but missed events may not
+	// have, so the deployment is sent again.
+	s.es <- deployment.Event{Type: deployment.EventTargetPolled, Target: "grpc-drop-dev"}
+	s.es <- deployment.Event{Type: deployment.EventsDropped, Dropped: 2}
+	close(s.es)
+	assert.Equal(t, nil, <-done)
+	assert.Equal(t, 1, len(w.sent))
+	assert.Equal(t, "grpc-drop", (<-w.sent).Artifact.Name)
+
+	p := eventToPB(deployment.Event{Type: deployment.EventsDropped, Dropped: 2})
+	assert.Equal(t, uint64(2), p.Dropped)
+}
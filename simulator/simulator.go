@@ -0,0 +1,340 @@
+// Package simulator runs virtual targets against the DDI API of a backend,
+// for load and conformance testing without real boards.
+//
+// Each target polls its controller resource, confirms and fetches the
+// actions it is offered, downloads the artifact and verifies its hash, and
+// reports feedback the way a device would, failing or canceling a share of
+// its updates as configured.
+package simulator
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"net/http"
+	"path"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jonathanyhliang/hawkbit-fota/backend"
+	"github.com/jonathanyhliang/hawkbit-fota/deployment"
+)
+
+var (
+	ErrSimulatorStatus = errors.New("Simulator: backend returned non-2xx status")
+)
+
+// Config describes the targets of a run.
+type Config struct {
+	// URL is the base URL of the backend, such as http://localhost:8081.
+	URL string
+	// Targets is the number of targets, named Prefix-0001 and so on.
+	Targets int
+	Prefix  string
+	// Poll is the time between polls of a target. If zero, targets sleep
+	// as long as the backend tells them to.
+	Poll time.Duration
+	// Jitter is the largest random delay added to each sleep, keeping the
+	// targets from polling in lockstep.
+	Jitter time.Duration
+	// Step is the time a target spends in each phase of an update: after
+	// reporting the download, after downloading and after installing.
+	Step time.Duration
+	// FailRate and CancelRate are the probabilities an update fails or is
+	// canceled by the target. A canceled update is not installed.
+	FailRate   float64
+	CancelRate float64
+	// Attributes, if any, are sent as config data on the first poll.
+	Attributes map[string]string
+	// Client sends the requests of the targets, http.DefaultClient if nil.
+	Client *http.Client
+	// Seed seeds the randomness of the targets.
+	Seed int64
+}
+
+// Simulator runs the targets of a Config.
+type Simulator struct {
+	cfg   Config
+	stats *stats
+}
+
+func New(cfg Config) *Simulator {
+	if cfg.Client == nil {
+		cfg.Client = http.DefaultClient
+	}
+	if cfg.Prefix == "" {
+		cfg.Prefix = "sim"
+	}
+	cfg.URL = strings.TrimSuffix(cfg.URL, "/")
+	return &Simulator{cfg: cfg, stats: newStats()}
+}
+
+// Run runs the targets until ctx is done.
+func (s *Simulator) Run(ctx context.Context) {
+	var wg sync.WaitGroup
+	for i := 0; i < s.cfg.Targets; i++ {
+		t := &target{
+			s:    s,
+			name: fmt.Sprintf("%s-%04d", s.cfg.Prefix, i+1),
+			rnd:  rand.New(rand.NewSource(s.cfg.Seed + int64(i))),
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			t.run(ctx)
+		}()
+	}
+	wg.Wait()
+}
+
+// Report returns the statistics of the run so far.
+func (s *Simulator) Report() Report {
+	return s.stats.report()
+}
+
+// target is one virtual device.
+type target struct {
+	s    *Simulator
+	name string
+	rnd  *rand.Rand
+	// done is the last action the target finished, which the backend keeps
+	// offering until another is assigned.
+	done string
+}
+
+func (t *target) run(ctx context.Context) {
+	if len(t.s.cfg.Attributes) > 0 {
+		var cfg backend.ConfigData
+		cfg.Mode = deployment.AttributesMerge
+		cfg.Data = t.s.cfg.Attributes
+		t.do(ctx, OpConfigData, "PUT", t.href("configData"), cfg, nil)
+	}
+	for {
+		sleep := t.poll(ctx)
+		if t.s.cfg.Poll != 0 {
+			sleep = t.s.cfg.Poll
+		}
+		if t.s.cfg.Jitter > 0 {
+			sleep += time.Duration(t.rnd.Int63n(int64(t.s.cfg.Jitter)))
+		}
+		if !t.sleep(ctx, sleep) {
+			return
+		}
+	}
+}
+
+// poll fetches the controller resource and follows its links, returning the
+// polling interval asked for.
+func (t *target) poll(ctx context.Context) time.Duration {
+	var c backend.Controller
+	if t.do(ctx, OpPoll, "GET", t.href(""), nil, &c) != nil {
+		return time.Minute
+	}
+	if h := linkHref(c.Links.CancelAction); h != "" {
+		t.cancel(ctx, h)
+	}
+	// The confirmation base names an action only while it awaits
+	// confirmation; the target always confirms.
+	if h := linkHref(c.Links.ConfirmationBase); path.Base(path.Dir(h)) == "confirmationBase" {
+		fb := backend.ConfirmationFeedback{Confirmation: deployment.ConfirmationConfirmed}
+		t.do(ctx, OpConfirm, "POST", h+"/feedback", fb, nil)
+	}
+	if h := linkHref(c.Links.DeploymentBase); h != "" && path.Base(h) != t.done {
+		t.update(ctx, h)
+	}
+	return parseSleep(c.Config.Polling.Sleep)
+}
+
+// linkHref returns the target of l, empty if the resource left it out.
+func linkHref(l *backend.Link) string {
+	if l == nil {
+		return ""
+	}
+	return l.Href
+}
+
+// update carries out the action at href.
+func (t *target) update(ctx context.Context, href string) {
+	acid := path.Base(href)
+	var db backend.DeploymentBase
+	if t.do(ctx, OpDeploymentBase, "GET", href, nil, &db) != nil {
+		return
+	}
+	a := db.Deployment
+	if a.Update == "skip" && a.MaintenanceWindow == "unavailable" {
+		// Wait for the window rather than downloading ahead of time.
+		return
+	}
+	feedback := func(execution string, finished string, cnt int) error {
+		var fb backend.DeploymentBaseFeedback
+		fb.ID = acid
+		fb.Status.Execution = execution
+		fb.Status.Result.Finished = finished
+		if cnt > 0 {
+			fb.Status.Result.Progress = &deployment.Progress{Cnt: cnt, Of: 3}
+		}
+		return t.do(ctx, OpFeedback, "POST", href+"/feedback", fb, nil)
+	}
+	// finish reports the outcome of the action, which the target then
+	// leaves alone.
+	finish := func(execution string, finished string, outcome string) {
+		if feedback(execution, finished, 0) == nil {
+			t.done = acid
+			t.s.stats.outcome(outcome)
+		}
+	}
+
+	if len(a.Chunks) == 0 || len(a.Chunks[0].Artifacts) == 0 {
+		// There is nothing to download, so the action cannot succeed.
+		finish("closed", "failure", OutcomeError)
+		return
+	}
+	if feedback("download", "none", 1) != nil || !t.sleep(ctx, t.s.cfg.Step) {
+		return
+	}
+	if t.rnd.Float64() < t.s.cfg.CancelRate {
+		finish("canceled", "none", OutcomeCanceled)
+		return
+	}
+	art := a.Chunks[0].Artifacts[0]
+	img, err := t.download(ctx, art.Links.DownloadHttp.Href)
+	if err != nil {
+		t.s.stats.outcome(OutcomeError)
+		return
+	}
+	if hash(img) != art.Hashes.SHA256 || len(img) != art.Size {
+		finish("closed", "failure", OutcomeHashMismatch)
+		return
+	}
+	if feedback("downloaded", "none", 2) != nil || !t.sleep(ctx, t.s.cfg.Step) {
+		return
+	}
+	if a.Update == "skip" {
+		finish("downloaded", "success", OutcomeSuccess)
+		return
+	}
+	if feedback("proceeding", "none", 3) != nil || !t.sleep(ctx, t.s.cfg.Step) {
+		return
+	}
+	if t.rnd.Float64() < t.s.cfg.FailRate {
+		finish("closed", "failure", OutcomeFailure)
+		return
+	}
+	finish("closed", "success", OutcomeSuccess)
+}
+
+// cancel acknowledges a cancelation of the action at href.
+func (t *target) cancel(ctx context.Context, href string) {
+	var fb backend.CancelActionFeedback
+	fb.ID = path.Base(href)
+	fb.Status.Execution = "closed"
+	fb.Status.Result.Finished = "success"
+	if t.do(ctx, OpCancel, "POST", href+"/feedback", fb, nil) == nil {
+		t.done = fb.ID
+		t.s.stats.outcome(OutcomeCanceled)
+	}
+}
+
+func (t *target) download(ctx context.Context, href string) ([]byte, error) {
+	begin := time.Now()
+	img, err := t.request(ctx, "GET", href, nil)
+	if ctx.Err() == nil {
+		t.s.stats.observe(OpDownload, time.Since(begin), err)
+	}
+	return img, err
+}
+
+// do sends body as JSON and decodes the response into out, unless nil.
+func (t *target) do(ctx context.Context, op string, method string, href string, body interface{},
+	out interface{}) error {
+	begin := time.Now()
+	b, err := t.request(ctx, method, href, body)
+	if err == nil && out != nil {
+		err = json.Unmarshal(b, out)
+	}
+	// Requests cut short by the end of the run are not the backend's fault.
+	if ctx.Err() == nil {
+		t.s.stats.observe(op, time.Since(begin), err)
+	}
+	return err
+}
+
+func (t *target) request(ctx context.Context, method string, href string, body interface{}) ([]byte, error) {
+	var r io.Reader
+	if body != nil {
+		b, err := json.Marshal(body)
+		if err != nil {
+			return nil, err
+		}
+		r = bytes.NewReader(b)
+	}
+	if !strings.HasPrefix(href, "http://") && !strings.HasPrefix(href, "https://") {
+		href = t.s.cfg.URL + href
+	}
+	req, err := http.NewRequestWithContext(ctx, method, href, r)
+	if err != nil {
+		return nil, err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	resp, err := t.s.cfg.Client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	b, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode/100 != 2 {
+		return nil, ErrSimulatorStatus
+	}
+	return b, nil
+}
+
+// href is the path of resource r of the target.
+func (t *target) href(r string) string {
+	h := "/default/controller/v1/" + t.name
+	if r != "" {
+		h += "/" + r
+	}
+	return h
+}
+
+// sleep waits for d, or returns false if ctx is done first.
+func (t *target) sleep(ctx context.Context, d time.Duration) bool {
+	if d <= 0 {
+		return ctx.Err() == nil
+	}
+	tm := time.NewTimer(d)
+	defer tm.Stop()
+	select {
+	case <-tm.C:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// parseSleep parses the hh:mm:ss polling interval of a controller.
+func parseSleep(s string) time.Duration {
+	var h, m, sec int
+	if _, err := fmt.Sscanf(s, "%d:%d:%d", &h, &m, &sec); err != nil {
+		return 5 * time.Minute
+	}
+	return time.Duration(h)*time.Hour + time.Duration(m)*time.Minute + time.Duration(sec)*time.Second
+}
+
+// hash is the hex SHA-256 of b.
+func hash(b []byte) string {
+	s := sha256.Sum256(b)
+	return hex.EncodeToString(s[:])
+}
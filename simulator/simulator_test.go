@@ -0,0 +1,146 @@
+package simulator
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/http/httputil"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/jonathanyhliang/hawkbit-fota/backend"
+	"github.com/jonathanyhliang/hawkbit-fota/deployment"
+	"github.com/stretchr/testify/assert"
+)
+
+// setup assigns a distribution named n to the targets of prefix and
+// returns the backend they poll, whose downloads corrupt wraps if set.
+func setup(t *testing.T, n string, prefix string, targets int, o deployment.DeploymentOptions,
+	corrupt bool) string {
+	img := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b := make([]byte, 4096)
+		for i := range b {
+			b[i] = byte(i * 7)
+		}
+		w.Write(b)
+	}))
+	t.Cleanup(img.Close)
+	assert.Equal(t, nil, deployment.SetUpload(deployment.Upload{Name: n, Version: "1.0.0", Url: img.URL}))
+	assert.Equal(t, nil, deployment.SetDistribution(deployment.Distribution{Name: n, Version: "1.0.0"}, n))
+	for i := 1; i <= targets; i++ {
+		assert.Equal(t, nil, deployment.SetDeployment(targetName(prefix, i), n, o))
+	}
+
+	h := backend.MakeBackendHTTPHandler(backend.NewHawkbitBackendService(), log.NewNopLogger())
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if corrupt && strings.Contains(r.URL.Path, "/softwareModules/") {
+			w.Write([]byte("garbage"))
+			return
+		}
+		h.ServeHTTP(w, r)
+	}))
+	t.Cleanup(s.Close)
+	return s.URL
+}
+
+func targetName(prefix string, i int) string {
+	return fmt.Sprintf("%s-%04d", prefix, i)
+}
+
+// run runs a simulator until its report shows n updates with outcome o.
+func run(t *testing.T, cfg Config, o string, n int) Report {
+	s := New(cfg)
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		s.Run(ctx)
+		close(done)
+	}()
+	assert.Eventually(t, func() bool { return s.Report().Outcomes[o] == n }, 5*time.Second,
+		10*time.Millisecond)
+	cancel()
+	<-done
+	return s.Report()
+}
+
+func status(t string) deployment.Status {
+	d, _ := deployment.GetDeployment(t)
+	return d.Status
+}
+
+func TestSimulator(t *testing.T) {
+	url := setup(t, "sim", "sim", 3, deployment.DeploymentOptions{ConfirmationRequired: true}, false)
+	r := run(t, Config{URL: url, Targets: 3, Poll: 10 * time.Millisecond,
+		Attributes: map[string]string{deployment.AttributeBoard: "sim_board"}}, OutcomeSuccess, 3)
+	for i := 1; i <= 3; i++ {
+		d, err := deployment.GetInstalled(targetName("sim", i))
+		assert.Equal(t, nil, err)
+		assert.Equal(t, "sim", d.Artifact.Name)
+	}
+	assert.Equal(t, 3, r.Ops[OpConfirm].Count)
+	assert.Equal(t, 3, r.Ops[OpDownload].Count)
+	assert.Equal(t, 0, r.Ops[OpPoll].Errors)
+	assert.Equal(t, 0, r.Ops[OpFeedback].Errors)
+	assert.Equal(t, 12, r.Ops[OpFeedback].Count)
+	assert.True(t, r.Ops[OpPoll].P99 >= r.Ops[OpPoll].P50)
+	assert.Equal(t, "sim_board", deployment.GetAttributes("sim-0001")[deployment.AttributeBoard])
+	assert.Contains(t, r.String(), "updates: success 3")
+}
+
+func TestSimulatorFailures(t *testing.T) {
+	url := setup(t, "sim-fail", "fail", 2, deployment.DeploymentOptions{}, false)
+	run(t, Config{URL: url, Targets: 2, Prefix: "fail", Poll: 10 * time.Millisecond, FailRate: 1},
+		OutcomeFailure, 2)
+	assert.Equal(t, "closed", status("fail-0001").Execution)
+	assert.Equal(t, "failure", status("fail-0002").Result.Finished)
+
+	url = setup(t, "sim-cancel", "cancel", 1, deployment.DeploymentOptions{}, false)
+	r := run(t, Config{URL: url, Targets: 1, Prefix: "cancel", Poll: 10 * time.Millisecond, CancelRate: 1},
+		OutcomeCanceled, 1)
+	assert.Equal(t, "canceled", status("cancel-0001").Execution)
+	assert.Equal(t, 0, r.Ops[OpDownload].Count)
+}
+
+func TestSimulatorHashMismatch(t *testing.T) {
+	url := setup(t, "sim-hash", "hash", 1, deployment.DeploymentOptions{}, true)
+	run(t, Config{URL: url, Targets: 1, Prefix: "hash", Poll: 10 * time.Millisecond}, OutcomeHashMismatch, 1)
+	assert.Equal(t, "failure", status("hash-0001").Result.Finished)
+}
+
+func TestSimulatorNoArtifacts(t *testing.T) {
+	u, err := url.Parse(setup(t, "sim-empty", "empty", 1, deployment.DeploymentOptions{}, false))
+	assert.Equal(t, nil, err)
+	proxy := httputil.NewSingleHostReverseProxy(u)
+	// Strip the chunks from the actions the backend offers.
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "GET" || !strings.Contains(r.URL.Path, "/deploymentBase/") {
+			proxy.ServeHTTP(w, r)
+			return
+		}
+		resp, err := http.Get(u.String() + r.URL.Path)
+		if !assert.Equal(t, nil, err) {
+			return
+		}
+		defer resp.Body.Close()
+		var db backend.DeploymentBase
+		assert.Equal(t, nil, json.NewDecoder(resp.Body).Decode(&db))
+		db.Deployment.Chunks = nil
+		json.NewEncoder(w).Encode(db)
+	}))
+	defer s.Close()
+
+	r := run(t, Config{URL: s.URL, Targets: 1, Prefix: "empty", Poll: 10 * time.Millisecond}, OutcomeError, 1)
+	assert.Equal(t, "failure", status("empty-0001").Result.Finished)
+	assert.Equal(t, 0, r.Ops[OpDownload].Count)
+}
+
+func TestParseSleep(t *testing.T) {
+	assert.Equal(t, 5*time.Minute, parseSleep("00:05:00"))
+	assert.Equal(t, time.Hour+2*time.Second, parseSleep("01:00:02"))
+	assert.Equal(t, 5*time.Minute, parseSleep("soon"))
+}
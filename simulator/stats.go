@@ -0,0 +1,150 @@
+package simulator
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
+)
+
+// Requests the simulator times.
+const (
+	OpPoll           = "poll"
+	OpConfigData     = "configData"
+	OpConfirm        = "confirm"
+	OpDeploymentBase = "deploymentBase"
+	OpDownload       = "download"
+	OpFeedback       = "feedback"
+	OpCancel         = "cancelAction"
+)
+
+// Outcomes of the updates of the targets.
+const (
+	OutcomeSuccess      = "success"
+	OutcomeFailure      = "failure"
+	OutcomeCanceled     = "canceled"
+	OutcomeHashMismatch = "hash mismatch"
+	OutcomeError        = "error"
+)
+
+// OpReport summarises the latency of one kind of request. Failed requests
+// count as errors and are timed all the same.
+type OpReport struct {
+	Count  int
+	Errors int
+	Min    time.Duration
+	Mean   time.Duration
+	P50    time.Duration
+	P95    time.Duration
+	P99    time.Duration
+	Max    time.Duration
+}
+
+// Report is the state of a run: the requests made and how the updates
+// ended.
+type Report struct {
+	Ops      map[string]OpReport
+	Outcomes map[string]int
+}
+
+func (r Report) String() string {
+	var b strings.Builder
+	tw := tabwriter.NewWriter(&b, 0, 8, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintln(tw, "REQUEST\tCOUNT\tERRORS\tMIN\tMEAN\tP50\tP95\tP99\tMAX\t")
+	ops := make([]string, 0, len(r.Ops))
+	for n := range r.Ops {
+		ops = append(ops, n)
+	}
+	sort.Strings(ops)
+	for _, n := range ops {
+		o := r.Ops[n]
+		fmt.Fprintf(tw, "%s\t%d\t%d\t%v\t%v\t%v\t%v\t%v\t%v\t\n", n, o.Count, o.Errors,
+			o.Min.Round(time.Microsecond), o.Mean.Round(time.Microsecond), o.P50.Round(time.Microsecond),
+			o.P95.Round(time.Microsecond), o.P99.Round(time.Microsecond), o.Max.Round(time.Microsecond))
+	}
+	tw.Flush()
+	outcomes := make([]string, 0, len(r.Outcomes))
+	for n, c := range r.Outcomes {
+		outcomes = append(outcomes, fmt.Sprintf("%s %d", n, c))
+	}
+	sort.Strings(outcomes)
+	fmt.Fprintf(&b, "updates: %s\n", strings.Join(outcomes, ", "))
+	return b.String()
+}
+
+type opStats struct {
+	latencies []time.Duration
+	errors    int
+}
+
+type stats struct {
+	mtx      sync.Mutex
+	ops      map[string]*opStats
+	outcomes map[string]int
+}
+
+func newStats() *stats {
+	return &stats{ops: map[string]*opStats{}, outcomes: map[string]int{}}
+}
+
+func (s *stats) observe(op string, d time.Duration, err error) {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	o, ok := s.ops[op]
+	if !ok {
+		o = &opStats{}
+		s.ops[op] = o
+	}
+	o.latencies = append(o.latencies, d)
+	if err != nil {
+		o.errors++
+	}
+}
+
+func (s *stats) outcome(o string) {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	s.outcomes[o]++
+}
+
+func (s *stats) report() Report {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	r := Report{Ops: map[string]OpReport{}, Outcomes: map[string]int{}}
+	for n, o := range s.ops {
+		l := append([]time.Duration(nil), o.latencies...)
+		sort.Slice(l, func(i, j int) bool { return l[i] < l[j] })
+		var sum time.Duration
+		for _, d := range l {
+			sum += d
+		}
+		r.Ops[n] = OpReport{
+			Count:  len(l),
+			Errors: o.errors,
+			Min:    l[0],
+			Mean:   sum / time.Duration(len(l)),
+			P50:    percentile(l, 0.50),
+			P95:    percentile(l, 0.95),
+			P99:    percentile(l, 0.99),
+			Max:    l[len(l)-1],
+		}
+	}
+	for n, c := range s.outcomes {
+		r.Outcomes[n] = c
+	}
+	return r
+}
+
+// percentile returns the p-th percentile of the sorted l by nearest rank.
+func percentile(l []time.Duration, p float64) time.Duration {
+	i := int(float64(len(l))*p+0.5) - 1
+	if i < 0 {
+		i = 0
+	}
+	if i >= len(l) {
+		i = len(l) - 1
+	}
+	return l[i]
+}